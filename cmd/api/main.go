@@ -9,15 +9,26 @@ import (
 	"time"
 
 	"paymatch/internal/config"
+	"paymatch/internal/services/account"
 	"paymatch/internal/services/data"
+	"paymatch/internal/services/delivery"
 	"paymatch/internal/services/event"
+	"paymatch/internal/services/idempotency"
+	"paymatch/internal/services/invoice"
 	"paymatch/internal/services/payment"
+	"paymatch/internal/services/payout"
+	"paymatch/internal/services/providerconfig"
+	"paymatch/internal/services/routing"
 	"paymatch/internal/services/tenant"
 	httpx "paymatch/internal/http"
 	"paymatch/internal/provider"
+	"paymatch/internal/provider/airtel"
+	"paymatch/internal/provider/base"
 	"paymatch/internal/provider/mpesa"
 	"paymatch/internal/store/postgres"
+	"paymatch/internal/store/redis"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
 
@@ -37,45 +48,122 @@ func main() {
 	eventRepo := postgres.NewEventRepository(pool)
 	tenantRepo := postgres.NewTenantRepository(pool)
 	credentialRepo := postgres.NewCredentialRepository(pool)
+	deliveryRepo := postgres.NewDeliveryRepository(pool)
+	webhookEndpointRepo := postgres.NewWebhookEndpointRepository(pool)
+	invoiceRepo := postgres.NewInvoiceRepository(pool)
+	creditRepo := postgres.NewCreditRepository(pool)
+	matchingRulesRepo := postgres.NewMatchingRulesRepository(pool)
+	matchReviewRepo := postgres.NewMatchReviewRepository(pool)
+	exceptionRepo := postgres.NewExceptionRepository(pool)
+	payoutRepo := postgres.NewPayoutRepository(pool)
+	payoutBatchRepo := postgres.NewPayoutBatchRepository(pool)
+	approvalRepo := postgres.NewApprovalRepository(pool)
+	reversalRepo := postgres.NewReversalRepository(pool)
+	accountQueryRepo := postgres.NewAccountQueryRepository(pool)
+	routingPolicyRepo := postgres.NewRoutingPolicyRepository(pool)
+	idempotencyRepo := postgres.NewIdempotencyRepository(pool)
 	unitOfWork := postgres.NewUnitOfWork(pool)
 	
 	// Create services with dependency injection
 	paymentService := payment.NewService(paymentRepo, eventRepo)
 	tenantService := tenant.NewService(tenantRepo, credentialRepo, cfg)
 	dataService := data.NewService(paymentRepo, eventRepo)
+	invoiceService := invoice.NewService(invoiceRepo, creditRepo, matchingRulesRepo, matchReviewRepo, exceptionRepo, unitOfWork)
+	deliveryService := delivery.NewService(deliveryRepo, webhookEndpointRepo, cfg.Sec.AESKey)
 
 	// Initialize provider registry with pure architecture
 	providerRegistry := provider.NewProviderRegistry(cfg, credentialRepo)
 	
-	// Register available providers
-	mpesaProvider := mpesa.New(cfg)
+	// Register available providers; they share one token manager so each credential authenticates once
+	tokens := base.NewTokenManager(base.TokenManagerConfig{
+		Store:         newTokenStore(cfg, pool),
+		RefreshBefore: cfg.Token.RefreshBefore,
+	})
+	if err := mpesa.CheckCertificate(cfg); err != nil {
+		// Only B2C, balance, status and reversal requests need it; they fail until it is installed
+		log.Warn().Err(err).Msg("M-Pesa certificate check failed")
+	}
+	mpesaProvider := mpesa.NewWithTokens(cfg, tokens)
 	providerRegistry.RegisterProvider(provider.ProviderMpesa, mpesaProvider)
+	airtelProvider := airtel.NewWithTokens(cfg, tokens)
+	providerRegistry.RegisterProvider(provider.ProviderAirtelMoney, airtelProvider)
+
+	// Apply operator endpoints and limits from provider_configs, and pick up changes to them
+	providerConfigService := providerconfig.NewService(postgres.NewProviderConfigRepository(pool), providerRegistry, providerconfig.Config{
+		ReloadInterval: cfg.Provider.ReloadInterval,
+	})
+	if err := providerConfigService.Load(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to load provider configs, using built-in defaults")
+	}
+	go providerConfigService.Run(ctx)
 	
+	payoutService := payout.NewService(payoutRepo, payoutBatchRepo, approvalRepo, credentialRepo, providerRegistry, unitOfWork, cfg.Sec.AESKey)
+	reversalService := payout.NewReversalService(paymentRepo, reversalRepo, credentialRepo, providerRegistry)
+	accountService := account.NewService(accountQueryRepo, credentialRepo, providerRegistry)
+	routingService := routing.NewService(routingPolicyRepo, credentialRepo, providerRegistry)
+
 	log.Info().
 		Int("provider_count", len(providerRegistry.ListProviders())).
 		Msg("provider registry initialized with all available providers")
 
 	// Create event services
-	eventProcessor := event.NewProcessor(eventRepo, paymentService, unitOfWork)
+	ingestService := event.NewIngestService(eventRepo)
 	replayService := event.NewReplayService(eventRepo, pool)
 
 	// Start event processing worker with pure architecture
 	workerConfig := event.DefaultWorkerConfig()
-	eventWorker, err := event.NewEventProcessingSystem(pool, paymentService, workerConfig)
+	eventWorker, err := event.NewEventProcessingSystem(pool, event.ProcessingDependencies{
+		PaymentService: paymentService,
+		Matcher:        invoice.NewMatcher(),
+		Notifier:       deliveryService,
+		Payouts:        payout.NewResultHandler(),
+		Reversals:      payout.NewReversalResultHandler(),
+		Queries:        account.NewResultHandler(),
+	}, workerConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create event processing system")
 	}
 	go eventWorker.Run(ctx)
 	log.Info().Msg("event processing worker started (pure architecture)")
 
+	// Start outbound webhook delivery to tenant endpoints
+	dispatcher := delivery.NewDispatcher(deliveryRepo, webhookEndpointRepo, eventRepo, cfg.Sec.AESKey, delivery.DefaultDispatcherConfig())
+	go dispatcher.Run(ctx)
+
+	// Start bulk payout batches, resuming any left unfinished by a previous run
+	batchRunner := payout.NewBatchRunner(payoutService, payout.BatchRunnerConfig{RatePerSecond: cfg.Payout.RatePerSecond})
+	go batchRunner.Run(ctx)
+
+	// Resolve STK payments whose callback never arrived
+	sweeper := payment.NewPendingSweeper(paymentService, credentialRepo, providerRegistry, payment.SweeperConfig{
+		PendingAfter: cfg.STK.QueryAfter,
+		GiveUpAfter:  cfg.STK.TimeoutAfter,
+	})
+	go sweeper.Run(ctx)
+
+	// Replay responses to retried payment requests, purging keys once their retention lapses
+	idempotencyService := idempotency.NewService(idempotencyRepo, idempotency.Config{
+		Retention:    cfg.Idempotency.Retention,
+		ClaimTimeout: cfg.Idempotency.ClaimTimeout,
+	})
+	go idempotencyService.Run(ctx)
+
 	// Create HTTP router with pure architecture
 	routerDeps := httpx.RouterDependencies{
-		Config:           cfg,
-		TenantService:    tenantService,
-		DataService:      dataService,
-		EventService:     replayService,
-		EventProcessor:   eventProcessor,
-		ProviderRegistry: providerRegistry,
+		Config:             cfg,
+		TenantService:      tenantService,
+		DataService:        dataService,
+		PaymentService:     paymentService,
+		EventService:       replayService,
+		EventIngest:        ingestService,
+		DeliveryService:    deliveryService,
+		InvoiceService:     invoiceService,
+		PayoutService:      payoutService,
+		ReversalService:    reversalService,
+		AccountService:     accountService,
+		ProviderRegistry:   providerRegistry,
+		RoutingService:     routingService,
+		IdempotencyService: idempotencyService,
 	}
 	r := httpx.NewRouter(routerDeps)
 
@@ -117,3 +205,16 @@ func main() {
 	
 	log.Info().Msg("server stopped gracefully")
 }
+
+// newTokenStore returns the configured store for sharing provider tokens between replicas
+func newTokenStore(cfg config.Cfg, pool *pgxpool.Pool) base.TokenStore {
+	switch cfg.Token.Store {
+	case "postgres":
+		return postgres.NewTokenStore(pool, cfg.Sec.AESKey)
+	case "redis":
+		return redis.NewTokenStore(cfg.Redis, cfg.Sec.AESKey)
+	default:
+		// Each replica authenticates on its own
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+// Command daraja-sim serves a simulated Safaricom Daraja API for local development.
+//
+// Point PayMatch's sandbox credentials at it with MPESA_SANDBOX_BASE_URL=http://localhost:8090
+// and script how payments from each phone number end:
+//
+//	go run ./cmd/daraja-sim -script 254708374149=cancel,254711111111=insufficient_funds
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"paymatch/pkg/darajasim"
+
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	defaults := darajasim.DefaultConfig()
+	addr := flag.String("addr", ":8090", "address to listen on")
+	callbackURL := flag.String("callback-url", "", "base URL that replaces the scheme and host of callback URLs, e.g. http://localhost:8080")
+	webhookToken := flag.String("webhook-token", "", "sent as X-Webhook-Token on callbacks")
+	consumerKey := flag.String("consumer-key", "", "only grant access tokens to this consumer key (default: any)")
+	consumerSecret := flag.String("consumer-secret", "", "secret for -consumer-key")
+	callbackLatency := flag.Duration("latency", defaults.CallbackLatency, "delay before results are called back")
+	responseLatency := flag.Duration("response-latency", 0, "delay before API calls are answered")
+	outcome := flag.String("outcome", string(defaults.Outcome), "outcome for unscripted phone numbers: success, cancel, timeout or insufficient_funds")
+	script := flag.String("script", "", "comma separated phone=outcome pairs")
+	balance := flag.Int64("balance", defaults.OpeningBalance, "opening utility account balance in KES")
+	flag.Parse()
+
+	defaultOutcome, err := darajasim.ParseOutcome(*outcome)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid -outcome")
+	}
+
+	sim := darajasim.New(darajasim.Config{
+		CallbackURL:     *callbackURL,
+		WebhookToken:    *webhookToken,
+		ConsumerKey:     *consumerKey,
+		ConsumerSecret:  *consumerSecret,
+		ResponseLatency: *responseLatency,
+		CallbackLatency: *callbackLatency,
+		Outcome:         defaultOutcome,
+		OpeningBalance:  *balance,
+		Logf: func(format string, args ...any) {
+			log.Info().Msgf(format, args...)
+		},
+	})
+
+	for _, pair := range strings.Split(*script, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		phone, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Fatal().Str("script", pair).Msg("-script entries must be phone=outcome")
+		}
+		o, err := darajasim.ParseOutcome(name)
+		if err != nil {
+			log.Fatal().Err(err).Str("phone", phone).Msg("invalid -script outcome")
+		}
+		sim.Script(strings.TrimSpace(phone), o)
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           sim,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Info().Str("addr", *addr).Str("outcome", string(defaultOutcome)).Msg("Daraja simulator listening")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("simulator failed")
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	sim.Close()
+	log.Info().Msg("Daraja simulator stopped")
+}
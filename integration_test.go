@@ -1,11 +1,59 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"paymatch/internal/config"
+	"paymatch/internal/domain/account"
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/delivery"
+	"paymatch/internal/domain/event"
+	"paymatch/internal/domain/exception"
+	"paymatch/internal/domain/idempotency"
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/domain/matching"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/domain/providerconfig"
+	"paymatch/internal/domain/routing"
+	"paymatch/internal/http/handlers"
+	middlewarex "paymatch/internal/http/middleware"
 	"paymatch/internal/provider"
+	"paymatch/internal/provider/airtel"
+	"paymatch/internal/provider/base"
 	"paymatch/internal/provider/mpesa"
+	deliveryservice "paymatch/internal/services/delivery"
+	eventservice "paymatch/internal/services/event"
+	idempotencyservice "paymatch/internal/services/idempotency"
+	paymentservice "paymatch/internal/services/payment"
+	"paymatch/internal/services/tenant"
+	"paymatch/internal/store/repositories"
+	"paymatch/pkg/darajasim"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 )
 
 // TestPureArchitectureIntegration tests the basic integration of pure architecture components
@@ -62,6 +110,8 @@ func TestPureArchitectureIntegration(t *testing.T) {
 		provider.OpB2C,
 		provider.OpBalance,
 		provider.OpStatus,
+		provider.OpReverse,
+		provider.OpSTKQuery,
 	}
 
 	if len(info.SupportedOperations) != len(expectedOperations) {
@@ -101,4 +151,1641 @@ func TestProviderTypes(t *testing.T) {
 	}
 
 	t.Log("Provider type system working correctly")
-}
\ No newline at end of file
+}
+
+// TestAirtelProviderRegistration tests that Airtel Money registers alongside M-Pesa
+func TestAirtelProviderRegistration(t *testing.T) {
+	cfg := config.Cfg{
+		Sec: config.SecurityCfg{
+			AESKey: make([]byte, 32), // Dummy key for testing
+		},
+	}
+
+	registry := provider.NewProviderRegistry(cfg, nil)
+	registry.RegisterProvider(provider.ProviderMpesa, mpesa.New(cfg))
+	registry.RegisterProvider(provider.ProviderAirtelMoney, airtel.New(cfg))
+
+	if len(registry.ListProviders()) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(registry.ListProviders()))
+	}
+
+	info, err := registry.GetProviderInfo(provider.ProviderAirtelMoney)
+	if err != nil {
+		t.Fatalf("failed to get provider info: %v", err)
+	}
+
+	if info.Name != "Airtel Money Africa" {
+		t.Fatalf("unexpected provider name: %s", info.Name)
+	}
+
+	if !provider.IsProviderSupported(provider.ProviderAirtelMoney) {
+		t.Fatal("Airtel Money provider should be supported")
+	}
+
+	// Callbacks for disbursements are recognised by their transaction ID prefix
+	evt, err := airtel.NewWebhookService().Parse([]byte(`{"transaction":{"id":"PMD1700000000abc","message":"done","status_code":"TS","airtel_money_id":"MP1"}}`), nil)
+	if err != nil {
+		t.Fatalf("failed to parse callback: %v", err)
+	}
+	if evt.Type != provider.EventB2C || evt.Status != provider.StatusCompleted {
+		t.Fatalf("unexpected event: type=%s status=%s", evt.Type, evt.Status)
+	}
+}
+
+// TestAirtelCallbackValidation tests that Airtel callbacks must be signed or carry the credential's token
+func TestAirtelCallbackValidation(t *testing.T) {
+	webhooks := airtel.NewWebhookService()
+	const token = "whk-secret"
+
+	// Signed over the transaction exactly as sent, including fields PayMatch does not read
+	signed := []byte(`{"transaction":{ "id": "PMC1700000000xyz", "message": "Paid", "status_code": "TS", "airtel_money_id": "MP210603.1234.L06941", "amount": "100" },
+		"hash":"Cb1r0cCVJyFLe3q/VxASA1CWdhuNANs2Ppk81prwSrs="}`)
+	if err := webhooks.Validate(signed, nil, token); err != nil {
+		t.Fatalf("expected a correctly signed callback to validate: %v", err)
+	}
+	if evt, err := webhooks.Parse(signed, nil); err != nil || evt.ExternalID != "PMC1700000000xyz" || evt.Type != provider.EventSTK {
+		t.Fatalf("failed to parse signed callback: %+v (%v)", evt, err)
+	}
+
+	tampered := []byte(strings.Replace(string(signed), `"TS"`, `"TF"`, 1))
+	if err := webhooks.Validate(tampered, nil, token); err == nil {
+		t.Fatal("expected a tampered callback to be rejected")
+	}
+
+	unsigned := []byte(`{"transaction":{"id":"PMC1700000000xyz","message":"Paid","status_code":"TS","airtel_money_id":"MP1"}}`)
+	if err := webhooks.Validate(unsigned, nil, token); err == nil {
+		t.Fatal("expected a callback with neither hash nor token to be rejected")
+	}
+	if err := webhooks.Validate(unsigned, map[string]string{"X-Webhook-Token": "guess"}, token); err == nil {
+		t.Fatal("expected a callback with the wrong token to be rejected")
+	}
+	if err := webhooks.Validate(unsigned, map[string]string{"X-Webhook-Token": token}, token); err != nil {
+		t.Fatalf("expected a callback with the credential's token to validate: %v", err)
+	}
+	if err := webhooks.Validate(unsigned, nil, ""); err == nil {
+		t.Fatal("expected callbacks to be rejected when the credential has no token")
+	}
+}
+
+// TestInvoicePaymentMatching tests how payments move an invoice through its statuses
+func TestInvoicePaymentMatching(t *testing.T) {
+	inv, err := invoice.NewInvoice(1, " inv-001 ", "cust-9", "March rent", 1000, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create invoice: %v", err)
+	}
+	if inv.Reference != "INV-001" || inv.CustomerRef != "CUST-9" || inv.Currency != payment.KES {
+		t.Fatalf("unexpected normalization: %s %s %s", inv.Reference, inv.CustomerRef, inv.Currency)
+	}
+
+	steps := []struct {
+		amount  payment.Money
+		outcome invoice.MatchOutcome
+		status  invoice.Status
+	}{
+		{400, invoice.OutcomePartial, invoice.StatusPartiallyPaid},
+		{600, invoice.OutcomeExact, invoice.StatusPaid},
+	}
+	for _, step := range steps {
+		outcome, err := inv.ApplyPayment(step.amount, payment.KES)
+		if err != nil {
+			t.Fatalf("failed to apply %d: %v", step.amount, err)
+		}
+		if outcome != step.outcome || inv.Status != step.status {
+			t.Fatalf("after %d: got %s/%s, want %s/%s", step.amount, outcome, inv.Status, step.outcome, step.status)
+		}
+	}
+
+	if _, err := inv.ApplyPayment(100, payment.KES); err == nil {
+		t.Fatal("expected paid invoice to reject further payments")
+	}
+	if err := inv.Cancel(); err == nil {
+		t.Fatal("expected paid invoice cancellation to fail")
+	}
+}
+
+// TestOverpaymentCredit tests that an overpayment becomes credit for the customer's next invoice
+func TestOverpaymentCredit(t *testing.T) {
+	first, _ := invoice.NewInvoice(1, "INV-002", "CUST-9", "", 500, payment.KES, nil)
+	first.ID = 2
+	if outcome, _ := first.ApplyPayment(700, payment.KES); outcome != invoice.OutcomeOver {
+		t.Fatalf("expected overpayment, got %s", outcome)
+	}
+
+	credit, err := invoice.NewOverpaymentCredit(first, 10)
+	if err != nil {
+		t.Fatalf("failed to create credit: %v", err)
+	}
+	if credit.Remaining != 200 || credit.CustomerRef != "CUST-9" {
+		t.Fatalf("unexpected credit: %d %s", credit.Remaining, credit.CustomerRef)
+	}
+
+	next, _ := invoice.NewInvoice(1, "INV-003", "CUST-9", "", 150, payment.KES, nil)
+	next.ID = 3
+	used, err := credit.ApplyTo(next)
+	if err != nil {
+		t.Fatalf("failed to apply credit: %v", err)
+	}
+	if used != 150 || credit.Remaining != 50 || next.Status != invoice.StatusPaid {
+		t.Fatalf("unexpected result: used %d, remaining %d, status %s", used, credit.Remaining, next.Status)
+	}
+
+	entry := invoice.NewCreditEntry(next, credit.ID, used)
+	if entry.Amount != -150 || entry.BalanceAfter != 0 {
+		t.Fatalf("unexpected ledger entry: %d/%d", entry.Amount, entry.BalanceAfter)
+	}
+}
+
+// TestFuzzyReferenceMatching tests normalization, edit-distance tolerance and the review thresholds
+func TestFuzzyReferenceMatching(t *testing.T) {
+	rules := matching.DefaultRules(1)
+	if err := rules.Validate(); err != nil {
+		t.Fatalf("default rules invalid: %v", err)
+	}
+
+	target, _ := invoice.NewInvoice(1, "INV-2024-0042", "", "", 1500, payment.KES, nil)
+	target.ID = 1
+	other, _ := invoice.NewInvoice(1, "INV-2024-0777", "", "", 900, payment.KES, nil)
+	other.ID = 2
+	invoices := []*invoice.Invoice{other, target}
+
+	cases := []struct {
+		reference string
+		amount    payment.Money
+		method    matching.Method
+		decision  matching.Decision
+	}{
+		{"inv 2024 0042", 1000, matching.MethodNormalized, matching.DecisionAutoMatch},
+		{"INV20240043", 1500, matching.MethodFuzzy, matching.DecisionAutoMatch}, // one typo, exact amount
+		{"INV20240043", 1000, matching.MethodFuzzy, matching.DecisionReview},    // one typo only
+		{"RENT", 1500, "", matching.DecisionNoMatch},
+	}
+	for _, c := range cases {
+		result := rules.BestMatch(matching.Payment{Reference: c.reference, Amount: c.amount}, invoices)
+		if decision := rules.Decide(result); decision != c.decision {
+			t.Fatalf("%s: got decision %s, want %s", c.reference, decision, c.decision)
+		}
+		if c.method != "" && (result.Method != c.method || result.Invoice.ID != target.ID) {
+			t.Fatalf("%s: matched invoice %d by %s", c.reference, result.Invoice.ID, result.Method)
+		}
+	}
+
+	// Amount and phone alone only match when the fallback is enabled, and never automatically
+	phone, _ := payment.NewMSISDN("254712345678")
+	target.SetCustomerPhone(phone)
+	p := matching.Payment{Reference: "", Amount: 1500, MSISDNHash: phone.Hash()}
+	if result := rules.BestMatch(p, invoices); result != nil {
+		t.Fatalf("expected no match without fallback, got %s", result.Method)
+	}
+	rules.AmountPhoneFallback = true
+	if result := rules.BestMatch(p, invoices); rules.Decide(result) != matching.DecisionReview {
+		t.Fatal("expected amount and phone fallback to be queued for review")
+	}
+}
+
+// TestPaymentExceptionActions tests split validation, the audit requirements and refund flagging
+func TestPaymentExceptionActions(t *testing.T) {
+	splits := []exception.Split{{InvoiceID: 1, Amount: 600}, {InvoiceID: 2, Amount: 400}}
+	if err := exception.ValidateSplits(splits, 1000); err != nil {
+		t.Fatalf("expected valid split: %v", err)
+	}
+	if err := exception.ValidateSplits(splits, 900); err == nil {
+		t.Fatal("expected split not covering the payment to fail")
+	}
+	if err := exception.ValidateSplits(append(splits, exception.Split{InvoiceID: 1, Amount: 1}), 1001); err == nil {
+		t.Fatal("expected duplicate invoice to fail")
+	}
+
+	if _, err := exception.NewAuditEntry(1, 10, exception.ActionSplit, "ops@example.com", " ", splits); err == nil {
+		t.Fatal("expected missing reason to fail")
+	}
+	if _, err := exception.NewAuditEntry(1, 10, exception.ActionSplit, "", "two months paid at once", splits); err == nil {
+		t.Fatal("expected missing actor to fail")
+	}
+
+	p, _ := payment.NewPayment(1, "", 1000, payment.KES, payment.MethodMpesa, "QAB123", nil)
+	if err := p.MarkRefundCandidate(); err == nil {
+		t.Fatal("expected pending payment refund flag to fail")
+	}
+	p.Status = payment.StatusCompleted
+	if err := p.MarkRefundCandidate(); err != nil {
+		t.Fatalf("failed to flag payment: %v", err)
+	}
+	if err := p.Update("", 0, payment.StatusCompleted, nil); err != nil || p.Status != payment.StatusRefundCandidate {
+		t.Fatalf("provider re-confirmation must keep the refund flag, got %s (%v)", p.Status, err)
+	}
+	if err := p.MarkReconciled(payment.StatusMatched, "INV-1"); err != nil {
+		t.Fatalf("refund candidate should still be matchable: %v", err)
+	}
+}
+
+// TestPayoutResults tests how B2C results and queue timeouts settle a payout
+func TestPayoutResults(t *testing.T) {
+	msisdn, _ := payment.NewMSISDN("254708374149")
+	if _, err := payout.NewPayout(1, 1, 0, msisdn, "BusinessPayment", "", ""); err == nil {
+		t.Fatal("expected zero amount to fail")
+	}
+
+	p, err := payout.NewPayout(1, 1, 500, msisdn, "BusinessPayment", "refund", "")
+	if err != nil {
+		t.Fatalf("failed to create payout: %v", err)
+	}
+	if err := p.Accept("AG_20240101_abc", "OC-1", "Accept the service request successfully."); err != nil {
+		t.Fatalf("failed to accept payout: %v", err)
+	}
+
+	// A timeout leaves room for the real result to arrive late
+	if !p.TimeOut("The service request timed out") || p.Status != payout.StatusTimedOut {
+		t.Fatalf("expected timed out payout, got %s", p.Status)
+	}
+	if !p.ApplyResult(true, "NLJ41HAY6Q", "254708374149 - John Doe", "The service request is processed successfully.") {
+		t.Fatal("expected late result to settle the payout")
+	}
+	if p.Status != payout.StatusCompleted || p.ReceiptNumber != "NLJ41HAY6Q" || p.CompletedAt == nil {
+		t.Fatalf("unexpected payout after result: %+v", p)
+	}
+
+	// Once settled, duplicate results and timeouts are ignored
+	if p.ApplyResult(false, "", "", "duplicate") || p.TimeOut("late timeout") || p.Status != payout.StatusCompleted {
+		t.Fatalf("settled payout must not change, got %s", p.Status)
+	}
+}
+
+// TestPayoutBatchSummary tests batch item limits and how outcomes are tallied
+func TestPayoutBatchSummary(t *testing.T) {
+	batch, err := payout.NewBatch(1, 1, "salaries-2024-01", "SalaryPayment")
+	if err != nil {
+		t.Fatalf("failed to create batch: %v", err)
+	}
+
+	msisdn, _ := payment.NewMSISDN("254708374149")
+	if _, err := batch.AddItem(msisdn, "enc", 0, "", ""); err == nil {
+		t.Fatal("expected zero amount to fail")
+	}
+
+	var items []*payout.BatchItem
+	for _, amount := range []payment.Money{100, 200, 300} {
+		item, err := batch.AddItem(msisdn, "enc", amount, "", "")
+		if err != nil {
+			t.Fatalf("failed to add item: %v", err)
+		}
+		items = append(items, item)
+	}
+	if batch.ItemCount != 3 || batch.TotalAmount != 600 || items[2].Line != 3 {
+		t.Fatalf("unexpected batch totals: %+v", batch)
+	}
+
+	items[0].Submitted(10)
+	items[0].PayoutStatus = payout.StatusCompleted
+	items[1].Interrupted("request failed")
+
+	summary := payout.Summarize(items)
+	if summary["completed"].Amount != 100 || summary["unknown"].Count != 1 || summary["queued"].Amount != 300 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if err := batch.Cancel(); err != nil {
+		t.Fatalf("failed to cancel batch: %v", err)
+	}
+	if err := batch.Resume(); err == nil {
+		t.Fatal("expected cancelled batch not to resume")
+	}
+}
+
+// TestPayoutApprovals tests approval thresholds and the maker-checker rules
+func TestPayoutApprovals(t *testing.T) {
+	policy := &payout.ApprovalPolicy{
+		TenantID:    1,
+		Tiers:       []payout.ApprovalTier{{MinAmount: 10000, Approvals: 1}, {MinAmount: 100000, Approvals: 2}},
+		ExpiryHours: 24,
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("expected valid policy: %v", err)
+	}
+	if policy.Required(9999) != 0 || policy.Required(10000) != 1 || policy.Required(250000) != 2 {
+		t.Fatal("unexpected approvals required per tier")
+	}
+	if _, err := payout.NewApproval(policy, payout.SubjectPayout, 1, 500, "maker#1"); err == nil {
+		t.Fatal("expected amount below the thresholds not to need approval")
+	}
+
+	a, err := payout.NewApproval(policy, payout.SubjectBatch, 7, 250000, "maker#1")
+	if err != nil {
+		t.Fatalf("failed to create approval: %v", err)
+	}
+	if _, err := a.Approve("maker#1"); err == nil {
+		t.Fatal("expected the requester not to approve their own payout")
+	}
+	if done, err := a.Approve("checker#2"); err != nil || done {
+		t.Fatalf("expected first of two approvals to be recorded, got done=%v err=%v", done, err)
+	}
+	if _, err := a.Approve("checker#2"); err == nil {
+		t.Fatal("expected the same approver not to count twice")
+	}
+	if done, err := a.Approve("checker#3"); err != nil || !done || a.Status != payout.ApprovalApproved {
+		t.Fatalf("expected second approval to complete it, got %s err=%v", a.Status, err)
+	}
+
+	// A lapsed approval can no longer be approved
+	lapsed, _ := payout.NewApproval(policy, payout.SubjectPayout, 8, 20000, "maker#1")
+	if lapsed.Expire(time.Now()) {
+		t.Fatal("expected fresh approval not to expire")
+	}
+	later := lapsed.ExpiresAt.Add(time.Second)
+	if !lapsed.Expire(later) || lapsed.Status != payout.ApprovalExpired {
+		t.Fatalf("expected approval to expire, got %s", lapsed.Status)
+	}
+	if _, err := lapsed.Approve("checker#2"); err == nil {
+		t.Fatal("expected expired approval to refuse approvals")
+	}
+}
+
+// TestPaymentReversal tests reversal eligibility, result handling and the reversal callback parser
+func TestPaymentReversal(t *testing.T) {
+	p, err := payment.NewPayment(1, "INV-1", 1500, payment.KES, payment.MethodMpesa, "QGR7I1F3XL", nil)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	if _, err := payment.NewReversal(p, 3, p.ExternalID, "", "ops#1"); err == nil {
+		t.Fatal("expected a pending payment not to be reversible")
+	}
+
+	p.Update("", 0, payment.StatusCompleted, nil)
+	rev, err := payment.NewReversal(p, 3, p.ExternalID, "paid twice", "ops#1")
+	if err != nil {
+		t.Fatalf("failed to create reversal: %v", err)
+	}
+	if rev.Amount != p.Amount || rev.Status != payment.ReversalPending {
+		t.Fatalf("expected pending reversal of the full amount, got %d %s", rev.Amount, rev.Status)
+	}
+	if !rev.TimeOut("queue timeout") || rev.Status != payment.ReversalTimedOut {
+		t.Fatalf("expected reversal to time out, got %s", rev.Status)
+	}
+	if !rev.ApplyResult(true, "RVS1234567", "reversed") || rev.Status != payment.ReversalCompleted {
+		t.Fatalf("expected late result to complete the reversal, got %s", rev.Status)
+	}
+	if rev.ApplyResult(false, "", "duplicate") {
+		t.Fatal("expected settled reversal to ignore further results")
+	}
+
+	if err := p.MarkReversed(); err != nil {
+		t.Fatalf("failed to mark payment reversed: %v", err)
+	}
+	p.Update("", 0, payment.StatusCompleted, nil)
+	if p.Status != payment.StatusReversed {
+		t.Fatalf("expected a replayed confirmation not to undo the reversal, got %s", p.Status)
+	}
+
+	body := []byte(`{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.",
+		"OriginatorConversationID":"AG_20260101_1","ConversationID":"AG_20260101_2","TransactionID":"RVS1234567",
+		"ResultParameters":{"ResultParameter":[{"Key":"Amount","Value":1500},{"Key":"OriginalTransactionID","Value":"QGR7I1F3XL"}]}}}`)
+	evt, err := mpesa.NewWebhookService().Parse(body, nil)
+	if err != nil {
+		t.Fatalf("failed to parse reversal result: %v", err)
+	}
+	if evt.Type != provider.EventReversal || evt.ExternalID != "AG_20260101_2" || evt.Amount != 1500 || evt.Status != provider.StatusCompleted {
+		t.Fatalf("unexpected reversal event: %+v", evt)
+	}
+}
+
+// TestPendingPaymentTimeout tests how a swept STK payment may still settle afterwards
+func TestPendingPaymentTimeout(t *testing.T) {
+	p, err := payment.NewPayment(1, "INV-2", 800, payment.KES, payment.MethodMpesa, "ws_CO_260101120000", nil)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	if err := p.Update("", 0, payment.StatusTimedOut, nil); err != nil || p.Status != payment.StatusTimedOut {
+		t.Fatalf("expected pending payment to time out, got %s err=%v", p.Status, err)
+	}
+	if err := p.Update("", 0, payment.StatusCompleted, nil); err != nil || p.Status != payment.StatusCompleted {
+		t.Fatalf("expected a late callback to complete the payment, got %s err=%v", p.Status, err)
+	}
+	if err := p.Update("", 0, payment.StatusTimedOut, nil); err == nil {
+		t.Fatal("expected a completed payment not to time out")
+	}
+}
+
+// TestAccountQueries tests balance reports and how query results settle a query
+func TestAccountQueries(t *testing.T) {
+	accounts, err := account.ParseAccounts("Working Account|KES|46713.00|46713.00|0.00|0.00&Float Account|KES|0.00|0.00|0.00|0.00")
+	if err != nil {
+		t.Fatalf("failed to parse balance report: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].Name != "Working Account" || accounts[0].Available != "46713.00" {
+		t.Fatalf("unexpected accounts: %+v", accounts)
+	}
+
+	q, err := account.NewQuery(1, 3, account.KindBalance, "", "ops#1")
+	if err != nil {
+		t.Fatalf("failed to create query: %v", err)
+	}
+	if _, err := q.Balance(); err == nil {
+		t.Fatal("expected a pending query not to report a balance")
+	}
+	if !q.TimeOut("queue timeout") || q.Status != account.QueryTimedOut {
+		t.Fatalf("expected query to time out, got %s", q.Status)
+	}
+	if !q.Complete(true, "processed", map[string]string{"AccountBalance": "x"}) || q.Status != account.QueryCompleted {
+		t.Fatalf("expected late result to complete the query, got %s", q.Status)
+	}
+	if q.Complete(false, "duplicate", nil) {
+		t.Fatal("expected completed query to ignore further results")
+	}
+	if _, err := account.NewQuery(1, 3, account.KindTransactionStatus, "", "ops#1"); err == nil {
+		t.Fatal("expected a status query without a transaction ID to be rejected")
+	}
+
+	body := []byte(`{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.",
+		"OriginatorConversationID":"AG_20260101_3","ConversationID":"AG_20260101_4","TransactionID":"QGR7I1F3XM",
+		"ResultParameters":{"ResultParameter":[{"Key":"AccountBalance","Value":"Working Account|KES|46713.00|46713.00|0.00|0.00"},
+		{"Key":"BOCompletedTime","Value":20260101120000}]}}}`)
+	evt, err := mpesa.NewWebhookService().Parse(body, nil)
+	if err != nil {
+		t.Fatalf("failed to parse balance result: %v", err)
+	}
+	if evt.Type != provider.EventBalance || evt.ExternalID != "AG_20260101_4" || evt.InvoiceRef != "AG_20260101_3" || evt.Status != provider.StatusCompleted {
+		t.Fatalf("unexpected balance event: %+v", evt)
+	}
+}
+
+// TestTokenManager tests that concurrent callers share one token fetch and tokens are refreshed before expiry
+func TestTokenManager(t *testing.T) {
+	tokens := base.NewTokenManager(base.TokenManagerConfig{RefreshBefore: time.Minute})
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*base.Token, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		<-release
+		return &base.Token{Value: fmt.Sprintf("token-%d", n), ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	var wg sync.WaitGroup
+	values := make([]string, 10)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _ = tokens.Token(context.Background(), "mpesa:600000_sandbox", fetch)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Fatalf("expected concurrent callers to share one fetch, got %d", fetches)
+	}
+	for _, v := range values {
+		if v != "token-1" {
+			t.Fatalf("expected every caller to get the shared token, got %q", v)
+		}
+	}
+
+	// A token already due for refresh is still handed out while a new one is fetched
+	short := base.NewTokenManager(base.TokenManagerConfig{RefreshBefore: time.Hour, MinValidity: time.Millisecond})
+	refreshed := make(chan struct{}, 2)
+	var n int32
+	shortFetch := func(ctx context.Context) (*base.Token, error) {
+		refreshed <- struct{}{}
+		return &base.Token{Value: fmt.Sprintf("short-%d", atomic.AddInt32(&n, 1)), ExpiresAt: time.Now().Add(2 * time.Second)}, nil
+	}
+	if v, err := short.Token(context.Background(), "airtel:1_sandbox", shortFetch); err != nil || v != "short-1" {
+		t.Fatalf("unexpected first token %q err=%v", v, err)
+	}
+	<-refreshed
+	time.Sleep(1100 * time.Millisecond)
+	if v, _ := short.Token(context.Background(), "airtel:1_sandbox", shortFetch); v != "short-1" {
+		t.Fatalf("expected the current token while refreshing, got %q", v)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("expected a background refresh")
+	}
+}
+
+// TestProviderHTTPClient tests retries of idempotent calls and the circuit breaker
+func TestProviderHTTPClient(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	client := base.NewHTTPClient("test", 5)
+	resp, err := client.Do(context.Background(), base.Request{Method: http.MethodGet, Endpoint: server.URL, Idempotent: true})
+	if err != nil || !resp.IsSuccess() || calls != 3 {
+		t.Fatalf("expected idempotent call to succeed on the third attempt, got calls=%d err=%v", calls, err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	resp, err = client.Do(context.Background(), base.Request{Method: http.MethodPost, Endpoint: server.URL, Payload: map[string]string{}})
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Fatalf("expected a payment call not to be resent, got calls=%d err=%v", calls, err)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	for i := 0; i < 5; i++ {
+		client.Do(context.Background(), base.Request{Method: http.MethodPost, Endpoint: down.URL, BreakerKey: "mpesa:600000_sandbox"})
+	}
+	_, err = client.Do(context.Background(), base.Request{Method: http.MethodPost, Endpoint: down.URL, BreakerKey: "mpesa:600000_sandbox"})
+	var providerErr *provider.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Code != provider.ErrProviderDown {
+		t.Fatalf("expected an open circuit to refuse the call, got %v", err)
+	}
+	if _, err := client.Do(context.Background(), base.Request{Method: http.MethodGet, Endpoint: server.URL, BreakerKey: "mpesa:600001_sandbox"}); err != nil {
+		t.Fatalf("expected other credentials to be unaffected, got %v", err)
+	}
+}
+
+// TestDarajaResultCodes tests that Daraja result codes keep cancelled and timed out prompts apart from failures
+func TestDarajaResultCodes(t *testing.T) {
+	cases := map[int]struct{ status, failureCode string }{
+		0:    {provider.StatusCompleted, ""},
+		1:    {provider.StatusFailed, provider.ErrInsufficientFunds},
+		1032: {provider.StatusCancelled, provider.ErrCancelled},
+		1037: {provider.StatusTimeout, provider.ErrProviderTimeout},
+		2001: {provider.StatusFailed, provider.ErrInvalidPIN},
+	}
+	for code, want := range cases {
+		body := []byte(fmt.Sprintf(`{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-1",
+			"CheckoutRequestID":"ws_CO_191220191020363925","ResultCode":%d,"ResultDesc":"result %d"}}}`, code, code))
+		evt, err := mpesa.NewWebhookService().Parse(body, nil)
+		if err != nil {
+			t.Fatalf("failed to parse STK callback %d: %v", code, err)
+		}
+		if evt.Status != want.status || evt.FailureCode != want.failureCode {
+			t.Errorf("result code %d: expected %s (%s), got %s (%s)", code, want.status, want.failureCode, evt.Status, evt.FailureCode)
+		}
+	}
+
+	p, err := payment.NewPayment(1, "INV-3", 500, payment.KES, payment.MethodMpesa, "ws_CO_191220191020363925", nil)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	if err := p.Update("", 0, payment.StatusCancelled, nil); err != nil {
+		t.Fatalf("failed to cancel payment: %v", err)
+	}
+	p.RecordFailure(provider.ErrCancelled, "Request cancelled by user")
+	if p.FailureCode != provider.ErrCancelled {
+		t.Fatalf("expected failure code to be recorded, got %q", p.FailureCode)
+	}
+	if err := p.Update("", 0, payment.StatusCompleted, nil); err != nil {
+		t.Fatalf("failed to complete payment: %v", err)
+	}
+	p.RecordFailure("", "")
+	if p.FailureCode != "" || p.FailureReason != "" {
+		t.Fatalf("expected completion to clear the failure, got %q", p.FailureCode)
+	}
+}
+
+// TestDarajaSimulator tests an STK push against the simulator, from the prompt to its callback and query
+func TestDarajaSimulator(t *testing.T) {
+	callbacks := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		callbacks <- body
+	}))
+	defer receiver.Close()
+
+	sim := darajasim.New(darajasim.Config{CallbackLatency: 10 * time.Millisecond})
+	defer sim.Close()
+	sim.Script("254708374149", darajasim.OutcomeCancel)
+	daraja := httptest.NewServer(sim)
+	defer daraja.Close()
+
+	cfg := config.Cfg{Sec: config.SecurityCfg{AESKey: make([]byte, 32)}, Mpesa: config.MpesaCfg{SandboxBaseURL: daraja.URL}}
+	cred := &credential.ProviderCredential{ID: 1, TenantID: 1, Shortcode: "174379", Environment: "sandbox", EncryptedCredentials: map[string]string{}}
+	for field, value := range map[string]string{"consumer_key": "key", "consumer_secret": "secret", "passkey": "passkey"} {
+		if err := cred.SetEncryptedField(field, value, cfg.Sec.AESKey); err != nil {
+			t.Fatalf("failed to encrypt %s: %v", field, err)
+		}
+	}
+
+	p := mpesa.New(cfg)
+	resp, err := p.STKPush(context.Background(), cred, provider.STKPushReq{
+		Amount: 100, PhoneNumber: "254708374149", AccountReference: "INV-1", Description: "Invoice INV-1",
+		CallbackURL: receiver.URL + "/webhooks/174379",
+	})
+	if err != nil {
+		t.Fatalf("STK push failed: %v", err)
+	}
+
+	select {
+	case body := <-callbacks:
+		evt, err := mpesa.NewWebhookService().Parse(body, nil)
+		if err != nil || evt.ExternalID != resp.ExternalID || evt.Status != provider.StatusCancelled {
+			t.Fatalf("expected a cancelled callback for %s, got %+v err=%v", resp.ExternalID, evt, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no STK callback received")
+	}
+
+	query, err := p.STKQuery(context.Background(), cred, resp.ExternalID)
+	if err != nil || query.Status != provider.StatusCancelled || query.ErrorCode != provider.ErrCancelled {
+		t.Fatalf("expected the query to report the cancellation, got %+v err=%v", query, err)
+	}
+}
+
+// TestSecurityCredential tests that initiator passwords are encrypted with the configured
+// certificate, and that a missing certificate is caught at startup
+func TestSecurityCredential(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "sandbox.safaricom.co.ke"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	certPath := filepath.Join(t.TempDir(), "sandbox.cer")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	sim := darajasim.New(darajasim.Config{CallbackLatency: time.Hour})
+	defer sim.Close()
+	credentials := make(chan string, 1)
+	daraja := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct{ SecurityCredential string }
+		if json.Unmarshal(body, &req) == nil && req.SecurityCredential != "" {
+			credentials <- req.SecurityCredential
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sim.ServeHTTP(w, r)
+	}))
+	defer daraja.Close()
+
+	cfg := config.Cfg{
+		App:   config.AppCfg{Env: "sandbox"},
+		Sec:   config.SecurityCfg{AESKey: make([]byte, 32)},
+		Mpesa: config.MpesaCfg{SandboxCertPath: certPath, SandboxBaseURL: daraja.URL},
+	}
+	if err := mpesa.CheckCertificate(cfg); err != nil {
+		t.Fatalf("expected the certificate to load, got %v", err)
+	}
+	cred := &credential.ProviderCredential{ID: 1, TenantID: 1, Shortcode: "600000", Environment: "sandbox", EncryptedCredentials: map[string]string{}}
+	for field, value := range map[string]string{"consumer_key": "key", "consumer_secret": "secret", "initiator_name": "testapi", "initiator_password": "Safaricom999!*!"} {
+		if err := cred.SetEncryptedField(field, value, cfg.Sec.AESKey); err != nil {
+			t.Fatalf("failed to encrypt %s: %v", field, err)
+		}
+	}
+
+	_, err = mpesa.New(cfg).B2C(context.Background(), cred, provider.B2CReq{
+		Amount: 100, PhoneNumber: "254708374149", Description: "Refund",
+		ResultURL: "http://localhost/webhooks/600000", TimeoutURL: "http://localhost/webhooks/600000/timeout",
+	})
+	if err != nil {
+		t.Fatalf("B2C failed: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(<-credentials)
+	if err != nil {
+		t.Fatalf("expected a base64 security credential: %v", err)
+	}
+	password, err := rsa.DecryptPKCS1v15(rand.Reader, key, ciphertext)
+	if err != nil || string(password) != "Safaricom999!*!" {
+		t.Fatalf("expected the credential to decrypt to the initiator password, got %q err=%v", password, err)
+	}
+
+	cfg.Mpesa.SandboxCertPath = filepath.Join(t.TempDir(), "missing.cer")
+	if err := mpesa.CheckCertificate(cfg); err == nil || !strings.Contains(err.Error(), "MPESA_SANDBOX_CERT_PATH") {
+		t.Fatalf("expected a missing certificate to name its setting, got %v", err)
+	}
+}
+
+// TestProviderSettings tests that operator settings reach providers, including ones registered later
+func TestProviderSettings(t *testing.T) {
+	sim := darajasim.New(darajasim.Config{CallbackLatency: time.Hour})
+	defer sim.Close()
+	daraja := httptest.NewServer(sim)
+	defer daraja.Close()
+
+	cfg := config.Cfg{Sec: config.SecurityCfg{AESKey: make([]byte, 32)}}
+	cred := &credential.ProviderCredential{ID: 1, TenantID: 1, ProviderType: credential.ProviderType(provider.ProviderMpesa), Shortcode: "174379", Environment: "sandbox", EncryptedCredentials: map[string]string{}}
+	for field, value := range map[string]string{"consumer_key": "key", "consumer_secret": "secret", "passkey": "passkey"} {
+		if err := cred.SetEncryptedField(field, value, cfg.Sec.AESKey); err != nil {
+			t.Fatalf("failed to encrypt %s: %v", field, err)
+		}
+	}
+
+	registry := provider.NewProviderRegistry(cfg, nil)
+	settings := provider.Settings{BaseURL: daraja.URL, MaxAmount: 100}
+	if err := registry.ApplySettings(provider.ProviderMpesa, "sandbox", settings); err != nil {
+		t.Fatalf("failed to apply settings: %v", err)
+	}
+	registry.RegisterProvider(provider.ProviderMpesa, mpesa.New(cfg))
+
+	push := func(amount int64) error {
+		_, err := registry.STKPush(context.Background(), cred, provider.STKPushReq{
+			Amount: amount, PhoneNumber: "254708374149", AccountReference: "INV-1", Description: "Invoice INV-1",
+			CallbackURL: "http://localhost/webhooks/174379",
+		})
+		return err
+	}
+
+	var providerErr *provider.ProviderError
+	if err := push(500); !errors.As(err, &providerErr) || providerErr.Code != provider.ErrInvalidAmount {
+		t.Fatalf("expected 500 to exceed the configured maximum, got %v", err)
+	}
+	if err := push(50); err != nil {
+		t.Fatalf("expected the push to reach the configured base URL, got %v", err)
+	}
+
+	settings.MaxAmount = 1000
+	if err := registry.ApplySettings(provider.ProviderMpesa, "sandbox", settings); err != nil {
+		t.Fatalf("failed to reapply settings: %v", err)
+	}
+	if err := push(500); err != nil {
+		t.Fatalf("expected the raised maximum to apply, got %v", err)
+	}
+
+	invalid := providerconfig.Config{ProviderType: "mpesa_daraja", Environment: "sandbox", BaseURL: "sandbox.safaricom.co.ke", MinAmount: 10, MaxAmount: 5}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected a config without a URL scheme to be rejected")
+	}
+	invalid.BaseURL = "https://sandbox.safaricom.co.ke"
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected a minimum above the maximum to be rejected")
+	}
+}
+
+// TestCredentialRouting tests how collections are routed across a tenant's credentials
+func TestCredentialRouting(t *testing.T) {
+	for phone, network := range map[string]routing.Network{
+		"254708374149":  routing.NetworkSafaricom,
+		"+254110000000": routing.NetworkSafaricom,
+		"0733000000":    routing.NetworkAirtel,
+		"254770000000":  routing.NetworkTelkom,
+		"255712345678":  routing.NetworkUnknown,
+	} {
+		if got := routing.NetworkOf(phone); got != network {
+			t.Errorf("NetworkOf(%s) = %q, want %q", phone, got, network)
+		}
+	}
+
+	mpesaA := &credential.ProviderCredential{ID: 1, ProviderType: credential.ProviderMpesa, IsActive: true}
+	mpesaB := &credential.ProviderCredential{ID: 2, ProviderType: credential.ProviderMpesa, IsActive: true}
+	airtelCred := &credential.ProviderCredential{ID: 3, ProviderType: credential.ProviderAirtelMoney, IsActive: true}
+	candidates := []*credential.ProviderCredential{mpesaA, mpesaB, airtelCred}
+	ids := func(creds []*credential.ProviderCredential) string {
+		var out []int64
+		for _, c := range creds {
+			out = append(out, c.ID)
+		}
+		return fmt.Sprint(out)
+	}
+	first := func(n int) int { return 0 }
+	last := func(n int) int { return n - 1 }
+
+	policy := routing.DefaultPolicy(1)
+	routed, err := policy.Route(candidates, "254708374149", "", first)
+	if err != nil || ids(routed) != "[1 2]" {
+		t.Fatalf("expected Safaricom numbers to route to M-Pesa credentials in order, got %s err=%v", ids(routed), err)
+	}
+	routed, err = policy.Route(candidates, "0733000000", "", first)
+	if err != nil || ids(routed) != "[3]" {
+		t.Fatalf("expected Airtel numbers to route to the Airtel credential, got %s err=%v", ids(routed), err)
+	}
+	if _, err := policy.Route(candidates, "254770000000", "", first); err == nil {
+		t.Fatal("expected no route for a network without a credential")
+	}
+
+	policy.PreferredProviders = []credential.ProviderType{credential.ProviderAirtelMoney}
+	routed, _ = policy.Route(candidates, "255712345678", "", first)
+	if ids(routed) != "[3 1 2]" {
+		t.Fatalf("expected the preferred provider first for unknown networks, got %s", ids(routed))
+	}
+	routed, _ = policy.Route(candidates, "255712345678", credential.ProviderMpesa, first)
+	if ids(routed) != "[1 2 3]" {
+		t.Fatalf("expected the requested provider ahead of the policy, got %s", ids(routed))
+	}
+
+	policy.Rules = []routing.Rule{
+		{CredentialID: 1, Weight: 30},
+		{CredentialID: 2, Networks: []routing.Network{routing.NetworkSafaricom}, Weight: 70},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("expected policy to be valid, got %v", err)
+	}
+	routed, _ = policy.Route(candidates, "254708374149", "", last)
+	if ids(routed) != "[2 1]" {
+		t.Fatalf("expected the heavier credential to win the last slice of the draw, got %s", ids(routed))
+	}
+	routed, _ = policy.Route(candidates, "254708374149", "", first)
+	if ids(routed) != "[1 2]" {
+		t.Fatalf("expected the lighter credential to win the first slice of the draw, got %s", ids(routed))
+	}
+
+	policy.Rules = append(policy.Rules, routing.Rule{CredentialID: 3, Networks: []routing.Network{"vodacom"}, Weight: 1})
+	if err := policy.Validate(); err == nil {
+		t.Fatal("expected a rule for an unknown network to be rejected")
+	}
+
+	// Failover: a credential whose circuit is open is reported unavailable
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	cfg := config.Cfg{Sec: config.SecurityCfg{AESKey: make([]byte, 32)}, Mpesa: config.MpesaCfg{SandboxBaseURL: down.URL}}
+	registry := provider.NewProviderRegistry(cfg, nil)
+	registry.RegisterProvider(provider.ProviderMpesa, mpesa.New(cfg))
+	failing := &credential.ProviderCredential{ID: 4, ProviderType: credential.ProviderMpesa, Shortcode: "600000", Environment: "sandbox", EncryptedCredentials: map[string]string{}}
+	for field, value := range map[string]string{"consumer_key": "key", "consumer_secret": "secret"} {
+		if err := failing.SetEncryptedField(field, value, cfg.Sec.AESKey); err != nil {
+			t.Fatalf("failed to encrypt %s: %v", field, err)
+		}
+	}
+	healthy := &credential.ProviderCredential{ID: 5, ProviderType: credential.ProviderMpesa, Shortcode: "600001", Environment: "sandbox"}
+	for i := 0; i < 5 && registry.Available(context.Background(), failing); i++ {
+		registry.CheckBalance(context.Background(), failing)
+	}
+	if registry.Available(context.Background(), failing) || !registry.Available(context.Background(), healthy) {
+		t.Fatal("expected only the failing credential's circuit to open")
+	}
+}
+
+// memoryIdempotencyRepository keeps idempotency records in memory
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	nextID  int64
+	records map[string]*idempotency.Record
+}
+
+func (m *memoryIdempotencyRepository) Claim(ctx context.Context, r *idempotency.Record, staleBefore time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.records[r.Key]; ok && existing.ExpiresAt.After(r.CreatedAt) {
+		stale := existing.Status == idempotency.StatusProcessing && existing.CreatedAt.Before(staleBefore) && existing.Fingerprint == r.Fingerprint
+		if !stale {
+			return false, nil
+		}
+		// Like the upsert, a takeover keeps the row's id
+		r.ID = existing.ID
+	} else {
+		m.nextID++
+		r.ID = m.nextID
+	}
+	copied := *r
+	m.records[r.Key] = &copied
+	return true, nil
+}
+
+func (m *memoryIdempotencyRepository) FindByKey(ctx context.Context, tenantID int64, key string) (*idempotency.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.records[key]; ok {
+		copied := *r
+		return &copied, nil
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryIdempotencyRepository) Complete(ctx context.Context, r *idempotency.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.holds(r) {
+		return pgx.ErrNoRows
+	}
+	copied := *r
+	m.records[r.Key] = &copied
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) Release(ctx context.Context, r *idempotency.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.holds(r) {
+		return pgx.ErrNoRows
+	}
+	delete(m.records, r.Key)
+	return nil
+}
+
+// holds reports whether the record's claim is still the one stored for its key
+func (m *memoryIdempotencyRepository) holds(r *idempotency.Record) bool {
+	existing, ok := m.records[r.Key]
+	return ok && existing.ID == r.ID && existing.Status == idempotency.StatusProcessing && existing.CreatedAt.Equal(r.CreatedAt)
+}
+
+func (m *memoryIdempotencyRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+// TestIdempotencyKeys tests that retried payment requests replay the first response
+func TestIdempotencyKeys(t *testing.T) {
+	repo := &memoryIdempotencyRepository{records: make(map[string]*idempotency.Record)}
+	svc := idempotencyservice.NewService(repo, idempotencyservice.DefaultConfig())
+
+	var prompts int32
+	handler := middlewarex.Idempotency(svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"amount":-1`) {
+			panic("handler bug")
+		}
+		if strings.Contains(string(body), `"amount":0`) {
+			http.Error(w, "amount must be greater than 0", http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&prompts, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"external_id":"ws_CO_%d"}`, n)
+	}))
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/stk", strings.NewReader(body))
+		req = req.WithContext(middlewarex.WithTenantID(req.Context(), 1))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("order-1", `{"amount":100}`)
+	retry := send("order-1", `{"amount":100}`)
+	if first.Code != http.StatusOK || retry.Body.String() != first.Body.String() || prompts != 1 {
+		t.Fatalf("expected the retry to replay %q without a second prompt, got %q after %d prompts", first.Body.String(), retry.Body.String(), prompts)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected replay headers, got %v", retry.Header())
+	}
+	if rec := send("order-1", `{"amount":200}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a reused key with another body to be rejected, got %d", rec.Code)
+	}
+
+	if rec := send("order-2", `{"amount":0}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the invalid request to fail, got %d", rec.Code)
+	}
+	if rec := send("order-2", `{"amount":50}`); rec.Code != http.StatusOK || prompts != 2 {
+		t.Fatalf("expected a rejected request to free its key, got %d after %d prompts", rec.Code, prompts)
+	}
+
+	send("", `{"amount":100}`)
+	send("", `{"amount":100}`)
+	if prompts != 4 {
+		t.Fatalf("expected requests without a key to pass through, got %d prompts", prompts)
+	}
+	if rec := send("has space", `{"amount":100}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a malformed key to be rejected, got %d", rec.Code)
+	}
+
+	// A panicking handler frees its key for the retry
+	func() {
+		defer func() { recover() }()
+		send("order-3", `{"amount":-1}`)
+	}()
+	if _, err := repo.FindByKey(context.Background(), 1, "order-3"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("expected the key to be released after a panic, got %v", err)
+	}
+
+	// A claim left processing by a crashed request is taken over once it is stale
+	stale, _ := idempotency.NewRecord(1, "order-4", idempotency.Fingerprint(http.MethodPost, "/api/v1/payments/stk", []byte(`{"amount":75}`)), time.Hour)
+	stale.CreatedAt = time.Now().Add(-10 * time.Minute)
+	repo.Claim(context.Background(), stale, stale.CreatedAt)
+	if rec := send("order-4", `{"amount":75}`); rec.Code != http.StatusOK || prompts != 5 {
+		t.Fatalf("expected a stale claim to be taken over, got %d after %d prompts", rec.Code, prompts)
+	}
+	// The crashed request finishing late must not free or overwrite the retry's response
+	if err := svc.Release(context.Background(), stale); !errors.Is(err, idempotencyservice.ErrClaimLost) {
+		t.Fatalf("expected the superseded claim to be refused, got %v", err)
+	}
+	if rec := send("order-4", `{"amount":75}`); rec.Header().Get("Idempotent-Replayed") != "true" || prompts != 5 {
+		t.Fatalf("expected the retry's response to be kept, got %d after %d prompts", rec.Code, prompts)
+	}
+
+	// A retried upload is recognized although each attempt picks a new multipart boundary
+	upload := func() *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("batch_id", "salaries-2024-03")
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payouts/batches", &body)
+		req = req.WithContext(middlewarex.WithTenantID(req.Context(), 1))
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Idempotency-Key", "batch-1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	upload()
+	if rec := upload(); rec.Header().Get("Idempotent-Replayed") != "true" || prompts != 6 {
+		t.Fatalf("expected the retried upload to be replayed, got %d after %d prompts", rec.Code, prompts)
+	}
+}
+
+// memoryPaymentRepository keeps payments in memory, unique by tenant and external ID
+type memoryPaymentRepository struct {
+	mu       sync.Mutex
+	payments []*payment.Payment
+}
+
+func (m *memoryPaymentRepository) Save(ctx context.Context, p *payment.Payment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.payments {
+		if existing.TenantID == p.TenantID && existing.ExternalID == p.ExternalID {
+			if p.ID != existing.ID {
+				return repositories.ErrDuplicate
+			}
+			copied := *p
+			m.payments[i] = &copied
+			return nil
+		}
+	}
+	p.ID = int64(len(m.payments) + 1)
+	copied := *p
+	m.payments = append(m.payments, &copied)
+	return nil
+}
+
+func (m *memoryPaymentRepository) FindByID(ctx context.Context, id int64) (*payment.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.payments {
+		if p.ID == id {
+			copied := *p
+			return &copied, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryPaymentRepository) FindByExternalID(ctx context.Context, tenantID int64, externalID string) (*payment.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.payments {
+		if p.TenantID == tenantID && p.ExternalID == externalID {
+			copied := *p
+			return &copied, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryPaymentRepository) FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*payment.Payment, error) {
+	return nil, nil
+}
+
+func (m *memoryPaymentRepository) FindPendingBefore(ctx context.Context, before time.Time, limit int) ([]*payment.Payment, error) {
+	return nil, nil
+}
+
+// TestSTKPendingPayment tests that an STK push is recorded before its callback settles it
+func TestSTKPendingPayment(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryPaymentRepository{}
+	svc := paymentservice.NewService(repo, nil)
+
+	pending, err := svc.CreatePendingPayment(ctx, 1, paymentservice.PendingPayment{
+		CredentialID: 7,
+		ExternalID:   "ws_CO_1",
+		Invoice:      "INV-9",
+		Amount:       1200,
+		PhoneNumber:  "254708374149",
+		Metadata:     map[string]string{"order_id": "A-17"},
+		InitiatedBy:  "key#3",
+	})
+	if err != nil {
+		t.Fatalf("failed to record STK push: %v", err)
+	}
+	if pending.ID == 0 || pending.Status != payment.StatusPending || pending.MSISDNHash == "" {
+		t.Fatalf("expected a pending payment with a phone hash, got %+v", pending)
+	}
+
+	// The callback carries no account reference; the payment keeps the one it was initiated with
+	err = svc.ProcessPaymentEvent(ctx, 1, 7, "ws_CO_1", 1200, "254708374149", "", paymentservice.Outcome{Status: "completed"})
+	if err != nil {
+		t.Fatalf("failed to apply callback: %v", err)
+	}
+	got, err := svc.GetPayment(ctx, 1, pending.ID)
+	if err != nil {
+		t.Fatalf("failed to get payment: %v", err)
+	}
+	if len(repo.payments) != 1 || got.Status != payment.StatusCompleted || got.InvoiceNo != "INV-9" || got.Metadata["order_id"] != "A-17" {
+		t.Fatalf("expected the callback to complete the same payment, got %+v", got)
+	}
+	if _, err := svc.GetPayment(ctx, 2, pending.ID); !errors.Is(err, paymentservice.ErrPaymentNotFound) {
+		t.Fatalf("expected another tenant's payment to be hidden, got %v", err)
+	}
+
+	// A callback that beats the initiation to the database gets the initiation details
+	if err := svc.ProcessPaymentEvent(ctx, 1, 7, "ws_CO_2", 500, "", "", paymentservice.Outcome{Status: "failed"}); err != nil {
+		t.Fatalf("failed to apply early callback: %v", err)
+	}
+	late, err := svc.CreatePendingPayment(ctx, 1, paymentservice.PendingPayment{
+		CredentialID: 7, ExternalID: "ws_CO_2", Invoice: "INV-10", Amount: 500, InitiatedBy: "key#3",
+	})
+	if err != nil {
+		t.Fatalf("failed to record late STK push: %v", err)
+	}
+	if late.Status != payment.StatusFailed || late.InvoiceNo != "INV-10" || late.InitiatedBy != "key#3" {
+		t.Fatalf("expected the callback's outcome with the initiation details, got %+v", late)
+	}
+
+	// Airtel collection callbacks carry no amount; they wait for the payment to be recorded
+	err = svc.ProcessPaymentEvent(ctx, 1, 8, "PMC1700000000xyz", 0, "", "", paymentservice.Outcome{Status: "completed"})
+	if !errors.Is(err, paymentservice.ErrPaymentNotRecorded) || len(repo.payments) != 2 {
+		t.Fatalf("expected an amount-less callback to create no payment, got %v", err)
+	}
+	if _, err := svc.CreatePendingPayment(ctx, 1, paymentservice.PendingPayment{CredentialID: 8, ExternalID: "PMC1700000000xyz", Amount: 100}); err != nil {
+		t.Fatalf("failed to record Airtel push: %v", err)
+	}
+	if err := svc.ProcessPaymentEvent(ctx, 1, 8, "PMC1700000000xyz", 0, "", "", paymentservice.Outcome{Status: "completed"}); err != nil {
+		t.Fatalf("failed to apply Airtel callback: %v", err)
+	}
+	if airtel, _ := repo.FindByExternalID(ctx, 1, "PMC1700000000xyz"); airtel.Status != payment.StatusCompleted || airtel.Amount != 100 {
+		t.Fatalf("expected the recorded amount to be kept, got %+v", airtel)
+	}
+
+	if err := payment.ValidateMetadata(map[string]string{strings.Repeat("k", 41): "v"}); err == nil {
+		t.Fatal("expected an oversized metadata key to be rejected")
+	}
+}
+
+// TestPaymentStateMachine tests that payments only move along allowed transitions and record each one
+func TestPaymentStateMachine(t *testing.T) {
+	p, err := payment.NewPayment(1, "INV-4", 700, payment.KES, payment.MethodMpesa, "ws_CO_4", nil)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	p.CausedBy(41)
+	if err := p.Update("", 0, payment.StatusProcessing, nil); err != nil {
+		t.Fatalf("expected pending payment to start processing: %v", err)
+	}
+	if err := p.CausedBy(42).Update("", 0, payment.StatusCompleted, nil); err != nil {
+		t.Fatalf("expected processing payment to complete: %v", err)
+	}
+
+	var domainErr payment.DomainError
+	if err := p.Update("", 0, payment.StatusFailed, nil); !errors.As(err, &domainErr) || domainErr.Code != payment.ErrInvalidTransition {
+		t.Fatalf("expected a completed payment not to fail again, got %v", err)
+	}
+	if err := p.Update("INV-9", 900, payment.StatusFailed, nil); err == nil || p.Status != payment.StatusCompleted || p.InvoiceNo != "INV-4" || p.Amount != 700 {
+		t.Fatalf("expected a rejected transition to leave the payment alone, got %s %s %d (%v)", p.Status, p.InvoiceNo, p.Amount, err)
+	}
+
+	changes := p.StatusChanges()
+	want := []struct {
+		from, to payment.Status
+		eventID  int64
+	}{
+		{"", payment.StatusPending, 41},
+		{payment.StatusPending, payment.StatusProcessing, 41},
+		{payment.StatusProcessing, payment.StatusCompleted, 42},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d status changes, got %+v", len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].From != w.from || changes[i].To != w.to || changes[i].EventID != w.eventID {
+			t.Errorf("change %d: expected %s -> %s by event %d, got %+v", i, w.from, w.to, w.eventID, changes[i])
+		}
+	}
+	p.ClearStatusChanges()
+
+	if err := p.CausedBy(0).MarkRefundCandidate(); err != nil {
+		t.Fatalf("failed to flag payment: %v", err)
+	}
+	if err := p.MarkReversed(); err != nil || p.Status != payment.StatusRefunded {
+		t.Fatalf("expected a reversed refund candidate to be refunded, got %s (%v)", p.Status, err)
+	}
+	if err := p.MarkReconciled(payment.StatusMatched, "INV-4"); err == nil {
+		t.Fatal("expected a refunded payment not to be matched")
+	}
+	if changes := p.StatusChanges(); len(changes) != 2 || changes[1].EventID != 0 {
+		t.Fatalf("expected operator changes without an event, got %+v", changes)
+	}
+	if err := p.Update("INV-9", 900, payment.StatusCompleted, nil); err != nil || p.Status != payment.StatusRefunded || p.InvoiceNo != "INV-4" || p.Amount != 700 {
+		t.Fatalf("expected a repeated completion to leave the refunded payment alone, got %s %s %d (%v)", p.Status, p.InvoiceNo, p.Amount, err)
+	}
+}
+
+// memoryEventRepository keeps events in memory, unique by tenant, type and external ID
+type memoryEventRepository struct {
+	mu     sync.Mutex
+	events []*event.Event
+}
+
+func (m *memoryEventRepository) Save(ctx context.Context, e *event.Event) error {
+	_, err := m.SaveIfAbsent(ctx, e)
+	return err
+}
+
+func (m *memoryEventRepository) SaveIfAbsent(ctx context.Context, e *event.Event) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.events {
+		if existing.TenantID == e.TenantID && existing.Type == e.Type && existing.ExternalID == e.ExternalID {
+			e.ID = existing.ID
+			return false, nil
+		}
+	}
+	e.ID = int64(len(m.events) + 1)
+	copied := *e
+	m.events = append(m.events, &copied)
+	return true, nil
+}
+
+func (m *memoryEventRepository) FindByID(ctx context.Context, id int64) (*event.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.ID == id {
+			copied := *e
+			return &copied, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryEventRepository) FindUnprocessed(ctx context.Context, limit int) ([]*event.Event, error) {
+	return nil, nil
+}
+
+func (m *memoryEventRepository) FindDeferredBefore(ctx context.Context, before time.Time, limit int) ([]*event.Event, error) {
+	return nil, nil
+}
+
+func (m *memoryEventRepository) FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*event.Event, error) {
+	return nil, nil
+}
+
+func (m *memoryEventRepository) MarkProcessed(ctx context.Context, id int64, status event.ProcessingStatus) error {
+	return nil
+}
+
+func (m *memoryEventRepository) MarkForReprocessing(ctx context.Context, tenantID, eventID int64) error {
+	return nil
+}
+
+// count returns how many events are stored
+func (m *memoryEventRepository) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.events)
+}
+
+// memoryCredentialRepository looks credentials up from a fixed list
+type memoryCredentialRepository struct {
+	credentials []*credential.ProviderCredential
+}
+
+func (m *memoryCredentialRepository) Save(ctx context.Context, cred *credential.ProviderCredential) error {
+	return nil
+}
+
+func (m *memoryCredentialRepository) FindByID(ctx context.Context, id int64) (*credential.ProviderCredential, error) {
+	for _, cred := range m.credentials {
+		if cred.ID == id {
+			return cred, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryCredentialRepository) FindByShortcode(ctx context.Context, shortcode string) (*credential.ProviderCredential, error) {
+	for _, cred := range m.credentials {
+		if cred.Shortcode == shortcode {
+			return cred, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryCredentialRepository) FindByWebhookToken(ctx context.Context, token string) (*credential.ProviderCredential, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (m *memoryCredentialRepository) FindByTenantID(ctx context.Context, tenantID int64) ([]*credential.ProviderCredential, error) {
+	return nil, nil
+}
+
+func (m *memoryCredentialRepository) Deactivate(ctx context.Context, id int64) error {
+	return nil
+}
+
+// TestWebhookDeduplication tests that a redelivered callback is stored once and still acknowledged
+func TestWebhookDeduplication(t *testing.T) {
+	cfg := config.Cfg{Sec: config.SecurityCfg{AESKey: make([]byte, 32)}}
+	credentials := &memoryCredentialRepository{credentials: []*credential.ProviderCredential{
+		{ID: 1, TenantID: 1, ProviderType: credential.ProviderMpesa, Shortcode: "174379", IsActive: true},
+		{ID: 2, TenantID: 2, ProviderType: credential.ProviderMpesa, Shortcode: "600000", IsActive: true},
+	}}
+	registry := provider.NewProviderRegistry(cfg, nil)
+	registry.RegisterProvider(provider.ProviderMpesa, mpesa.New(cfg))
+	events := &memoryEventRepository{}
+
+	router := chi.NewRouter()
+	router.Post("/webhooks/{shortcode}", handlers.WebhookByShortcode(
+		tenant.NewService(nil, credentials, cfg), eventservice.NewIngestService(events), registry))
+
+	deliver := func(shortcode, checkoutID string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":%q,"ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`, checkoutID)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks/"+shortcode, strings.NewReader(body)))
+
+		var ack struct {
+			ResultCode int
+			ResultDesc string
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &ack) != nil || ack.ResultCode != 0 {
+			t.Fatalf("expected Daraja to be acknowledged, got %d %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	deliver("174379", "ws_CO_191220191020363925")
+	deliver("174379", "ws_CO_191220191020363925")
+	if n := events.count(); n != 1 {
+		t.Fatalf("expected a redelivered callback to be stored once, got %d events", n)
+	}
+
+	// The service reports the redelivery against the stored event
+	again, _ := event.NewEvent(1, 1, event.TypeSTK, "ws_CO_191220191020363925", []byte(`{}`))
+	result, err := eventservice.NewIngestService(events).Ingest(context.Background(), again)
+	if err != nil || !result.Duplicate || result.EventID != 1 {
+		t.Fatalf("expected a duplicate of event 1, got %+v err=%v", result, err)
+	}
+
+	// The same checkout ID under another tenant, or another checkout ID, is a new event
+	deliver("600000", "ws_CO_191220191020363925")
+	deliver("174379", "ws_CO_191220191020363926")
+	if n := events.count(); n != 3 {
+		t.Fatalf("expected events to be unique per tenant, type and external ID, got %d events", n)
+	}
+}
+
+// memoryDeliveryRepository keeps the delivery queue in memory
+type memoryDeliveryRepository struct {
+	mu         sync.Mutex
+	deliveries []*delivery.Delivery
+}
+
+func (m *memoryDeliveryRepository) Enqueue(ctx context.Context, d *delivery.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.ID = int64(len(m.deliveries) + 1)
+	copied := *d
+	m.deliveries = append(m.deliveries, &copied)
+	return nil
+}
+
+func (m *memoryDeliveryRepository) ClaimDue(ctx context.Context, limit int) ([]*delivery.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*delivery.Delivery
+	for _, d := range m.deliveries {
+		if (d.Status == delivery.StatusPending || d.Status == delivery.StatusFailed) && !d.NextAttemptAt.After(time.Now()) && len(due) < limit {
+			d.Status = delivery.StatusDelivering
+			copied := *d
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryDeliveryRepository) Save(ctx context.Context, d *delivery.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *d
+	m.deliveries[d.ID-1] = &copied
+	return nil
+}
+
+func (m *memoryDeliveryRepository) FindByID(ctx context.Context, id int64) (*delivery.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || int(id) > len(m.deliveries) {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *m.deliveries[id-1]
+	return &copied, nil
+}
+
+func (m *memoryDeliveryRepository) FindByTenantID(ctx context.Context, tenantID int64, status delivery.Status, limit, offset int) ([]*delivery.Delivery, error) {
+	return nil, nil
+}
+
+// memoryEndpointRepository keeps one webhook endpoint per tenant in memory
+type memoryEndpointRepository struct {
+	mu        sync.Mutex
+	endpoints map[int64]*delivery.Endpoint
+}
+
+func (m *memoryEndpointRepository) Save(ctx context.Context, endpoint *delivery.Endpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *endpoint
+	m.endpoints[endpoint.TenantID] = &copied
+	return nil
+}
+
+func (m *memoryEndpointRepository) FindByTenantID(ctx context.Context, tenantID int64) (*delivery.Endpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if endpoint, ok := m.endpoints[tenantID]; ok {
+		copied := *endpoint
+		return &copied, nil
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// TestWebhookDeliveryRetries tests that failed deliveries back off, are dead-lettered after
+// the last attempt, and can be redelivered
+func TestWebhookDeliveryRetries(t *testing.T) {
+	policy := delivery.RetryPolicy{MaxAttempts: 3, BaseDelay: 30 * time.Second, MaxDelay: 2 * time.Minute}
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 6: 2 * time.Minute} {
+		for i := 0; i < 20; i++ {
+			if got := policy.Backoff(attempt); got < want/2 || got > want {
+				t.Fatalf("expected attempt %d to back off between %s and %s, got %s", attempt, want/2, want, got)
+			}
+		}
+	}
+
+	d, _ := delivery.NewDelivery(1, 1)
+	d.MarkFailed("endpoint returned status 500", 500, policy)
+	if wait := time.Until(d.NextAttemptAt); d.Status != delivery.StatusFailed || wait < 14*time.Second || wait > 30*time.Second {
+		t.Fatalf("expected a retry scheduled within the first backoff, got %s in %s", d.Status, wait)
+	}
+
+	var status, hits int32 = http.StatusInternalServerError, 0
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer endpoint.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aesKey := make([]byte, 32)
+	events := &memoryEventRepository{}
+	deliveries := &memoryDeliveryRepository{}
+	endpoints := &memoryEndpointRepository{endpoints: make(map[int64]*delivery.Endpoint)}
+	svc := deliveryservice.NewService(deliveries, endpoints, aesKey)
+	if _, err := svc.ConfigureEndpoint(ctx, 1, endpoint.URL); err != nil {
+		t.Fatalf("failed to configure endpoint: %v", err)
+	}
+	evt, _ := event.NewEvent(1, 1, event.TypeC2B, "RKTQDM7W6S", []byte(`{}`))
+	events.SaveIfAbsent(ctx, evt)
+	queued, _ := delivery.NewDelivery(evt.TenantID, evt.ID)
+	if err := deliveries.Enqueue(ctx, queued); err != nil {
+		t.Fatalf("failed to queue delivery: %v", err)
+	}
+
+	dispatcher := deliveryservice.NewDispatcher(deliveries, endpoints, events, aesKey, deliveryservice.DispatcherConfig{
+		PollInterval: 5 * time.Millisecond,
+		Retry:        delivery.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 20 * time.Millisecond},
+	})
+	go dispatcher.Run(ctx)
+
+	waitFor := func(want delivery.Status) *delivery.Delivery {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			d, _ := deliveries.FindByID(ctx, 1)
+			if d.Status == want {
+				return d
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the delivery to become %s, got %+v", want, d)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	dead := waitFor(delivery.StatusDead)
+	if dead.Attempts != 3 || dead.LastStatusCode != http.StatusInternalServerError || atomic.LoadInt32(&hits) != 3 {
+		t.Fatalf("expected three attempts before giving up, got %+v after %d requests", dead, hits)
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	if _, err := svc.Redeliver(ctx, 1); err != nil {
+		t.Fatalf("failed to redeliver: %v", err)
+	}
+	done := waitFor(delivery.StatusDone)
+	if done.Attempts != 1 || done.DeliveredAt == nil || atomic.LoadInt32(&hits) != 4 {
+		t.Fatalf("expected the redelivery to succeed with a fresh attempt budget, got %+v after %d requests", done, hits)
+	}
+
+	var validationErr *deliveryservice.ValidationError
+	if _, err := svc.Redeliver(ctx, 1); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a delivered notification not to be redelivered, got %v", err)
+	}
+}
+
+// TestC2BRegistrationAndValidation tests that registered C2B URLs lead Daraja to PayMatch,
+// which accepts payments whose bill reference matches the credential's rules and rejects others
+func TestC2BRegistrationAndValidation(t *testing.T) {
+	sim := darajasim.New(darajasim.Config{CallbackLatency: 10 * time.Millisecond})
+	defer sim.Close()
+	daraja := httptest.NewServer(sim)
+	defer daraja.Close()
+
+	router := chi.NewRouter()
+	paymatch := httptest.NewServer(router)
+	defer paymatch.Close()
+
+	cfg := config.Cfg{
+		App:   config.AppCfg{CallbackBaseURL: paymatch.URL},
+		Sec:   config.SecurityCfg{AESKey: make([]byte, 32)},
+		Mpesa: config.MpesaCfg{SandboxBaseURL: daraja.URL},
+	}
+	cred := &credential.ProviderCredential{
+		ID: 1, TenantID: 1, ProviderType: credential.ProviderMpesa, Shortcode: "600000", Environment: "sandbox", IsActive: true,
+		C2BConfiguration:     credential.C2BConfig{Mode: credential.C2BModePaybill, BillRefRequired: true, BillRefRegex: `^INV-\d+$`},
+		EncryptedCredentials: map[string]string{},
+	}
+	for field, value := range map[string]string{"consumer_key": "key", "consumer_secret": "secret"} {
+		if err := cred.SetEncryptedField(field, value, cfg.Sec.AESKey); err != nil {
+			t.Fatalf("failed to encrypt %s: %v", field, err)
+		}
+	}
+	registry := provider.NewProviderRegistry(cfg, nil)
+	registry.RegisterProvider(provider.ProviderMpesa, mpesa.New(cfg))
+	tenants := tenant.NewService(nil, &memoryCredentialRepository{credentials: []*credential.ProviderCredential{cred}}, cfg)
+	events := &memoryEventRepository{}
+	router.Post("/webhooks/{shortcode}", handlers.WebhookByShortcode(tenants, eventservice.NewIngestService(events), registry))
+	router.Post("/webhooks/{shortcode}/c2b/validation", handlers.C2BValidation(tenants, registry))
+
+	registered, err := registry.RegisterC2BURLs(context.Background(), cred, provider.C2BRegisterReq{})
+	if err != nil {
+		t.Fatalf("C2B URL registration failed: %v", err)
+	}
+	if registered.ValidationURL != paymatch.URL+"/webhooks/600000/c2b/validation" || registered.ConfirmationURL != paymatch.URL+"/webhooks/600000" {
+		t.Fatalf("expected the URLs to default to PayMatch's webhooks, got %+v", registered)
+	}
+
+	// Pay the shortcode as a customer would, through the simulator's C2B API
+	tokenReq, _ := http.NewRequest(http.MethodGet, daraja.URL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	tokenReq.SetBasicAuth("key", "secret")
+	tokenResp, err := http.DefaultClient.Do(tokenReq)
+	if err != nil {
+		t.Fatalf("failed to get access token: %v", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	json.NewDecoder(tokenResp.Body).Decode(&token)
+	tokenResp.Body.Close()
+	pay := func(billRef string) {
+		t.Helper()
+		body := fmt.Sprintf(`{"ShortCode":"600000","CommandID":"CustomerPayBillOnline","Amount":250,"Msisdn":"254708374149","BillRefNumber":%q}`, billRef)
+		req, _ := http.NewRequest(http.MethodPost, daraja.URL+"/mpesa/c2b/v1/simulate", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("C2B simulation failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	pay("INV-42")
+	deadline := time.Now().Add(2 * time.Second)
+	for events.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stored, err := events.FindByID(context.Background(), 1)
+	if err != nil || stored.Type != event.TypeC2B || stored.InvoiceRef != "INV-42" || sim.Balance("600000") == 0 {
+		t.Fatalf("expected the validated payment to be confirmed and stored, got %+v err=%v", stored, err)
+	}
+
+	// A reference that breaks the credential's rules is rejected before the customer pays
+	pay("order 42")
+	time.Sleep(100 * time.Millisecond)
+	if n := events.count(); n != 1 {
+		t.Fatalf("expected the rejected payment not to be confirmed, got %d events", n)
+	}
+
+	validate := func(shortcode, billRef string) string {
+		t.Helper()
+		body := fmt.Sprintf(`{"TransactionType":"Pay Bill","TransID":"RKTQDM7W6S","TransAmount":"250.00","BusinessShortCode":%q,"BillRefNumber":%q,"MSISDN":"254708374149"}`, shortcode, billRef)
+		resp, err := http.Post(paymatch.URL+"/webhooks/"+shortcode+"/c2b/validation", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("validation request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result struct{ ResultCode string }
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result.ResultCode
+	}
+	if code := validate("600000", ""); code != "C2B00012" {
+		t.Fatalf("expected a missing bill reference to be rejected as invalid, got %q", code)
+	}
+	if code := validate("999999", "INV-42"); code != "C2B00015" {
+		t.Fatalf("expected an unknown shortcode to be rejected, got %q", code)
+	}
+	if code := validate("600000", "INV-43"); code != "0" {
+		t.Fatalf("expected a matching bill reference to be accepted, got %q", code)
+	}
+}
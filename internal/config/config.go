@@ -41,7 +41,39 @@ func loadDotenv(path string) {
 
 type AppCfg struct{ Env, Port, BaseURL, CallbackBaseURL string }
 type DBCfg struct{ DSN string }
-type RedisCfg struct{ Addr string }
+
+// RedisCfg locates the Redis used to share provider tokens; DB selects the logical database
+type RedisCfg struct {
+	Addr, Password string
+	DB             int
+	TLS            bool
+}
+
+// MpesaCfg locates the Safaricom certificates used to encrypt initiator passwords. The base
+// URLs, when set, override the provider_configs endpoint, e.g. to use a local simulator.
+type MpesaCfg struct {
+	SandboxCertPath, ProductionCertPath string
+	SandboxBaseURL, ProductionBaseURL   string
+}
+
+// PayoutCfg paces bulk payouts so provider rate limits are respected
+type PayoutCfg struct{ RatePerSecond int }
+
+// STKCfg decides when STK payments without a callback are queried and given up on
+type STKCfg struct{ QueryAfter, TimeoutAfter time.Duration }
+
+// TokenCfg chooses where provider access tokens are shared ("memory", "postgres" or "redis")
+// and how long before expiry they are refreshed
+type TokenCfg struct {
+	Store         string
+	RefreshBefore time.Duration
+}
+
+// ProviderCfg sets how often provider endpoints and limits are reloaded from provider_configs
+type ProviderCfg struct{ ReloadInterval time.Duration }
+
+// IdempotencyCfg sets how long Idempotency-Key responses are kept for replay
+type IdempotencyCfg struct{ Retention, ClaimTimeout time.Duration }
 
 type SecurityCfg struct {
 	AESKey          []byte
@@ -50,10 +82,16 @@ type SecurityCfg struct {
 }
 
 type Cfg struct {
-	App   AppCfg
-	DB    DBCfg
-	Redis RedisCfg
-	Sec   SecurityCfg
+	App         AppCfg
+	DB          DBCfg
+	Redis       RedisCfg
+	Sec         SecurityCfg
+	Mpesa       MpesaCfg
+	Payout      PayoutCfg
+	STK         STKCfg
+	Token       TokenCfg
+	Provider    ProviderCfg
+	Idempotency IdempotencyCfg
 }
 
 func Load() Cfg {
@@ -67,6 +105,16 @@ func Load() Cfg {
 	viper.SetDefault("RATE_LIMIT_PER_MIN", 300)
 	viper.SetDefault("TZ", "Africa/Nairobi")
 	viper.SetDefault("ADMIN_TOKEN", "")
+	viper.SetDefault("MPESA_SANDBOX_CERT_PATH", "certs/mpesa/sandbox.cer")
+	viper.SetDefault("MPESA_PRODUCTION_CERT_PATH", "certs/mpesa/production.cer")
+	viper.SetDefault("PAYOUT_RATE_PER_SECOND", 5)
+	viper.SetDefault("STK_QUERY_AFTER", "2m")
+	viper.SetDefault("STK_TIMEOUT_AFTER", "15m")
+	viper.SetDefault("TOKEN_STORE", "memory")
+	viper.SetDefault("TOKEN_REFRESH_BEFORE", "5m")
+	viper.SetDefault("PROVIDER_CONFIG_RELOAD_INTERVAL", "30s")
+	viper.SetDefault("IDEMPOTENCY_RETENTION", "24h")
+	viper.SetDefault("IDEMPOTENCY_CLAIM_TIMEOUT", "5m")
 
 	// Ensure TZ
 	if tz := viper.GetString("TZ"); tz != "" {
@@ -84,13 +132,38 @@ func Load() Cfg {
 			BaseURL:         viper.GetString("APP_BASE_URL"),
 			CallbackBaseURL: viper.GetString("CALLBACK_BASE_URL"),
 		},
-		DB:    DBCfg{DSN: viper.GetString("DB_DSN")},
-		Redis: RedisCfg{Addr: viper.GetString("REDIS_ADDR")},
+		DB: DBCfg{DSN: viper.GetString("DB_DSN")},
+		Redis: RedisCfg{
+			Addr:     viper.GetString("REDIS_ADDR"),
+			Password: viper.GetString("REDIS_PASSWORD"),
+			DB:       viper.GetInt("REDIS_DB"),
+			TLS:      viper.GetBool("REDIS_TLS"),
+		},
 		Sec: SecurityCfg{
 			AESKey:          key,
 			RateLimitPerMin: viper.GetInt("RATE_LIMIT_PER_MIN"),
 			AdminToken:      strings.TrimSpace(viper.GetString("ADMIN_TOKEN")),
 		},
+		Mpesa: MpesaCfg{
+			SandboxCertPath:    viper.GetString("MPESA_SANDBOX_CERT_PATH"),
+			ProductionCertPath: viper.GetString("MPESA_PRODUCTION_CERT_PATH"),
+			SandboxBaseURL:     strings.TrimSuffix(viper.GetString("MPESA_SANDBOX_BASE_URL"), "/"),
+			ProductionBaseURL:  strings.TrimSuffix(viper.GetString("MPESA_PRODUCTION_BASE_URL"), "/"),
+		},
+		Payout: PayoutCfg{RatePerSecond: viper.GetInt("PAYOUT_RATE_PER_SECOND")},
+		STK: STKCfg{
+			QueryAfter:   viper.GetDuration("STK_QUERY_AFTER"),
+			TimeoutAfter: viper.GetDuration("STK_TIMEOUT_AFTER"),
+		},
+		Token: TokenCfg{
+			Store:         strings.ToLower(strings.TrimSpace(viper.GetString("TOKEN_STORE"))),
+			RefreshBefore: viper.GetDuration("TOKEN_REFRESH_BEFORE"),
+		},
+		Provider: ProviderCfg{ReloadInterval: viper.GetDuration("PROVIDER_CONFIG_RELOAD_INTERVAL")},
+		Idempotency: IdempotencyCfg{
+			Retention:    viper.GetDuration("IDEMPOTENCY_RETENTION"),
+			ClaimTimeout: viper.GetDuration("IDEMPOTENCY_CLAIM_TIMEOUT"),
+		},
 	}
 
 	// 3) Fail fast on required settings
@@ -100,6 +173,15 @@ func Load() Cfg {
 	if err != nil || len(cfg.Sec.AESKey) != 32 {
 		log.Fatal().Msg("AES_256_KEY_BASE64 must be a valid 32-byte base64 key")
 	}
+	switch cfg.Token.Store {
+	case "memory", "postgres":
+	case "redis":
+		if cfg.Redis.Addr == "" {
+			log.Fatal().Msg("REDIS_ADDR is required when TOKEN_STORE is redis")
+		}
+	default:
+		log.Fatal().Str("token_store", cfg.Token.Store).Msg("TOKEN_STORE must be memory, postgres or redis")
+	}
 
 	_ = time.Local // TZ set via env
 	return cfg
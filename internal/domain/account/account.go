@@ -0,0 +1,187 @@
+package account
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query is a balance or transaction status request whose result the provider reports later
+type Query struct {
+	ID                       int64
+	TenantID                 int64
+	ProviderCredentialID     int64
+	Kind                     Kind
+	TransactionID            string // the transaction a status query looks up
+	ExternalID               string // provider conversation ID; empty for providers that answer at once
+	OriginatorConversationID string
+	Status                   QueryStatus
+	ResultDesc               string
+	Result                   map[string]string // result parameters as reported by the provider
+	Accounts                 []Account         // set by a completed balance query
+	RequestedBy              string
+	CreatedAt                time.Time
+	UpdatedAt                time.Time
+	CompletedAt              *time.Time
+}
+
+// Kind is what a query asks the provider for
+type Kind string
+
+const (
+	KindBalance           Kind = "balance"
+	KindTransactionStatus Kind = "transaction_status"
+)
+
+// QueryStatus represents query status
+type QueryStatus string
+
+const (
+	QueryPending   QueryStatus = "pending"   // accepted by the provider and awaiting its result
+	QueryCompleted QueryStatus = "completed" // the result arrived
+	QueryFailed    QueryStatus = "failed"    // the provider could not answer
+	QueryTimedOut  QueryStatus = "timed_out" // the provider's queue timed out; a late result may still arrive
+)
+
+// Account is one account's balances as reported by a balance query. Amounts are kept
+// as the provider's decimal strings since they are only ever displayed.
+type Account struct {
+	Name      string
+	Currency  string
+	Current   string
+	Available string
+	Reserved  string
+	Uncleared string
+}
+
+// Balance is the latest known balance of a credential's accounts
+type Balance struct {
+	TenantID             int64
+	ProviderCredentialID int64
+	QueryID              int64 // the query that reported it
+	Accounts             []Account
+	UpdatedAt            time.Time
+}
+
+// NewQuery creates a pending query
+func NewQuery(tenantID, credentialID int64, kind Kind, transactionID, requestedBy string) (*Query, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+	if credentialID <= 0 {
+		return nil, fmt.Errorf("invalid credential ID: %d", credentialID)
+	}
+	transactionID = strings.TrimSpace(transactionID)
+	switch kind {
+	case KindBalance:
+		transactionID = ""
+	case KindTransactionStatus:
+		if transactionID == "" {
+			return nil, fmt.Errorf("transaction ID is required")
+		}
+	default:
+		return nil, fmt.Errorf("invalid query kind: %s", kind)
+	}
+
+	now := time.Now()
+	return &Query{
+		TenantID:             tenantID,
+		ProviderCredentialID: credentialID,
+		Kind:                 kind,
+		TransactionID:        transactionID,
+		Status:               QueryPending,
+		RequestedBy:          strings.TrimSpace(requestedBy),
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}, nil
+}
+
+// Accept records the identifiers the provider assigned when it queued the query
+func (q *Query) Accept(conversationID, originatorConversationID, desc string) error {
+	if strings.TrimSpace(conversationID) == "" {
+		return fmt.Errorf("conversation ID is required")
+	}
+	q.ExternalID = conversationID
+	q.OriginatorConversationID = originatorConversationID
+	q.ResultDesc = desc
+	q.UpdatedAt = time.Now()
+	return nil
+}
+
+// Complete records the provider's result; it returns false if the query was already settled
+func (q *Query) Complete(succeeded bool, desc string, result map[string]string) bool {
+	if q.IsFinal() {
+		return false
+	}
+
+	now := time.Now()
+	q.Status = QueryFailed
+	if succeeded {
+		q.Status = QueryCompleted
+	}
+	q.ResultDesc = desc
+	q.Result = result
+	q.UpdatedAt = now
+	q.CompletedAt = &now
+	return true
+}
+
+// TimeOut marks a pending query whose result did not arrive in time; it returns false otherwise
+func (q *Query) TimeOut(desc string) bool {
+	if q.Status != QueryPending {
+		return false
+	}
+	q.Status = QueryTimedOut
+	q.ResultDesc = desc
+	q.UpdatedAt = time.Now()
+	return true
+}
+
+// IsFinal reports whether the query has a definitive result
+func (q *Query) IsFinal() bool {
+	return q.Status == QueryCompleted || q.Status == QueryFailed
+}
+
+// Balance returns the credential balance a completed balance query reported
+func (q *Query) Balance() (*Balance, error) {
+	if q.Kind != KindBalance || q.Status != QueryCompleted {
+		return nil, fmt.Errorf("query %d did not report a balance", q.ID)
+	}
+	return &Balance{
+		TenantID:             q.TenantID,
+		ProviderCredentialID: q.ProviderCredentialID,
+		QueryID:              q.ID,
+		Accounts:             q.Accounts,
+		UpdatedAt:            q.UpdatedAt,
+	}, nil
+}
+
+// ParseAccounts parses a balance report of the form
+// "Working Account|KES|46713.00|46713.00|0.00|0.00&Float Account|KES|0.00|0.00|0.00|0.00",
+// where each account lists its name, currency, current, available, reserved and uncleared balance
+func ParseAccounts(report string) ([]Account, error) {
+	report = strings.TrimSpace(report)
+	if report == "" {
+		return nil, fmt.Errorf("balance report is empty")
+	}
+
+	var accounts []Account
+	for _, entry := range strings.Split(report, "&") {
+		fields := strings.Split(entry, "|")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid account balance %q", entry)
+		}
+		for len(fields) < 6 {
+			fields = append(fields, "")
+		}
+		accounts = append(accounts, Account{
+			Name:      strings.TrimSpace(fields[0]),
+			Currency:  strings.TrimSpace(fields[1]),
+			Current:   strings.TrimSpace(fields[2]),
+			Available: strings.TrimSpace(fields[3]),
+			Reserved:  strings.TrimSpace(fields[4]),
+			Uncleared: strings.TrimSpace(fields[5]),
+		})
+	}
+	return accounts, nil
+}
@@ -0,0 +1,235 @@
+package delivery
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Delivery represents one outbound notification of a payment event to a tenant endpoint
+type Delivery struct {
+	ID             int64
+	TenantID       int64
+	EventID        int64
+	Status         Status
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	LastStatusCode int
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Status represents delivery status
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusDelivering Status = "delivering"
+	StatusDone       Status = "done"
+	StatusFailed     Status = "failed" // retry scheduled
+	StatusDead       Status = "dead"   // retries exhausted
+)
+
+// RetryPolicy controls exponential backoff between delivery attempts
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy returns sensible defaults (roughly a day of retries)
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    6 * time.Hour,
+	}
+}
+
+// Backoff returns the delay before the given retry attempt (1-based), using full jitter
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// Full jitter keeps retries from many tenants from synchronising
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// NewDelivery creates a pending delivery for an event
+func NewDelivery(tenantID, eventID int64) (*Delivery, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+	if eventID <= 0 {
+		return nil, fmt.Errorf("invalid event ID: %d", eventID)
+	}
+
+	now := time.Now()
+	return &Delivery{
+		TenantID:      tenantID,
+		EventID:       eventID,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// MarkDelivered records a successful attempt
+func (d *Delivery) MarkDelivered(statusCode int) {
+	now := time.Now()
+	d.Attempts++
+	d.Status = StatusDone
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+	d.DeliveredAt = &now
+	d.UpdatedAt = now
+}
+
+// MarkFailed records a failed attempt and either schedules a retry or dead-letters the delivery
+func (d *Delivery) MarkFailed(reason string, statusCode int, policy RetryPolicy) {
+	now := time.Now()
+	d.Attempts++
+	d.LastError = reason
+	d.LastStatusCode = statusCode
+	d.UpdatedAt = now
+
+	if d.Attempts >= policy.MaxAttempts {
+		d.Status = StatusDead
+		return
+	}
+
+	d.Status = StatusFailed
+	d.NextAttemptAt = now.Add(policy.Backoff(d.Attempts))
+}
+
+// Redeliver puts a failed or dead-lettered delivery back in the queue with a fresh attempt budget
+func (d *Delivery) Redeliver() error {
+	if d.Status != StatusDead && d.Status != StatusFailed {
+		return fmt.Errorf("delivery %d cannot be redelivered in status %s", d.ID, d.Status)
+	}
+
+	now := time.Now()
+	d.Status = StatusPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	d.UpdatedAt = now
+	return nil
+}
+
+// Endpoint is the URL a tenant receives payment notifications on
+type Endpoint struct {
+	ID       int64
+	TenantID int64
+	URL      string
+	IsActive bool
+
+	// Signing secrets are stored encrypted; the previous secret stays valid
+	// until PreviousSecretExpiresAt so tenants can rotate without downtime
+	SigningSecretEnc        string
+	PreviousSecretEnc       string
+	PreviousSecretExpiresAt *time.Time
+	SecretRotatedAt         *time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewEndpoint creates a webhook endpoint with validation
+func NewEndpoint(tenantID int64, rawURL string) (*Endpoint, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+
+	if err := validateEndpointURL(rawURL); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Endpoint{
+		TenantID:  tenantID,
+		URL:       strings.TrimSpace(rawURL),
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// ChangeURL points the endpoint at a new URL
+func (e *Endpoint) ChangeURL(rawURL string) error {
+	if err := validateEndpointURL(rawURL); err != nil {
+		return err
+	}
+	e.URL = strings.TrimSpace(rawURL)
+	e.IsActive = true
+	e.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetSigningSecret installs the first signing secret of an endpoint
+func (e *Endpoint) SetSigningSecret(secretEnc string) {
+	e.SigningSecretEnc = secretEnc
+	e.PreviousSecretEnc = ""
+	e.PreviousSecretExpiresAt = nil
+	e.UpdatedAt = time.Now()
+}
+
+// RotateSecret replaces the signing secret, keeping the old one valid for the overlap window
+func (e *Endpoint) RotateSecret(secretEnc string, overlap time.Duration) error {
+	if secretEnc == "" {
+		return fmt.Errorf("signing secret is required")
+	}
+	if overlap < 0 {
+		return fmt.Errorf("overlap must not be negative")
+	}
+
+	now := time.Now()
+	e.PreviousSecretEnc = e.SigningSecretEnc
+	if e.PreviousSecretEnc != "" && overlap > 0 {
+		expiresAt := now.Add(overlap)
+		e.PreviousSecretExpiresAt = &expiresAt
+	} else {
+		e.PreviousSecretEnc = ""
+		e.PreviousSecretExpiresAt = nil
+	}
+	e.SigningSecretEnc = secretEnc
+	e.SecretRotatedAt = &now
+	e.UpdatedAt = now
+	return nil
+}
+
+// ActiveSecretsEnc returns the encrypted secrets deliveries must be signed with
+func (e *Endpoint) ActiveSecretsEnc(now time.Time) []string {
+	var secrets []string
+	if e.SigningSecretEnc != "" {
+		secrets = append(secrets, e.SigningSecretEnc)
+	}
+	if e.PreviousSecretEnc != "" && e.PreviousSecretExpiresAt != nil && now.Before(*e.PreviousSecretExpiresAt) {
+		secrets = append(secrets, e.PreviousSecretEnc)
+	}
+	return secrets
+}
+
+// validateEndpointURL ensures the endpoint is an absolute http(s) URL
+func validateEndpointURL(rawURL string) error {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid endpoint URL: %s", rawURL)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("endpoint URL must use http or https")
+	}
+	return nil
+}
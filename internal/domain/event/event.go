@@ -18,6 +18,7 @@ type Event struct {
 	InvoiceRef           string
 	TransactionID        string
 	Status               string
+	FailureCode          string // standard provider error code when the event reports a failure
 	ResponseDescription  string
 	RawJSON              []byte
 	ReceivedAt           time.Time
@@ -34,6 +35,9 @@ const (
 	TypeB2C         Type = "b2c"
 	TypeBalance     Type = "balance"
 	TypeBulkTransfer Type = "bulk_transfer"
+	TypeTimeout     Type = "timeout" // provider queue timeout for an outgoing request
+	TypeReversal    Type = "reversal" // result of a transaction reversal request
+	TypeTransactionStatus Type = "transaction_status" // result of a transaction status query
 )
 
 // ProcessingStatus represents the event processing status
@@ -44,6 +48,7 @@ const (
 	ProcessingQueued    ProcessingStatus = "queued"
 	ProcessingCompleted ProcessingStatus = "completed"
 	ProcessingFailed    ProcessingStatus = "failed"
+	ProcessingDeferred  ProcessingStatus = "deferred" // refers to a request not recorded yet; retried until it is
 )
 
 // NewEvent creates a new event with validation
@@ -96,13 +101,20 @@ func (e *Event) IsProcessed() bool {
 	return e.ProcessingStatus == ProcessingCompleted || e.ProcessingStatus == ProcessingFailed
 }
 
+// IsPayment checks if the event records an incoming customer payment
+func (e *Event) IsPayment() bool {
+	return e.Type == TypeSTK || e.Type == TypeC2B
+}
+
 // CanChangeStatus checks if status can be changed
 func (e *Event) CanChangeStatus(newStatus ProcessingStatus) bool {
 	switch e.ProcessingStatus {
 	case ProcessingPending:
-		return newStatus == ProcessingQueued || newStatus == ProcessingCompleted || newStatus == ProcessingFailed
+		return newStatus == ProcessingQueued || newStatus == ProcessingCompleted || newStatus == ProcessingFailed || newStatus == ProcessingDeferred
 	case ProcessingQueued:
-		return newStatus == ProcessingCompleted || newStatus == ProcessingFailed
+		return newStatus == ProcessingCompleted || newStatus == ProcessingFailed || newStatus == ProcessingDeferred
+	case ProcessingDeferred:
+		return newStatus == ProcessingQueued || newStatus == ProcessingCompleted || newStatus == ProcessingFailed || newStatus == ProcessingDeferred
 	case ProcessingCompleted:
 		return newStatus == ProcessingQueued // Allow reprocessing
 	case ProcessingFailed:
@@ -144,7 +156,7 @@ func validateEventCreation(tenantID, credentialID int64, eventType Type, externa
 
 // isValidEventType checks if event type is valid
 func isValidEventType(eventType Type) bool {
-	validTypes := []Type{TypeSTK, TypeC2B, TypeB2C, TypeBalance, TypeBulkTransfer}
+	validTypes := []Type{TypeSTK, TypeC2B, TypeB2C, TypeBalance, TypeBulkTransfer, TypeTimeout, TypeReversal, TypeTransactionStatus}
 	for _, valid := range validTypes {
 		if eventType == valid {
 			return true
@@ -0,0 +1,115 @@
+package exception
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/payment"
+)
+
+// Kind classifies why a payment needs an operator's attention
+type Kind string
+
+const (
+	KindUnmatched       Kind = "unmatched"        // completed but not tied to any invoice
+	KindAmbiguous       Kind = "ambiguous"        // a suggested match is waiting in the review queue
+	KindRefundCandidate Kind = "refund_candidate" // flagged to be returned to the payer
+)
+
+// Exception is a payment that automatic reconciliation could not settle
+type Exception struct {
+	Payment            *payment.Payment
+	Kind               Kind
+	ReviewID           *int64 // pending match review, if any
+	SuggestedInvoiceID *int64
+	Confidence         *float64
+}
+
+// Action is an operator decision on an exception
+type Action string
+
+const (
+	ActionManualMatch     Action = "manual_match"
+	ActionSplit           Action = "split"
+	ActionRefundCandidate Action = "refund_candidate"
+)
+
+// Split is the part of a payment applied to one invoice
+type Split struct {
+	InvoiceID int64
+	Amount    payment.Money
+}
+
+// AuditEntry records who took an action on a payment and why
+type AuditEntry struct {
+	ID        int64
+	TenantID  int64
+	PaymentID int64
+	Action    Action
+	Actor     string
+	Reason    string
+	Splits    []Split // invoices the payment was applied to; empty for refund candidates
+	CreatedAt time.Time
+}
+
+// NewAuditEntry creates an audit entry; every action must name its actor and reason
+func NewAuditEntry(tenantID, paymentID int64, action Action, actor, reason string, splits []Split) (*AuditEntry, error) {
+	if tenantID <= 0 || paymentID <= 0 {
+		return nil, fmt.Errorf("invalid tenant or payment ID")
+	}
+
+	actor = strings.TrimSpace(actor)
+	if actor == "" {
+		return nil, fmt.Errorf("actor is required")
+	}
+	if len(actor) > 128 {
+		return nil, fmt.Errorf("actor must be at most 128 characters")
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	if len(reason) > 1000 {
+		return nil, fmt.Errorf("reason must be at most 1000 characters")
+	}
+
+	return &AuditEntry{
+		TenantID:  tenantID,
+		PaymentID: paymentID,
+		Action:    action,
+		Actor:     actor,
+		Reason:    reason,
+		Splits:    splits,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// ValidateSplits checks that splits cover the whole payment, each invoice at most once
+func ValidateSplits(splits []Split, total payment.Money) error {
+	if len(splits) == 0 {
+		return fmt.Errorf("at least one allocation is required")
+	}
+
+	seen := make(map[int64]bool, len(splits))
+	var sum payment.Money
+	for _, s := range splits {
+		if s.InvoiceID <= 0 {
+			return fmt.Errorf("invalid invoice ID: %d", s.InvoiceID)
+		}
+		if seen[s.InvoiceID] {
+			return fmt.Errorf("invoice %d appears more than once", s.InvoiceID)
+		}
+		if s.Amount <= 0 {
+			return fmt.Errorf("allocation amount must be positive: %d", s.Amount)
+		}
+		seen[s.InvoiceID] = true
+		sum += s.Amount
+	}
+
+	if sum != total {
+		return fmt.Errorf("allocations total %d but the payment is %d", sum, total)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Record ties a client's Idempotency-Key to the request it first came with and, once
+// handled, the response that is replayed for retries
+type Record struct {
+	ID                  int64
+	TenantID            int64
+	Key                 string
+	Fingerprint         string
+	Status              Status
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseBody        []byte
+	CreatedAt           time.Time
+	CompletedAt         *time.Time
+	ExpiresAt           time.Time
+}
+
+// Status represents how far the keyed request got
+type Status string
+
+const (
+	StatusProcessing Status = "processing" // the first request is still being handled
+	StatusCompleted  Status = "completed"  // the response is stored for replay
+)
+
+// MaxKeyLength bounds the keys clients may send
+const MaxKeyLength = 255
+
+// NewRecord claims a key for a request; it lapses after retention
+func NewRecord(tenantID int64, key, fingerprint string, retention time.Duration) (*Record, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if retention <= 0 {
+		return nil, fmt.Errorf("retention must be positive")
+	}
+
+	// Claims are matched on their creation time, so keep only what Postgres stores
+	now := time.Now().Truncate(time.Microsecond)
+	return &Record{
+		TenantID:    tenantID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      StatusProcessing,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(retention),
+	}, nil
+}
+
+// ValidateKey checks that a key is non-empty printable ASCII of bounded length
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("idempotency key cannot be empty")
+	}
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("idempotency key must be at most %d characters", MaxKeyLength)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return fmt.Errorf("idempotency key must be printable ASCII without spaces")
+		}
+	}
+	return nil
+}
+
+// Fingerprint identifies a request by its method, path and body, so a key reused for a
+// different request can be told apart from a retry
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Matches reports whether a request with the fingerprint is a retry of the recorded one
+func (r *Record) Matches(fingerprint string) bool {
+	return r.Fingerprint == fingerprint
+}
+
+// Complete stores the response to replay for retries
+func (r *Record) Complete(status int, contentType string, body []byte) {
+	now := time.Now()
+	r.Status = StatusCompleted
+	r.ResponseStatus = status
+	r.ResponseContentType = contentType
+	r.ResponseBody = body
+	r.CompletedAt = &now
+}
@@ -0,0 +1,213 @@
+package invoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/payment"
+)
+
+// Invoice represents an amount a tenant expects to be paid against a reference
+type Invoice struct {
+	ID                 int64
+	TenantID           int64
+	Reference          string
+	CustomerRef        string // optional; links overpayment credits to the customer's next invoice
+	CustomerMSISDNHash string // optional; phone the customer is expected to pay from
+	Description        string
+	AmountDue          payment.Money
+	AmountPaid         payment.Money // payments and applied credits
+	Currency           payment.Currency
+	DueDate            *time.Time
+	Status             Status
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	CancelledAt        *time.Time
+}
+
+// Status represents invoice status
+type Status string
+
+const (
+	StatusOpen          Status = "open"
+	StatusPartiallyPaid Status = "partially_paid"
+	StatusPaid          Status = "paid"
+	StatusOverpaid      Status = "overpaid"
+	StatusCancelled     Status = "cancelled"
+)
+
+// MatchOutcome describes how a payment relates to the invoice it was applied to
+type MatchOutcome string
+
+const (
+	OutcomeExact   MatchOutcome = "matched"
+	OutcomePartial MatchOutcome = "partially_paid"
+	OutcomeOver    MatchOutcome = "overpaid"
+)
+
+// Allocation links a payment to the invoice it was applied to
+type Allocation struct {
+	ID        int64
+	InvoiceID int64
+	PaymentID int64
+	Amount    payment.Money
+	CreatedAt time.Time
+}
+
+// NewInvoice creates a new open invoice with validation
+func NewInvoice(tenantID int64, reference, customerRef, description string, amountDue payment.Money, currency payment.Currency, dueDate *time.Time) (*Invoice, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+
+	reference = NormalizeReference(reference)
+	if reference == "" {
+		return nil, fmt.Errorf("reference is required")
+	}
+	if len(reference) > 64 {
+		return nil, fmt.Errorf("reference must be at most 64 characters")
+	}
+
+	if amountDue <= 0 {
+		return nil, fmt.Errorf("amount must be positive: %d", amountDue)
+	}
+
+	currency = payment.Currency(strings.ToUpper(strings.TrimSpace(string(currency))))
+	if currency == "" {
+		currency = payment.KES
+	}
+	if len(currency) != 3 {
+		return nil, fmt.Errorf("invalid currency: %s", currency)
+	}
+
+	now := time.Now()
+	return &Invoice{
+		TenantID:    tenantID,
+		Reference:   reference,
+		CustomerRef: NormalizeReference(customerRef),
+		Description: strings.TrimSpace(description),
+		AmountDue:   amountDue,
+		Currency:    currency,
+		DueDate:     dueDate,
+		Status:      StatusOpen,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// SetCustomerPhone records the phone the customer is expected to pay from
+func (i *Invoice) SetCustomerPhone(msisdn *payment.MSISDN) {
+	if msisdn == nil {
+		i.CustomerMSISDNHash = ""
+		return
+	}
+	i.CustomerMSISDNHash = msisdn.Hash()
+}
+
+// NormalizeReference trims a reference and upper-cases it, as customers type bill refs loosely
+func NormalizeReference(reference string) string {
+	return strings.ToUpper(strings.TrimSpace(reference))
+}
+
+// AcceptsPayments reports whether payments can still be applied to the invoice
+func (i *Invoice) AcceptsPayments() bool {
+	return i.Status == StatusOpen || i.Status == StatusPartiallyPaid
+}
+
+// Balance returns the amount still outstanding (negative when overpaid)
+func (i *Invoice) Balance() payment.Money {
+	return i.AmountDue - i.AmountPaid
+}
+
+// Outstanding returns the amount the customer still owes
+func (i *Invoice) Outstanding() payment.Money {
+	if balance := i.Balance(); balance > 0 {
+		return balance
+	}
+	return 0
+}
+
+// Overpaid returns the amount received above what was due
+func (i *Invoice) Overpaid() payment.Money {
+	if balance := i.Balance(); balance < 0 {
+		return -balance
+	}
+	return 0
+}
+
+// CanApply reports why a payment could not be applied to the invoice, if it could not
+func (i *Invoice) CanApply(amount payment.Money, currency payment.Currency) error {
+	if !i.AcceptsPayments() {
+		return fmt.Errorf("invoice %s does not accept payments in status %s", i.Reference, i.Status)
+	}
+	if amount <= 0 {
+		return fmt.Errorf("amount must be positive: %d", amount)
+	}
+	if currency != "" && !strings.EqualFold(string(currency), string(i.Currency)) {
+		return fmt.Errorf("currency %s does not match invoice currency %s", currency, i.Currency)
+	}
+	return nil
+}
+
+// ApplyPayment records a payment against the invoice and returns how it matched
+func (i *Invoice) ApplyPayment(amount payment.Money, currency payment.Currency) (MatchOutcome, error) {
+	if err := i.CanApply(amount, currency); err != nil {
+		return "", err
+	}
+
+	i.AmountPaid += amount
+	i.UpdatedAt = time.Now()
+
+	switch balance := i.Balance(); {
+	case balance > 0:
+		i.Status = StatusPartiallyPaid
+		return OutcomePartial, nil
+	case balance == 0:
+		i.Status = StatusPaid
+		return OutcomeExact, nil
+	default:
+		i.Status = StatusOverpaid
+		return OutcomeOver, nil
+	}
+}
+
+// ApplyCredit settles up to the outstanding amount from a customer credit and returns the amount used
+func (i *Invoice) ApplyCredit(available payment.Money, currency payment.Currency) (payment.Money, error) {
+	if !i.AcceptsPayments() {
+		return 0, fmt.Errorf("invoice %s does not accept payments in status %s", i.Reference, i.Status)
+	}
+	if currency != i.Currency {
+		return 0, fmt.Errorf("currency %s does not match invoice currency %s", currency, i.Currency)
+	}
+
+	amount := available
+	if outstanding := i.Outstanding(); amount > outstanding {
+		amount = outstanding
+	}
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	// Credits never overpay, so the outcome is either partial or exact
+	if _, err := i.ApplyPayment(amount, currency); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// Cancel cancels an invoice that has not received any payment
+func (i *Invoice) Cancel() error {
+	if i.Status == StatusCancelled {
+		return fmt.Errorf("invoice %s is already cancelled", i.Reference)
+	}
+	if i.AmountPaid > 0 {
+		return fmt.Errorf("invoice %s has received payments and cannot be cancelled", i.Reference)
+	}
+
+	now := time.Now()
+	i.Status = StatusCancelled
+	i.CancelledAt = &now
+	i.UpdatedAt = now
+	return nil
+}
@@ -0,0 +1,138 @@
+package invoice
+
+import (
+	"fmt"
+	"time"
+
+	"paymatch/internal/domain/payment"
+)
+
+// LedgerEntry is one movement on an invoice's balance
+type LedgerEntry struct {
+	ID           int64
+	TenantID     int64
+	InvoiceID    int64
+	Type         EntryType
+	Amount       payment.Money // positive increases what is owed, negative reduces it
+	BalanceAfter payment.Money // running balance; negative when overpaid
+	PaymentID    *int64
+	CreditID     *int64
+	CreatedAt    time.Time
+}
+
+// EntryType represents the kind of ledger movement
+type EntryType string
+
+const (
+	EntryCharge  EntryType = "charge"  // invoice issued
+	EntryPayment EntryType = "payment" // provider payment applied
+	EntryCredit  EntryType = "credit"  // customer credit applied
+)
+
+// NewChargeEntry records the amount due when an invoice is issued
+func NewChargeEntry(inv *Invoice) *LedgerEntry {
+	return &LedgerEntry{
+		TenantID:     inv.TenantID,
+		InvoiceID:    inv.ID,
+		Type:         EntryCharge,
+		Amount:       inv.AmountDue,
+		BalanceAfter: inv.AmountDue,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// NewPaymentEntry records a payment already applied to the invoice
+func NewPaymentEntry(inv *Invoice, paymentID int64, amount payment.Money) *LedgerEntry {
+	return &LedgerEntry{
+		TenantID:     inv.TenantID,
+		InvoiceID:    inv.ID,
+		Type:         EntryPayment,
+		Amount:       -amount,
+		BalanceAfter: inv.Balance(),
+		PaymentID:    &paymentID,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// NewCreditEntry records a customer credit already applied to the invoice
+func NewCreditEntry(inv *Invoice, creditID int64, amount payment.Money) *LedgerEntry {
+	return &LedgerEntry{
+		TenantID:     inv.TenantID,
+		InvoiceID:    inv.ID,
+		Type:         EntryCredit,
+		Amount:       -amount,
+		BalanceAfter: inv.Balance(),
+		CreditID:     &creditID,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Credit is money a customer paid above an invoice, available for later invoices
+type Credit struct {
+	ID              int64
+	TenantID        int64
+	CustomerRef     string
+	SourceInvoiceID int64
+	SourcePaymentID int64
+	Amount          payment.Money
+	Remaining       payment.Money
+	Currency        payment.Currency
+	Status          CreditStatus
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// CreditStatus represents credit status
+type CreditStatus string
+
+const (
+	CreditAvailable CreditStatus = "available"
+	CreditConsumed  CreditStatus = "consumed"
+)
+
+// NewOverpaymentCredit turns the excess on an overpaid invoice into a customer credit
+func NewOverpaymentCredit(inv *Invoice, paymentID int64) (*Credit, error) {
+	excess := inv.Overpaid()
+	if excess <= 0 {
+		return nil, fmt.Errorf("invoice %s is not overpaid", inv.Reference)
+	}
+
+	now := time.Now()
+	return &Credit{
+		TenantID:        inv.TenantID,
+		CustomerRef:     inv.CustomerRef,
+		SourceInvoiceID: inv.ID,
+		SourcePaymentID: paymentID,
+		Amount:          excess,
+		Remaining:       excess,
+		Currency:        inv.Currency,
+		Status:          CreditAvailable,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}, nil
+}
+
+// ApplyTo settles as much of the invoice as the credit allows and returns the amount used
+func (c *Credit) ApplyTo(inv *Invoice) (payment.Money, error) {
+	if c.Status != CreditAvailable || c.Remaining <= 0 {
+		return 0, fmt.Errorf("credit %d has no remaining balance", c.ID)
+	}
+	if inv.TenantID != c.TenantID {
+		return 0, fmt.Errorf("credit %d belongs to another tenant", c.ID)
+	}
+	if inv.ID == c.SourceInvoiceID {
+		return 0, fmt.Errorf("credit %d cannot be applied to the invoice it came from", c.ID)
+	}
+
+	used, err := inv.ApplyCredit(c.Remaining, c.Currency)
+	if err != nil {
+		return 0, err
+	}
+
+	c.Remaining -= used
+	if c.Remaining == 0 {
+		c.Status = CreditConsumed
+	}
+	c.UpdatedAt = time.Now()
+	return used, nil
+}
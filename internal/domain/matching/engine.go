@@ -0,0 +1,160 @@
+package matching
+
+import (
+	"math"
+	"sort"
+
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/domain/payment"
+)
+
+// Method describes how a candidate invoice was found
+type Method string
+
+const (
+	MethodExact       Method = "exact"        // reference identical after trimming and case folding
+	MethodNormalized  Method = "normalized"   // identical after the tenant's normalizers
+	MethodFuzzy       Method = "fuzzy"        // within the edit-distance tolerance
+	MethodAmountPhone Method = "amount_phone" // no reference match; same payer phone and exact amount
+)
+
+// Confidence scores per method; bonuses are added for corroborating evidence
+const (
+	confidenceExact        = 1.0
+	confidenceNormalized   = 0.95
+	confidenceFuzzyBase    = 0.95
+	confidenceFuzzyPerEdit = 0.15
+	confidenceAmountPhone  = 0.7
+	bonusExactAmount       = 0.1
+	bonusSamePhone         = 0.05
+	maxInexactConfidence   = 0.99
+	ambiguityMargin        = 0.05
+)
+
+// Payment is the information about an incoming payment used for matching
+type Payment struct {
+	Reference  string
+	Amount     payment.Money
+	MSISDNHash string
+}
+
+// Result is the best invoice found for a payment
+type Result struct {
+	Invoice    *invoice.Invoice
+	Confidence float64
+	Method     Method
+	Distance   int
+	Ambiguous  bool // another invoice scored almost as well
+}
+
+// Decision is what should happen with a payment given a result
+type Decision string
+
+const (
+	DecisionAutoMatch Decision = "auto_match"
+	DecisionReview    Decision = "review"
+	DecisionNoMatch   Decision = "no_match"
+)
+
+// Decide turns a result into an action according to the thresholds
+func (r *Rules) Decide(result *Result) Decision {
+	if result == nil || result.Confidence < r.ReviewThreshold {
+		return DecisionNoMatch
+	}
+	if result.Confidence >= r.AutoMatchThreshold && !result.Ambiguous {
+		return DecisionAutoMatch
+	}
+	return DecisionReview
+}
+
+// BestMatch scores every payable invoice and returns the strongest candidate, or nil
+func (r *Rules) BestMatch(p Payment, invoices []*invoice.Invoice) *Result {
+	var results []*Result
+	for _, inv := range invoices {
+		if !inv.AcceptsPayments() {
+			continue
+		}
+		if result := r.score(p, inv); result != nil {
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Confidence > results[j].Confidence
+	})
+
+	best := results[0]
+	if len(results) > 1 && best.Confidence < confidenceExact && best.Confidence-results[1].Confidence < ambiguityMargin {
+		best.Ambiguous = true
+	}
+	return best
+}
+
+// score rates how likely it is that the payment was meant for the invoice
+func (r *Rules) score(p Payment, inv *invoice.Invoice) *Result {
+	if invoice.NormalizeReference(p.Reference) != "" && invoice.NormalizeReference(p.Reference) == inv.Reference {
+		return &Result{Invoice: inv, Confidence: confidenceExact, Method: MethodExact}
+	}
+
+	sameAmount := p.Amount > 0 && p.Amount == inv.Outstanding()
+	samePhone := p.MSISDNHash != "" && p.MSISDNHash == inv.CustomerMSISDNHash
+
+	var result *Result
+	paymentRef, invoiceRef := r.Normalize(p.Reference), r.Normalize(inv.Reference)
+	if paymentRef != "" && invoiceRef != "" {
+		if paymentRef == invoiceRef {
+			result = &Result{Invoice: inv, Confidence: confidenceNormalized, Method: MethodNormalized}
+		} else if d := levenshtein(paymentRef, invoiceRef); d <= r.MaxEditDistance && len([]rune(invoiceRef)) > 3*d {
+			// Short references need proportionally fewer edits to collide, hence the length guard
+			result = &Result{
+				Invoice:    inv,
+				Confidence: confidenceFuzzyBase - confidenceFuzzyPerEdit*float64(d),
+				Method:     MethodFuzzy,
+				Distance:   d,
+			}
+		}
+	}
+
+	if result == nil {
+		if r.AmountPhoneFallback && sameAmount && samePhone {
+			return &Result{Invoice: inv, Confidence: confidenceAmountPhone, Method: MethodAmountPhone}
+		}
+		return nil
+	}
+
+	if sameAmount {
+		result.Confidence += bonusExactAmount
+	}
+	if samePhone {
+		result.Confidence += bonusSamePhone
+	}
+	// Round so that sums like 0.8+0.1 compare equal to a 0.9 threshold
+	result.Confidence = math.Min(math.Round(result.Confidence*100)/100, maxInexactConfidence)
+	return result
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,72 @@
+package matching
+
+import (
+	"fmt"
+	"time"
+)
+
+// Review is a low-confidence or ambiguous match waiting for a person to confirm it
+type Review struct {
+	ID         int64
+	TenantID   int64
+	PaymentID  int64
+	InvoiceID  int64 // suggested invoice
+	Confidence float64
+	Method     Method
+	Ambiguous  bool
+	Status     ReviewStatus
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
+}
+
+// ReviewStatus represents review status
+type ReviewStatus string
+
+const (
+	ReviewPending    ReviewStatus = "pending"
+	ReviewAccepted   ReviewStatus = "accepted"
+	ReviewRejected   ReviewStatus = "rejected"
+	ReviewSuperseded ReviewStatus = "superseded" // the payment was reconciled manually instead
+)
+
+// NewReview queues a suggested match for review
+func NewReview(tenantID, paymentID int64, result *Result) (*Review, error) {
+	if result == nil || result.Invoice == nil {
+		return nil, fmt.Errorf("a suggested invoice is required")
+	}
+	if tenantID <= 0 || paymentID <= 0 {
+		return nil, fmt.Errorf("invalid tenant or payment ID")
+	}
+
+	return &Review{
+		TenantID:   tenantID,
+		PaymentID:  paymentID,
+		InvoiceID:  result.Invoice.ID,
+		Confidence: result.Confidence,
+		Method:     result.Method,
+		Ambiguous:  result.Ambiguous,
+		Status:     ReviewPending,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// Accept confirms the suggested match
+func (r *Review) Accept() error {
+	return r.resolve(ReviewAccepted)
+}
+
+// Reject dismisses the suggested match
+func (r *Review) Reject() error {
+	return r.resolve(ReviewRejected)
+}
+
+// resolve moves a pending review to its final status
+func (r *Review) resolve(status ReviewStatus) error {
+	if r.Status != ReviewPending {
+		return fmt.Errorf("review %d is already %s", r.ID, r.Status)
+	}
+	now := time.Now()
+	r.Status = status
+	r.ResolvedAt = &now
+	return nil
+}
@@ -0,0 +1,128 @@
+package matching
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rules configures how loosely payment references are matched to invoices.
+// A tenant has one default rule set and may override it per provider credential.
+type Rules struct {
+	ID                  int64
+	TenantID            int64
+	CredentialID        *int64 // nil for the tenant default
+	Normalizers         []Normalizer
+	MaxEditDistance     int
+	AmountPhoneFallback bool
+	AutoMatchThreshold  float64 // at or above: applied automatically
+	ReviewThreshold     float64 // at or above (but below auto): queued for review
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// Normalizer is a named reference normalization step
+type Normalizer string
+
+const (
+	NormalizeUppercase        Normalizer = "uppercase"         // inv-1 -> INV-1
+	NormalizeStripSpaces      Normalizer = "strip_spaces"      // INV 1 -> INV1
+	NormalizeStripPunctuation Normalizer = "strip_punctuation" // INV-1 -> INV1
+	NormalizeConfusables      Normalizer = "confusables"       // O->0, I/L->1 so INVO1 ~ INV01
+	NormalizeStripLeadingZero Normalizer = "strip_leading_zeros"
+)
+
+var knownNormalizers = map[Normalizer]bool{
+	NormalizeUppercase:        true,
+	NormalizeStripSpaces:      true,
+	NormalizeStripPunctuation: true,
+	NormalizeConfusables:      true,
+	NormalizeStripLeadingZero: true,
+}
+
+// DefaultRules returns the rules used when a tenant has not configured any
+func DefaultRules(tenantID int64) *Rules {
+	return &Rules{
+		TenantID: tenantID,
+		Normalizers: []Normalizer{
+			NormalizeUppercase,
+			NormalizeStripSpaces,
+			NormalizeStripPunctuation,
+		},
+		MaxEditDistance:     1,
+		AmountPhoneFallback: false,
+		AutoMatchThreshold:  0.9,
+		ReviewThreshold:     0.5,
+	}
+}
+
+// Touch stamps the rule set as updated now
+func (r *Rules) Touch() *Rules {
+	now := time.Now()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = now
+	}
+	r.UpdatedAt = now
+	return r
+}
+
+// Validate validates a rule set
+func (r *Rules) Validate() error {
+	if r.TenantID <= 0 {
+		return fmt.Errorf("invalid tenant ID: %d", r.TenantID)
+	}
+	for _, n := range r.Normalizers {
+		if !knownNormalizers[n] {
+			return fmt.Errorf("unknown normalizer: %s", n)
+		}
+	}
+	if r.MaxEditDistance < 0 || r.MaxEditDistance > 3 {
+		return fmt.Errorf("max edit distance must be between 0 and 3")
+	}
+	if r.AutoMatchThreshold <= 0 || r.AutoMatchThreshold > 1 {
+		return fmt.Errorf("auto match threshold must be in (0, 1]")
+	}
+	if r.ReviewThreshold < 0 || r.ReviewThreshold > r.AutoMatchThreshold {
+		return fmt.Errorf("review threshold must be between 0 and the auto match threshold")
+	}
+	return nil
+}
+
+// Normalize applies the configured normalization steps to a reference
+func (r *Rules) Normalize(reference string) string {
+	out := strings.TrimSpace(reference)
+	for _, n := range r.Normalizers {
+		switch n {
+		case NormalizeUppercase:
+			out = strings.ToUpper(out)
+		case NormalizeStripSpaces:
+			out = strings.Map(func(c rune) rune {
+				if unicode.IsSpace(c) {
+					return -1
+				}
+				return c
+			}, out)
+		case NormalizeStripPunctuation:
+			out = strings.Map(func(c rune) rune {
+				if unicode.IsPunct(c) || unicode.IsSymbol(c) {
+					return -1
+				}
+				return c
+			}, out)
+		case NormalizeConfusables:
+			out = strings.Map(func(c rune) rune {
+				switch c {
+				case 'O', 'o':
+					return '0'
+				case 'I', 'i', 'L', 'l':
+					return '1'
+				}
+				return c
+			}, out)
+		case NormalizeStripLeadingZero:
+			out = strings.TrimLeft(out, "0")
+		}
+	}
+	return out
+}
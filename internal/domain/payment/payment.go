@@ -10,17 +10,25 @@ import (
 
 // Payment represents a financial payment transaction
 type Payment struct {
-	ID         int64
-	TenantID   int64
-	InvoiceNo  string
-	Amount     Money
-	Currency   Currency
-	Status     Status
-	Method     Method
-	ExternalID string
-	MSISDNHash string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	ID                   int64
+	TenantID             int64
+	ProviderCredentialID int64 // credential the payment arrived on; zero if unknown
+	InvoiceNo            string
+	Amount               Money
+	Currency             Currency
+	Status               Status
+	Method               Method
+	ExternalID           string
+	MSISDNHash           string
+	FailureCode          string            // standard provider error code for why the payment did not complete
+	FailureReason        string            // the provider's description of the failure
+	Metadata             map[string]string // the caller's own references, kept from initiation
+	InitiatedBy          string            // who requested an STK push; empty for payments the customer started
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+
+	changes []StatusChange // status changes not yet saved to the history
+	cause   int64          // event the changes are attributed to
 }
 
 // Money represents a monetary amount in smallest currency unit (cents)
@@ -38,10 +46,24 @@ const (
 type Status string
 
 const (
-	StatusPending   Status = "pending"
-	StatusCompleted Status = "completed"
-	StatusFailed    Status = "failed"
-	StatusCancelled Status = "cancelled"
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing" // the provider has the request and awaits the customer
+	StatusCompleted  Status = "completed"
+	StatusFailed     Status = "failed"
+	StatusCancelled  Status = "cancelled"
+	StatusTimedOut   Status = "timed_out" // the customer never answered the prompt
+
+	// Reconciliation outcomes once a completed payment is applied to an invoice
+	StatusMatched       Status = "matched"
+	StatusPartiallyPaid Status = "partially_paid"
+	StatusOverpaid      Status = "overpaid"
+
+	// Flagged by an operator to be returned to the payer instead of matched
+	StatusRefundCandidate Status = "refund_candidate"
+
+	// Returned to the payer through a provider reversal, or refunded once flagged for refund
+	StatusReversed Status = "reversed"
+	StatusRefunded Status = "refunded"
 )
 
 // Method represents payment method
@@ -95,6 +117,7 @@ func NewPayment(tenantID int64, invoice string, amount Money, currency Currency,
 		msisdnHash = msisdn.Hash()
 	}
 	
+	now := time.Now()
 	return &Payment{
 		TenantID:   tenantID,
 		InvoiceNo:  invoice,
@@ -104,8 +127,9 @@ func NewPayment(tenantID int64, invoice string, amount Money, currency Currency,
 		Method:     method,
 		ExternalID: externalID,
 		MSISDNHash: msisdnHash,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		changes:    []StatusChange{{To: StatusPending, CreatedAt: now}},
 	}, nil
 }
 
@@ -115,6 +139,19 @@ func (p *Payment) Update(invoice string, amount Money, status Status, msisdn *MS
 		return err
 	}
 	
+	// Business rule: a provider re-confirming completion must not undo reconciliation or a
+	// reversal, nor replace the invoice and amount the payment was settled with
+	if status == StatusCompleted && p.IsSettled() {
+		return nil
+	}
+	
+	// Check the status change before touching any field, so a refused update changes nothing
+	if status != "" && status != p.Status {
+		if err := p.transition(status); err != nil {
+			return err
+		}
+	}
+	
 	// Business rule: Only update non-empty values
 	if invoice != "" {
 		p.InvoiceNo = invoice
@@ -124,10 +161,6 @@ func (p *Payment) Update(invoice string, amount Money, status Status, msisdn *MS
 		p.Amount = amount
 	}
 	
-	if status != "" {
-		p.Status = status
-	}
-	
 	if msisdn != nil {
 		p.MSISDNHash = msisdn.Hash()
 	}
@@ -136,14 +169,112 @@ func (p *Payment) Update(invoice string, amount Money, status Status, msisdn *MS
 	return nil
 }
 
+// Initiated copies what was known when an STK push was sent onto a payment its callback
+// created first, keeping whatever the callback already reported
+func (p *Payment) Initiated(initiation *Payment) {
+	if p.InvoiceNo == "" {
+		p.InvoiceNo = initiation.InvoiceNo
+	}
+	if p.MSISDNHash == "" {
+		p.MSISDNHash = initiation.MSISDNHash
+	}
+	if p.ProviderCredentialID == 0 {
+		p.ProviderCredentialID = initiation.ProviderCredentialID
+	}
+	p.Metadata = initiation.Metadata
+	p.InitiatedBy = initiation.InitiatedBy
+	p.UpdatedAt = time.Now()
+}
+
+// RecordFailure notes why a payment did not complete; it is cleared if the payment later completes
+func (p *Payment) RecordFailure(code, reason string) {
+	if p.CanBeUpdated() || p.Status == StatusCompleted || p.IsReconciled() {
+		p.FailureCode = ""
+		p.FailureReason = ""
+		return
+	}
+	p.FailureCode = code
+	p.FailureReason = reason
+}
+
 // IsCompleted checks if payment is in completed state
 func (p *Payment) IsCompleted() bool {
 	return p.Status == StatusCompleted
 }
 
+// IsReconciled checks if payment has been applied to an invoice
+func (p *Payment) IsReconciled() bool {
+	return p.Status == StatusMatched || p.Status == StatusPartiallyPaid || p.Status == StatusOverpaid
+}
+
+// IsSettled checks if a completed payment has since been reconciled, flagged for refund
+// or returned to the payer
+func (p *Payment) IsSettled() bool {
+	return p.IsReconciled() || p.Status == StatusRefundCandidate || p.Status == StatusReversed || p.Status == StatusRefunded
+}
+
+// MarkReconciled records the outcome of applying a completed payment to an invoice
+func (p *Payment) MarkReconciled(status Status, invoiceRef string) error {
+	if status != StatusMatched && status != StatusPartiallyPaid && status != StatusOverpaid {
+		return fmt.Errorf("invalid reconciliation status: %s", status)
+	}
+	if err := p.transition(status); err != nil {
+		return err
+	}
+
+	p.InvoiceNo = invoiceRef
+	return nil
+}
+
+// MarkRefundCandidate flags a completed, unmatched payment to be refunded
+func (p *Payment) MarkRefundCandidate() error {
+	return p.transition(StatusRefundCandidate)
+}
+
+// IsReversible checks if the payment can be returned to the payer; reconciled payments
+// must be unmatched or flagged for refund first
+func (p *Payment) IsReversible() bool {
+	return p.Status == StatusCompleted || p.Status == StatusRefundCandidate
+}
+
+// MarkReversed records that the provider returned the payment to the payer; a payment
+// flagged for refund is refunded
+func (p *Payment) MarkReversed() error {
+	if p.Status == StatusRefundCandidate {
+		return p.transition(StatusRefunded)
+	}
+	return p.transition(StatusReversed)
+}
+
 // CanBeUpdated checks if payment can be modified
 func (p *Payment) CanBeUpdated() bool {
-	return p.Status == StatusPending
+	return p.Status == StatusPending || p.Status == StatusProcessing
+}
+
+// Metadata limits keep the caller's references small enough to store with every payment
+const (
+	MaxMetadataKeys   = 20
+	MaxMetadataKeyLen = 40
+	MaxMetadataValLen = 500
+)
+
+// ValidateMetadata validates the caller's metadata for a payment
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataKeys {
+		return fmt.Errorf("metadata cannot have more than %d keys", MaxMetadataKeys)
+	}
+	for key, value := range metadata {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("metadata keys cannot be empty")
+		}
+		if len(key) > MaxMetadataKeyLen {
+			return fmt.Errorf("metadata key %q is longer than %d characters", key, MaxMetadataKeyLen)
+		}
+		if len(value) > MaxMetadataValLen {
+			return fmt.Errorf("metadata value for %q is longer than %d characters", key, MaxMetadataValLen)
+		}
+	}
+	return nil
 }
 
 // validatePaymentCreation validates payment creation
@@ -165,8 +296,9 @@ func validatePaymentCreation(tenantID int64, amount Money, externalID string) er
 
 // validateUpdate validates payment update
 func (p *Payment) validateUpdate(amount Money, status Status) error {
-	if !p.CanBeUpdated() && status != StatusCompleted && status != StatusFailed {
-		return fmt.Errorf("payment %d cannot be updated in status %s", p.ID, p.Status)
+	// Status changes are checked against the state machine as they are applied
+	if !p.CanBeUpdated() && status == "" {
+		return DomainError{Code: ErrPaymentReadOnly, Message: fmt.Sprintf("payment %d cannot be updated in status %s", p.ID, p.Status)}
 	}
 	
 	if amount < 0 {
@@ -188,8 +320,9 @@ func (e DomainError) Error() string {
 
 // Domain error codes
 const (
-	ErrInvalidAmount    = "INVALID_AMOUNT"
-	ErrInvalidStatus    = "INVALID_STATUS"
-	ErrInvalidTenant    = "INVALID_TENANT"
-	ErrPaymentReadOnly  = "PAYMENT_READ_ONLY"
+	ErrInvalidAmount     = "INVALID_AMOUNT"
+	ErrInvalidStatus     = "INVALID_STATUS"
+	ErrInvalidTenant     = "INVALID_TENANT"
+	ErrPaymentReadOnly   = "PAYMENT_READ_ONLY"
+	ErrInvalidTransition = "INVALID_TRANSITION"
 )
\ No newline at end of file
@@ -0,0 +1,124 @@
+package payment
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Reversal returns a completed payment to the payer through the provider
+type Reversal struct {
+	ID                       int64
+	TenantID                 int64
+	PaymentID                int64
+	ProviderCredentialID     int64
+	TransactionID            string // provider receipt of the payment being reversed
+	ExternalID               string // provider conversation ID, set once the provider accepts the request
+	OriginatorConversationID string
+	Amount                   Money
+	Remarks                  string
+	RequestedBy              string
+	Status                   ReversalStatus
+	ResultDesc               string
+	ReceiptNumber            string // provider receipt of the reversal itself
+	CreatedAt                time.Time
+	UpdatedAt                time.Time
+	CompletedAt              *time.Time
+}
+
+// ReversalStatus represents reversal status
+type ReversalStatus string
+
+const (
+	ReversalPending   ReversalStatus = "pending"   // accepted by the provider and awaiting its result
+	ReversalCompleted ReversalStatus = "completed" // the money went back to the payer
+	ReversalFailed    ReversalStatus = "failed"    // refused by the provider or by the result callback
+	ReversalTimedOut  ReversalStatus = "timed_out" // the provider's queue timed out; a late result may still arrive
+)
+
+// receiptPattern matches M-Pesa receipt numbers such as "QGR7I1F3XL"
+var receiptPattern = regexp.MustCompile(`^[A-Z0-9]{10}$`)
+
+// IsReceiptNumber reports whether the value looks like a provider receipt that can be reversed
+func IsReceiptNumber(value string) bool {
+	return receiptPattern.MatchString(value)
+}
+
+// NewReversal creates a pending reversal of the full payment amount
+func NewReversal(p *Payment, credentialID int64, transactionID, remarks, requestedBy string) (*Reversal, error) {
+	if !p.IsReversible() {
+		return nil, fmt.Errorf("payment %d cannot be reversed in status %s", p.ID, p.Status)
+	}
+	if credentialID <= 0 {
+		return nil, fmt.Errorf("invalid credential ID: %d", credentialID)
+	}
+	transactionID = strings.ToUpper(strings.TrimSpace(transactionID))
+	if !IsReceiptNumber(transactionID) {
+		return nil, fmt.Errorf("invalid transaction ID: %q", transactionID)
+	}
+	requestedBy = strings.TrimSpace(requestedBy)
+	if requestedBy == "" {
+		return nil, fmt.Errorf("requester is required")
+	}
+
+	now := time.Now()
+	return &Reversal{
+		TenantID:             p.TenantID,
+		PaymentID:            p.ID,
+		ProviderCredentialID: credentialID,
+		TransactionID:        transactionID,
+		Amount:               p.Amount,
+		Remarks:              strings.TrimSpace(remarks),
+		RequestedBy:          requestedBy,
+		Status:               ReversalPending,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}, nil
+}
+
+// Accept records the identifiers the provider assigned when it queued the reversal
+func (r *Reversal) Accept(conversationID, originatorConversationID, desc string) error {
+	if strings.TrimSpace(conversationID) == "" {
+		return fmt.Errorf("conversation ID is required")
+	}
+	r.ExternalID = conversationID
+	r.OriginatorConversationID = originatorConversationID
+	r.ResultDesc = desc
+	r.UpdatedAt = time.Now()
+	return nil
+}
+
+// ApplyResult records the provider's final result; it returns false if the reversal was already settled
+func (r *Reversal) ApplyResult(succeeded bool, receipt, desc string) bool {
+	if r.IsFinal() {
+		return false
+	}
+
+	now := time.Now()
+	r.Status = ReversalFailed
+	if succeeded {
+		r.Status = ReversalCompleted
+		r.ReceiptNumber = receipt
+	}
+	r.ResultDesc = desc
+	r.UpdatedAt = now
+	r.CompletedAt = &now
+	return true
+}
+
+// TimeOut marks a pending reversal whose result did not arrive in time; it returns false otherwise
+func (r *Reversal) TimeOut(desc string) bool {
+	if r.Status != ReversalPending {
+		return false
+	}
+	r.Status = ReversalTimedOut
+	r.ResultDesc = desc
+	r.UpdatedAt = time.Now()
+	return true
+}
+
+// IsFinal reports whether the reversal has a definitive result
+func (r *Reversal) IsFinal() bool {
+	return r.Status == ReversalCompleted || r.Status == ReversalFailed
+}
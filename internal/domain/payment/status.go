@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"fmt"
+	"time"
+)
+
+// transitions lists the statuses a payment may move to from each status. Statuses with no
+// entry are final.
+var transitions = map[Status][]Status{
+	StatusPending:    {StatusProcessing, StatusCompleted, StatusFailed, StatusCancelled, StatusTimedOut},
+	StatusProcessing: {StatusCompleted, StatusFailed, StatusCancelled, StatusTimedOut},
+
+	// A provider may still confirm a payment after reporting it failed, or after we gave up on it
+	StatusFailed:    {StatusCompleted},
+	StatusCancelled: {StatusCompleted},
+	StatusTimedOut:  {StatusCompleted},
+
+	StatusCompleted:       {StatusMatched, StatusPartiallyPaid, StatusOverpaid, StatusRefundCandidate, StatusReversed},
+	StatusRefundCandidate: {StatusMatched, StatusPartiallyPaid, StatusOverpaid, StatusRefunded},
+}
+
+// CanTransitionTo reports whether a payment in this status may move to the next one
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChange is one entry in a payment's status history
+type StatusChange struct {
+	ID        int64
+	TenantID  int64
+	PaymentID int64
+	From      Status // empty for the status the payment was created with
+	To        Status
+	EventID   int64 // event that caused the change; zero for operator actions and sweeps
+	CreatedAt time.Time
+}
+
+// CausedBy attributes the payment's unsaved status changes, and those made from now on,
+// to the event
+func (p *Payment) CausedBy(eventID int64) *Payment {
+	p.cause = eventID
+	for i := range p.changes {
+		if p.changes[i].EventID == 0 {
+			p.changes[i].EventID = eventID
+		}
+	}
+	return p
+}
+
+// StatusChanges returns the status changes made since the payment was last saved
+func (p *Payment) StatusChanges() []StatusChange {
+	changes := make([]StatusChange, len(p.changes))
+	for i, change := range p.changes {
+		change.TenantID = p.TenantID
+		change.PaymentID = p.ID
+		changes[i] = change
+	}
+	return changes
+}
+
+// ClearStatusChanges forgets the status changes once they have been saved
+func (p *Payment) ClearStatusChanges() {
+	p.changes = nil
+}
+
+// transition moves the payment to the next status, rejecting moves the state machine
+// does not allow
+func (p *Payment) transition(next Status) error {
+	if !p.Status.CanTransitionTo(next) {
+		return DomainError{
+			Code:    ErrInvalidTransition,
+			Message: fmt.Sprintf("payment %d cannot move from %s to %s", p.ID, p.Status, next),
+		}
+	}
+
+	now := time.Now()
+	p.changes = append(p.changes, StatusChange{From: p.Status, To: next, EventID: p.cause, CreatedAt: now})
+	p.Status = next
+	p.UpdatedAt = now
+	return nil
+}
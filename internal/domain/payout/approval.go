@@ -0,0 +1,261 @@
+package payout
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/payment"
+)
+
+// ApprovalPolicy decides how many approvals a tenant's outgoing money needs before it is sent
+type ApprovalPolicy struct {
+	TenantID    int64
+	Tiers       []ApprovalTier // ascending by MinAmount; amounts below the first tier need no approval
+	ExpiryHours int            // pending approvals lapse after this long
+	UpdatedAt   time.Time
+}
+
+// ApprovalTier requires a number of distinct approvers at or above an amount
+type ApprovalTier struct {
+	MinAmount payment.Money
+	Approvals int
+}
+
+// MaxApprovals bounds how many approvers a single tier can demand
+const MaxApprovals = 5
+
+// DefaultApprovalPolicy requires one approval for every payout; tenants relax it explicitly
+func DefaultApprovalPolicy(tenantID int64) *ApprovalPolicy {
+	return &ApprovalPolicy{
+		TenantID:    tenantID,
+		Tiers:       []ApprovalTier{{MinAmount: 1, Approvals: 1}},
+		ExpiryHours: 24,
+	}
+}
+
+// Validate validates a policy
+func (p *ApprovalPolicy) Validate() error {
+	if p.TenantID <= 0 {
+		return fmt.Errorf("invalid tenant ID: %d", p.TenantID)
+	}
+	if p.ExpiryHours < 1 || p.ExpiryHours > 720 {
+		return fmt.Errorf("expiry must be between 1 and 720 hours")
+	}
+	for i, tier := range p.Tiers {
+		if tier.MinAmount < 0 {
+			return fmt.Errorf("tier %d: min amount cannot be negative", i+1)
+		}
+		if tier.Approvals < 1 || tier.Approvals > MaxApprovals {
+			return fmt.Errorf("tier %d: approvals must be between 1 and %d", i+1, MaxApprovals)
+		}
+		if i > 0 && tier.MinAmount <= p.Tiers[i-1].MinAmount {
+			return fmt.Errorf("tier %d: min amounts must be ascending", i+1)
+		}
+		if i > 0 && tier.Approvals < p.Tiers[i-1].Approvals {
+			return fmt.Errorf("tier %d: a larger amount cannot need fewer approvals", i+1)
+		}
+	}
+	return nil
+}
+
+// Required returns how many approvals the amount needs; zero means it may be sent straight away
+func (p *ApprovalPolicy) Required(amount payment.Money) int {
+	required := 0
+	for _, tier := range p.Tiers {
+		if amount >= tier.MinAmount {
+			required = tier.Approvals
+		}
+	}
+	return required
+}
+
+// Touch stamps the policy as updated now
+func (p *ApprovalPolicy) Touch() *ApprovalPolicy {
+	p.UpdatedAt = time.Now()
+	return p
+}
+
+// Approval collects the sign-offs a payout or batch needs before it reaches the provider
+type Approval struct {
+	ID          int64
+	TenantID    int64
+	Subject     Subject
+	SubjectID   int64
+	Amount      payment.Money
+	Required    int
+	RequestedBy string
+	ApprovedBy  []string
+	Status      ApprovalStatus
+	Reason      string // why the approval was rejected or cancelled
+	ExpiresAt   time.Time
+	DecidedAt   *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Subject is the kind of money movement an approval releases
+type Subject string
+
+const (
+	SubjectPayout Subject = "payout"
+	SubjectBatch  Subject = "batch"
+)
+
+// ApprovalStatus represents approval status
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"
+	ApprovalApproved  ApprovalStatus = "approved"  // enough distinct approvers signed off; the money is released
+	ApprovalRejected  ApprovalStatus = "rejected"  // an approver turned it down
+	ApprovalExpired   ApprovalStatus = "expired"   // not approved in time
+	ApprovalCancelled ApprovalStatus = "cancelled" // the payout or batch was withdrawn
+)
+
+// NewApproval opens an approval for a payout or batch under the tenant's policy
+func NewApproval(policy *ApprovalPolicy, subject Subject, subjectID int64, amount payment.Money, requestedBy string) (*Approval, error) {
+	if subjectID <= 0 {
+		return nil, fmt.Errorf("invalid %s ID: %d", subject, subjectID)
+	}
+	requestedBy = strings.TrimSpace(requestedBy)
+	if requestedBy == "" {
+		return nil, fmt.Errorf("requester is required")
+	}
+	required := policy.Required(amount)
+	if required == 0 {
+		return nil, fmt.Errorf("amount %d does not need approval", amount)
+	}
+
+	now := time.Now()
+	return &Approval{
+		TenantID:    policy.TenantID,
+		Subject:     subject,
+		SubjectID:   subjectID,
+		Amount:      amount,
+		Required:    required,
+		RequestedBy: requestedBy,
+		Status:      ApprovalPending,
+		ExpiresAt:   now.Add(time.Duration(policy.ExpiryHours) * time.Hour),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// Approve records an approver's sign-off; it returns true once the approval is complete.
+// The requester cannot approve their own request, and nobody can approve twice.
+func (a *Approval) Approve(actor string) (bool, error) {
+	actor = strings.TrimSpace(actor)
+	if a.Status != ApprovalPending {
+		return false, fmt.Errorf("approval is already %s", a.Status)
+	}
+	if a.IsExpired(time.Now()) {
+		return false, fmt.Errorf("approval expired at %s", a.ExpiresAt.Format(time.RFC3339))
+	}
+	if actor == "" {
+		return false, fmt.Errorf("approver is required")
+	}
+	if actor == a.RequestedBy {
+		return false, fmt.Errorf("approver must be a different user than the requester")
+	}
+	for _, approver := range a.ApprovedBy {
+		if approver == actor {
+			return false, fmt.Errorf("%s has already approved", actor)
+		}
+	}
+
+	now := time.Now()
+	a.ApprovedBy = append(a.ApprovedBy, actor)
+	a.UpdatedAt = now
+	if len(a.ApprovedBy) < a.Required {
+		return false, nil
+	}
+	a.Status = ApprovalApproved
+	a.DecidedAt = &now
+	return true, nil
+}
+
+// Reject turns the request down; any user, including the requester, may reject
+func (a *Approval) Reject(actor, reason string) error {
+	if a.Status != ApprovalPending {
+		return fmt.Errorf("approval is already %s", a.Status)
+	}
+	if strings.TrimSpace(actor) == "" {
+		return fmt.Errorf("approver is required")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	a.close(ApprovalRejected, reason)
+	return nil
+}
+
+// Expire closes a pending approval whose deadline has passed; it returns false otherwise
+func (a *Approval) Expire(now time.Time) bool {
+	if a.Status != ApprovalPending || !a.IsExpired(now) {
+		return false
+	}
+	a.close(ApprovalExpired, "not approved before "+a.ExpiresAt.Format(time.RFC3339))
+	return true
+}
+
+// Cancel closes a pending approval whose payout or batch was withdrawn; it returns false otherwise
+func (a *Approval) Cancel(reason string) bool {
+	if a.Status != ApprovalPending {
+		return false
+	}
+	a.close(ApprovalCancelled, reason)
+	return true
+}
+
+// IsExpired reports whether the approval deadline has passed
+func (a *Approval) IsExpired(now time.Time) bool {
+	return !now.Before(a.ExpiresAt)
+}
+
+func (a *Approval) close(status ApprovalStatus, reason string) {
+	now := time.Now()
+	a.Status = status
+	a.Reason = reason
+	a.UpdatedAt = now
+	a.DecidedAt = &now
+}
+
+// ApprovalAction is an entry type in the approval audit trail
+type ApprovalAction string
+
+const (
+	ActionRequested ApprovalAction = "requested"
+	ActionApproved  ApprovalAction = "approved"
+	ActionRejected  ApprovalAction = "rejected"
+	ActionExpired   ApprovalAction = "expired"
+	ActionCancelled ApprovalAction = "cancelled"
+	ActionReleased  ApprovalAction = "released" // the approved money was handed to the provider
+)
+
+// SystemActor records actions taken by the service itself, such as expiry
+const SystemActor = "system"
+
+// ApprovalAuditEntry records who did what to an approval and why
+type ApprovalAuditEntry struct {
+	ID         int64
+	ApprovalID int64
+	TenantID   int64
+	Action     ApprovalAction
+	Actor      string
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// NewApprovalAuditEntry creates an audit entry for an approval
+func NewApprovalAuditEntry(a *Approval, action ApprovalAction, actor, reason string) *ApprovalAuditEntry {
+	return &ApprovalAuditEntry{
+		ApprovalID: a.ID,
+		TenantID:   a.TenantID,
+		Action:     action,
+		Actor:      actor,
+		Reason:     strings.TrimSpace(reason),
+		CreatedAt:  time.Now(),
+	}
+}
@@ -0,0 +1,222 @@
+package payout
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/payment"
+)
+
+// MaxBatchItems bounds the size of a single payout batch
+const MaxBatchItems = 5000
+
+// Batch is a list of payouts submitted together and sent one B2C call at a time
+type Batch struct {
+	ID                   int64
+	TenantID             int64
+	ProviderCredentialID int64
+	Reference            string // tenant's own batch identifier, unique per tenant
+	CommandID            string
+	Status               BatchStatus
+	ItemCount            int
+	TotalAmount          payment.Money
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	CompletedAt          *time.Time
+}
+
+// BatchStatus represents batch status
+type BatchStatus string
+
+const (
+	BatchAwaitingApproval BatchStatus = "awaiting_approval" // held until enough approvers sign off
+	BatchProcessing       BatchStatus = "processing"        // items are being sent
+	BatchCompleted        BatchStatus = "completed"         // every item was submitted, rejected or cancelled
+	BatchCancelled        BatchStatus = "cancelled"         // unsent items were withdrawn
+)
+
+// BatchItem is one payout within a batch
+type BatchItem struct {
+	ID          int64
+	BatchID     int64
+	TenantID    int64
+	Line        int    // position in the uploaded batch, starting at 1
+	PhoneEnc    string // encrypted; the number must survive a restart to be sent
+	MSISDNHash  string
+	Amount      payment.Money
+	Reference   string
+	Description string
+	Status      ItemStatus
+	PayoutID    *int64
+	Error       string
+	Attempts    int
+	SendingAt   *time.Time
+	UpdatedAt   time.Time
+
+	// Loaded from the linked payout for reporting
+	PayoutStatus  Status
+	ReceiptNumber string
+}
+
+// ItemStatus represents how far an item got towards the provider
+type ItemStatus string
+
+const (
+	ItemQueued    ItemStatus = "queued"
+	ItemSending   ItemStatus = "sending"   // claimed by a worker; the B2C call is in flight
+	ItemSubmitted ItemStatus = "submitted" // accepted by the provider; the payout carries the result
+	ItemRejected  ItemStatus = "rejected"  // the provider refused the request
+	ItemUnknown   ItemStatus = "unknown"   // interrupted mid-call; may or may not have been paid
+	ItemCancelled ItemStatus = "cancelled"
+)
+
+// NewBatch creates a batch that starts processing as soon as it is saved
+func NewBatch(tenantID, credentialID int64, reference, commandID string) (*Batch, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+	if credentialID <= 0 {
+		return nil, fmt.Errorf("invalid credential ID: %d", credentialID)
+	}
+	reference = strings.TrimSpace(reference)
+	if len(reference) > 64 {
+		return nil, fmt.Errorf("reference must be at most 64 characters")
+	}
+
+	now := time.Now()
+	return &Batch{
+		TenantID:             tenantID,
+		ProviderCredentialID: credentialID,
+		Reference:            reference,
+		CommandID:            commandID,
+		Status:               BatchProcessing,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}, nil
+}
+
+// AddItem appends a payout to the batch; phoneEnc is the encrypted phone number
+func (b *Batch) AddItem(msisdn *payment.MSISDN, phoneEnc string, amount payment.Money, reference, description string) (*BatchItem, error) {
+	if b.ItemCount >= MaxBatchItems {
+		return nil, fmt.Errorf("a batch holds at most %d items", MaxBatchItems)
+	}
+	if msisdn == nil || phoneEnc == "" {
+		return nil, fmt.Errorf("phone number is required")
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive: %d", amount)
+	}
+
+	b.ItemCount++
+	b.TotalAmount += amount
+	return &BatchItem{
+		TenantID:    b.TenantID,
+		Line:        b.ItemCount,
+		PhoneEnc:    phoneEnc,
+		MSISDNHash:  msisdn.Hash(),
+		Amount:      amount,
+		Reference:   strings.TrimSpace(reference),
+		Description: strings.TrimSpace(description),
+		Status:      ItemQueued,
+		UpdatedAt:   b.CreatedAt,
+	}, nil
+}
+
+// AwaitApproval holds a new batch so the runner does not send it until it is approved
+func (b *Batch) AwaitApproval() error {
+	if b.ID != 0 || b.Status != BatchProcessing {
+		return fmt.Errorf("only a new batch can await approval")
+	}
+	b.Status = BatchAwaitingApproval
+	b.UpdatedAt = time.Now()
+	return nil
+}
+
+// Release starts sending an approved batch
+func (b *Batch) Release() error {
+	if b.Status != BatchAwaitingApproval {
+		return fmt.Errorf("batch in status %s is not awaiting approval", b.Status)
+	}
+	b.Status = BatchProcessing
+	b.UpdatedAt = time.Now()
+	return nil
+}
+
+// Cancel withdraws a batch that has not finished; items already sent are unaffected
+func (b *Batch) Cancel() error {
+	if b.Status != BatchProcessing && b.Status != BatchAwaitingApproval {
+		return fmt.Errorf("batch in status %s cannot be cancelled", b.Status)
+	}
+	now := time.Now()
+	b.Status = BatchCancelled
+	b.UpdatedAt = now
+	b.CompletedAt = &now
+	return nil
+}
+
+// Resume puts a finished batch back into processing so requeued items are sent
+func (b *Batch) Resume() error {
+	if b.Status == BatchCancelled || b.Status == BatchAwaitingApproval {
+		return fmt.Errorf("batch in status %s cannot be resumed", b.Status)
+	}
+	b.Status = BatchProcessing
+	b.UpdatedAt = time.Now()
+	b.CompletedAt = nil
+	return nil
+}
+
+// Submitted records the payout the provider accepted for the item
+func (i *BatchItem) Submitted(payoutID int64) {
+	i.Status = ItemSubmitted
+	i.PayoutID = &payoutID
+	i.Error = ""
+	i.UpdatedAt = time.Now()
+}
+
+// Rejected records why the provider refused the item
+func (i *BatchItem) Rejected(reason string) {
+	i.Status = ItemRejected
+	i.Error = reason
+	i.UpdatedAt = time.Now()
+}
+
+// Interrupted records that the item's call failed in a way that may still have reached the provider
+func (i *BatchItem) Interrupted(reason string) {
+	i.Status = ItemUnknown
+	i.Error = reason
+	i.UpdatedAt = time.Now()
+}
+
+// Release returns a claimed item that was never sent to the queue
+func (i *BatchItem) Release() {
+	i.Status = ItemQueued
+	i.SendingAt = nil
+	i.UpdatedAt = time.Now()
+}
+
+// Outcome is the item's furthest known state: the payout's status once submitted, else the item's own
+func (i *BatchItem) Outcome() string {
+	if i.Status == ItemSubmitted && i.PayoutStatus != "" {
+		return string(i.PayoutStatus)
+	}
+	return string(i.Status)
+}
+
+// Tally is the number and value of items with the same outcome
+type Tally struct {
+	Count  int
+	Amount payment.Money
+}
+
+// Summarize tallies items by outcome
+func Summarize(items []*BatchItem) map[string]Tally {
+	summary := make(map[string]Tally)
+	for _, item := range items {
+		t := summary[item.Outcome()]
+		t.Count++
+		t.Amount += item.Amount
+		summary[item.Outcome()] = t
+	}
+	return summary
+}
@@ -0,0 +1,170 @@
+package payout
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/payment"
+)
+
+// Payout is money sent from a tenant's shortcode to a customer (B2C)
+type Payout struct {
+	ID                       int64
+	TenantID                 int64
+	ProviderCredentialID     int64
+	BatchID                  *int64 // set when the payout was sent as part of a batch
+	ExternalID               string // provider conversation ID, set once the provider accepts the request
+	OriginatorConversationID string
+	Amount                   payment.Money
+	Currency                 payment.Currency
+	MSISDNHash               string
+	PhoneEnc                 string // encrypted; kept only while the payout waits for approval
+	CommandID                string
+	Remarks                  string
+	Occasion                 string
+	Status                   Status
+	ResultDesc               string
+	ReceiptNumber            string
+	ReceiverName             string
+	CreatedAt                time.Time
+	UpdatedAt                time.Time
+	CompletedAt              *time.Time
+}
+
+// Status represents payout status
+type Status string
+
+const (
+	StatusAwaitingApproval Status = "awaiting_approval" // held until enough approvers sign off
+	StatusPending          Status = "pending"           // created, or accepted by the provider and awaiting its result
+	StatusCompleted        Status = "completed"         // the customer received the money
+	StatusFailed           Status = "failed"            // rejected on submission or by the result callback
+	StatusTimedOut         Status = "timed_out"         // the provider's queue timed out; a late result may still arrive
+	StatusCancelled        Status = "cancelled"         // its approval was rejected or expired; never sent
+)
+
+// NewPayout creates a pending payout with validation
+func NewPayout(tenantID, credentialID int64, amount payment.Money, msisdn *payment.MSISDN, commandID, remarks, occasion string) (*Payout, error) {
+	if tenantID <= 0 {
+		return nil, fmt.Errorf("invalid tenant ID: %d", tenantID)
+	}
+	if credentialID <= 0 {
+		return nil, fmt.Errorf("invalid credential ID: %d", credentialID)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive: %d", amount)
+	}
+	if msisdn == nil {
+		return nil, fmt.Errorf("phone number is required")
+	}
+
+	now := time.Now()
+	return &Payout{
+		TenantID:             tenantID,
+		ProviderCredentialID: credentialID,
+		Amount:               amount,
+		Currency:             payment.KES,
+		MSISDNHash:           msisdn.Hash(),
+		CommandID:            commandID,
+		Remarks:              strings.TrimSpace(remarks),
+		Occasion:             strings.TrimSpace(occasion),
+		Status:               StatusPending,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}, nil
+}
+
+// AwaitApproval holds a new payout until it is approved, keeping the encrypted number to send it later
+func (p *Payout) AwaitApproval(phoneEnc string) error {
+	if p.ID != 0 || p.Status != StatusPending {
+		return fmt.Errorf("only a new payout can await approval")
+	}
+	if phoneEnc == "" {
+		return fmt.Errorf("encrypted phone number is required")
+	}
+	p.Status = StatusAwaitingApproval
+	p.PhoneEnc = phoneEnc
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// Release marks an approved payout as ready to send
+func (p *Payout) Release() error {
+	if p.Status != StatusAwaitingApproval {
+		return fmt.Errorf("payout in status %s is not awaiting approval", p.Status)
+	}
+	p.Status = StatusPending
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// Cancel withdraws a payout that was never approved; it returns false otherwise
+func (p *Payout) Cancel(reason string) bool {
+	if p.Status != StatusAwaitingApproval {
+		return false
+	}
+	now := time.Now()
+	p.Status = StatusCancelled
+	p.PhoneEnc = ""
+	p.ResultDesc = reason
+	p.UpdatedAt = now
+	p.CompletedAt = &now
+	return true
+}
+
+// Accept records the identifiers the provider assigned when it queued the payout
+func (p *Payout) Accept(conversationID, originatorConversationID, desc string) error {
+	if strings.TrimSpace(conversationID) == "" {
+		return fmt.Errorf("conversation ID is required")
+	}
+	p.ExternalID = conversationID
+	p.PhoneEnc = ""
+	p.OriginatorConversationID = originatorConversationID
+	p.ResultDesc = desc
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// Reject marks a payout the provider refused to queue
+func (p *Payout) Reject(reason string) {
+	p.Status = StatusFailed
+	p.PhoneEnc = ""
+	p.ResultDesc = reason
+	p.UpdatedAt = time.Now()
+}
+
+// ApplyResult records the provider's final result; it returns false if the payout was already settled
+func (p *Payout) ApplyResult(succeeded bool, receipt, receiverName, desc string) bool {
+	if p.IsFinal() {
+		return false
+	}
+
+	now := time.Now()
+	p.Status = StatusFailed
+	if succeeded {
+		p.Status = StatusCompleted
+		p.ReceiptNumber = receipt
+		p.ReceiverName = receiverName
+	}
+	p.ResultDesc = desc
+	p.UpdatedAt = now
+	p.CompletedAt = &now
+	return true
+}
+
+// TimeOut marks a pending payout whose result did not arrive in time; it returns false otherwise
+func (p *Payout) TimeOut(desc string) bool {
+	if p.Status != StatusPending {
+		return false
+	}
+	p.Status = StatusTimedOut
+	p.ResultDesc = desc
+	p.UpdatedAt = time.Now()
+	return true
+}
+
+// IsFinal reports whether the payout has a definitive result
+func (p *Payout) IsFinal() bool {
+	return p.Status == StatusCompleted || p.Status == StatusFailed || p.Status == StatusCancelled
+}
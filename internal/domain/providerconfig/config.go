@@ -0,0 +1,52 @@
+package providerconfig
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config is an operator's endpoint, timeout and amount limits for one provider in one
+// environment. Zero values leave the provider's built-in default in place.
+type Config struct {
+	ID             int64
+	ProviderType   string
+	Environment    string
+	BaseURL        string
+	TimeoutSeconds int
+	MinAmount      int64
+	MaxAmount      int64
+	Currency       string
+	IsActive       bool
+	UpdatedAt      time.Time
+}
+
+// Validate checks that the config can safely be applied to a provider
+func (c *Config) Validate() error {
+	if strings.TrimSpace(c.ProviderType) == "" {
+		return fmt.Errorf("provider type is required")
+	}
+	if strings.TrimSpace(c.Environment) == "" {
+		return fmt.Errorf("environment is required")
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid base URL: %q", c.BaseURL)
+		}
+	}
+	if c.TimeoutSeconds < 0 || c.TimeoutSeconds > 300 {
+		return fmt.Errorf("timeout must be between 1 and 300 seconds: %d", c.TimeoutSeconds)
+	}
+	if c.MinAmount < 0 || c.MaxAmount < 0 {
+		return fmt.Errorf("amount limits cannot be negative")
+	}
+	if c.MinAmount > 0 && c.MaxAmount > 0 && c.MinAmount > c.MaxAmount {
+		return fmt.Errorf("minimum amount %d exceeds maximum amount %d", c.MinAmount, c.MaxAmount)
+	}
+	if c.Currency != "" && len(c.Currency) != 3 {
+		return fmt.Errorf("invalid currency: %q", c.Currency)
+	}
+	return nil
+}
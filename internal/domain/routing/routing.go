@@ -0,0 +1,231 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/credential"
+)
+
+// Policy decides which of a tenant's credentials collects a payment and which ones it
+// fails over to
+type Policy struct {
+	TenantID           int64
+	PreferredProviders []credential.ProviderType // tried in this order; providers not listed come after
+	Rules              []Rule
+	UpdatedAt          time.Time
+}
+
+// Rule spreads payments over a provider's credentials by weight
+type Rule struct {
+	CredentialID int64
+	Networks     []Network // phone networks the rule applies to; empty: any
+	Weight       int       // share of payments relative to the provider's other credentials
+}
+
+// MaxWeight bounds a rule's weight
+const MaxWeight = 1000
+
+// Network is a mobile network operator, recognised from a phone number's prefix
+type Network string
+
+const (
+	NetworkUnknown   Network = ""
+	NetworkSafaricom Network = "safaricom"
+	NetworkAirtel    Network = "airtel"
+	NetworkTelkom    Network = "telkom"
+)
+
+// networkPrefixes maps Kenyan subscriber number prefixes, after the 254 country code,
+// to their network
+var networkPrefixes = map[Network][]string{
+	NetworkSafaricom: {"70", "71", "72", "740", "741", "742", "743", "745", "746", "748", "757", "758", "759", "768", "769", "79", "110", "111", "112", "113", "114", "115"},
+	NetworkAirtel:    {"73", "750", "751", "752", "753", "754", "755", "756", "762", "78", "100", "101", "102"},
+	NetworkTelkom:    {"77"},
+}
+
+// networkProviders is the mobile money provider that can collect from each network
+var networkProviders = map[Network]credential.ProviderType{
+	NetworkSafaricom: credential.ProviderMpesa,
+	NetworkAirtel:    credential.ProviderAirtelMoney,
+	NetworkTelkom:    credential.ProviderTKash,
+}
+
+// NetworkOf returns the network of a Kenyan phone number given as 2547XXXXXXXX, +2547XXXXXXXX
+// or 07XXXXXXXX; numbers it does not recognise are NetworkUnknown
+func NetworkOf(phone string) Network {
+	digits := strings.TrimPrefix(strings.TrimSpace(phone), "+")
+	switch {
+	case strings.HasPrefix(digits, "254"):
+		digits = digits[3:]
+	case strings.HasPrefix(digits, "0"):
+		digits = digits[1:]
+	default:
+		return NetworkUnknown
+	}
+	if len(digits) != 9 {
+		return NetworkUnknown
+	}
+
+	for network, prefixes := range networkPrefixes {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(digits, prefix) {
+				return network
+			}
+		}
+	}
+	return NetworkUnknown
+}
+
+// DefaultPolicy keeps credentials in the order they were added, with no preferences or weights
+func DefaultPolicy(tenantID int64) *Policy {
+	return &Policy{TenantID: tenantID}
+}
+
+// Validate validates a policy
+func (p *Policy) Validate() error {
+	if p.TenantID <= 0 {
+		return fmt.Errorf("invalid tenant ID: %d", p.TenantID)
+	}
+
+	seen := make(map[credential.ProviderType]bool)
+	for _, providerType := range p.PreferredProviders {
+		if providerType == "" {
+			return fmt.Errorf("preferred provider cannot be empty")
+		}
+		if seen[providerType] {
+			return fmt.Errorf("provider %s is listed more than once", providerType)
+		}
+		seen[providerType] = true
+	}
+
+	for i, rule := range p.Rules {
+		if rule.CredentialID <= 0 {
+			return fmt.Errorf("rule %d: credential ID is required", i+1)
+		}
+		if rule.Weight < 0 || rule.Weight > MaxWeight {
+			return fmt.Errorf("rule %d: weight must be between 0 and %d", i+1, MaxWeight)
+		}
+		for _, network := range rule.Networks {
+			if _, ok := networkProviders[network]; !ok {
+				return fmt.Errorf("rule %d: unknown network: %s", i+1, network)
+			}
+		}
+	}
+	return nil
+}
+
+// Touch stamps the policy as updated now
+func (p *Policy) Touch() *Policy {
+	p.UpdatedAt = time.Now()
+	return p
+}
+
+// Route orders the credentials that may collect a payment from the phone number; the
+// first is tried first and the others are failover targets. Credentials are grouped by
+// provider, the requested provider first and then the policy's preferred ones, and
+// ordered within a provider by a weighted draw; pick returns a random int in [0, n).
+// When the phone's network is known only credentials of the provider serving it qualify.
+func (p *Policy) Route(candidates []*credential.ProviderCredential, phone string, requested credential.ProviderType, pick func(n int) int) ([]*credential.ProviderCredential, error) {
+	network := NetworkOf(phone)
+
+	groups := make(map[credential.ProviderType][]*credential.ProviderCredential)
+	var order []credential.ProviderType
+	for _, cred := range candidates {
+		providerType := providerOf(cred)
+		if network != NetworkUnknown && providerType != networkProviders[network] {
+			continue
+		}
+		if _, ok := groups[providerType]; !ok {
+			order = append(order, providerType)
+		}
+		groups[providerType] = append(groups[providerType], cred)
+	}
+	if len(order) == 0 {
+		if network != NetworkUnknown {
+			return nil, fmt.Errorf("no active credential can collect from %s numbers", network)
+		}
+		return nil, fmt.Errorf("no active credential can collect this payment")
+	}
+
+	preferred := append([]credential.ProviderType{requested}, p.PreferredProviders...)
+	rank := func(providerType credential.ProviderType) int {
+		for i, pt := range preferred {
+			if pt != "" && pt == providerType {
+				return i
+			}
+		}
+		return len(preferred)
+	}
+	// Stable insertion sort: providers nobody prefers keep the order their credentials came in
+	for i := 1; i < len(order); i++ {
+		for j := i; j > 0 && rank(order[j]) < rank(order[j-1]); j-- {
+			order[j], order[j-1] = order[j-1], order[j]
+		}
+	}
+
+	routed := make([]*credential.ProviderCredential, 0, len(candidates))
+	for _, providerType := range order {
+		routed = append(routed, p.weighted(groups[providerType], network, pick)...)
+	}
+	return routed, nil
+}
+
+// weighted orders one provider's credentials by repeated weighted draws. Without a rule
+// for the network the order is unchanged; credentials without a rule, or with weight
+// zero, come last.
+func (p *Policy) weighted(creds []*credential.ProviderCredential, network Network, pick func(n int) int) []*credential.ProviderCredential {
+	weights := make([]int, len(creds))
+	total := 0
+	for i, cred := range creds {
+		weights[i] = p.weight(cred.ID, network)
+		total += weights[i]
+	}
+	if total == 0 {
+		return creds
+	}
+
+	remaining := append([]*credential.ProviderCredential(nil), creds...)
+	ordered := make([]*credential.ProviderCredential, 0, len(creds))
+	for total > 0 {
+		n := pick(total)
+		for i := range remaining {
+			if n < weights[i] {
+				ordered = append(ordered, remaining[i])
+				total -= weights[i]
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				weights = append(weights[:i], weights[i+1:]...)
+				break
+			}
+			n -= weights[i]
+		}
+	}
+	return append(ordered, remaining...)
+}
+
+// weight returns the weight of the first rule for the credential that covers the network
+func (p *Policy) weight(credentialID int64, network Network) int {
+	for _, rule := range p.Rules {
+		if rule.CredentialID != credentialID {
+			continue
+		}
+		if len(rule.Networks) == 0 {
+			return rule.Weight
+		}
+		for _, n := range rule.Networks {
+			if n == network {
+				return rule.Weight
+			}
+		}
+	}
+	return 0
+}
+
+// providerOf returns the credential's provider, falling back to the legacy provider field
+func providerOf(cred *credential.ProviderCredential) credential.ProviderType {
+	if cred.ProviderType != "" {
+		return cred.ProviderType
+	}
+	return credential.ProviderType(cred.Provider)
+}
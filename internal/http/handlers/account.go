@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"paymatch/internal/domain/account"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/provider"
+	accountservice "paymatch/internal/services/account"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestBalance asks the provider for a credential's account balances. The returned
+// query's ID identifies the request; it completes when the provider's result arrives.
+func RequestBalance(accountService *accountservice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		// Every field is optional, so an empty body is allowed
+		var req accountservice.BalanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		q, err := accountService.RequestBalance(r.Context(), tenantID, middlewarex.Actor(r.Context()), req)
+		if err != nil {
+			var providerErr *provider.ProviderError
+			if errors.As(err, &providerErr) {
+				log.Error().Err(err).Int64("tenant_id", tenantID).Msg("balance query failed")
+				writeErrorResponse(w, "balance query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeAccountError(w, err)
+			return
+		}
+
+		writeQuery(w, q)
+	}
+}
+
+// ListBalances returns the latest known balance of each of the tenant's credentials
+func ListBalances(accountService *accountservice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		balances, err := accountService.Balances(r.Context(), tenantID)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"balances": balances})
+	}
+}
+
+// RequestTransactionStatus asks the provider for the status of a transaction. The returned
+// query's ID identifies the request; it completes when the provider's result arrives.
+func RequestTransactionStatus(accountService *accountservice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req accountservice.StatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		q, err := accountService.RequestStatus(r.Context(), tenantID, middlewarex.Actor(r.Context()), req)
+		if err != nil {
+			var providerErr *provider.ProviderError
+			if errors.As(err, &providerErr) {
+				log.Error().Err(err).Int64("tenant_id", tenantID).Str("transaction_id", req.TransactionID).Msg("transaction status query failed")
+				writeErrorResponse(w, "transaction status query failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeAccountError(w, err)
+			return
+		}
+
+		writeQuery(w, q)
+	}
+}
+
+// GetAccountQuery returns a balance or transaction status query of the given kind and its result
+func GetAccountQuery(accountService *accountservice.Service, kind account.Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid query id", http.StatusBadRequest)
+			return
+		}
+
+		q, err := accountService.Get(r.Context(), tenantID, id)
+		if err == nil && q.Kind != kind {
+			err = accountservice.ErrQueryNotFound
+		}
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+	}
+}
+
+// writeQuery responds with a new query; pending ones are accepted rather than done
+func writeQuery(w http.ResponseWriter, q *account.Query) {
+	status := http.StatusOK
+	if q.Status == account.QueryPending {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(q)
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	var validationErr *accountservice.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, accountservice.ErrQueryNotFound):
+		writeErrorResponse(w, err.Error(), http.StatusNotFound)
+	default:
+		writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -2,13 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"paymatch/internal/config"
 	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/provider"
 	"paymatch/internal/services/event"
 	"paymatch/internal/services/tenant"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
 )
 
 // OnboardTenant handles tenant onboarding using the tenant service
@@ -100,4 +106,77 @@ func ReplayEvents(eventsService *event.ReplayService) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
-}
\ No newline at end of file
+}
+// RegisterC2BURLs registers a credential's C2B validation and confirmation URLs with its provider
+func RegisterC2BURLs(registry *provider.Registry, tenantService *tenant.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid credential id", http.StatusBadRequest)
+			return
+		}
+
+		var req provider.C2BRegisterReq
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		cred, err := tenantService.GetCredential(r.Context(), id)
+		if err != nil {
+			writeErrorResponse(w, "credential not found", http.StatusNotFound)
+			return
+		}
+
+		response, err := registry.RegisterC2BURLs(r.Context(), cred, req)
+		if err != nil {
+			log.Error().Err(err).Int64("credential_id", id).Str("shortcode", cred.Shortcode).Msg("C2B URL registration failed")
+			var providerErr *provider.ProviderError
+			if errors.As(err, &providerErr) {
+				writeErrorResponse(w, providerErr.Error(), http.StatusBadGateway)
+				return
+			}
+			writeErrorResponse(w, "C2B URL registration failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// CreateAPIKey issues another API key for a tenant; give each user their own key
+func CreateAPIKey(tenantService *tenant.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid tenant id", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		response, err := tenantService.CreateAPIKey(r.Context(), tenantID, req.Name)
+		if err != nil {
+			var validationErr *tenant.ValidationError
+			if errors.As(err, &validationErr) {
+				writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+				return
+			}
+			writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	domainpayout "paymatch/internal/domain/payout"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/payout"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetApprovalPolicy returns the thresholds the tenant's payouts are approved under
+func GetApprovalPolicy(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		policy, err := payoutService.ApprovalPolicy(r.Context(), tenantID)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	}
+}
+
+// SetApprovalPolicy replaces a tenant's approval thresholds. It is an admin route so
+// that the users being controlled cannot relax their own controls.
+func SetApprovalPolicy(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid tenant id", http.StatusBadRequest)
+			return
+		}
+
+		var req payout.PolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		policy, err := payoutService.UpdateApprovalPolicy(r.Context(), tenantID, req)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	}
+}
+
+// ListApprovals lists the tenant's payout approvals, optionally filtered by ?status=
+func ListApprovals(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		status := domainpayout.ApprovalStatus(r.URL.Query().Get("status"))
+
+		response, err := payoutService.ListApprovals(r.Context(), tenantID, status, req.Limit, req.Offset)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetApproval returns an approval with its audit trail and the payout or batch it holds
+func GetApproval(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid approval id", http.StatusBadRequest)
+			return
+		}
+
+		detail, err := payoutService.GetApproval(r.Context(), tenantID, id)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
+
+// ApprovePayout records the calling user's approval; the last one releases the money
+func ApprovePayout(payoutService *payout.Service) http.HandlerFunc {
+	return decideApproval(payoutService.Approve)
+}
+
+// RejectPayout turns an approval down and cancels what it was holding
+func RejectPayout(payoutService *payout.Service) http.HandlerFunc {
+	return decideApproval(payoutService.Reject)
+}
+
+// decideApproval handles an approve or reject decision made by the calling user
+func decideApproval(decide func(ctx context.Context, tenantID, id int64, actor string, req payout.DecisionRequest) (*payout.ApprovalDetail, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid approval id", http.StatusBadRequest)
+			return
+		}
+
+		var req payout.DecisionRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		detail, err := decide(r.Context(), tenantID, id, middlewarex.Actor(r.Context()), req)
+		if err != nil {
+			if errors.Is(err, payout.ErrApprovalExpired) {
+				writeErrorResponse(w, err.Error(), http.StatusConflict)
+				return
+			}
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(detail)
+	}
+}
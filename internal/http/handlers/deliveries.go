@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	domaindelivery "paymatch/internal/domain/delivery"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/delivery"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// ListDeliveries lists outbound webhook deliveries for operators, e.g. ?status=dead&tenant_id=42
+func ListDeliveries(deliveryService *delivery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tenantID int64
+		if v := r.URL.Query().Get("tenant_id"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeErrorResponse(w, "invalid tenant_id", http.StatusBadRequest)
+				return
+			}
+			tenantID = n
+		}
+
+		status := domaindelivery.Status(r.URL.Query().Get("status"))
+		req := parseListRequest(r)
+
+		response, err := deliveryService.ListDeliveries(r.Context(), tenantID, status, req.Limit, req.Offset)
+		if err != nil {
+			writeErrorResponse(w, "failed to list deliveries: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RedeliverDelivery requeues a failed or dead-lettered delivery
+func RedeliverDelivery(deliveryService *delivery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid delivery id", http.StatusBadRequest)
+			return
+		}
+
+		d, err := deliveryService.Redeliver(r.Context(), id)
+		if err != nil {
+			writeDeliveryError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d)
+	}
+}
+
+// GetWebhookEndpoint returns the calling tenant's webhook endpoint
+func GetWebhookEndpoint(deliveryService *delivery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		endpoint, err := deliveryService.GetEndpoint(r.Context(), tenantID)
+		if err != nil {
+			writeDeliveryError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(endpoint)
+	}
+}
+
+// ConfigureWebhookEndpoint sets the URL payment notifications are delivered to
+func ConfigureWebhookEndpoint(deliveryService *delivery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		endpoint, err := deliveryService.ConfigureEndpoint(r.Context(), tenantID, req.URL)
+		if err != nil {
+			writeDeliveryError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(endpoint)
+	}
+}
+
+// RotateWebhookSecret issues a new signing secret; the previous one stays valid for overlap_hours (default 24)
+func RotateWebhookSecret(deliveryService *delivery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			OverlapHours *int `json:"overlap_hours,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		overlap := delivery.DefaultSecretOverlap
+		if req.OverlapHours != nil {
+			overlap = time.Duration(*req.OverlapHours) * time.Hour
+		}
+
+		endpoint, err := deliveryService.RotateSecret(r.Context(), tenantID, overlap)
+		if err != nil {
+			writeDeliveryError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(endpoint)
+	}
+}
+
+// writeDeliveryError maps delivery service errors to HTTP responses
+func writeDeliveryError(w http.ResponseWriter, err error) {
+	var validationErr *delivery.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, pgx.ErrNoRows):
+		writeErrorResponse(w, "not found", http.StatusNotFound)
+	default:
+		writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"paymatch/internal/domain/exception"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/invoice"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListExceptions lists payments that need an operator, optionally filtered by ?kind=
+func ListExceptions(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		kind := exception.Kind(r.URL.Query().Get("kind"))
+
+		response, err := invoiceService.ListExceptions(r.Context(), tenantID, kind, req.Limit, req.Offset)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// ManualMatchPayment applies an unmatched payment to an invoice chosen by an operator
+func ManualMatchPayment(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, paymentID, ok := exceptionTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req invoice.ManualMatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		response, err := invoiceService.ManualMatch(r.Context(), tenantID, paymentID, req)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// SplitPayment applies an unmatched payment across several invoices
+func SplitPayment(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, paymentID, ok := exceptionTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req invoice.SplitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		response, err := invoiceService.SplitPayment(r.Context(), tenantID, paymentID, req)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// MarkRefundCandidate flags an unmatched payment to be returned to the payer
+func MarkRefundCandidate(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, paymentID, ok := exceptionTarget(w, r)
+		if !ok {
+			return
+		}
+
+		var req invoice.ActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		response, err := invoiceService.MarkRefundCandidate(r.Context(), tenantID, paymentID, req)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetPaymentAudit returns the operator actions taken on a payment
+func GetPaymentAudit(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, paymentID, ok := exceptionTarget(w, r)
+		if !ok {
+			return
+		}
+
+		entries, err := invoiceService.PaymentAudit(r.Context(), tenantID, paymentID)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"payment_id": paymentID,
+			"entries":    entries,
+		})
+	}
+}
+
+// exceptionTarget resolves the tenant and payment ID of an exception request, writing an error if either is missing
+func exceptionTarget(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	tenantID, ok := middlewarex.TenantID(r.Context())
+	if !ok {
+		writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	paymentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeErrorResponse(w, "invalid payment id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return tenantID, paymentID, true
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	domaininvoice "paymatch/internal/domain/invoice"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/invoice"
+	"paymatch/internal/store/repositories"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateInvoice registers an invoice payments can be matched against
+func CreateInvoice(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req invoice.CreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		inv, err := invoiceService.Create(r.Context(), tenantID, req)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// ListInvoices lists the tenant's invoices, optionally filtered by ?status= and ?customer_ref=
+func ListInvoices(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		filter := repositories.InvoiceFilter{
+			Status:      domaininvoice.Status(r.URL.Query().Get("status")),
+			CustomerRef: r.URL.Query().Get("customer_ref"),
+		}
+
+		response, err := invoiceService.List(r.Context(), tenantID, filter, req.Limit, req.Offset)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetInvoice returns an invoice with the payments applied to it
+func GetInvoice(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		details, err := invoiceService.Get(r.Context(), tenantID, id)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(details)
+	}
+}
+
+// CancelInvoice cancels an unpaid invoice
+func CancelInvoice(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		inv, err := invoiceService.Cancel(r.Context(), tenantID, id)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// GetInvoiceLedger returns the running balance ledger of an invoice
+func GetInvoiceLedger(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+
+		ledger, err := invoiceService.Ledger(r.Context(), tenantID, id)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"invoice_id": id,
+			"entries":    ledger,
+		})
+	}
+}
+
+// ListCredits lists customer credits, optionally filtered by ?customer_ref= and ?status=
+func ListCredits(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		customerRef := r.URL.Query().Get("customer_ref")
+		status := domaininvoice.CreditStatus(r.URL.Query().Get("status"))
+
+		response, err := invoiceService.ListCredits(r.Context(), tenantID, customerRef, status, req.Limit, req.Offset)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// ApplyCredit settles an invoice from a customer credit
+func ApplyCredit(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		creditID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid credit id", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			InvoiceID int64 `json:"invoice_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.InvoiceID <= 0 {
+			writeErrorResponse(w, "invoice_id is required", http.StatusBadRequest)
+			return
+		}
+
+		response, err := invoiceService.ApplyCredit(r.Context(), tenantID, creditID, req.InvoiceID)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetCustomerBalance summarizes a customer's outstanding invoices and available credit
+func GetCustomerBalance(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		response, err := invoiceService.CustomerBalance(r.Context(), tenantID, chi.URLParam(r, "customerRef"))
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// writeInvoiceError maps invoice service errors to HTTP responses
+func writeInvoiceError(w http.ResponseWriter, err error) {
+	var validationErr *invoice.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, invoice.ErrNotFound), errors.Is(err, invoice.ErrCreditNotFound), errors.Is(err, invoice.ErrReviewNotFound),
+		errors.Is(err, invoice.ErrPaymentNotFound):
+		writeErrorResponse(w, err.Error(), http.StatusNotFound)
+	default:
+		writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"paymatch/internal/domain/matching"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/invoice"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetMatchingRules returns the tenant's reference matching rules, or a credential's with ?credential_id=
+func GetMatchingRules(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var credentialID *int64
+		if raw := r.URL.Query().Get("credential_id"); raw != "" {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				writeErrorResponse(w, "invalid credential_id", http.StatusBadRequest)
+				return
+			}
+			credentialID = &id
+		}
+
+		rules, err := invoiceService.GetMatchingRules(r.Context(), tenantID, credentialID)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+// UpdateMatchingRules sets the tenant default rules or a per-credential override
+func UpdateMatchingRules(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req invoice.RulesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		rules, err := invoiceService.UpdateMatchingRules(r.Context(), tenantID, req)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+// ListMatchReviews lists suggested matches awaiting confirmation, filtered by ?status= (default pending)
+func ListMatchReviews(invoiceService *invoice.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		status := matching.ReviewStatus(r.URL.Query().Get("status"))
+		if status == "" {
+			status = matching.ReviewPending
+		} else if status == "all" {
+			status = ""
+		}
+
+		response, err := invoiceService.ListReviews(r.Context(), tenantID, status, req.Limit, req.Offset)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// AcceptMatchReview applies the payment to the suggested invoice
+func AcceptMatchReview(invoiceService *invoice.Service) http.HandlerFunc {
+	return resolveMatchReview(invoiceService.AcceptReview)
+}
+
+// RejectMatchReview dismisses the suggestion and leaves the payment unmatched
+func RejectMatchReview(invoiceService *invoice.Service) http.HandlerFunc {
+	return resolveMatchReview(invoiceService.RejectReview)
+}
+
+// resolveMatchReview wraps a review resolution in the shared request handling
+func resolveMatchReview(resolve func(ctx context.Context, tenantID, reviewID int64) (*invoice.ReviewResponse, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid review id", http.StatusBadRequest)
+			return
+		}
+
+		response, err := resolve(r.Context(), tenantID, id)
+		if err != nil {
+			writeInvoiceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
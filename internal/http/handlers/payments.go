@@ -1,21 +1,25 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
-	"paymatch/internal/domain/credential"
+	domainpayment "paymatch/internal/domain/payment"
 	middlewarex "paymatch/internal/http/middleware"
 	"paymatch/internal/provider"
+	"paymatch/internal/services/payment"
+	"paymatch/internal/services/payout"
+	"paymatch/internal/services/routing"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 )
 
-// STKPush handles STK push payment requests
-func STKPush(registry *provider.Registry, tenantService interface {
-	GetTenantCredentials(ctx context.Context, tenantID int64) ([]*credential.ProviderCredential, error)
-}) http.HandlerFunc {
+// STKPush handles STK push payment requests, routing each to one of the tenant's credentials
+// and recording the push as a pending payment
+func STKPush(routingService *routing.Service, paymentService *payment.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tenantID, ok := middlewarex.TenantID(r.Context())
 		if !ok {
@@ -24,7 +28,7 @@ func STKPush(registry *provider.Registry, tenantService interface {
 		}
 
 		// Parse request
-		var req provider.STKPushReq
+		var req routing.STKPushRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
 			return
@@ -47,43 +51,59 @@ func STKPush(registry *provider.Registry, tenantService interface {
 			writeErrorResponse(w, "callback_url is required", http.StatusBadRequest)
 			return
 		}
-
-		// Get tenant credentials from credential service
-		credentials, err := tenantService.GetTenantCredentials(r.Context(), tenantID)
-		if err != nil {
-			log.Error().Err(err).Int64("tenant_id", tenantID).Msg("Failed to get tenant credentials")
-			writeErrorResponse(w, "failed to get tenant credentials", http.StatusInternalServerError)
-			return
-		}
-
-		if len(credentials) == 0 {
-			writeErrorResponse(w, "no provider credentials found for tenant", http.StatusBadRequest)
+		if err := domainpayment.ValidateMetadata(req.Metadata); err != nil {
+			writeErrorResponse(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Use the first credential (for now, in the future this could be provider-specific)
-		cred := credentials[0]
-
 		log.Info().
 			Int64("tenant_id", tenantID).
 			Int64("amount", req.Amount).
 			Str("phone_number", req.PhoneNumber).
-			Str("provider", string(cred.ProviderType)).
+			Int64("credential_id", req.CredentialID).
+			Str("provider", req.Provider).
 			Msg("STK Push request received")
 
-		// Call the provider registry to perform STK Push
-		response, err := registry.STKPush(r.Context(), cred, req)
+		// Route the push to a credential, failing over while a provider is unavailable
+		response, err := routingService.STKPush(r.Context(), tenantID, req)
 		if err != nil {
-			log.Error().Err(err).
-				Int64("tenant_id", tenantID).
-				Str("provider", string(cred.ProviderType)).
-				Msg("STK Push failed")
-			writeErrorResponse(w, "STK Push failed: "+err.Error(), http.StatusInternalServerError)
-			return
+			var validationErr *routing.ValidationError
+			var providerErr *provider.ProviderError
+			switch {
+			case errors.As(err, &validationErr):
+				writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+			case errors.As(err, &providerErr) && providerErr.Refused:
+				writeErrorResponse(w, "STK Push failed: "+err.Error(), http.StatusServiceUnavailable)
+			default:
+				log.Error().Err(err).Int64("tenant_id", tenantID).Msg("STK Push failed")
+				writeErrorResponse(w, "STK Push failed: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// The push has reached the customer, so a failure to record it is not the caller's to
+		// retry; the response says so with 202 and the callback creates the payment instead
+		p, err := paymentService.CreatePendingPayment(r.Context(), tenantID, payment.PendingPayment{
+			CredentialID: response.CredentialID,
+			ExternalID:   response.ExternalID,
+			Invoice:      req.AccountReference,
+			Amount:       req.Amount,
+			PhoneNumber:  req.PhoneNumber,
+			Metadata:     req.Metadata,
+			InitiatedBy:  middlewarex.Actor(r.Context()),
+		})
+		if err != nil {
+			log.Error().Err(err).Int64("tenant_id", tenantID).Str("external_id", response.ExternalID).Msg("failed to record STK push as pending payment")
+		} else {
+			response.PaymentID = p.ID
+			response.PaymentRecorded = true
 		}
 
 		// Return success response
 		w.Header().Set("Content-Type", "application/json")
+		if !response.PaymentRecorded {
+			w.WriteHeader(http.StatusAccepted)
+		}
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			log.Error().Err(err).Msg("Failed to encode STK Push response")
 			writeErrorResponse(w, "failed to encode response", http.StatusInternalServerError)
@@ -92,8 +112,8 @@ func STKPush(registry *provider.Registry, tenantService interface {
 	}
 }
 
-// B2C handles business to customer transfer requests
-func B2C(registry *provider.Registry) http.HandlerFunc {
+// GetPayment returns one of the tenant's payments, for polling an STK push until its callback settles it
+func GetPayment(paymentService *payment.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tenantID, ok := middlewarex.TenantID(r.Context())
 		if !ok {
@@ -101,44 +121,63 @@ func B2C(registry *provider.Registry) http.HandlerFunc {
 			return
 		}
 
-		// Parse request
-		var req provider.B2CReq
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid payment id", http.StatusBadRequest)
 			return
 		}
 
-		// Validate required fields
-		if req.Amount <= 0 {
-			writeErrorResponse(w, "amount must be greater than 0", http.StatusBadRequest)
+		p, err := paymentService.GetPayment(r.Context(), tenantID, id)
+		if errors.Is(err, payment.ErrPaymentNotFound) {
+			writeErrorResponse(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		if req.PhoneNumber == "" {
-			writeErrorResponse(w, "phone_number is required", http.StatusBadRequest)
+		if err != nil {
+			log.Error().Err(err).Int64("tenant_id", tenantID).Int64("payment_id", id).Msg("failed to get payment")
+			writeErrorResponse(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-		if req.ResultURL == "" {
-			writeErrorResponse(w, "result_url is required", http.StatusBadRequest)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// B2C sends money from the tenant's shortcode to a customer and records the payout
+func B2C(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
 			return
 		}
-		if req.TimeoutURL == "" {
-			writeErrorResponse(w, "timeout_url is required", http.StatusBadRequest)
+
+		// Parse request
+		var req payout.InitiateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
 			return
 		}
 
-		// TODO: Get tenant's credential (this requires a service to get credentials by tenant ID)
-		// For now, return not implemented
-		writeErrorResponse(w, "B2C implementation requires credential lookup service", http.StatusNotImplemented)
-		
-		// The full implementation would be:
-		// 1. Get tenant credentials from credential service
-		// 2. Call registry.B2C(ctx, cred, req)
-		// 3. Return response
-
 		log.Info().
 			Int64("tenant_id", tenantID).
 			Int64("amount", req.Amount).
-			Str("phone_number", req.PhoneNumber).
 			Msg("B2C request received")
+
+		p, err := payoutService.Initiate(r.Context(), tenantID, middlewarex.Actor(r.Context()), req)
+		if err != nil {
+			var providerErr *provider.ProviderError
+			if errors.As(err, &providerErr) {
+				log.Error().Err(err).Int64("tenant_id", tenantID).Msg("B2C failed")
+				writeErrorResponse(w, "B2C failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(p)
 	}
-}
\ No newline at end of file
+}
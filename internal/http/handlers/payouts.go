@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	domainpayout "paymatch/internal/domain/payout"
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/payout"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListPayouts lists the tenant's B2C payouts, optionally filtered by ?status=
+func ListPayouts(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		status := domainpayout.Status(r.URL.Query().Get("status"))
+
+		response, err := payoutService.List(r.Context(), tenantID, status, req.Limit, req.Offset)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetPayout returns a payout and its result
+func GetPayout(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid payout id", http.StatusBadRequest)
+			return
+		}
+
+		p, err := payoutService.Get(r.Context(), tenantID, id)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// maxBatchUploadBytes bounds a bulk payout upload; 5000 CSV lines fit comfortably
+const maxBatchUploadBytes = 5 << 20
+
+// CreatePayoutBatch queues a bulk payout. The body is either a JSON batch request or a CSV
+// file (sent raw as text/csv or as the multipart field "file"); for CSV uploads batch_id,
+// credential_id and command_id are read from the form or query string.
+func CreatePayoutBatch(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBatchUploadBytes)
+
+		var req payout.BatchRequest
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv", "multipart/form-data":
+			var upload io.Reader = r.Body
+			if mediaType == "multipart/form-data" {
+				file, _, err := r.FormFile("file")
+				if err != nil {
+					writeErrorResponse(w, "multipart upload needs a CSV in the \"file\" field", http.StatusBadRequest)
+					return
+				}
+				defer file.Close()
+				upload = file
+			}
+
+			transfers, err := payout.ParseBatchCSV(upload)
+			if err != nil {
+				writePayoutError(w, err)
+				return
+			}
+			req.Transfers = transfers
+			req.BatchID = r.FormValue("batch_id")
+			req.CommandID = r.FormValue("command_id")
+			if v := r.FormValue("credential_id"); v != "" {
+				if req.CredentialID, err = strconv.ParseInt(v, 10, 64); err != nil {
+					writeErrorResponse(w, "invalid credential_id", http.StatusBadRequest)
+					return
+				}
+			}
+		default:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeErrorResponse(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, err := payoutService.CreateBatch(r.Context(), tenantID, middlewarex.Actor(r.Context()), req)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// ListPayoutBatches lists the tenant's payout batches, optionally filtered by ?status=
+func ListPayoutBatches(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		req := parseListRequest(r)
+		status := domainpayout.BatchStatus(r.URL.Query().Get("status"))
+
+		response, err := payoutService.ListBatches(r.Context(), tenantID, status, req.Limit, req.Offset)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetPayoutBatch returns a batch with its per-outcome summary and items
+func GetPayoutBatch(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, id, ok := payoutBatchParams(w, r)
+		if !ok {
+			return
+		}
+
+		report, err := payoutService.BatchReport(r.Context(), tenantID, id)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// GetPayoutBatchReport returns the batch report; ?format=csv downloads it as a spreadsheet
+func GetPayoutBatchReport(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, id, ok := payoutBatchParams(w, r)
+		if !ok {
+			return
+		}
+
+		report, err := payoutService.BatchReport(r.Context(), tenantID, id)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		if r.URL.Query().Get("format") != "csv" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=payout-batch-"+strconv.FormatInt(id, 10)+".csv")
+		payout.WriteBatchReportCSV(w, report)
+	}
+}
+
+// CancelPayoutBatch withdraws the batch items that have not been sent yet
+func CancelPayoutBatch(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, id, ok := payoutBatchParams(w, r)
+		if !ok {
+			return
+		}
+
+		batch, err := payoutService.CancelBatch(r.Context(), tenantID, id, middlewarex.Actor(r.Context()))
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(batch)
+	}
+}
+
+// ResumePayoutBatch requeues rejected items, and interrupted ones when retry_unknown is set
+func ResumePayoutBatch(payoutService *payout.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, id, ok := payoutBatchParams(w, r)
+		if !ok {
+			return
+		}
+
+		var req payout.ResumeRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeErrorResponse(w, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, err := payoutService.ResumeBatch(r.Context(), tenantID, id, req)
+		if err != nil {
+			writePayoutError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// payoutBatchParams reads the tenant and batch ID, writing an error response if either is missing
+func payoutBatchParams(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	tenantID, ok := middlewarex.TenantID(r.Context())
+	if !ok {
+		writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeErrorResponse(w, "invalid batch id", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return tenantID, id, true
+}
+
+// writePayoutError maps payout service errors to HTTP responses
+func writePayoutError(w http.ResponseWriter, err error) {
+	var validationErr *payout.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, payout.ErrNotFound), errors.Is(err, payout.ErrBatchNotFound), errors.Is(err, payout.ErrApprovalNotFound):
+		writeErrorResponse(w, err.Error(), http.StatusNotFound)
+	default:
+		writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/provider"
+	"paymatch/internal/services/payout"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ReversePayment asks the provider to return a completed payment to the payer. The reversal
+// is pending until the provider's result callback settles it.
+func ReversePayment(reversalService *payout.ReversalService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		paymentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid payment id", http.StatusBadRequest)
+			return
+		}
+
+		// Every field is optional, so an empty body is allowed
+		var req payout.ReverseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		rev, err := reversalService.Reverse(r.Context(), tenantID, paymentID, middlewarex.Actor(r.Context()), req)
+		if err != nil {
+			var providerErr *provider.ProviderError
+			if errors.As(err, &providerErr) {
+				log.Error().Err(err).Int64("tenant_id", tenantID).Int64("payment_id", paymentID).Msg("reversal failed")
+				writeErrorResponse(w, "reversal failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeReversalError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(rev)
+	}
+}
+
+// ListPaymentReversals returns every reversal attempted for a payment
+func ListPaymentReversals(reversalService *payout.ReversalService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		paymentID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid payment id", http.StatusBadRequest)
+			return
+		}
+
+		reversals, err := reversalService.ListForPayment(r.Context(), tenantID, paymentID)
+		if err != nil {
+			writeReversalError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"reversals": reversals})
+	}
+}
+
+// GetReversal returns a reversal and its result
+func GetReversal(reversalService *payout.ReversalService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			writeErrorResponse(w, "invalid reversal id", http.StatusBadRequest)
+			return
+		}
+
+		rev, err := reversalService.Get(r.Context(), tenantID, id)
+		if err != nil {
+			writeReversalError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rev)
+	}
+}
+
+func writeReversalError(w http.ResponseWriter, err error) {
+	var validationErr *payout.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, payout.ErrReversalNotFound), errors.Is(err, payout.ErrPaymentNotFound):
+		writeErrorResponse(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, payout.ErrReversalExists):
+		writeErrorResponse(w, err.Error(), http.StatusConflict)
+	default:
+		writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	middlewarex "paymatch/internal/http/middleware"
+	"paymatch/internal/services/routing"
+)
+
+// GetRoutingPolicy returns how the tenant's collections are routed to its credentials
+func GetRoutingPolicy(routingService *routing.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		policy, err := routingService.Policy(r.Context(), tenantID)
+		if err != nil {
+			writeRoutingError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	}
+}
+
+// UpdateRoutingPolicy replaces the tenant's provider preferences and weighted rules
+func UpdateRoutingPolicy(routingService *routing.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, ok := middlewarex.TenantID(r.Context())
+		if !ok {
+			writeErrorResponse(w, "tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req routing.PolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, "invalid JSON request", http.StatusBadRequest)
+			return
+		}
+
+		policy, err := routingService.UpdatePolicy(r.Context(), tenantID, req)
+		if err != nil {
+			writeRoutingError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(policy)
+	}
+}
+
+func writeRoutingError(w http.ResponseWriter, err error) {
+	var validationErr *routing.ValidationError
+	if errors.As(err, &validationErr) {
+		writeErrorResponse(w, validationErr.Error(), http.StatusBadRequest)
+		return
+	}
+	writeErrorResponse(w, "internal error", http.StatusInternalServerError)
+}
@@ -14,11 +14,51 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// WebhookByShortcode handles provider webhooks with pure architecture
+// WebhookByShortcode persists provider webhooks and acknowledges them immediately;
+// processing happens asynchronously in the event worker
 func WebhookByShortcode(
 	tenantSvc *tenant.Service,
-	eventProcessor *eventservice.Processor,
+	ingestService *eventservice.IngestService,
 	providerRegistry *provider.Registry,
+) http.HandlerFunc {
+	return acceptWebhook(tenantSvc, ingestService, providerRegistry, "")
+}
+
+// WebhookTimeout persists the provider's queue-timeout callback for an outgoing request (B2C QueueTimeOutURL).
+// It is stored as a timeout event so that it never collides with the request's real result.
+func WebhookTimeout(
+	tenantSvc *tenant.Service,
+	ingestService *eventservice.IngestService,
+	providerRegistry *provider.Registry,
+) http.HandlerFunc {
+	return acceptWebhook(tenantSvc, ingestService, providerRegistry, event.TypeTimeout)
+}
+
+// WebhookReversal persists the result of a transaction reversal request. Failed reversal
+// results look like any other result payload, so the route decides the event type.
+func WebhookReversal(
+	tenantSvc *tenant.Service,
+	ingestService *eventservice.IngestService,
+	providerRegistry *provider.Registry,
+) http.HandlerFunc {
+	return acceptWebhook(tenantSvc, ingestService, providerRegistry, event.TypeReversal)
+}
+
+// WebhookResult persists the result of an account balance or transaction status query
+func WebhookResult(
+	tenantSvc *tenant.Service,
+	ingestService *eventservice.IngestService,
+	providerRegistry *provider.Registry,
+) http.HandlerFunc {
+	return acceptWebhook(tenantSvc, ingestService, providerRegistry, "")
+}
+
+// acceptWebhook validates, parses and stores a provider callback; a non-empty eventType overrides the parsed type
+func acceptWebhook(
+	tenantSvc *tenant.Service,
+	ingestService *eventservice.IngestService,
+	providerRegistry *provider.Registry,
+	eventType event.Type,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		shortcode := chi.URLParam(r, "shortcode")
@@ -72,6 +112,9 @@ func WebhookByShortcode(
 			writeErrorResponse(w, "invalid webhook payload", http.StatusBadRequest)
 			return
 		}
+		if eventType != "" {
+			providerEvent.Type = eventType
+		}
 
 		// Convert to domain event
 		domainEvent, err := createDomainEvent(credential.TenantID, credential.ID, providerEvent, body)
@@ -81,29 +124,125 @@ func WebhookByShortcode(
 			return
 		}
 
-		// Process the event asynchronously (this adds it to the processing queue)
-		if err := eventProcessor.ProcessEvent(r.Context(), domainEvent); err != nil {
-			log.Error().Err(err).Str("shortcode", shortcode).Int64("event_id", domainEvent.ID).Msg("failed to process event")
-			writeErrorResponse(w, "failed to process event", http.StatusInternalServerError)
+		// Durably store the event before acknowledging; a failure here lets the provider retry
+		result, err := ingestService.Ingest(r.Context(), domainEvent)
+		if err != nil {
+			log.Error().Err(err).Str("shortcode", shortcode).Str("external_id", domainEvent.ExternalID).Msg("failed to persist event")
+			writeErrorResponse(w, "failed to store event", http.StatusInternalServerError)
 			return
 		}
 
 		log.Info().
 			Str("shortcode", shortcode).
 			Int64("tenant_id", credential.TenantID).
+			Int64("event_id", result.EventID).
+			Bool("duplicate", result.Duplicate).
 			Str("event_type", string(domainEvent.Type)).
 			Str("external_id", domainEvent.ExternalID).
-			Msg("webhook processed successfully")
-
-		// Return success
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "success",
-			"message": "webhook processed",
-		})
+			Msg("webhook accepted")
+
+		writeDarajaAck(w)
+	}
+}
+
+// Daraja C2B validation result codes
+const (
+	c2bAccept                 = "0"
+	c2bRejectInvalidBillRef   = "C2B00012" // Invalid Account Number
+	c2bRejectInvalidShortcode = "C2B00015"
+	c2bRejectOther            = "C2B00016"
+)
+
+// C2BValidation answers Daraja's C2B validation request, accepting or rejecting the
+// payment against the credential's bill reference rules before it completes
+func C2BValidation(
+	tenantSvc *tenant.Service,
+	providerRegistry *provider.Registry,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shortcode := chi.URLParam(r, "shortcode")
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeErrorResponse(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		headers := make(map[string]string)
+		for name, values := range r.Header {
+			if len(values) > 0 {
+				headers[name] = values[0]
+			}
+		}
+
+		credential, err := tenantSvc.GetCredentialByShortcode(r.Context(), shortcode)
+		if err != nil || !credential.IsActive {
+			log.Warn().Err(err).Str("shortcode", shortcode).Msg("C2B validation for unknown shortcode")
+			writeC2BValidationResult(w, c2bRejectInvalidShortcode, "Rejected")
+			return
+		}
+
+		provider, err := providerRegistry.GetProviderForCredential(r.Context(), credential)
+		if err != nil {
+			log.Error().Err(err).Str("shortcode", shortcode).Msg("provider not found")
+			writeC2BValidationResult(w, c2bRejectOther, "Rejected")
+			return
+		}
+
+		if err := provider.ValidateWebhook(body, headers, credential.WebhookToken); err != nil {
+			log.Warn().Err(err).Str("shortcode", shortcode).Msg("C2B validation request failed authentication")
+			writeErrorResponse(w, "invalid webhook signature", http.StatusUnauthorized)
+			return
+		}
+
+		// The validation request carries the same fields as the confirmation
+		providerEvent, err := provider.ParseWebhook(body, headers)
+		if err != nil || providerEvent.Type != event.TypeC2B {
+			log.Warn().Err(err).Str("shortcode", shortcode).Msg("invalid C2B validation payload")
+			writeC2BValidationResult(w, c2bRejectOther, "Rejected")
+			return
+		}
+
+		if err := credential.ValidateC2BTransaction(providerEvent.InvoiceRef); err != nil {
+			log.Info().
+				Str("shortcode", shortcode).
+				Str("trans_id", providerEvent.ExternalID).
+				Str("bill_ref", providerEvent.InvoiceRef).
+				Str("reason", err.Error()).
+				Msg("C2B payment rejected")
+			writeC2BValidationResult(w, c2bRejectInvalidBillRef, "Rejected")
+			return
+		}
+
+		log.Info().
+			Str("shortcode", shortcode).
+			Str("trans_id", providerEvent.ExternalID).
+			Str("bill_ref", providerEvent.InvoiceRef).
+			Msg("C2B payment accepted")
+		writeC2BValidationResult(w, c2bAccept, "Accepted")
 	}
 }
 
+// writeC2BValidationResult writes the body Daraja expects in reply to a validation request
+func writeC2BValidationResult(w http.ResponseWriter, code, desc string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ResultCode": code,
+		"ResultDesc": desc,
+	})
+}
+
+// writeDarajaAck writes the acknowledgement body Daraja expects on callbacks
+func writeDarajaAck(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ResultCode": 0,
+		"ResultDesc": "Accepted",
+	})
+}
+
 // createDomainEvent converts a provider event to a domain event
 func createDomainEvent(tenantID, credentialID int64, providerEvent provider.Event, rawJSON []byte) (*event.Event, error) {
 	// Create domain event with validation
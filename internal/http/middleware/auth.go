@@ -24,7 +24,14 @@ func APIKeyAuth(tenantService *tenant.Service) func(http.Handler) http.Handler {
 				return
 			}
 
-			next.ServeHTTP(w, r.WithContext(WithTenantID(r.Context(), ten.ID)))
+			apiKey, err := tenantService.GetAPIKey(r.Context(), key)
+			if err != nil {
+				http.Error(w, "invalid key", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := WithTenantID(r.Context(), ten.ID)
+			next.ServeHTTP(w, r.WithContext(WithAPIKey(ctx, apiKey)))
 		})
 	}
 }
@@ -1,11 +1,17 @@
 package middlewarex
 
-import "context"
+import (
+	"context"
+	"strconv"
+
+	"paymatch/internal/domain/tenant"
+)
 
 type ctxKey string
 
 const (
 	ctxTenantID ctxKey = "tenant_id"
+	ctxActor    ctxKey = "actor"
 )
 
 func WithTenantID(ctx context.Context, tenantID int64) context.Context {
@@ -16,3 +22,15 @@ func TenantID(ctx context.Context) (int64, bool) {
 	v, ok := ctx.Value(ctxTenantID).(int64)
 	return v, ok
 }
+
+// WithAPIKey records the API key that authenticated the request as its actor
+func WithAPIKey(ctx context.Context, key *tenant.APIKey) context.Context {
+	return context.WithValue(ctx, ctxActor, key.Name+"#"+strconv.FormatInt(key.ID, 10))
+}
+
+// Actor identifies who made the request: each API key stands for one user, so
+// maker-checker rules compare keys. The key ID keeps same-named keys apart.
+func Actor(ctx context.Context) string {
+	v, _ := ctx.Value(ctxActor).(string)
+	return v
+}
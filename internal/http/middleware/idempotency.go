@@ -0,0 +1,151 @@
+package middlewarex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"paymatch/internal/domain/idempotency"
+	idempotencyservice "paymatch/internal/services/idempotency"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxIdempotentBody bounds the request bodies read for fingerprinting
+const maxIdempotentBody = 1 << 20
+
+// Idempotency replays the stored response when a request carries an Idempotency-Key
+// already used for the same request, so retries never pay or prompt twice. Requests
+// without the header, or without a service, pass straight through. Responses are kept
+// unless the request clearly had no effect (4xx or 503), in which case the key is freed.
+// A handler that panics frees the key too, before the panic reaches the recoverer.
+func Idempotency(svc *idempotencyservice.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || svc == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tenantID, ok := TenantID(r.Context())
+			if !ok {
+				http.Error(w, "tenant not found", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			if err != nil || len(body) > maxIdempotentBody {
+				http.Error(w, "request body too large or unreadable", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			rec, err := svc.Begin(r.Context(), tenantID, key, idempotency.Fingerprint(r.Method, r.URL.Path, fingerprintContent(r, body)))
+			if err != nil {
+				var validationErr *idempotencyservice.ValidationError
+				switch {
+				case errors.As(err, &validationErr):
+					http.Error(w, validationErr.Error(), http.StatusBadRequest)
+				case errors.Is(err, idempotencyservice.ErrKeyReused):
+					http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				case errors.Is(err, idempotencyservice.ErrInProgress):
+					http.Error(w, err.Error(), http.StatusConflict)
+				default:
+					log.Error().Err(err).Int64("tenant_id", tenantID).Msg("failed to check idempotency key")
+					http.Error(w, "internal error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			if rec.Status == idempotency.StatusCompleted {
+				if rec.ResponseContentType != "" {
+					w.Header().Set("Content-Type", rec.ResponseContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(rec.ResponseStatus)
+				w.Write(rec.ResponseBody)
+				return
+			}
+
+			defer func() {
+				if p := recover(); p != nil {
+					if err := svc.Release(context.WithoutCancel(r.Context()), rec); err != nil {
+						log.Error().Err(err).Int64("tenant_id", tenantID).Msg("failed to release idempotency key after panic")
+					}
+					panic(p)
+				}
+			}()
+
+			rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			// The outcome must be stored even if the client has gone away
+			ctx := context.WithoutCancel(r.Context())
+			if rw.status == http.StatusServiceUnavailable || (rw.status >= 400 && rw.status < 500) {
+				err = svc.Release(ctx, rec)
+			} else {
+				err = svc.Complete(ctx, rec, rw.status, rw.Header().Get("Content-Type"), rw.body.Bytes())
+			}
+			if errors.Is(err, idempotencyservice.ErrClaimLost) {
+				log.Warn().Int64("tenant_id", tenantID).Str("key", key).Msg("idempotency key taken over before the response was stored")
+			} else if err != nil {
+				log.Error().Err(err).Int64("tenant_id", tenantID).Msg("failed to store idempotent response")
+			}
+		})
+	}
+}
+
+// fingerprintContent returns the part of a request body that identifies the request.
+// Multipart bodies are reduced to their field names and values, since a client retrying
+// an upload usually picks a new boundary; bodies that fail to parse are used as sent.
+func fingerprintContent(r *http.Request, body []byte) []byte {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return body
+	}
+
+	var content bytes.Buffer
+	parts := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return content.Bytes()
+		}
+		if err != nil {
+			return body
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return body
+		}
+		fmt.Fprintf(&content, "%s\x00%d\x00", part.FormName(), len(value))
+		content.Write(value)
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
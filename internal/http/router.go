@@ -8,8 +8,16 @@ import (
 	"paymatch/internal/http/handlers"
 	middlewarex "paymatch/internal/http/middleware"
 	"paymatch/internal/provider"
+	"paymatch/internal/domain/account"
+	accountservice "paymatch/internal/services/account"
+	idempotencyservice "paymatch/internal/services/idempotency"
 	"paymatch/internal/services/data"
+	"paymatch/internal/services/delivery"
 	"paymatch/internal/services/event"
+	"paymatch/internal/services/invoice"
+	"paymatch/internal/services/payment"
+	"paymatch/internal/services/payout"
+	"paymatch/internal/services/routing"
 	"paymatch/internal/services/tenant"
 
 	"github.com/go-chi/chi/v5"
@@ -18,12 +26,20 @@ import (
 
 // RouterDependencies holds all dependencies for the HTTP router
 type RouterDependencies struct {
-	Config           config.Cfg
-	TenantService    *tenant.Service
-	DataService      *data.Service
-	EventService     *event.ReplayService
-	EventProcessor   *event.Processor
-	ProviderRegistry *provider.Registry
+	Config             config.Cfg
+	TenantService      *tenant.Service
+	DataService        *data.Service
+	PaymentService     *payment.Service
+	EventService       *event.ReplayService
+	EventIngest        *event.IngestService
+	DeliveryService    *delivery.Service
+	InvoiceService     *invoice.Service
+	PayoutService      *payout.Service
+	ReversalService    *payout.ReversalService
+	AccountService     *accountservice.Service
+	ProviderRegistry   *provider.Registry
+	RoutingService     *routing.Service
+	IdempotencyService *idempotencyservice.Service
 }
 
 // NewRouter creates the HTTP router with pure architecture services
@@ -54,6 +70,23 @@ func NewRouter(deps RouterDependencies) http.Handler {
 		
 		// Event replay for debugging/recovery
 		r.Post("/events/replay", handlers.ReplayEvents(deps.EventService))
+		
+		// C2B URL registration with the credential's provider
+		if deps.ProviderRegistry != nil {
+			r.Post("/credentials/{id}/c2b/register-urls", handlers.RegisterC2BURLs(deps.ProviderRegistry, deps.TenantService))
+		}
+		
+		// Outbound webhook deliveries
+		if deps.DeliveryService != nil {
+			r.Get("/deliveries", handlers.ListDeliveries(deps.DeliveryService))
+			r.Post("/deliveries/{id}/redeliver", handlers.RedeliverDelivery(deps.DeliveryService))
+		}
+		
+		// Per-user API keys and payout approval thresholds
+		r.Post("/tenants/{id}/api-keys", handlers.CreateAPIKey(deps.TenantService))
+		if deps.PayoutService != nil {
+			r.Put("/tenants/{id}/approval-policy", handlers.SetApprovalPolicy(deps.PayoutService))
+		}
 	})
 
 	// V1 Admin routes (alternative path for compatibility)
@@ -73,11 +106,89 @@ func NewRouter(deps RouterDependencies) http.Handler {
 		// Data listing endpoints
 		r.Get("/payments", handlers.ListPayments(deps.DataService))
 		r.Get("/events", handlers.ListEvents(deps.DataService))
+		if deps.PaymentService != nil {
+			r.Get("/payments/{id}", handlers.GetPayment(deps.PaymentService))
+		}
 		
-		// Provider payment operations (if registry is available)
-		if deps.ProviderRegistry != nil {
-			r.Post("/payments/stk", handlers.STKPush(deps.ProviderRegistry, deps.TenantService))
-			r.Post("/payments/b2c", handlers.B2C(deps.ProviderRegistry))
+		// Invoice registry
+		if deps.InvoiceService != nil {
+			r.Post("/invoices", handlers.CreateInvoice(deps.InvoiceService))
+			r.Get("/invoices", handlers.ListInvoices(deps.InvoiceService))
+			r.Get("/invoices/{id}", handlers.GetInvoice(deps.InvoiceService))
+			r.Post("/invoices/{id}/cancel", handlers.CancelInvoice(deps.InvoiceService))
+			r.Get("/invoices/{id}/ledger", handlers.GetInvoiceLedger(deps.InvoiceService))
+			r.Get("/credits", handlers.ListCredits(deps.InvoiceService))
+			r.Post("/credits/{id}/apply", handlers.ApplyCredit(deps.InvoiceService))
+			r.Get("/customers/{customerRef}/balance", handlers.GetCustomerBalance(deps.InvoiceService))
+			
+			// Fuzzy reference matching
+			r.Get("/matching-rules", handlers.GetMatchingRules(deps.InvoiceService))
+			r.Put("/matching-rules", handlers.UpdateMatchingRules(deps.InvoiceService))
+			r.Get("/match-reviews", handlers.ListMatchReviews(deps.InvoiceService))
+			r.Post("/match-reviews/{id}/accept", handlers.AcceptMatchReview(deps.InvoiceService))
+			r.Post("/match-reviews/{id}/reject", handlers.RejectMatchReview(deps.InvoiceService))
+			
+			// Exceptions: payments the matcher could not reconcile
+			r.Get("/exceptions", handlers.ListExceptions(deps.InvoiceService))
+			r.Post("/exceptions/{id}/match", handlers.ManualMatchPayment(deps.InvoiceService))
+			r.Post("/exceptions/{id}/split", handlers.SplitPayment(deps.InvoiceService))
+			r.Post("/exceptions/{id}/refund-candidate", handlers.MarkRefundCandidate(deps.InvoiceService))
+			r.Get("/exceptions/{id}/audit", handlers.GetPaymentAudit(deps.InvoiceService))
+		}
+		
+		// Outbound webhook endpoint configuration
+		if deps.DeliveryService != nil {
+			r.Get("/webhook-endpoint", handlers.GetWebhookEndpoint(deps.DeliveryService))
+			r.Put("/webhook-endpoint", handlers.ConfigureWebhookEndpoint(deps.DeliveryService))
+			r.Post("/webhook-endpoint/rotate-secret", handlers.RotateWebhookSecret(deps.DeliveryService))
+		}
+		
+		// Requests that move money honour an Idempotency-Key header
+		idempotent := middlewarex.Idempotency(deps.IdempotencyService)
+
+		// Provider payment operations, routed across the tenant's credentials
+		if deps.RoutingService != nil {
+			r.With(idempotent).Post("/payments/stk", handlers.STKPush(deps.RoutingService, deps.PaymentService))
+			r.Get("/routing-policy", handlers.GetRoutingPolicy(deps.RoutingService))
+			r.Put("/routing-policy", handlers.UpdateRoutingPolicy(deps.RoutingService))
+		}
+		
+		// Outgoing B2C payouts
+		if deps.PayoutService != nil {
+			r.With(idempotent).Post("/payments/b2c", handlers.B2C(deps.PayoutService))
+			r.Get("/payouts", handlers.ListPayouts(deps.PayoutService))
+			r.Get("/payouts/{id}", handlers.GetPayout(deps.PayoutService))
+
+			// Bulk disbursement
+			r.With(idempotent).Post("/payout-batches", handlers.CreatePayoutBatch(deps.PayoutService))
+			r.Get("/payout-batches", handlers.ListPayoutBatches(deps.PayoutService))
+			r.Get("/payout-batches/{id}", handlers.GetPayoutBatch(deps.PayoutService))
+			r.Get("/payout-batches/{id}/report", handlers.GetPayoutBatchReport(deps.PayoutService))
+			r.Post("/payout-batches/{id}/cancel", handlers.CancelPayoutBatch(deps.PayoutService))
+			r.Post("/payout-batches/{id}/resume", handlers.ResumePayoutBatch(deps.PayoutService))
+
+			// Maker-checker approvals; the approver must use a different API key than the creator
+			r.Get("/approval-policy", handlers.GetApprovalPolicy(deps.PayoutService))
+			r.Get("/approvals", handlers.ListApprovals(deps.PayoutService))
+			r.Get("/approvals/{id}", handlers.GetApproval(deps.PayoutService))
+			r.Post("/approvals/{id}/approve", handlers.ApprovePayout(deps.PayoutService))
+			r.Post("/approvals/{id}/reject", handlers.RejectPayout(deps.PayoutService))
+		}
+
+		// Reversals return a completed payment to the payer
+		if deps.ReversalService != nil {
+			r.Post("/payments/{id}/reverse", handlers.ReversePayment(deps.ReversalService))
+			r.Get("/payments/{id}/reversals", handlers.ListPaymentReversals(deps.ReversalService))
+			r.Get("/reversals/{id}", handlers.GetReversal(deps.ReversalService))
+		}
+
+		// Balance and transaction status queries are answered by a later provider result
+		if deps.AccountService != nil {
+			r.Post("/balance", handlers.RequestBalance(deps.AccountService))
+			r.Get("/balance", handlers.ListBalances(deps.AccountService))
+			r.Get("/balance/{id}", handlers.GetAccountQuery(deps.AccountService, account.KindBalance))
+			r.Post("/transaction-status", handlers.RequestTransactionStatus(deps.AccountService))
+			r.Get("/transaction-status/{id}", handlers.GetAccountQuery(deps.AccountService, account.KindTransactionStatus))
 		}
 	})
 
@@ -86,7 +197,34 @@ func NewRouter(deps RouterDependencies) http.Handler {
 		// Webhook by shortcode - provider-specific
 		r.Post("/{shortcode}", handlers.WebhookByShortcode(
 			deps.TenantService,
-			deps.EventProcessor,
+			deps.EventIngest,
+			deps.ProviderRegistry,
+		))
+		
+		// Queue timeouts for outgoing requests (B2C, reversals)
+		r.Post("/{shortcode}/timeout", handlers.WebhookTimeout(
+			deps.TenantService,
+			deps.EventIngest,
+			deps.ProviderRegistry,
+		))
+		
+		// Transaction reversal results
+		r.Post("/{shortcode}/reversal", handlers.WebhookReversal(
+			deps.TenantService,
+			deps.EventIngest,
+			deps.ProviderRegistry,
+		))
+		
+		// Balance and transaction status query results
+		r.Post("/{shortcode}/result", handlers.WebhookResult(
+			deps.TenantService,
+			deps.EventIngest,
+			deps.ProviderRegistry,
+		))
+		
+		// C2B validation: accept or reject a payment before it completes
+		r.Post("/{shortcode}/c2b/validation", handlers.C2BValidation(
+			deps.TenantService,
 			deps.ProviderRegistry,
 		))
 	})
@@ -0,0 +1,112 @@
+package airtel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"paymatch/internal/provider"
+)
+
+// WebhookService handles Airtel Money callback parsing and validation
+type WebhookService struct{}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService() *WebhookService {
+	return &WebhookService{}
+}
+
+// callbackPayload is the transaction callback Airtel posts for collections and disbursements.
+// The transaction is kept as sent, since the hash covers its exact bytes.
+type callbackPayload struct {
+	Transaction json.RawMessage `json:"transaction"`
+	Hash        string          `json:"hash,omitempty"`
+}
+
+// callbackTransaction is the part of the transaction object PayMatch reads
+type callbackTransaction struct {
+	ID            string `json:"id"`
+	Message       string `json:"message"`
+	StatusCode    string `json:"status_code"`
+	AirtelMoneyID string `json:"airtel_money_id"`
+}
+
+// Parse parses an Airtel callback and converts it to a standard Event
+func (w *WebhookService) Parse(body []byte, headers map[string]string) (provider.Event, error) {
+	var callback callbackPayload
+	var txn callbackTransaction
+	if err := json.Unmarshal(body, &callback); err != nil || json.Unmarshal(callback.Transaction, &txn) != nil {
+		return provider.Event{}, &provider.ProviderError{
+			Code:    "unrecognized_webhook",
+			Message: "unrecognized Airtel Money webhook payload format",
+		}
+	}
+
+	if txn.ID == "" {
+		return provider.Event{}, &provider.ProviderError{
+			Code:    "unrecognized_webhook",
+			Message: "unrecognized Airtel Money webhook payload format",
+		}
+	}
+
+	// The transaction ID prefix tells us which operation created it
+	eventType := provider.EventSTK
+	if strings.HasPrefix(txn.ID, disbursementPrefix) {
+		eventType = provider.EventB2C
+	}
+
+	return provider.Event{
+		Type:                eventType,
+		ExternalID:          txn.ID,
+		TransactionID:       txn.AirtelMoneyID,
+		Status:              mapTransactionStatus(txn.StatusCode),
+		FailureCode:         transactionFailureCode(txn.StatusCode),
+		ResponseDescription: txn.Message,
+		RawJSON:             body,
+	}, nil
+}
+
+// Validate validates Airtel callback authenticity
+func (w *WebhookService) Validate(body []byte, headers map[string]string, webhookToken string) error {
+	var callback callbackPayload
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return &provider.ProviderError{
+			Code:    "invalid_webhook_payload",
+			Message: "webhook payload is not valid JSON",
+		}
+	}
+
+	// Without a token nothing ties the callback to Airtel, so it cannot be trusted
+	if webhookToken == "" {
+		return &provider.ProviderError{
+			Code:    "invalid_webhook_token",
+			Message: "no webhook token configured for this credential",
+		}
+	}
+
+	// Authenticated callbacks carry an HMAC of the transaction object as Airtel sent it
+	if callback.Hash != "" {
+		mac := hmac.New(sha256.New, []byte(webhookToken))
+		mac.Write(callback.Transaction)
+		expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(callback.Hash)) {
+			return &provider.ProviderError{
+				Code:    "invalid_webhook_token",
+				Message: "webhook hash validation failed",
+			}
+		}
+		return nil
+	}
+
+	// Callbacks without a hash must carry the credential's token in the custom header
+	if token := headers["X-Webhook-Token"]; !hmac.Equal([]byte(token), []byte(webhookToken)) {
+		return &provider.ProviderError{
+			Code:    "invalid_webhook_token",
+			Message: "webhook token validation failed",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreakerConfig holds configuration for provider circuit breakers
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // consecutive failures that open the circuit
+	OpenFor          time.Duration // how long calls are refused before one is let through as a probe
+}
+
+// DefaultCircuitBreakerConfig returns sensible defaults for circuit breakers
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: 5,
+		OpenFor:          30 * time.Second,
+	}
+}
+
+// circuitBreakers tracks provider health per key, typically one credential, so one
+// failing account does not cut off the others
+type circuitBreakers struct {
+	config   CircuitBreakerConfig
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the health of one key
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool // a probe call is in flight while half-open
+}
+
+// newCircuitBreakers creates an empty set of circuit breakers
+func newCircuitBreakers(config CircuitBreakerConfig) *circuitBreakers {
+	defaults := DefaultCircuitBreakerConfig()
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = defaults.FailureThreshold
+	}
+	if config.OpenFor == 0 {
+		config.OpenFor = defaults.OpenFor
+	}
+
+	return &circuitBreakers{
+		config:   config,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// allow reports whether a call for the key may go ahead. Once the open period has passed
+// a single probe is allowed; its outcome closes the circuit or opens it again.
+func (b *circuitBreakers) allow(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[key]
+	if c == nil || c.failures < b.config.FailureThreshold {
+		return true
+	}
+	if time.Now().Before(c.openUntil) || c.probing {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// isOpen reports whether calls for the key are currently being refused
+func (b *circuitBreakers) isOpen(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[key]
+	if c == nil || c.failures < b.config.FailureThreshold {
+		return false
+	}
+	return time.Now().Before(c.openUntil) || c.probing
+}
+
+// record notes the outcome of a call for the key
+func (b *circuitBreakers) record(key string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[key]
+	if !failed {
+		if c != nil {
+			delete(b.circuits, key)
+		}
+		return
+	}
+
+	if c == nil {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	c.failures++
+	c.probing = false
+	if c.failures >= b.config.FailureThreshold {
+		c.openUntil = time.Now().Add(b.config.OpenFor)
+	}
+}
+
+// release gives up a call for the key whose outcome says nothing about the provider,
+// such as one the caller cancelled
+func (b *circuitBreakers) release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c := b.circuits[key]; c != nil {
+		c.probing = false
+	}
+}
@@ -4,19 +4,34 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"paymatch/internal/provider"
+
 	"github.com/rs/zerolog/log"
 )
 
-// HTTPClient provides common HTTP functionality for providers
+// Retry settings for calls that are safe to resend
+const (
+	maxRetries  = 2
+	baseBackoff = 250 * time.Millisecond
+)
+
+// HTTPClient provides common HTTP functionality for providers. Each provider gets its
+// own client, and with it its own connection pool and circuit breakers.
 type HTTPClient struct {
-	client  *http.Client
-	baseURL string
-	name    string // provider name for logging
+	client   *http.Client
+	timeout  time.Duration // per attempt, unless the request sets its own
+	baseURL  string
+	name     string // provider name for logging
+	breakers *circuitBreakers
 }
 
 // NewHTTPClient creates a new HTTP client with default settings
@@ -25,11 +40,16 @@ func NewHTTPClient(providerName string, timeoutSec int) *HTTPClient {
 		timeoutSec = 30 // default timeout
 	}
 
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 20
+	transport.IdleConnTimeout = 90 * time.Second
+
 	return &HTTPClient{
-		client: &http.Client{
-			Timeout: time.Duration(timeoutSec) * time.Second,
-		},
-		name: providerName,
+		client:   &http.Client{Transport: transport},
+		timeout:  time.Duration(timeoutSec) * time.Second,
+		name:     providerName,
+		breakers: newCircuitBreakers(DefaultCircuitBreakerConfig()),
 	}
 }
 
@@ -38,85 +58,171 @@ func (c *HTTPClient) SetBaseURL(baseURL string) {
 	c.baseURL = baseURL
 }
 
-// PostJSON makes a POST request with JSON payload
-func (c *HTTPClient) PostJSON(ctx context.Context, endpoint string, payload interface{}, headers map[string]string) (*HTTPResponse, error) {
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
+// Available reports whether calls with the breaker key would be let through; it is false
+// while the circuit is open
+func (c *HTTPClient) Available(breakerKey string) bool {
+	if breakerKey == "" {
+		breakerKey = c.name
 	}
+	return !c.breakers.isOpen(breakerKey)
+}
 
-	url := c.baseURL + endpoint
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// Request describes one outbound provider call
+type Request struct {
+	Method     string
+	Endpoint   string      // appended to the base URL
+	Payload    interface{} // sent as JSON when set
+	Headers    map[string]string
+	Idempotent bool          // the call may be resent after a timeout or server error
+	BreakerKey string        // calls with the same key share a circuit breaker; default: the provider
+	Timeout    time.Duration // limit for each attempt; default: the client's timeout
+	// Failed reports whether a response means the provider is failing, which makes it count
+	// against the circuit breaker and be retried. Default: any 5xx status.
+	Failed func(resp *HTTPResponse) bool
+}
+
+// failed reports whether a response means the provider is failing
+func (r Request) failed(resp *HTTPResponse) bool {
+	if r.Failed != nil {
+		return r.Failed(resp)
 	}
+	return resp.StatusCode >= 500
+}
 
-	// Set default headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", fmt.Sprintf("PayMatch/%s", c.name))
+// PostJSON makes a POST request with JSON payload. It is never resent once it may have
+// reached the provider.
+func (c *HTTPClient) PostJSON(ctx context.Context, endpoint string, payload interface{}, headers map[string]string) (*HTTPResponse, error) {
+	return c.Do(ctx, Request{Method: http.MethodPost, Endpoint: endpoint, Payload: payload, Headers: headers})
+}
 
-	// Add custom headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
+// Get makes a GET request
+func (c *HTTPClient) Get(ctx context.Context, endpoint string, headers map[string]string) (*HTTPResponse, error) {
+	return c.Do(ctx, Request{Method: http.MethodGet, Endpoint: endpoint, Headers: headers, Idempotent: true})
+}
+
+// Do makes a request through the circuit breaker. Idempotent requests are retried with
+// backoff on timeouts and server errors; any request is retried if the connection could
+// not be made, since the provider never saw it. Non-2xx responses are returned, not errors.
+func (c *HTTPClient) Do(ctx context.Context, req Request) (*HTTPResponse, error) {
+	var body []byte
+	if req.Payload != nil {
+		var err error
+		body, err = json.Marshal(req.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON payload: %w", err)
+		}
 	}
 
-	// Log the request (without sensitive data)
-	log.Debug().
-		Str("provider", c.name).
-		Str("method", "POST").
-		Str("url", url).
-		Msg("making HTTP request")
+	breakerKey := req.BreakerKey
+	if breakerKey == "" {
+		breakerKey = c.name
+	}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		log.Error().
+	for attempt := 0; ; attempt++ {
+		if !c.breakers.allow(breakerKey) {
+			log.Warn().Str("provider", c.name).Str("breaker", breakerKey).Msg("circuit open, refusing provider call")
+			return nil, &provider.ProviderError{
+				Code:    provider.ErrProviderDown,
+				Message: fmt.Sprintf("%s is unavailable after repeated failures, try again later", c.name),
+				Refused: true,
+			}
+		}
+
+		resp, err := c.send(ctx, req, body)
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the provider
+			c.breakers.release(breakerKey)
+			return nil, &provider.ProviderError{Code: provider.ErrRequestFailed, Message: fmt.Sprintf("request failed: %v", ctx.Err())}
+		}
+
+		failed := err != nil || req.failed(resp)
+		c.breakers.record(breakerKey, failed)
+		if !failed {
+			return resp, nil
+		}
+
+		retry := attempt < maxRetries && (req.Idempotent || isDialError(err))
+		if !retry {
+			if err != nil {
+				return nil, requestError(err)
+			}
+			return resp, nil
+		}
+
+		backoff := baseBackoff << attempt
+		backoff += time.Duration(rand.Int63n(int64(backoff) / 2))
+		log.Warn().
 			Str("provider", c.name).
-			Str("url", url).
-			Err(err).
-			Msg("HTTP request failed")
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
-	}
+			Str("method", req.Method).
+			Str("url", c.baseURL+req.Endpoint).
+			Int("attempt", attempt+1).
+			Dur("backoff", backoff).
+			AnErr("error", err).
+			Msg("retrying provider call")
 
-	return c.handleResponse(resp)
+		select {
+		case <-ctx.Done():
+			c.breakers.release(breakerKey)
+			return nil, &provider.ProviderError{Code: provider.ErrRequestFailed, Message: fmt.Sprintf("request failed: %v", ctx.Err())}
+		case <-time.After(backoff):
+		}
+	}
 }
 
-// Get makes a GET request
-func (c *HTTPClient) Get(ctx context.Context, endpoint string, headers map[string]string) (*HTTPResponse, error) {
-	url := c.baseURL + endpoint
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// send makes a single attempt
+func (c *HTTPClient) send(ctx context.Context, req Request, body []byte) (*HTTPResponse, error) {
+	timeout := c.timeout
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	url := c.baseURL + req.Endpoint
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, url, reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set default headers
-	req.Header.Set("User-Agent", fmt.Sprintf("PayMatch/%s", c.name))
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("User-Agent", fmt.Sprintf("PayMatch/%s", c.name))
 
 	// Add custom headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
 	}
 
 	log.Debug().
 		Str("provider", c.name).
-		Str("method", "GET").
+		Str("method", req.Method).
 		Str("url", url).
+		Str("body", redactJSON(body)).
 		Msg("making HTTP request")
 
-	resp, err := c.client.Do(req)
+	started := time.Now()
+	resp, err := c.client.Do(httpReq)
 	if err != nil {
 		log.Error().
 			Str("provider", c.name).
 			Str("url", url).
+			Dur("elapsed", time.Since(started)).
 			Err(err).
 			Msg("HTTP request failed")
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, err
 	}
 
-	return c.handleResponse(resp)
+	return c.handleResponse(resp, started)
 }
 
 // handleResponse processes the HTTP response
-func (c *HTTPClient) handleResponse(resp *http.Response) (*HTTPResponse, error) {
+func (c *HTTPClient) handleResponse(resp *http.Response, started time.Time) (*HTTPResponse, error) {
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
@@ -130,16 +236,79 @@ func (c *HTTPClient) handleResponse(resp *http.Response) (*HTTPResponse, error)
 		Body:       body,
 	}
 
-	// Log response (without sensitive data in body)
 	log.Debug().
 		Str("provider", c.name).
 		Int("status_code", resp.StatusCode).
-		Int("body_length", len(body)).
+		Dur("elapsed", time.Since(started)).
+		Str("body", redactJSON(body)).
 		Msg("received HTTP response")
 
 	return httpResp, nil
 }
 
+// requestError maps a transport failure to a provider error; timeouts get their own code
+// because the provider may still have acted on the request
+func requestError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &provider.ProviderError{Code: provider.ErrProviderTimeout, Message: fmt.Sprintf("request timed out: %v", err)}
+	}
+	return &provider.ProviderError{Code: provider.ErrRequestFailed, Message: fmt.Sprintf("request failed: %v", err)}
+}
+
+// isDialError reports whether the request failed before a connection was made
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// sensitiveKeys are JSON fields never written to logs, compared in lower case
+var sensitiveKeys = map[string]bool{
+	"password":           true,
+	"securitycredential": true,
+	"initiatorpassword":  true,
+	"client_secret":      true,
+	"consumer_secret":    true,
+	"access_token":       true,
+	"pin":                true,
+}
+
+// redactJSON renders a JSON body for logging with secret fields masked. Bodies that are
+// not JSON are summarised by size, since they cannot be checked for secrets.
+func redactJSON(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	redacted, err := json.Marshal(redactValue(data))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	return string(redacted)
+}
+
+// redactValue masks sensitive fields at any depth
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if sensitiveKeys[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
 // HTTPResponse represents an HTTP response
 type HTTPResponse struct {
 	StatusCode int
@@ -152,12 +321,12 @@ func (r *HTTPResponse) IsSuccess() bool {
 	return r.StatusCode >= 200 && r.StatusCode < 300
 }
 
-// UnmarshalJSON unmarshals the response body into the provided struct
-func (r *HTTPResponse) UnmarshalJSON(v interface{}) error {
+// DecodeJSON unmarshals the response body into the provided struct
+func (r *HTTPResponse) DecodeJSON(v interface{}) error {
 	return json.Unmarshal(r.Body, v)
 }
 
 // String returns the response body as a string
 func (r *HTTPResponse) String() string {
 	return string(r.Body)
-}
\ No newline at end of file
+}
@@ -0,0 +1,94 @@
+package base
+
+import (
+	"sync"
+	"time"
+
+	"paymatch/internal/provider"
+)
+
+// SettingsStore holds a provider's settings per environment, with a request validator
+// built from each environment's limits
+type SettingsStore struct {
+	country  string
+	defaults func(environment string) provider.Settings
+	mu       sync.RWMutex
+	settings map[string]provider.Settings
+	checks   map[string]*RequestValidator
+}
+
+// NewSettingsStore creates a settings store; defaults returns the built-in settings of an environment
+func NewSettingsStore(country string, defaults func(environment string) provider.Settings) *SettingsStore {
+	return &SettingsStore{
+		country:  country,
+		defaults: defaults,
+		settings: make(map[string]provider.Settings),
+		checks:   make(map[string]*RequestValidator),
+	}
+}
+
+// Apply replaces an environment's settings; zero fields take the defaults
+func (s *SettingsStore) Apply(environment string, settings provider.Settings) {
+	defaults := s.defaults(environment)
+	if settings.BaseURL == "" {
+		settings.BaseURL = defaults.BaseURL
+	}
+	if settings.TimeoutSeconds <= 0 {
+		settings.TimeoutSeconds = defaults.TimeoutSeconds
+	}
+	if settings.MinAmount <= 0 {
+		settings.MinAmount = defaults.MinAmount
+	}
+	if settings.MaxAmount <= 0 {
+		settings.MaxAmount = defaults.MaxAmount
+	}
+	if settings.Currency == "" {
+		settings.Currency = defaults.Currency
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(environment, settings)
+}
+
+// put stores an environment's settings and validator; callers hold s.mu
+func (s *SettingsStore) put(environment string, settings provider.Settings) *RequestValidator {
+	validator := NewRequestValidator(s.country, settings.Currency, int(settings.MinAmount), int(settings.MaxAmount))
+	s.settings[environment] = settings
+	s.checks[environment] = validator
+	return validator
+}
+
+// Get returns an environment's settings
+func (s *SettingsStore) Get(environment string) provider.Settings {
+	s.mu.RLock()
+	settings, ok := s.settings[environment]
+	s.mu.RUnlock()
+	if !ok {
+		return s.defaults(environment)
+	}
+	return settings
+}
+
+// Timeout returns how long a call in the environment may take
+func (s *SettingsStore) Timeout(environment string) time.Duration {
+	return time.Duration(s.Get(environment).TimeoutSeconds) * time.Second
+}
+
+// Validator returns the request validator for an environment's limits
+func (s *SettingsStore) Validator(environment string) *RequestValidator {
+	s.mu.RLock()
+	validator, ok := s.checks[environment]
+	s.mu.RUnlock()
+	if ok {
+		return validator
+	}
+
+	// Nothing applied yet: build one from the defaults, unless settings arrived meanwhile
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if validator, ok := s.checks[environment]; ok {
+		return validator
+	}
+	return s.put(environment, s.defaults(environment))
+}
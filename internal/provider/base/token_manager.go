@@ -0,0 +1,166 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// Token is a provider OAuth access token
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+	RefreshAt time.Time // when a replacement is fetched in the background
+}
+
+// TokenStore shares tokens between API replicas so each credential is only
+// authenticated once. GetToken returns nil without an error for unknown keys.
+type TokenStore interface {
+	GetToken(ctx context.Context, key string) (*Token, error)
+	SetToken(ctx context.Context, key string, token *Token) error
+}
+
+// TokenFetcher requests a new token from the provider. RefreshAt is filled in by the manager.
+type TokenFetcher func(ctx context.Context) (*Token, error)
+
+// TokenManagerConfig holds configuration for the token manager
+type TokenManagerConfig struct {
+	Store         TokenStore    // optional; tokens are only kept in memory without it
+	RefreshBefore time.Duration // tokens are refreshed this long before they expire
+	MinValidity   time.Duration // tokens closer than this to expiry are never handed out
+}
+
+// DefaultTokenManagerConfig returns sensible defaults for the token manager
+func DefaultTokenManagerConfig() TokenManagerConfig {
+	return TokenManagerConfig{
+		RefreshBefore: 5 * time.Minute,
+		MinValidity:   30 * time.Second,
+	}
+}
+
+// TokenManager caches provider access tokens. Concurrent callers that find no usable
+// token share one fetch, and tokens nearing expiry are replaced in the background
+// while the current one is still handed out.
+type TokenManager struct {
+	config TokenManagerConfig
+	mu     sync.RWMutex
+	tokens map[string]*Token
+	group  singleflight.Group
+}
+
+// NewTokenManager creates a new token manager
+func NewTokenManager(config TokenManagerConfig) *TokenManager {
+	defaults := DefaultTokenManagerConfig()
+	if config.RefreshBefore == 0 {
+		config.RefreshBefore = defaults.RefreshBefore
+	}
+	if config.MinValidity == 0 {
+		config.MinValidity = defaults.MinValidity
+	}
+
+	return &TokenManager{
+		config: config,
+		tokens: make(map[string]*Token),
+	}
+}
+
+// Token returns a usable token for the key, fetching one if needed
+func (m *TokenManager) Token(ctx context.Context, key string, fetch TokenFetcher) (string, error) {
+	now := time.Now()
+	if token := m.cached(key); m.usable(token, now) {
+		if !now.Before(token.RefreshAt) {
+			// Refresh in the background; DoChan joins a refresh already under way
+			m.group.DoChan(key, func() (interface{}, error) {
+				return m.load(context.WithoutCancel(ctx), key, fetch)
+			})
+		}
+		return token.Value, nil
+	}
+
+	// The fetch is shared by every waiting caller, so one caller giving up must not cancel it
+	v, err, _ := m.group.Do(key, func() (interface{}, error) {
+		return m.load(context.WithoutCancel(ctx), key, fetch)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(*Token).Value, nil
+}
+
+// load returns a token that is not yet due for refresh, taking it from memory, the shared
+// store or the provider in that order
+func (m *TokenManager) load(ctx context.Context, key string, fetch TokenFetcher) (*Token, error) {
+	now := time.Now()
+	current := m.cached(key)
+	if m.fresh(current, now) {
+		return current, nil
+	}
+
+	if m.config.Store != nil {
+		stored, err := m.config.Store.GetToken(ctx, key)
+		if err != nil {
+			log.Warn().Err(err).Str("token_key", key).Msg("failed to read shared token")
+		} else if m.fresh(stored, now) {
+			m.remember(key, stored)
+			return stored, nil
+		}
+	}
+
+	token, err := fetch(ctx)
+	if err != nil {
+		if m.usable(current, time.Now()) {
+			// The current token still works; the next call tries again
+			log.Warn().Err(err).Str("token_key", key).Msg("failed to refresh token, keeping current one")
+			return current, nil
+		}
+		return nil, err
+	}
+	if token.Value == "" {
+		return nil, fmt.Errorf("provider returned an empty access token")
+	}
+
+	// Refresh early, but never sooner than halfway through the token's life
+	lead := m.config.RefreshBefore
+	if lifetime := token.ExpiresAt.Sub(now); lead > lifetime/2 {
+		lead = lifetime / 2
+	}
+	token.RefreshAt = token.ExpiresAt.Add(-lead)
+
+	m.remember(key, token)
+	if m.config.Store != nil {
+		if err := m.config.Store.SetToken(ctx, key, token); err != nil {
+			log.Warn().Err(err).Str("token_key", key).Msg("failed to share token")
+		}
+	}
+
+	log.Debug().Str("token_key", key).Time("expires_at", token.ExpiresAt).Msg("access token refreshed")
+	return token, nil
+}
+
+// cached returns the token held in memory for the key
+func (m *TokenManager) cached(key string) *Token {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tokens[key]
+}
+
+// remember keeps a token in memory
+func (m *TokenManager) remember(key string, token *Token) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[key] = token
+}
+
+// usable reports whether the token can still be sent to the provider
+func (m *TokenManager) usable(token *Token, now time.Time) bool {
+	return token != nil && token.ExpiresAt.After(now.Add(m.config.MinValidity))
+}
+
+// fresh reports whether the token is usable and not yet due for refresh
+func (m *TokenManager) fresh(token *Token, now time.Time) bool {
+	return m.usable(token, now) && now.Before(token.RefreshAt)
+}
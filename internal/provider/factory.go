@@ -15,6 +15,7 @@ func NewProviderRegistry(cfg config.Cfg, credentialRepo repositories.CredentialR
 func GetAvailableProviders() []ProviderType {
 	return []ProviderType{
 		ProviderMpesa,
+		ProviderAirtelMoney,
 		// Add other providers here as they become available
 	}
 }
@@ -1,15 +1,15 @@
 package mpesa
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"paymatch/internal/config"
@@ -24,26 +24,26 @@ import (
 type Provider struct {
 	cfg        config.Cfg
 	httpClient *base.HTTPClient
-	validator  *base.RequestValidator
-	tokenCache map[string]*accessToken
+	settings   *base.SettingsStore
+	certs      *certificateStore
+	tokens     *base.TokenManager
 }
 
-// accessToken represents cached M-Pesa access token
-type accessToken struct {
-	Token     string
-	ExpiresAt time.Time
+// New creates a new M-Pesa provider instance that keeps its own access tokens
+func New(cfg config.Cfg) provider.Provider {
+	return NewWithTokens(cfg, base.NewTokenManager(base.DefaultTokenManagerConfig()))
 }
 
-// New creates a new M-Pesa provider instance
-func New(cfg config.Cfg) provider.Provider {
-	httpClient := base.NewHTTPClient("mpesa", 30)                // 30 second timeout
-	validator := base.NewRequestValidator("KE", "KES", 1, 70000) // Kenya limits
+// NewWithTokens creates a new M-Pesa provider instance that shares the given token manager
+func NewWithTokens(cfg config.Cfg, tokens *base.TokenManager) provider.Provider {
+	httpClient := base.NewHTTPClient("mpesa", 30) // 30 second timeout
 
 	return &Provider{
 		cfg:        cfg,
 		httpClient: httpClient,
-		validator:  validator,
-		tokenCache: make(map[string]*accessToken),
+		settings:   base.NewSettingsStore("KE", defaultSettings),
+		certs:      newCertificateStore(cfg.Mpesa.SandboxCertPath, cfg.Mpesa.ProductionCertPath),
+		tokens:     tokens,
 	}
 }
 
@@ -60,6 +60,8 @@ func (p *Provider) SupportedOperations() []provider.OperationType {
 		provider.OpB2C,
 		provider.OpBalance,
 		provider.OpStatus,
+		provider.OpReverse,
+		provider.OpSTKQuery,
 		// M-Pesa doesn't support bulk transfers natively
 	}
 }
@@ -91,6 +93,18 @@ func (p *Provider) RequiredCredentialFields() []provider.CredentialField {
 			Type:        "password",
 			Required:    true,
 		},
+		{
+			Name:        "initiator_name",
+			DisplayName: "Initiator Name (B2C, balance and status)",
+			Type:        "text",
+			Required:    false,
+		},
+		{
+			Name:        "initiator_password",
+			DisplayName: "Initiator Password (B2C, balance and status)",
+			Type:        "password",
+			Required:    false,
+		},
 		{
 			Name:        "environment",
 			DisplayName: "Environment",
@@ -110,7 +124,7 @@ func (p *Provider) RequiredCredentialFields() []provider.CredentialField {
 // STKPush initiates STK push payment
 func (p *Provider) STKPush(ctx context.Context, cred *credential.ProviderCredential, req provider.STKPushReq) (*provider.STKPushResp, error) {
 	// Validate request
-	if err := p.validator.ValidateSTKPushReq(&req); err != nil {
+	if err := p.settings.Validator(string(cred.Environment)).ValidateSTKPushReq(&req); err != nil {
 		return nil, err
 	}
 
@@ -155,7 +169,7 @@ func (p *Provider) STKPush(ctx context.Context, cred *credential.ProviderCredent
 	baseURL := p.getBaseURL(string(cred.Environment))
 	url := baseURL + "/mpesa/stkpush/v1/processrequest"
 
-	responseBody, err := p.makeAuthenticatedRequest(ctx, "POST", url, token, payload)
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, false)
 	if err != nil {
 		return nil, err
 	}
@@ -180,17 +194,11 @@ func (p *Provider) STKPush(ctx context.Context, cred *credential.ProviderCredent
 
 	// Check for errors
 	if response.ErrorCode != "" {
-		return nil, &provider.ProviderError{
-			Code:    response.ErrorCode,
-			Message: response.ErrorMessage,
-		}
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
 	}
 
 	if response.ResponseCode != "0" {
-		return nil, &provider.ProviderError{
-			Code:    "stk_failed",
-			Message: response.ResponseDescription,
-		}
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
 	}
 
 	p.logOperation("stk_push", map[string]interface{}{
@@ -209,10 +217,124 @@ func (p *Provider) STKPush(ctx context.Context, cred *credential.ProviderCredent
 	}, nil
 }
 
+// stkQueryInProgress is the error Daraja answers an STK query with while the customer has not acted yet
+const stkQueryInProgress = "500.001.1001"
+
+// STKQuery looks up an STK push by its checkout request ID, for when the callback never arrives
+func (p *Provider) STKQuery(ctx context.Context, cred *credential.ProviderCredential, checkoutRequestID string) (*provider.STKQueryResp, error) {
+	if checkoutRequestID == "" {
+		return nil, &provider.ProviderError{
+			Code:    "invalid_request",
+			Message: "checkout request ID is required",
+		}
+	}
+
+	// Get access token
+	token, err := p.getAccessToken(ctx, cred)
+	if err != nil {
+		return nil, &provider.ProviderError{
+			Code:    "auth_failed",
+			Message: fmt.Sprintf("failed to get access token: %v", err),
+		}
+	}
+
+	// Same password scheme as the push itself
+	timestamp := time.Now().Format("20060102150405")
+	password := base64.StdEncoding.EncodeToString([]byte(cred.Shortcode + cred.GetDecryptedField("passkey", p.cfg.Sec.AESKey) + timestamp))
+
+	payload := map[string]interface{}{
+		"BusinessShortCode": cred.Shortcode,
+		"Password":          password,
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": checkoutRequestID,
+	}
+
+	// Make request
+	baseURL := p.getBaseURL(string(cred.Environment))
+	url := baseURL + "/mpesa/stkpushquery/v1/query"
+
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, true)
+	if err != nil {
+		// Daraja reports a prompt the customer has not answered yet as an HTTP error
+		var providerErr *provider.ProviderError
+		if errors.As(err, &providerErr) && providerErr.ProviderErr == stkQueryInProgress {
+			return &provider.STKQueryResp{
+				ExternalID: checkoutRequestID,
+				Status:     provider.StatusPending,
+				Message:    "The transaction is being processed",
+			}, nil
+		}
+		return nil, err
+	}
+
+	// Parse response; ResultCode comes back as a string, but tolerate a number
+	var response struct {
+		CheckoutRequestID   string      `json:"CheckoutRequestID"`
+		ResponseCode        string      `json:"ResponseCode"`
+		ResponseDescription string      `json:"ResponseDescription"`
+		ResultCode          json.Number `json:"ResultCode"`
+		ResultDesc          string      `json:"ResultDesc"`
+		ErrorCode           string      `json:"errorCode"`
+		ErrorMessage        string      `json:"errorMessage"`
+	}
+
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, &provider.ProviderError{
+			Code:    "response_parse_failed",
+			Message: fmt.Sprintf("failed to parse STK query response: %v", err),
+		}
+	}
+
+	// Check for errors
+	if response.ErrorCode == stkQueryInProgress {
+		return &provider.STKQueryResp{
+			ExternalID: checkoutRequestID,
+			Status:     provider.StatusPending,
+			Message:    response.ErrorMessage,
+		}, nil
+	}
+	if response.ErrorCode != "" {
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
+	}
+
+	if response.ResponseCode != "0" {
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
+	}
+
+	resultCode := response.ResultCode.String()
+	status, errorCode := resultOutcome(resultCode, true)
+
+	p.logOperation("stk_query", map[string]interface{}{
+		"checkout_request_id": checkoutRequestID,
+		"result_code":         resultCode,
+		"status":              status,
+		"shortcode":           cred.Shortcode,
+	})
+
+	return &provider.STKQueryResp{
+		ExternalID: checkoutRequestID,
+		Status:     status,
+		ResultCode: resultCode,
+		ErrorCode:  errorCode,
+		Message:    response.ResultDesc,
+	}, nil
+}
+
 // B2C initiates business to customer transfer
 func (p *Provider) B2C(ctx context.Context, cred *credential.ProviderCredential, req provider.B2CReq) (*provider.B2CResp, error) {
+	if req.CommandID == "" {
+		req.CommandID = "BusinessPayment"
+	}
+	// Results and queue timeouts come back to this service by default
+	if req.ResultURL == "" {
+		req.ResultURL = p.callbackBaseURL() + "/webhooks/" + cred.Shortcode
+	}
+	if req.TimeoutURL == "" {
+		req.TimeoutURL = p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/timeout"
+	}
+
 	// Validate request
-	if err := p.validator.ValidateB2CReq(&req); err != nil {
+	if err := p.settings.Validator(string(cred.Environment)).ValidateB2CReq(&req); err != nil {
 		return nil, err
 	}
 
@@ -225,6 +347,11 @@ func (p *Provider) B2C(ctx context.Context, cred *credential.ProviderCredential,
 		}
 	}
 
+	initiatorName, securityCredential, err := p.getInitiator(cred)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate originator conversation ID
 	originatorID, err := p.generateConversationID()
 	if err != nil {
@@ -236,9 +363,9 @@ func (p *Provider) B2C(ctx context.Context, cred *credential.ProviderCredential,
 
 	// Build request payload
 	payload := map[string]interface{}{
-		"InitiatorName":              "testapi", // This should be configurable
-		"SecurityCredential":         p.getSecurityCredential(cred),
-		"CommandID":                  "BusinessPayment",
+		"InitiatorName":              initiatorName,
+		"SecurityCredential":         securityCredential,
+		"CommandID":                  req.CommandID,
 		"Amount":                     req.Amount,
 		"PartyA":                     cred.Shortcode,
 		"PartyB":                     req.PhoneNumber,
@@ -253,7 +380,7 @@ func (p *Provider) B2C(ctx context.Context, cred *credential.ProviderCredential,
 	baseURL := p.getBaseURL(string(cred.Environment))
 	url := baseURL + "/mpesa/b2c/v1/paymentrequest"
 
-	responseBody, err := p.makeAuthenticatedRequest(ctx, "POST", url, token, payload)
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, false)
 	if err != nil {
 		return nil, err
 	}
@@ -277,17 +404,11 @@ func (p *Provider) B2C(ctx context.Context, cred *credential.ProviderCredential,
 
 	// Check for errors
 	if response.ErrorCode != "" {
-		return nil, &provider.ProviderError{
-			Code:    response.ErrorCode,
-			Message: response.ErrorMessage,
-		}
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
 	}
 
 	if response.ResponseCode != "0" {
-		return nil, &provider.ProviderError{
-			Code:    "b2c_failed",
-			Message: response.ResponseDescription,
-		}
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
 	}
 
 	p.logOperation("b2c_transfer", map[string]interface{}{
@@ -313,6 +434,196 @@ func (p *Provider) BulkTransfer(ctx context.Context, cred *credential.ProviderCr
 	}
 }
 
+// RegisterC2BURLs registers the shortcode's C2B validation and confirmation URLs with Daraja.
+// Safaricom only calls the validation URL when external validation is enabled on the shortcode.
+func (p *Provider) RegisterC2BURLs(ctx context.Context, cred *credential.ProviderCredential, req provider.C2BRegisterReq) (*provider.C2BRegisterResp, error) {
+	if req.ResponseType == "" {
+		req.ResponseType = "Completed"
+	}
+	if req.ResponseType != "Completed" && req.ResponseType != "Cancelled" {
+		return nil, &provider.ProviderError{
+			Code:    "invalid_request",
+			Message: "response_type must be Completed or Cancelled",
+		}
+	}
+	if req.ConfirmationURL == "" {
+		req.ConfirmationURL = p.callbackBaseURL() + "/webhooks/" + cred.Shortcode
+	}
+	if req.ValidationURL == "" {
+		req.ValidationURL = p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/c2b/validation"
+	}
+
+	// Get access token
+	token, err := p.getAccessToken(ctx, cred)
+	if err != nil {
+		return nil, &provider.ProviderError{
+			Code:    "auth_failed",
+			Message: fmt.Sprintf("failed to get access token: %v", err),
+		}
+	}
+
+	// Build request payload
+	payload := map[string]interface{}{
+		"ShortCode":       cred.Shortcode,
+		"ResponseType":    req.ResponseType,
+		"ConfirmationURL": req.ConfirmationURL,
+		"ValidationURL":   req.ValidationURL,
+	}
+
+	// Make request
+	baseURL := p.getBaseURL(string(cred.Environment))
+	url := baseURL + "/mpesa/c2b/v1/registerurl"
+
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response (Daraja spells the conversation ID field "OriginatorCoversationID")
+	var response struct {
+		OriginatorConversationID string `json:"OriginatorCoversationID"`
+		ResponseCode             string `json:"ResponseCode"`
+		ResponseDescription      string `json:"ResponseDescription"`
+		ErrorCode                string `json:"errorCode"`
+		ErrorMessage             string `json:"errorMessage"`
+	}
+
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, &provider.ProviderError{
+			Code:    "response_parse_failed",
+			Message: fmt.Sprintf("failed to parse C2B register response: %v", err),
+		}
+	}
+
+	// Check for errors
+	if response.ErrorCode != "" {
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
+	}
+
+	if response.ResponseCode != "0" {
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
+	}
+
+	p.logOperation("c2b_register_url", map[string]interface{}{
+		"shortcode":        cred.Shortcode,
+		"response_type":    req.ResponseType,
+		"confirmation_url": req.ConfirmationURL,
+		"validation_url":   req.ValidationURL,
+	})
+
+	return &provider.C2BRegisterResp{
+		Status:            provider.StatusCompleted,
+		Message:           response.ResponseDescription,
+		ConfirmationURL:   req.ConfirmationURL,
+		ValidationURL:     req.ValidationURL,
+		ProviderReference: response.OriginatorConversationID,
+	}, nil
+}
+
+// Reverse asks Daraja to reverse a completed transaction back to the payer. The outcome
+// arrives asynchronously on the result URL.
+func (p *Provider) Reverse(ctx context.Context, cred *credential.ProviderCredential, req provider.ReverseReq) (*provider.ReverseResp, error) {
+	if req.TransactionID == "" {
+		return nil, &provider.ProviderError{
+			Code:    "invalid_request",
+			Message: "transaction_id is required",
+		}
+	}
+	if req.Amount <= 0 {
+		return nil, &provider.ProviderError{
+			Code:    "invalid_request",
+			Message: "amount must be positive",
+		}
+	}
+	if req.Remarks == "" {
+		req.Remarks = "Transaction reversal"
+	}
+	if req.ResultURL == "" {
+		req.ResultURL = p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/reversal"
+	}
+	if req.TimeoutURL == "" {
+		req.TimeoutURL = p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/timeout"
+	}
+
+	// Get access token
+	token, err := p.getAccessToken(ctx, cred)
+	if err != nil {
+		return nil, &provider.ProviderError{
+			Code:    "auth_failed",
+			Message: fmt.Sprintf("failed to get access token: %v", err),
+		}
+	}
+
+	initiatorName, securityCredential, err := p.getInitiator(cred)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build request payload (Daraja spells the identifier type field "RecieverIdentifierType")
+	payload := map[string]interface{}{
+		"Initiator":              initiatorName,
+		"SecurityCredential":     securityCredential,
+		"CommandID":              "TransactionReversal",
+		"TransactionID":          req.TransactionID,
+		"Amount":                 req.Amount,
+		"ReceiverParty":          cred.Shortcode,
+		"RecieverIdentifierType": "11",
+		"ResultURL":              req.ResultURL,
+		"QueueTimeOutURL":        req.TimeoutURL,
+		"Remarks":                req.Remarks,
+		"Occasion":               req.Occasion,
+	}
+
+	// Make request
+	baseURL := p.getBaseURL(string(cred.Environment))
+	url := baseURL + "/mpesa/reversal/v1/request"
+
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response
+	var response struct {
+		ConversationID           string `json:"ConversationID"`
+		OriginatorConversationID string `json:"OriginatorConversationID"`
+		ResponseCode             string `json:"ResponseCode"`
+		ResponseDescription      string `json:"ResponseDescription"`
+		ErrorCode                string `json:"errorCode"`
+		ErrorMessage             string `json:"errorMessage"`
+	}
+
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, &provider.ProviderError{
+			Code:    "response_parse_failed",
+			Message: fmt.Sprintf("failed to parse reversal response: %v", err),
+		}
+	}
+
+	// Check for errors
+	if response.ErrorCode != "" {
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
+	}
+
+	if response.ResponseCode != "0" {
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
+	}
+
+	p.logOperation("reversal", map[string]interface{}{
+		"conversation_id": response.ConversationID,
+		"transaction_id":  req.TransactionID,
+		"amount":          req.Amount,
+		"shortcode":       cred.Shortcode,
+	})
+
+	return &provider.ReverseResp{
+		ExternalID:        response.ConversationID,
+		Status:            provider.StatusPending,
+		Message:           response.ResponseDescription,
+		ProviderReference: response.OriginatorConversationID,
+	}, nil
+}
+
 // CheckBalance checks account balance
 func (p *Provider) CheckBalance(ctx context.Context, cred *credential.ProviderCredential) (*provider.BalanceResp, error) {
 	// Get access token
@@ -324,23 +635,28 @@ func (p *Provider) CheckBalance(ctx context.Context, cred *credential.ProviderCr
 		}
 	}
 
+	initiatorName, securityCredential, err := p.getInitiator(cred)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build request payload
 	payload := map[string]interface{}{
-		"Initiator":              "testapi", // This should be configurable
-		"SecurityCredential":     p.getSecurityCredential(cred),
+		"Initiator":              initiatorName,
+		"SecurityCredential":     securityCredential,
 		"CommandID":              "AccountBalance",
 		"PartyA":                 cred.Shortcode,
 		"IdentifierType":         "4",
 		"Remarks":                "Balance inquiry",
-		"QueueTimeOutURL":        p.cfg.App.BaseURL + "/webhooks/" + cred.Shortcode + "/timeout",
-		"ResultURL":              p.cfg.App.BaseURL + "/webhooks/" + cred.Shortcode + "/result",
+		"QueueTimeOutURL":        p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/timeout",
+		"ResultURL":              p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/result",
 	}
 
 	// Make request
 	baseURL := p.getBaseURL(string(cred.Environment))
 	url := baseURL + "/mpesa/accountbalance/v1/query"
 
-	responseBody, err := p.makeAuthenticatedRequest(ctx, "POST", url, token, payload)
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, true)
 	if err != nil {
 		return nil, err
 	}
@@ -364,17 +680,11 @@ func (p *Provider) CheckBalance(ctx context.Context, cred *credential.ProviderCr
 
 	// Check for errors
 	if response.ErrorCode != "" {
-		return nil, &provider.ProviderError{
-			Code:    response.ErrorCode,
-			Message: response.ErrorMessage,
-		}
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
 	}
 
 	if response.ResponseCode != "0" {
-		return nil, &provider.ProviderError{
-			Code:    "balance_failed",
-			Message: response.ResponseDescription,
-		}
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
 	}
 
 	p.logOperation("balance_inquiry", map[string]interface{}{
@@ -382,10 +692,12 @@ func (p *Provider) CheckBalance(ctx context.Context, cred *credential.ProviderCr
 		"shortcode":       cred.Shortcode,
 	})
 
+	// The balance itself arrives on the result URL
 	return &provider.BalanceResp{
-		ExternalID: response.ConversationID,
-		Status:     provider.StatusPending,
-		Message:    response.ResponseDescription,
+		ExternalID:        response.ConversationID,
+		Status:            provider.StatusPending,
+		Message:           response.ResponseDescription,
+		ProviderReference: response.OriginatorConversationID,
 	}, nil
 }
 
@@ -400,17 +712,22 @@ func (p *Provider) GetTransactionStatus(ctx context.Context, cred *credential.Pr
 		}
 	}
 
+	initiatorName, securityCredential, err := p.getInitiator(cred)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build request payload
 	payload := map[string]interface{}{
-		"Initiator":              "testapi", // This should be configurable
-		"SecurityCredential":     p.getSecurityCredential(cred),
+		"Initiator":              initiatorName,
+		"SecurityCredential":     securityCredential,
 		"CommandID":              "TransactionStatusQuery",
 		"TransactionID":          externalID,
 		"PartyA":                 cred.Shortcode,
 		"IdentifierType":         "4",
 		"Remarks":                "Transaction status query",
-		"QueueTimeOutURL":        p.cfg.App.BaseURL + "/webhooks/" + cred.Shortcode + "/timeout",
-		"ResultURL":              p.cfg.App.BaseURL + "/webhooks/" + cred.Shortcode + "/result",
+		"QueueTimeOutURL":        p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/timeout",
+		"ResultURL":              p.callbackBaseURL() + "/webhooks/" + cred.Shortcode + "/result",
 		"Occasion":               "Status Check",
 	}
 
@@ -418,7 +735,7 @@ func (p *Provider) GetTransactionStatus(ctx context.Context, cred *credential.Pr
 	baseURL := p.getBaseURL(string(cred.Environment))
 	url := baseURL + "/mpesa/transactionstatus/v1/query"
 
-	responseBody, err := p.makeAuthenticatedRequest(ctx, "POST", url, token, payload)
+	responseBody, err := p.makeAuthenticatedRequest(ctx, cred, url, token, payload, true)
 	if err != nil {
 		return nil, err
 	}
@@ -442,17 +759,11 @@ func (p *Provider) GetTransactionStatus(ctx context.Context, cred *credential.Pr
 
 	// Check for errors
 	if response.ErrorCode != "" {
-		return nil, &provider.ProviderError{
-			Code:    response.ErrorCode,
-			Message: response.ErrorMessage,
-		}
+		return nil, apiError(http.StatusOK, response.ErrorCode, response.ErrorMessage)
 	}
 
 	if response.ResponseCode != "0" {
-		return nil, &provider.ProviderError{
-			Code:    "status_failed",
-			Message: response.ResponseDescription,
-		}
+		return nil, responseError(response.ResponseCode, response.ResponseDescription)
 	}
 
 	p.logOperation("status_query", map[string]interface{}{
@@ -461,11 +772,13 @@ func (p *Provider) GetTransactionStatus(ctx context.Context, cred *credential.Pr
 		"shortcode":       cred.Shortcode,
 	})
 
+	// The transaction's status arrives on the result URL
 	return &provider.StatusResp{
-		ExternalID:    externalID,
-		Status:        provider.StatusPending,
-		Message:       response.ResponseDescription,
-		ConversationID: response.ConversationID,
+		ExternalID:        externalID,
+		Status:            provider.StatusPending,
+		Message:           response.ResponseDescription,
+		ConversationID:    response.ConversationID,
+		ProviderReference: response.OriginatorConversationID,
 	}, nil
 }
 
@@ -481,12 +794,49 @@ func (p *Provider) ValidateWebhook(body []byte, headers map[string]string, webho
 	return webhookService.Validate(body, headers, webhookToken)
 }
 
-// getBaseURL returns the appropriate base URL for the environment
-func (p *Provider) getBaseURL(environment string) string {
+// ApplySettings replaces the endpoint and limits used for an environment
+func (p *Provider) ApplySettings(environment string, settings provider.Settings) {
+	p.settings.Apply(environment, settings)
+}
+
+// Available reports whether calls for the credential are being let through
+func (p *Provider) Available(cred *credential.ProviderCredential) bool {
+	return p.httpClient.Available(credentialKey(cred))
+}
+
+// defaultSettings returns the Daraja endpoint and Kenyan limits for an environment
+func defaultSettings(environment string) provider.Settings {
+	settings := provider.Settings{
+		BaseURL:        "https://sandbox.safaricom.co.ke",
+		TimeoutSeconds: 30,
+		MinAmount:      1,
+		MaxAmount:      70000,
+		Currency:       "KES",
+	}
 	if environment == "production" {
-		return "https://api.safaricom.co.ke"
+		settings.BaseURL = "https://api.safaricom.co.ke"
+	}
+	return settings
+}
+
+// getBaseURL returns the Daraja base URL for the environment; one set in the process
+// environment wins over the provider settings
+func (p *Provider) getBaseURL(environment string) string {
+	if environment == "production" && p.cfg.Mpesa.ProductionBaseURL != "" {
+		return p.cfg.Mpesa.ProductionBaseURL
 	}
-	return "https://sandbox.safaricom.co.ke"
+	if environment != "production" && p.cfg.Mpesa.SandboxBaseURL != "" {
+		return p.cfg.Mpesa.SandboxBaseURL
+	}
+	return strings.TrimSuffix(p.settings.Get(environment).BaseURL, "/")
+}
+
+// callbackBaseURL returns the public base URL Daraja should call back on
+func (p *Provider) callbackBaseURL() string {
+	if base := p.cfg.CBBaseURL(); base != "" {
+		return base
+	}
+	return p.cfg.App.BaseURL
 }
 
 // logOperation logs provider operations for debugging
@@ -500,18 +850,19 @@ func (p *Provider) logOperation(operation string, details map[string]interface{}
 
 // getAccessToken retrieves or generates an access token for M-Pesa API
 func (p *Provider) getAccessToken(ctx context.Context, cred *credential.ProviderCredential) (string, error) {
-	// Check cache first
-	cacheKey := cred.Shortcode + "_" + string(cred.Environment)
-	if token, exists := p.tokenCache[cacheKey]; exists && token.ExpiresAt.After(time.Now().Add(5*time.Minute)) {
-		return token.Token, nil
-	}
+	return p.tokens.Token(ctx, credentialKey(cred), func(ctx context.Context) (*base.Token, error) {
+		return p.fetchAccessToken(ctx, cred)
+	})
+}
 
+// fetchAccessToken requests a new access token from the Daraja OAuth endpoint
+func (p *Provider) fetchAccessToken(ctx context.Context, cred *credential.ProviderCredential) (*base.Token, error) {
 	// Get credentials
 	consumerKey := cred.GetDecryptedField("consumer_key", p.cfg.Sec.AESKey)
 	consumerSecret := cred.GetDecryptedField("consumer_secret", p.cfg.Sec.AESKey)
 	
 	if consumerKey == "" || consumerSecret == "" {
-		return "", fmt.Errorf("missing consumer key or secret")
+		return nil, fmt.Errorf("missing consumer key or secret")
 	}
 
 	// Create basic auth
@@ -521,24 +872,21 @@ func (p *Provider) getAccessToken(ctx context.Context, cred *credential.Provider
 	baseURL := p.getBaseURL(string(cred.Environment))
 	url := baseURL + "/oauth/v1/generate?grant_type=client_credentials"
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create auth request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Basic "+auth)
-	req.Header.Set("Content-Type", "application/json")
-
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	// Token requests change nothing at the provider, so they are safe to retry
+	resp, err := p.httpClient.Do(ctx, base.Request{
+		Method:     http.MethodGet,
+		Endpoint:   url,
+		Headers:    map[string]string{"Authorization": "Basic " + auth},
+		Idempotent: true,
+		BreakerKey: credentialKey(cred),
+		Timeout:    p.settings.Timeout(string(cred.Environment)),
+	})
 	if err != nil {
-		return "", fmt.Errorf("auth request failed: %w", err)
+		return nil, fmt.Errorf("auth request failed: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("auth failed with status %d", resp.StatusCode)
+		return nil, fmt.Errorf("auth failed with status %d", resp.StatusCode)
 	}
 
 	// Parse response
@@ -547,8 +895,8 @@ func (p *Provider) getAccessToken(ctx context.Context, cred *credential.Provider
 		ExpiresIn   string `json:"expires_in"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&authResponse); err != nil {
-		return "", fmt.Errorf("failed to parse auth response: %w", err)
+	if err := resp.DecodeJSON(&authResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse auth response: %w", err)
 	}
 
 	// Parse expiry
@@ -557,58 +905,58 @@ func (p *Provider) getAccessToken(ctx context.Context, cred *credential.Provider
 		expiresIn = 3600 // Default to 1 hour
 	}
 
-	// Cache token
-	p.tokenCache[cacheKey] = &accessToken{
-		Token:     authResponse.AccessToken,
+	return &base.Token{
+		Value:     authResponse.AccessToken,
 		ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second),
-	}
-
-	return authResponse.AccessToken, nil
+	}, nil
 }
 
-// makeAuthenticatedRequest makes an authenticated request to M-Pesa API
-func (p *Provider) makeAuthenticatedRequest(ctx context.Context, method, url, token string, payload interface{}) ([]byte, error) {
-	var body []byte
-	var err error
-
-	if payload != nil {
-		body, err = json.Marshal(payload)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal payload: %w", err)
-		}
-	}
-
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
+// makeAuthenticatedRequest makes an authenticated POST request to M-Pesa API. Only
+// idempotent requests are resent after a timeout or server error.
+func (p *Provider) makeAuthenticatedRequest(ctx context.Context, cred *credential.ProviderCredential, url, token string, payload interface{}, idempotent bool) ([]byte, error) {
+	resp, err := p.httpClient.Do(ctx, base.Request{
+		Method:     http.MethodPost,
+		Endpoint:   url,
+		Payload:    payload,
+		Headers:    map[string]string{"Authorization": "Bearer " + token},
+		Idempotent: idempotent,
+		BreakerKey: credentialKey(cred),
+		Timeout:    p.settings.Timeout(string(cred.Environment)),
+		Failed:     serverFailed,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, &provider.ProviderError{
-			Code:    "request_failed",
-			Message: fmt.Sprintf("request failed: %v", err),
+	if !resp.IsSuccess() {
+		var body struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
 		}
+		if err := resp.DecodeJSON(&body); err != nil || body.ErrorMessage == "" {
+			body.ErrorMessage = fmt.Sprintf("API returned status %d", resp.StatusCode)
+		}
+		return nil, apiError(resp.StatusCode, body.ErrorCode, body.ErrorMessage)
 	}
-	defer resp.Body.Close()
 
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+	return resp.Body, nil
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, &provider.ProviderError{
-			Code:    "api_error",
-			Message: fmt.Sprintf("API returned status %d: %s", resp.StatusCode, string(responseBody)),
-		}
+// serverFailed reports whether Daraja failed to handle a request. Daraja also answers
+// some ordinary outcomes, such as an unanswered STK prompt, with a 5xx status.
+func serverFailed(resp *base.HTTPResponse) bool {
+	if resp.StatusCode < 500 {
+		return false
 	}
+	var body struct {
+		ErrorCode string `json:"errorCode"`
+	}
+	return resp.DecodeJSON(&body) != nil || body.ErrorCode != stkQueryInProgress
+}
 
-	return responseBody, nil
+// credentialKey identifies a credential's access token and circuit breaker
+func credentialKey(cred *credential.ProviderCredential) string {
+	return "mpesa:" + cred.Shortcode + "_" + string(cred.Environment)
 }
 
 // generateTransactionID generates a unique transaction ID
@@ -628,10 +976,3 @@ func (p *Provider) generateConversationID() (string, error) {
 	}
 	return fmt.Sprintf("AG_%d_%x", time.Now().Unix(), bytes), nil
 }
-
-// getSecurityCredential returns the security credential (placeholder)
-func (p *Provider) getSecurityCredential(cred *credential.ProviderCredential) string {
-	// In production, this should be the encrypted initiator password
-	// For now, return a placeholder
-	return "encrypted_security_credential"
-}
@@ -0,0 +1,118 @@
+package mpesa
+
+import (
+	"net/http"
+
+	"paymatch/internal/provider"
+)
+
+// outcome is what a Daraja code means for the transaction it reports on
+type outcome struct {
+	status    string // transaction status
+	errorCode string // standard provider error code; empty on success
+}
+
+// resultCodes maps the ResultCode of callbacks, async results and STK queries. Codes
+// that are not listed are plain failures.
+var resultCodes = map[string]outcome{
+	"0":       {provider.StatusCompleted, ""},
+	"1":       {provider.StatusFailed, provider.ErrInsufficientFunds},  // insufficient balance
+	"2":       {provider.StatusFailed, provider.ErrInvalidAmount},      // less than the minimum transaction value
+	"3":       {provider.StatusFailed, provider.ErrInvalidAmount},      // more than the maximum transaction value
+	"4":       {provider.StatusFailed, provider.ErrLimitExceeded},      // would exceed the daily transfer limit
+	"5":       {provider.StatusFailed, provider.ErrInsufficientFunds},  // would go below the minimum balance
+	"6":       {provider.StatusFailed, provider.ErrInvalidAccount},     // unresolved primary party
+	"7":       {provider.StatusFailed, provider.ErrInvalidAccount},     // unresolved receiver party
+	"8":       {provider.StatusFailed, provider.ErrLimitExceeded},      // would exceed the maximum balance
+	"11":      {provider.StatusFailed, provider.ErrInvalidAccount},     // debit account in an invalid state
+	"12":      {provider.StatusFailed, provider.ErrInvalidAccount},     // credit account in an invalid state
+	"13":      {provider.StatusFailed, provider.ErrInvalidAccount},     // unresolved debit account
+	"14":      {provider.StatusFailed, provider.ErrInvalidAccount},     // unresolved credit account
+	"15":      {provider.StatusFailed, provider.ErrDuplicateRequest},   // duplicate detected
+	"17":      {provider.StatusFailed, provider.ErrDuplicateRequest},   // same request repeated within two minutes
+	"20":      {provider.StatusFailed, provider.ErrInvalidCredentials}, // unresolved initiator
+	"21":      {provider.StatusFailed, provider.ErrInvalidCredentials}, // initiator not allowed to make the request
+	"26":      {provider.StatusFailed, provider.ErrRateLimited},        // traffic blocking condition in place
+	"1001":    {provider.StatusFailed, provider.ErrDuplicateRequest},   // subscriber busy with another transaction
+	"1019":    {provider.StatusTimeout, provider.ErrProviderTimeout},   // transaction expired before completion
+	"1025":    {provider.StatusFailed, provider.ErrProviderDown},       // the prompt could not be sent
+	"1032":    {provider.StatusCancelled, provider.ErrCancelled},       // cancelled by the customer
+	"1037":    {provider.StatusTimeout, provider.ErrProviderTimeout},   // customer's phone could not be reached
+	"2001":    {provider.StatusFailed, provider.ErrInvalidCredentials}, // initiator credentials are invalid
+	"2028":    {provider.StatusFailed, provider.ErrInvalidCredentials}, // request not permitted for the shortcode
+	"2040":    {provider.StatusFailed, provider.ErrInvalidPhone},       // receiver is not a registered customer
+	"8006":    {provider.StatusFailed, provider.ErrInvalidCredentials}, // security credential locked
+	"9999":    {provider.StatusFailed, provider.ErrProviderDown},       // error sending the prompt
+	"R000001": {provider.StatusFailed, provider.ErrDuplicateRequest},   // transaction already reversed
+	"R000002": {provider.StatusFailed, provider.ErrInvalidRequest},     // original transaction not found
+}
+
+// stkResultCodes overrides codes that mean something else for an STK prompt, where the
+// initiator is the customer
+var stkResultCodes = map[string]outcome{
+	"2001": {provider.StatusFailed, provider.ErrInvalidPIN}, // the customer entered a wrong PIN
+}
+
+// errorCodes maps the errorCode of synchronous API errors
+var errorCodes = map[string]string{
+	"400.002.01":   provider.ErrInvalidRequest,     // invalid request
+	"400.002.02":   provider.ErrInvalidRequest,     // a field is invalid; the message names it
+	"400.002.05":   provider.ErrInvalidRequest,     // invalid request payload
+	"400.003.01":   provider.ErrInvalidCredentials, // invalid access token
+	"400.003.02":   provider.ErrInvalidRequest,     // bad request
+	"401.002.01":   provider.ErrInvalidCredentials, // invalid access token
+	"404.001.01":   provider.ErrInvalidRequest,     // resource not found
+	"404.001.03":   provider.ErrInvalidCredentials, // invalid access token
+	"404.001.04":   provider.ErrInvalidCredentials, // invalid authentication header
+	"500.001.1001": provider.ErrDuplicateRequest,   // a transaction for the subscriber is already in process
+	"500.002.1001": provider.ErrProviderDown,       // server error
+	"500.003.02":   provider.ErrProviderDown,       // system busy
+	"500.003.03":   provider.ErrRateLimited,        // quota violation or spike arrest
+	"500.003.1001": provider.ErrProviderDown,       // internal server error
+	"503.001.01":   provider.ErrProviderDown,       // service unavailable
+}
+
+// resultOutcome returns the status and standard error code a result code stands for;
+// stk selects the meanings specific to STK prompts
+func resultOutcome(resultCode string, stk bool) (string, string) {
+	if resultCode == "" {
+		return provider.StatusPending, ""
+	}
+	if o, ok := stkResultCodes[resultCode]; ok && stk {
+		return o.status, o.errorCode
+	}
+	if o, ok := resultCodes[resultCode]; ok {
+		return o.status, o.errorCode
+	}
+	return provider.StatusFailed, provider.ErrUnknownError
+}
+
+// apiError converts the errorCode and errorMessage of a failed API call into a provider
+// error; status is the HTTP status, used for codes that are not listed
+func apiError(status int, errorCode, message string) *provider.ProviderError {
+	code, ok := errorCodes[errorCode]
+	if !ok {
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			code = provider.ErrInvalidCredentials
+		case status == http.StatusTooManyRequests:
+			code = provider.ErrRateLimited
+		case status >= 500:
+			code = provider.ErrProviderDown
+		case status >= 400:
+			code = provider.ErrInvalidRequest
+		default:
+			code = provider.ErrUnknownError
+		}
+	}
+	return &provider.ProviderError{Code: code, Message: message, ProviderErr: errorCode}
+}
+
+// responseError converts a non-zero ResponseCode of an accepted API call into a provider error
+func responseError(responseCode, description string) *provider.ProviderError {
+	_, code := resultOutcome(responseCode, false)
+	if code == "" {
+		code = provider.ErrUnknownError
+	}
+	return &provider.ProviderError{Code: code, Message: description, ProviderErr: responseCode}
+}
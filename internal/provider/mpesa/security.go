@@ -0,0 +1,151 @@
+package mpesa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"paymatch/internal/config"
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/provider"
+)
+
+// Credential fields holding the Daraja API operator used for B2C, balance, status and reversal calls
+const (
+	fieldInitiatorName     = "initiator_name"
+	fieldInitiatorPassword = "initiator_password"
+)
+
+// certificateStore loads and caches the Safaricom public key for each environment
+type certificateStore struct {
+	paths map[credential.Environment]string
+	mu    sync.Mutex
+	keys  map[credential.Environment]*rsa.PublicKey
+}
+
+// newCertificateStore creates a store reading the sandbox and production certificates from disk
+func newCertificateStore(sandboxPath, productionPath string) *certificateStore {
+	return &certificateStore{
+		paths: map[credential.Environment]string{
+			credential.EnvironmentSandbox:    sandboxPath,
+			credential.EnvironmentProduction: productionPath,
+		},
+		keys: make(map[credential.Environment]*rsa.PublicKey),
+	}
+}
+
+// publicKey returns the RSA key of the certificate for an environment, loading it on first use
+func (s *certificateStore) publicKey(env credential.Environment) (*rsa.PublicKey, error) {
+	if env != credential.EnvironmentProduction {
+		env = credential.EnvironmentSandbox
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[env]; ok {
+		return key, nil
+	}
+
+	path := s.paths[env]
+	if path == "" {
+		return nil, fmt.Errorf("no M-Pesa %s certificate configured", env)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read M-Pesa %s certificate: %w", env, err)
+	}
+
+	key, err := parseCertificateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid M-Pesa %s certificate: %w", env, err)
+	}
+	s.keys[env] = key
+	return key, nil
+}
+
+// CheckCertificate loads the Safaricom certificate for the app's environment, so a missing
+// or invalid certificate is reported at startup rather than on the first B2C or reversal call.
+// The certificate is not shipped; download it from the Daraja portal.
+func CheckCertificate(cfg config.Cfg) error {
+	env := credential.Environment(cfg.App.Env)
+	if env != credential.EnvironmentProduction {
+		env = credential.EnvironmentSandbox
+	}
+
+	certs := newCertificateStore(cfg.Mpesa.SandboxCertPath, cfg.Mpesa.ProductionCertPath)
+	if _, err := certs.publicKey(env); err != nil {
+		return fmt.Errorf("%w; download the %s certificate from the Daraja portal and point MPESA_%s_CERT_PATH at it",
+			err, env, strings.ToUpper(string(env)))
+	}
+	return nil
+}
+
+// parseCertificateKey extracts the RSA public key from a PEM or DER encoded X.509 certificate
+func parseCertificateKey(data []byte) (*rsa.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate does not hold an RSA public key")
+	}
+	return key, nil
+}
+
+// encryptSecurityCredential produces Daraja's SecurityCredential: the initiator password
+// RSA-encrypted (PKCS #1 v1.5) with the Safaricom certificate, base64 encoded
+func encryptSecurityCredential(key *rsa.PublicKey, password string) (string, error) {
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, key, []byte(password))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// getInitiator returns the initiator name and SecurityCredential for a credential.
+// The credential is generated per call since PKCS #1 v1.5 encryption is randomized.
+func (p *Provider) getInitiator(cred *credential.ProviderCredential) (string, string, error) {
+	name := cred.GetDecryptedField(fieldInitiatorName, p.cfg.Sec.AESKey)
+	password := cred.GetDecryptedField(fieldInitiatorPassword, p.cfg.Sec.AESKey)
+	if name == "" || password == "" {
+		return "", "", &provider.ProviderError{
+			Code:    ErrMissingInitiator,
+			Message: "initiator_name and initiator_password must be configured for this operation",
+		}
+	}
+
+	key, err := p.certs.publicKey(cred.Environment)
+	if err != nil {
+		return "", "", &provider.ProviderError{
+			Code:        "security_credential_failed",
+			Message:     "failed to load M-Pesa certificate",
+			ProviderErr: err.Error(),
+		}
+	}
+
+	securityCredential, err := encryptSecurityCredential(key, password)
+	if err != nil {
+		return "", "", &provider.ProviderError{
+			Code:        "security_credential_failed",
+			Message:     "failed to encrypt initiator password",
+			ProviderErr: err.Error(),
+		}
+	}
+	return name, securityCredential, nil
+}
+
+// ErrMissingInitiator is the error code returned when initiator credentials are not configured
+const ErrMissingInitiator = "missing_initiator_credentials"
@@ -3,6 +3,8 @@ package mpesa
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"paymatch/internal/provider"
 )
@@ -27,6 +29,16 @@ func (w *WebhookService) Parse(body []byte, headers map[string]string) (provider
 		return event, nil
 	}
 
+	// Try balance and transaction status results before reversal and B2C; all share the Result envelope
+	if event, err := w.parseQueryResult(body); err == nil {
+		return event, nil
+	}
+
+	// Try reversal result before B2C; both share the Result envelope
+	if event, err := w.parseReversalResult(body); err == nil {
+		return event, nil
+	}
+
 	// Try B2C result
 	if event, err := w.parseB2CResult(body); err == nil {
 		return event, nil
@@ -95,11 +107,8 @@ func (w *WebhookService) parseSTKCallback(body []byte) (provider.Event, error) {
 		}
 	}
 
-	// Determine status
-	status := provider.StatusFailed
-	if callback.ResultCode == 0 {
-		status = provider.StatusCompleted
-	}
+	// Cancelled and timed out prompts are told apart from failures
+	status, failureCode := resultOutcome(strconv.Itoa(callback.ResultCode), true)
 
 	return provider.Event{
 		Type:                provider.EventSTK,
@@ -109,6 +118,7 @@ func (w *WebhookService) parseSTKCallback(body []byte) (provider.Event, error) {
 		InvoiceRef:          accountRef,
 		TransactionID:       transactionID,
 		Status:              status,
+		FailureCode:         failureCode,
 		ResponseDescription: callback.ResultDesc,
 		RawJSON:             body,
 	}, nil
@@ -213,11 +223,7 @@ func (w *WebhookService) parseB2CResult(body []byte) (provider.Event, error) {
 		}
 	}
 
-	// Determine status
-	status := provider.StatusFailed
-	if result.ResultCode == 0 {
-		status = provider.StatusCompleted
-	}
+	status, failureCode := resultOutcome(strconv.Itoa(result.ResultCode), false)
 
 	return provider.Event{
 		Type:                provider.EventB2C,
@@ -227,11 +233,151 @@ func (w *WebhookService) parseB2CResult(body []byte) (provider.Event, error) {
 		InvoiceRef:          result.OriginatorConversationID,
 		TransactionID:       transactionID,
 		Status:              status,
+		FailureCode:         failureCode,
 		ResponseDescription: result.ResultDesc,
 		RawJSON:             body,
 	}, nil
 }
 
+// parseReversalResult parses a transaction reversal result. Only successful results carry
+// the OriginalTransactionID parameter; failed ones parse as a plain B2C-style result and
+// are typed by the route they arrive on.
+func (w *WebhookService) parseReversalResult(body []byte) (provider.Event, error) {
+	var reversalResult struct {
+		Result struct {
+			ResultCode               int    `json:"ResultCode"`
+			ResultDesc               string `json:"ResultDesc"`
+			OriginatorConversationID string `json:"OriginatorConversationID"`
+			ConversationID           string `json:"ConversationID"`
+			TransactionID            string `json:"TransactionID"`
+			ResultParameters         struct {
+				ResultParameter []struct {
+					Key   string      `json:"Key"`
+					Value interface{} `json:"Value"`
+				} `json:"ResultParameter"`
+			} `json:"ResultParameters,omitempty"`
+		} `json:"Result"`
+	}
+
+	if err := json.Unmarshal(body, &reversalResult); err != nil {
+		return provider.Event{}, err
+	}
+
+	result := reversalResult.Result
+	if result.ConversationID == "" {
+		return provider.Event{}, fmt.Errorf("not a reversal result")
+	}
+
+	var amount int64
+	var originalTransactionID string
+	for _, param := range result.ResultParameters.ResultParameter {
+		switch param.Key {
+		case "Amount":
+			switch v := param.Value.(type) {
+			case float64:
+				amount = int64(v)
+			case string:
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					amount = int64(f)
+				}
+			}
+		case "OriginalTransactionID":
+			if s, ok := param.Value.(string); ok {
+				originalTransactionID = s
+			}
+		}
+	}
+	if originalTransactionID == "" {
+		return provider.Event{}, fmt.Errorf("not a reversal result")
+	}
+
+	status, failureCode := resultOutcome(strconv.Itoa(result.ResultCode), false)
+
+	return provider.Event{
+		Type:                provider.EventReversal,
+		ExternalID:          result.ConversationID,
+		Amount:              amount,
+		InvoiceRef:          result.OriginatorConversationID,
+		TransactionID:       result.TransactionID,
+		Status:              status,
+		FailureCode:         failureCode,
+		ResponseDescription: result.ResultDesc,
+		RawJSON:             body,
+	}, nil
+}
+
+// parseQueryResult parses an AccountBalance or TransactionStatusQuery result, told apart by
+// their result parameters. Failed results carry no parameters and parse as a plain result;
+// the conversation ID still ties them to the query.
+func (w *WebhookService) parseQueryResult(body []byte) (provider.Event, error) {
+	var queryResult struct {
+		Result struct {
+			ResultCode               int    `json:"ResultCode"`
+			ResultDesc               string `json:"ResultDesc"`
+			OriginatorConversationID string `json:"OriginatorConversationID"`
+			ConversationID           string `json:"ConversationID"`
+			TransactionID            string `json:"TransactionID"`
+			ResultParameters         struct {
+				ResultParameter []struct {
+					Key   string      `json:"Key"`
+					Value interface{} `json:"Value"`
+				} `json:"ResultParameter"`
+			} `json:"ResultParameters,omitempty"`
+		} `json:"Result"`
+	}
+
+	if err := json.Unmarshal(body, &queryResult); err != nil {
+		return provider.Event{}, err
+	}
+
+	result := queryResult.Result
+	if result.ConversationID == "" {
+		return provider.Event{}, fmt.Errorf("not a query result")
+	}
+
+	params := make(map[string]interface{}, len(result.ResultParameters.ResultParameter))
+	for _, param := range result.ResultParameters.ResultParameter {
+		params[param.Key] = param.Value
+	}
+
+	status, failureCode := resultOutcome(strconv.Itoa(result.ResultCode), false)
+
+	evt := provider.Event{
+		ExternalID:          result.ConversationID,
+		InvoiceRef:          result.OriginatorConversationID,
+		Status:              status,
+		FailureCode:         failureCode,
+		ResponseDescription: result.ResultDesc,
+		RawJSON:             body,
+	}
+
+	switch {
+	case params["AccountBalance"] != nil:
+		evt.Type = provider.EventBalance
+	case params["ReceiptNo"] != nil || params["TransactionStatus"] != nil:
+		evt.Type = provider.EventTransactionStatus
+		if s, ok := params["ReceiptNo"].(string); ok {
+			evt.TransactionID = s
+		}
+		switch v := params["Amount"].(type) {
+		case float64:
+			evt.Amount = int64(v)
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				evt.Amount = int64(f)
+			}
+		}
+		// The party name is reported as "254712345678 - Jane Doe"
+		if s, ok := params["DebitPartyName"].(string); ok {
+			evt.MSISDN = strings.TrimSpace(strings.SplitN(s, " - ", 2)[0])
+		}
+	default:
+		return provider.Event{}, fmt.Errorf("not a query result")
+	}
+
+	return evt, nil
+}
+
 // Validate validates M-Pesa webhook authenticity
 func (w *WebhookService) Validate(body []byte, headers map[string]string, webhookToken string) error {
 	// M-Pesa doesn't provide signature validation in their current implementation
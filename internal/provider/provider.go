@@ -9,8 +9,11 @@ import (
 type Provider interface {
 	// Core payment operations
 	STKPush(ctx context.Context, cred *credential.ProviderCredential, req STKPushReq) (*STKPushResp, error)
+	STKQuery(ctx context.Context, cred *credential.ProviderCredential, checkoutRequestID string) (*STKQueryResp, error)
 	B2C(ctx context.Context, cred *credential.ProviderCredential, req B2CReq) (*B2CResp, error)
 	BulkTransfer(ctx context.Context, cred *credential.ProviderCredential, req BulkTransferReq) (*BulkTransferResp, error)
+	RegisterC2BURLs(ctx context.Context, cred *credential.ProviderCredential, req C2BRegisterReq) (*C2BRegisterResp, error)
+	Reverse(ctx context.Context, cred *credential.ProviderCredential, req ReverseReq) (*ReverseResp, error)
 
 	// Webhook processing
 	ParseWebhook(body []byte, headers map[string]string) (Event, error)
@@ -25,3 +28,15 @@ type Provider interface {
 	CheckBalance(ctx context.Context, cred *credential.ProviderCredential) (*BalanceResp, error)
 	GetTransactionStatus(ctx context.Context, cred *credential.ProviderCredential, externalID string) (*StatusResp, error)
 }
+
+// Configurable is implemented by providers whose endpoint and limits can be changed while
+// running; applying zero Settings restores the defaults
+type Configurable interface {
+	ApplySettings(environment string, settings Settings)
+}
+
+// HealthReporter is implemented by providers that track the health of each credential;
+// Available is false while calls for the credential are being refused
+type HealthReporter interface {
+	Available(cred *credential.ProviderCredential) bool
+}
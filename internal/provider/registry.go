@@ -15,6 +15,7 @@ import (
 // Registry manages all payment providers
 type Registry struct {
 	providers      map[ProviderType]Provider
+	settings       map[settingsKey]Settings
 	cfg            config.Cfg
 	credentialRepo repositories.CredentialRepository
 	mu             sync.RWMutex
@@ -24,6 +25,7 @@ type Registry struct {
 func NewRegistry(cfg config.Cfg, credentialRepo repositories.CredentialRepository) *Registry {
 	return &Registry{
 		providers:      make(map[ProviderType]Provider),
+		settings:       make(map[settingsKey]Settings),
 		cfg:            cfg,
 		credentialRepo: credentialRepo,
 	}
@@ -35,6 +37,13 @@ func (r *Registry) RegisterProvider(providerType ProviderType, provider Provider
 	defer r.mu.Unlock()
 	
 	r.providers[providerType] = provider
+	if configurable, ok := provider.(Configurable); ok {
+		for key, settings := range r.settings {
+			if key.providerType == providerType {
+				configurable.ApplySettings(key.environment, settings)
+			}
+		}
+	}
 	log.Info().
 		Str("provider", string(providerType)).
 		Str("name", provider.Name()).
@@ -42,6 +51,35 @@ func (r *Registry) RegisterProvider(providerType ProviderType, provider Provider
 		Msg("registered payment provider")
 }
 
+// ApplySettings sets a provider's endpoint and limits for an environment. Settings for a
+// provider that is not registered yet are kept and applied when it registers; zero
+// settings restore the provider's defaults.
+func (r *Registry) ApplySettings(providerType ProviderType, environment string, settings Settings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := settingsKey{providerType: providerType, environment: environment}
+	if settings == (Settings{}) {
+		delete(r.settings, key)
+	} else {
+		r.settings[key] = settings
+	}
+
+	provider, ok := r.providers[providerType]
+	if !ok {
+		return nil
+	}
+	configurable, ok := provider.(Configurable)
+	if !ok {
+		return &ProviderError{
+			Code:    "operation_not_supported",
+			Message: fmt.Sprintf("provider %s does not accept settings", provider.Name()),
+		}
+	}
+	configurable.ApplySettings(environment, settings)
+	return nil
+}
+
 // GetProvider returns a provider by type
 func (r *Registry) GetProvider(providerType ProviderType) (Provider, error) {
 	r.mu.RLock()
@@ -75,6 +113,19 @@ func (r *Registry) GetProviderForCredential(ctx context.Context, cred *credentia
 	}
 }
 
+// Available reports whether the credential's provider is registered and not refusing
+// calls for it after repeated failures
+func (r *Registry) Available(ctx context.Context, cred *credential.ProviderCredential) bool {
+	provider, err := r.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return false
+	}
+	if health, ok := provider.(HealthReporter); ok {
+		return health.Available(cred)
+	}
+	return true
+}
+
 // ListProviders returns all registered provider types
 func (r *Registry) ListProviders() []ProviderType {
 	r.mu.RLock()
@@ -171,6 +222,57 @@ func (r *Registry) BulkTransfer(ctx context.Context, cred *credential.ProviderCr
 	return provider.BulkTransfer(ctx, cred, req)
 }
 
+// RegisterC2BURLs registers C2B validation and confirmation URLs through the appropriate provider
+func (r *Registry) RegisterC2BURLs(ctx context.Context, cred *credential.ProviderCredential, req C2BRegisterReq) (*C2BRegisterResp, error) {
+	provider, err := r.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	
+	if !r.supportsOperation(provider, OpC2B) {
+		return nil, &ProviderError{
+			Code:    "operation_not_supported",
+			Message: fmt.Sprintf("provider %s does not support C2B", provider.Name()),
+		}
+	}
+	
+	return provider.RegisterC2BURLs(ctx, cred, req)
+}
+
+// STKQuery looks up the state of an STK push through the appropriate provider
+func (r *Registry) STKQuery(ctx context.Context, cred *credential.ProviderCredential, checkoutRequestID string) (*STKQueryResp, error) {
+	provider, err := r.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	
+	if !r.supportsOperation(provider, OpSTKQuery) {
+		return nil, &ProviderError{
+			Code:    "operation_not_supported",
+			Message: fmt.Sprintf("provider %s does not support STK push queries", provider.Name()),
+		}
+	}
+	
+	return provider.STKQuery(ctx, cred, checkoutRequestID)
+}
+
+// Reverse requests a transaction reversal through the appropriate provider
+func (r *Registry) Reverse(ctx context.Context, cred *credential.ProviderCredential, req ReverseReq) (*ReverseResp, error) {
+	provider, err := r.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	
+	if !r.supportsOperation(provider, OpReverse) {
+		return nil, &ProviderError{
+			Code:    "operation_not_supported",
+			Message: fmt.Sprintf("provider %s does not support reversals", provider.Name()),
+		}
+	}
+	
+	return provider.Reverse(ctx, cred, req)
+}
+
 // CheckBalance checks account balance through the appropriate provider
 func (r *Registry) CheckBalance(ctx context.Context, cred *credential.ProviderCredential) (*BalanceResp, error) {
 	provider, err := r.GetProviderForCredential(ctx, cred)
@@ -227,6 +329,12 @@ func (r *Registry) ValidateWebhook(ctx context.Context, cred *credential.Provide
 
 // Helper types and functions
 
+// settingsKey identifies the settings of one provider in one environment
+type settingsKey struct {
+	providerType ProviderType
+	environment  string
+}
+
 // ProviderInfo contains metadata about a provider
 type ProviderInfo struct {
 	Type                 ProviderType      `json:"type"`
@@ -24,8 +24,20 @@ const (
 	OpBulkTransfer OperationType = "bulk_transfer"
 	OpBalance      OperationType = "balance"
 	OpStatus       OperationType = "status"
+	OpReverse      OperationType = "reverse"
+	OpSTKQuery     OperationType = "stk_query"
 )
 
+// Settings are the operator-tunable endpoint and limits of a provider in one environment.
+// Zero fields keep the provider's built-in defaults.
+type Settings struct {
+	BaseURL        string
+	TimeoutSeconds int
+	MinAmount      int64
+	MaxAmount      int64
+	Currency       string
+}
+
 // Credential field definitions for provider setup
 type CredentialField struct {
 	Name        string `json:"name"`
@@ -52,6 +64,15 @@ type STKPushResp struct {
 	ProviderReference string `json:"provider_reference,omitempty"`
 }
 
+// STKQueryResp is the current state of an STK push, looked up by its checkout request ID
+type STKQueryResp struct {
+	ExternalID string `json:"external_id"`
+	Status     string `json:"status"` // pending until the customer acts or the prompt expires
+	ResultCode string `json:"result_code,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"` // why the payment did not complete
+	Message    string `json:"message"`
+}
+
 // B2C (Business to Customer transfers)
 type B2CReq struct {
 	Amount      int64  `json:"amount"`
@@ -70,6 +91,38 @@ type B2CResp struct {
 	ProviderReference string `json:"provider_reference,omitempty"`
 }
 
+// C2B URL registration (where the provider sends validation and confirmation requests)
+type C2BRegisterReq struct {
+	ConfirmationURL string `json:"confirmation_url,omitempty"` // defaults to the shortcode webhook route
+	ValidationURL   string `json:"validation_url,omitempty"`   // defaults to the shortcode validation route
+	ResponseType    string `json:"response_type,omitempty"`    // Completed or Cancelled: what happens if validation is unreachable
+}
+
+type C2BRegisterResp struct {
+	Status            string `json:"status"`
+	Message           string `json:"message"`
+	ConfirmationURL   string `json:"confirmation_url"`
+	ValidationURL     string `json:"validation_url"`
+	ProviderReference string `json:"provider_reference,omitempty"`
+}
+
+// Reversal of a completed incoming payment back to the payer
+type ReverseReq struct {
+	TransactionID string `json:"transaction_id"` // provider receipt of the payment being reversed
+	Amount        int64  `json:"amount"`
+	Remarks       string `json:"remarks"`
+	Occasion      string `json:"occasion,omitempty"`
+	ResultURL     string `json:"result_url"`
+	TimeoutURL    string `json:"timeout_url"`
+}
+
+type ReverseResp struct {
+	ExternalID        string `json:"external_id"`
+	Status            string `json:"status"`
+	Message           string `json:"message"`
+	ProviderReference string `json:"provider_reference,omitempty"`
+}
+
 // Bulk Transfer
 type BulkTransferReq struct {
 	Transfers []BulkTransferItem `json:"transfers"`
@@ -92,21 +145,23 @@ type BulkTransferResp struct {
 
 // Balance inquiry
 type BalanceResp struct {
-	ExternalID       string `json:"external_id"`
-	Status           string `json:"status"`
-	Message          string `json:"message"`
-	AccountBalance   string `json:"account_balance,omitempty"`
-	AvailableBalance string `json:"available_balance,omitempty"`
-	Currency         string `json:"currency,omitempty"`
+	ExternalID        string `json:"external_id"`
+	Status            string `json:"status"`
+	Message           string `json:"message"`
+	AccountBalance    string `json:"account_balance,omitempty"`
+	AvailableBalance  string `json:"available_balance,omitempty"`
+	Currency          string `json:"currency,omitempty"`
+	ProviderReference string `json:"provider_reference,omitempty"`
 }
 
 // Transaction status
 type StatusResp struct {
-	ExternalID     string `json:"external_id"`
-	Status         string `json:"status"`
-	Message        string `json:"message"`
-	ConversationID string `json:"conversation_id,omitempty"`
-	TransactionID  string `json:"transaction_id,omitempty"`
+	ExternalID        string `json:"external_id"`
+	Status            string `json:"status"`
+	Message           string `json:"message"`
+	ConversationID    string `json:"conversation_id,omitempty"`
+	TransactionID     string `json:"transaction_id,omitempty"`
+	ProviderReference string `json:"provider_reference,omitempty"`
 }
 
 // Re-export core types for convenience
@@ -121,15 +176,19 @@ const (
 	EventB2C         = event.TypeB2C
 	EventBalance     = event.TypeBalance
 	EventBulkTransfer = event.TypeBulkTransfer
+	EventTimeout     = event.TypeTimeout
+	EventReversal    = event.TypeReversal
+	EventTransactionStatus = event.TypeTransactionStatus
 )
 
 // Transaction status constants
 const (
-	StatusPending   = "pending"
-	StatusCompleted = "completed"
-	StatusFailed    = "failed"
-	StatusCancelled = "cancelled"
-	StatusTimeout   = "timeout"
+	StatusPending    = "pending"
+	StatusProcessing = "processing" // the provider has the request and awaits the customer
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+	StatusTimeout    = "timeout"
 )
 
 // Common error types
@@ -137,6 +196,7 @@ type ProviderError struct {
 	Code        string `json:"code"`
 	Message     string `json:"message"`
 	ProviderErr string `json:"provider_error,omitempty"`
+	Refused     bool   `json:"-"` // turned away before reaching the provider, e.g. by an open circuit
 }
 
 func (e *ProviderError) Error() string {
@@ -154,6 +214,13 @@ const (
 	ErrInvalidAmount      = "invalid_amount"
 	ErrProviderTimeout    = "provider_timeout"
 	ErrProviderDown       = "provider_down"
+	ErrRequestFailed      = "request_failed" // the call broke off; the provider may still have acted on it
 	ErrDuplicateRequest   = "duplicate_request"
 	ErrUnknownError       = "unknown_error"
+	ErrCancelled          = "cancelled"       // the customer dismissed the prompt
+	ErrInvalidPIN         = "invalid_pin"     // the customer entered a wrong PIN
+	ErrLimitExceeded      = "limit_exceeded"  // a transaction or balance limit would be exceeded
+	ErrInvalidAccount     = "invalid_account" // a party's account is unknown or not in a usable state
+	ErrRateLimited        = "rate_limited"
+	ErrInvalidRequest     = "invalid_request"
 )
\ No newline at end of file
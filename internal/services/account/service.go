@@ -0,0 +1,364 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"paymatch/internal/domain/account"
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/event"
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Service requests account balances and transaction statuses from providers. M-Pesa
+// answers both asynchronously, so each request is recorded as a query that the result
+// callback later completes.
+type Service struct {
+	queryRepo      repositories.AccountQueryRepository
+	credentialRepo repositories.CredentialRepository
+	registry       *provider.Registry
+}
+
+// NewService creates a new account service
+func NewService(
+	queryRepo repositories.AccountQueryRepository,
+	credentialRepo repositories.CredentialRepository,
+	registry *provider.Registry,
+) *Service {
+	return &Service{
+		queryRepo:      queryRepo,
+		credentialRepo: credentialRepo,
+		registry:       registry,
+	}
+}
+
+// BalanceRequest represents an account balance request
+type BalanceRequest struct {
+	CredentialID int64 `json:"credential_id,omitempty"` // default: the tenant's first active credential that supports balance queries
+}
+
+// StatusRequest represents a transaction status request
+type StatusRequest struct {
+	CredentialID  int64  `json:"credential_id,omitempty"` // default: the tenant's first active credential that supports status queries
+	TransactionID string `json:"transaction_id"`
+}
+
+// RequestBalance asks the provider for the credential's account balances. The returned
+// query stays pending until the provider reports the balance, unless it answers at once.
+func (s *Service) RequestBalance(ctx context.Context, tenantID int64, actor string, req BalanceRequest) (*account.Query, error) {
+	cred, err := s.resolveCredential(ctx, tenantID, req.CredentialID, provider.OpBalance, "balance queries")
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := account.NewQuery(tenantID, cred.ID, account.KindBalance, "", actor)
+	if err != nil {
+		return nil, &ValidationError{Field: "query", Message: err.Error()}
+	}
+
+	resp, err := s.registry.CheckBalance(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ProviderReference == "" && resp.Status == provider.StatusCompleted {
+		// Providers that answer at once report a single account
+		q.Accounts = []account.Account{{
+			Name:      "Balance",
+			Currency:  resp.Currency,
+			Current:   resp.AccountBalance,
+			Available: resp.AvailableBalance,
+		}}
+		q.Complete(true, resp.Message, map[string]string{
+			"AccountBalance":   resp.AccountBalance,
+			"AvailableBalance": resp.AvailableBalance,
+			"Currency":         resp.Currency,
+		})
+	} else if err := q.Accept(resp.ExternalID, resp.ProviderReference, resp.Message); err != nil {
+		return nil, &ServiceError{Op: "accept_query", Err: err}
+	}
+
+	if err := s.save(ctx, q); err != nil {
+		return nil, err
+	}
+
+	if q.Status == account.QueryCompleted {
+		b, _ := q.Balance()
+		if err := s.queryRepo.SaveBalance(ctx, b); err != nil {
+			return nil, &ServiceError{Op: "save_balance", Err: err}
+		}
+	}
+	return q, nil
+}
+
+// RequestStatus asks the provider for the status of a transaction. The returned query
+// stays pending until the provider reports the status, unless it answers at once.
+func (s *Service) RequestStatus(ctx context.Context, tenantID int64, actor string, req StatusRequest) (*account.Query, error) {
+	if req.TransactionID == "" {
+		return nil, &ValidationError{Field: "transaction_id", Message: "transaction_id is required"}
+	}
+
+	cred, err := s.resolveCredential(ctx, tenantID, req.CredentialID, provider.OpStatus, "status queries")
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := account.NewQuery(tenantID, cred.ID, account.KindTransactionStatus, req.TransactionID, actor)
+	if err != nil {
+		return nil, &ValidationError{Field: "query", Message: err.Error()}
+	}
+
+	resp, err := s.registry.GetTransactionStatus(ctx, cred, q.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ProviderReference == "" {
+		// Providers that answer at once report the transaction's status directly
+		q.Complete(true, resp.Message, map[string]string{
+			"TransactionID":     q.TransactionID,
+			"TransactionStatus": resp.Status,
+			"ReceiptNo":         resp.TransactionID,
+		})
+	} else if err := q.Accept(resp.ConversationID, resp.ProviderReference, resp.Message); err != nil {
+		return nil, &ServiceError{Op: "accept_query", Err: err}
+	}
+
+	if err := s.save(ctx, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Get retrieves a query belonging to the tenant
+func (s *Service) Get(ctx context.Context, tenantID, id int64) (*account.Query, error) {
+	q, err := s.queryRepo.FindByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && q.TenantID != tenantID) {
+		return nil, ErrQueryNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_query", Err: err}
+	}
+	return q, nil
+}
+
+// Balances lists the latest known balance of each of the tenant's credentials
+func (s *Service) Balances(ctx context.Context, tenantID int64) ([]*account.Balance, error) {
+	balances, err := s.queryRepo.FindBalances(ctx, tenantID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_balances", Err: err}
+	}
+	if balances == nil {
+		balances = []*account.Balance{}
+	}
+	return balances, nil
+}
+
+// save records a query the provider has already accepted
+func (s *Service) save(ctx context.Context, q *account.Query) error {
+	if err := s.queryRepo.Save(ctx, q); err != nil {
+		log.Error().Err(err).
+			Int64("tenant_id", q.TenantID).
+			Str("kind", string(q.Kind)).
+			Str("conversation_id", q.ExternalID).
+			Msg("query accepted by provider but not recorded")
+		return &ServiceError{Op: "save_query", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", q.TenantID).
+		Int64("query_id", q.ID).
+		Str("kind", string(q.Kind)).
+		Str("conversation_id", q.ExternalID).
+		Str("status", string(q.Status)).
+		Msg("account query requested")
+	return nil
+}
+
+// resolveCredential picks the credential to query: the requested one, or the tenant's
+// first active credential that supports the operation
+func (s *Service) resolveCredential(ctx context.Context, tenantID, credentialID int64, op provider.OperationType, label string) (*credential.ProviderCredential, error) {
+	credentials, err := s.credentialRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_credentials", Err: err}
+	}
+
+	for _, cred := range credentials {
+		if !cred.IsActive {
+			continue
+		}
+		if credentialID != 0 {
+			if cred.ID == credentialID {
+				return cred, nil
+			}
+			continue
+		}
+		if s.supportsOperation(ctx, cred, op) {
+			return cred, nil
+		}
+	}
+
+	if credentialID != 0 {
+		return nil, &ValidationError{Field: "credential_id", Message: "no active credential with this ID"}
+	}
+	return nil, &ValidationError{Field: "credential_id", Message: "tenant has no active credential that supports " + label}
+}
+
+// supportsOperation reports whether the credential's provider can perform the operation
+func (s *Service) supportsOperation(ctx context.Context, cred *credential.ProviderCredential, op provider.OperationType) bool {
+	p, err := s.registry.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return false
+	}
+	for _, supported := range p.SupportedOperations() {
+		if supported == op {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultHandler completes queries from provider result and queue-timeout callbacks
+type ResultHandler struct{}
+
+// NewResultHandler creates a new query result handler
+func NewResultHandler() *ResultHandler {
+	return &ResultHandler{}
+}
+
+// ApplyResult updates the query a result or timeout event refers to, and records the
+// credential's balance when a balance query completes. It runs inside the caller's
+// transaction; it returns false if no query matches the event.
+func (h *ResultHandler) ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error) {
+	repo := tx.AccountQueryRepository()
+
+	q, err := repo.LockByExternalID(ctx, evt.TenantID, evt.ExternalID)
+	if errors.Is(err, pgx.ErrNoRows) && evt.InvoiceRef != "" {
+		// Results carry the originator conversation ID as the reference
+		q, err = repo.LockByExternalID(ctx, evt.TenantID, evt.InvoiceRef)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load query %s: %w", evt.ExternalID, err)
+	}
+
+	var changed bool
+	switch evt.Type {
+	case event.TypeTimeout:
+		changed = q.TimeOut(evt.ResponseDescription)
+	default:
+		changed = q.Complete(evt.Status == "completed", evt.ResponseDescription, parseResultParameters(evt.RawJSON))
+	}
+	if !changed {
+		log.Info().
+			Int64("query_id", q.ID).
+			Str("status", string(q.Status)).
+			Str("event_type", string(evt.Type)).
+			Msg("query already completed, ignoring callback")
+		return true, nil
+	}
+
+	if q.Kind == account.KindBalance && q.Status == account.QueryCompleted {
+		accounts, err := account.ParseAccounts(q.Result["AccountBalance"])
+		if err != nil {
+			// Keep the raw result; the report format is the provider's and may change
+			log.Warn().Err(err).Int64("query_id", q.ID).Msg("failed to parse balance report")
+		}
+		q.Accounts = accounts
+	}
+
+	if err := repo.Save(ctx, q); err != nil {
+		return false, fmt.Errorf("failed to update query %d: %w", q.ID, err)
+	}
+
+	if q.Kind == account.KindBalance && len(q.Accounts) > 0 {
+		b, err := q.Balance()
+		if err != nil {
+			return false, err
+		}
+		if err := repo.SaveBalance(ctx, b); err != nil {
+			return false, fmt.Errorf("failed to save balance for credential %d: %w", q.ProviderCredentialID, err)
+		}
+	}
+
+	log.Info().
+		Int64("query_id", q.ID).
+		Int64("tenant_id", q.TenantID).
+		Str("kind", string(q.Kind)).
+		Str("status", string(q.Status)).
+		Msg("query result applied")
+	return true, nil
+}
+
+// parseResultParameters extracts the Result.ResultParameters key/value list of a raw
+// result callback; the event itself only carries the common fields
+func parseResultParameters(raw []byte) map[string]string {
+	var payload struct {
+		Result struct {
+			ResultParameters struct {
+				ResultParameter json.RawMessage `json:"ResultParameter"`
+			} `json:"ResultParameters"`
+		} `json:"Result"`
+	}
+	params := make(map[string]string)
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return params
+	}
+
+	// Daraja sends a single parameter as an object rather than a list
+	var list []struct {
+		Key   string      `json:"Key"`
+		Value interface{} `json:"Value"`
+	}
+	data := payload.Result.ResultParameters.ResultParameter
+	if len(data) > 0 && data[0] == '{' {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep amounts as sent rather than in float notation
+	if err := decoder.Decode(&list); err != nil {
+		return params
+	}
+	for _, p := range list {
+		if p.Value != nil {
+			params[p.Key] = fmt.Sprint(p.Value)
+		}
+	}
+	return params
+}
+
+// ValidationError represents an input validation error
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error [" + e.Field + "]: " + e.Message
+}
+
+// ServiceError represents an account service error
+type ServiceError struct {
+	Op  string
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	return "account service " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+// ErrQueryNotFound is returned when a query does not exist for the tenant
+var ErrQueryNotFound = errors.New("query not found")
@@ -0,0 +1,219 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/domain/delivery"
+	"paymatch/internal/store/repositories"
+	"paymatch/pkg/webhooksig"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DispatcherConfig holds configuration for the delivery dispatcher
+type DispatcherConfig struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	RequestTimeout time.Duration
+	Retry          delivery.RetryPolicy
+}
+
+// DefaultDispatcherConfig returns sensible defaults for the dispatcher
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		PollInterval:   2 * time.Second,
+		BatchSize:      25,
+		RequestTimeout: 10 * time.Second,
+		Retry:          delivery.DefaultRetryPolicy(),
+	}
+}
+
+// Dispatcher pushes queued notifications to tenant endpoints
+type Dispatcher struct {
+	deliveryRepo repositories.DeliveryRepository
+	endpointRepo repositories.WebhookEndpointRepository
+	eventRepo    repositories.EventRepository
+	aesKey       []byte
+	client       *http.Client
+	config       DispatcherConfig
+}
+
+// NewDispatcher creates a new delivery dispatcher
+func NewDispatcher(
+	deliveryRepo repositories.DeliveryRepository,
+	endpointRepo repositories.WebhookEndpointRepository,
+	eventRepo repositories.EventRepository,
+	aesKey []byte,
+	config DispatcherConfig,
+) *Dispatcher {
+	defaults := DefaultDispatcherConfig()
+	if config.PollInterval == 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = defaults.RequestTimeout
+	}
+	if config.Retry.MaxAttempts == 0 {
+		config.Retry = defaults.Retry
+	}
+
+	return &Dispatcher{
+		deliveryRepo: deliveryRepo,
+		endpointRepo: endpointRepo,
+		eventRepo:    eventRepo,
+		aesKey:       aesKey,
+		client:       &http.Client{Timeout: config.RequestTimeout},
+		config:       config,
+	}
+}
+
+// Run starts the dispatcher and delivers notifications until context is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Info().
+		Dur("poll_every", d.config.PollInterval).
+		Int("batch_size", d.config.BatchSize).
+		Int("max_attempts", d.config.Retry.MaxAttempts).
+		Msg("webhook delivery dispatcher started")
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("webhook delivery dispatcher stopping")
+			return
+		case <-ticker.C:
+			if err := d.dispatchBatch(ctx); err != nil {
+				log.Error().Err(err).Msg("error dispatching delivery batch")
+			}
+		}
+	}
+}
+
+// dispatchBatch claims due deliveries and attempts each one
+func (d *Dispatcher) dispatchBatch(ctx context.Context) error {
+	deliveries, err := d.deliveryRepo.ClaimDue(ctx, d.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, dl := range deliveries {
+		d.attempt(ctx, dl)
+
+		if err := d.deliveryRepo.Save(ctx, dl); err != nil {
+			log.Error().Err(err).Int64("delivery_id", dl.ID).Msg("failed to save delivery outcome")
+		}
+	}
+
+	return nil
+}
+
+// attempt performs one delivery attempt and records the outcome on the delivery
+func (d *Dispatcher) attempt(ctx context.Context, dl *delivery.Delivery) {
+	endpoint, err := d.endpointRepo.FindByTenantID(ctx, dl.TenantID)
+	if err != nil || !endpoint.IsActive {
+		dl.MarkFailed("no active webhook endpoint", 0, d.config.Retry)
+		return
+	}
+
+	evt, err := d.eventRepo.FindByID(ctx, dl.EventID)
+	if err != nil {
+		dl.MarkFailed(fmt.Sprintf("failed to load event: %v", err), 0, d.config.Retry)
+		return
+	}
+
+	body, err := json.Marshal(newNotification(evt))
+	if err != nil {
+		dl.MarkFailed(fmt.Sprintf("failed to encode notification: %v", err), 0, d.config.Retry)
+		return
+	}
+
+	secrets, err := d.signingSecrets(endpoint)
+	if err != nil {
+		dl.MarkFailed(fmt.Sprintf("failed to load signing secret: %v", err), 0, d.config.Retry)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		dl.MarkFailed(fmt.Sprintf("failed to create request: %v", err), 0, d.config.Retry)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PayMatch-Webhooks/1.0")
+	req.Header.Set("PayMatch-Event-Id", strconv.FormatInt(evt.ID, 10))
+	req.Header.Set("PayMatch-Delivery-Id", strconv.FormatInt(dl.ID, 10))
+	req.Header.Set("PayMatch-Delivery-Attempt", strconv.Itoa(dl.Attempts+1))
+
+	// Sign every attempt with a fresh timestamp so receivers can reject replays
+	timestamp := time.Now().Unix()
+	req.Header.Set(webhooksig.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhooksig.HeaderSignature, webhooksig.SignatureHeader(timestamp, body, secrets...))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		dl.MarkFailed(fmt.Sprintf("request failed: %v", err), 0, d.config.Retry)
+		d.logOutcome(dl, endpoint.URL)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		dl.MarkDelivered(resp.StatusCode)
+		d.logOutcome(dl, endpoint.URL)
+		return
+	}
+
+	// Keep a short excerpt of the response for operators
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	dl.MarkFailed(fmt.Sprintf("endpoint returned status %d: %s", resp.StatusCode, string(excerpt)), resp.StatusCode, d.config.Retry)
+	d.logOutcome(dl, endpoint.URL)
+}
+
+// signingSecrets decrypts the secrets currently valid for an endpoint
+func (d *Dispatcher) signingSecrets(endpoint *delivery.Endpoint) ([]string, error) {
+	encrypted := endpoint.ActiveSecretsEnc(time.Now())
+	if len(encrypted) == 0 {
+		return nil, fmt.Errorf("endpoint has no signing secret")
+	}
+
+	secrets := make([]string, 0, len(encrypted))
+	for _, enc := range encrypted {
+		secret, err := crypto.DecryptString(d.aesKey, enc)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// logOutcome logs the result of a delivery attempt
+func (d *Dispatcher) logOutcome(dl *delivery.Delivery, url string) {
+	entry := log.Info()
+	if dl.Status == delivery.StatusDead {
+		entry = log.Warn()
+	}
+
+	entry.
+		Int64("delivery_id", dl.ID).
+		Int64("tenant_id", dl.TenantID).
+		Int64("event_id", dl.EventID).
+		Str("url", url).
+		Str("status", string(dl.Status)).
+		Int("attempts", dl.Attempts).
+		Int("status_code", dl.LastStatusCode).
+		Msg("webhook delivery attempt")
+}
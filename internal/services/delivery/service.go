@@ -0,0 +1,284 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/domain/delivery"
+	"paymatch/internal/domain/event"
+	"paymatch/internal/store/repositories"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSecretOverlap is how long a rotated-out signing secret keeps being used
+const DefaultSecretOverlap = 24 * time.Hour
+
+// signingSecretPrefix makes PayMatch secrets easy to recognise in config files
+const signingSecretPrefix = "whsec_"
+
+// Service manages tenant webhook endpoints and the outbound delivery queue
+type Service struct {
+	deliveryRepo repositories.DeliveryRepository
+	endpointRepo repositories.WebhookEndpointRepository
+	aesKey       []byte
+}
+
+// NewService creates a new delivery service; aesKey encrypts signing secrets at rest
+func NewService(deliveryRepo repositories.DeliveryRepository, endpointRepo repositories.WebhookEndpointRepository, aesKey []byte) *Service {
+	return &Service{
+		deliveryRepo: deliveryRepo,
+		endpointRepo: endpointRepo,
+		aesKey:       aesKey,
+	}
+}
+
+// Notify queues a delivery for a processed event in the transaction that records its effects,
+// so a committed payment is always announced. Only payment events are announced, and
+// tenants without an active endpoint are skipped.
+func (s *Service) Notify(ctx context.Context, tx repositories.Transaction, evt *event.Event) error {
+	if !evt.IsPayment() {
+		return nil
+	}
+
+	endpoint, err := s.endpointRepo.FindByTenantID(ctx, evt.TenantID)
+	if err != nil || !endpoint.IsActive {
+		log.Debug().Int64("tenant_id", evt.TenantID).Int64("event_id", evt.ID).Msg("no active webhook endpoint, skipping delivery")
+		return nil
+	}
+
+	d, err := delivery.NewDelivery(evt.TenantID, evt.ID)
+	if err != nil {
+		return &ServiceError{Op: "enqueue", Err: err}
+	}
+
+	if err := tx.DeliveryRepository().Enqueue(ctx, d); err != nil {
+		return &ServiceError{Op: "enqueue", Err: err}
+	}
+	return nil
+}
+
+// ConfigureEndpoint creates or updates the tenant's webhook endpoint.
+// A signing secret is generated the first time and returned only in that response.
+func (s *Service) ConfigureEndpoint(ctx context.Context, tenantID int64, url string) (*EndpointResponse, error) {
+	endpoint, err := s.endpointRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		endpoint, err = delivery.NewEndpoint(tenantID, url)
+	} else {
+		err = endpoint.ChangeURL(url)
+	}
+	if err != nil {
+		return nil, &ValidationError{Field: "url", Message: err.Error()}
+	}
+
+	var secret string
+	if endpoint.SigningSecretEnc == "" {
+		var secretEnc string
+		secret, secretEnc, err = s.newSigningSecret()
+		if err != nil {
+			return nil, &ServiceError{Op: "generate_secret", Err: err}
+		}
+		endpoint.SetSigningSecret(secretEnc)
+	}
+
+	if err := s.endpointRepo.Save(ctx, endpoint); err != nil {
+		return nil, &ServiceError{Op: "save_endpoint", Err: err}
+	}
+	return newEndpointResponse(endpoint, secret), nil
+}
+
+// RotateSecret issues a new signing secret; the old one is still used for signing during the overlap
+func (s *Service) RotateSecret(ctx context.Context, tenantID int64, overlap time.Duration) (*EndpointResponse, error) {
+	endpoint, err := s.endpointRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, &ServiceError{Op: "get_endpoint", Err: err}
+	}
+
+	secret, secretEnc, err := s.newSigningSecret()
+	if err != nil {
+		return nil, &ServiceError{Op: "generate_secret", Err: err}
+	}
+
+	if err := endpoint.RotateSecret(secretEnc, overlap); err != nil {
+		return nil, &ValidationError{Field: "overlap", Message: err.Error()}
+	}
+
+	if err := s.endpointRepo.Save(ctx, endpoint); err != nil {
+		return nil, &ServiceError{Op: "save_endpoint", Err: err}
+	}
+
+	log.Info().Int64("tenant_id", tenantID).Dur("overlap", overlap).Msg("webhook signing secret rotated")
+	return newEndpointResponse(endpoint, secret), nil
+}
+
+// GetEndpoint returns the tenant's webhook endpoint
+func (s *Service) GetEndpoint(ctx context.Context, tenantID int64) (*EndpointResponse, error) {
+	endpoint, err := s.endpointRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, &ServiceError{Op: "get_endpoint", Err: err}
+	}
+	return newEndpointResponse(endpoint, ""), nil
+}
+
+// newSigningSecret generates a random secret and its encrypted form
+func (s *Service) newSigningSecret() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := signingSecretPrefix + hex.EncodeToString(raw)
+
+	secretEnc, err := crypto.EncryptString(s.aesKey, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, secretEnc, nil
+}
+
+// EndpointResponse is the tenant-facing view of an endpoint; secrets are never echoed back after creation
+type EndpointResponse struct {
+	ID                      int64      `json:"id"`
+	URL                     string     `json:"url"`
+	IsActive                bool       `json:"is_active"`
+	SigningSecret           string     `json:"signing_secret,omitempty"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at,omitempty"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+// newEndpointResponse builds the response for an endpoint, including a freshly issued secret if any
+func newEndpointResponse(e *delivery.Endpoint, secret string) *EndpointResponse {
+	return &EndpointResponse{
+		ID:                      e.ID,
+		URL:                     e.URL,
+		IsActive:                e.IsActive,
+		SigningSecret:           secret,
+		SecretRotatedAt:         e.SecretRotatedAt,
+		PreviousSecretExpiresAt: e.PreviousSecretExpiresAt,
+		CreatedAt:               e.CreatedAt,
+		UpdatedAt:               e.UpdatedAt,
+	}
+}
+
+// ListDeliveries lists deliveries, optionally filtered by tenant and status
+func (s *Service) ListDeliveries(ctx context.Context, tenantID int64, status delivery.Status, limit, offset int) (*DeliveryListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	deliveries, err := s.deliveryRepo.FindByTenantID(ctx, tenantID, status, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_deliveries", Err: err}
+	}
+
+	return &DeliveryListResponse{
+		Deliveries: deliveries,
+		Limit:      limit,
+		Offset:     offset,
+	}, nil
+}
+
+// DeliveryListResponse represents paginated delivery data
+type DeliveryListResponse struct {
+	Deliveries []*delivery.Delivery `json:"deliveries"`
+	Limit      int                  `json:"limit"`
+	Offset     int                  `json:"offset"`
+}
+
+// Redeliver requeues a failed or dead-lettered delivery
+func (s *Service) Redeliver(ctx context.Context, id int64) (*delivery.Delivery, error) {
+	d, err := s.deliveryRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_delivery", Err: err}
+	}
+
+	if err := d.Redeliver(); err != nil {
+		return nil, &ValidationError{Field: "status", Message: err.Error()}
+	}
+
+	if err := s.deliveryRepo.Save(ctx, d); err != nil {
+		return nil, &ServiceError{Op: "save_delivery", Err: err}
+	}
+	return d, nil
+}
+
+// Notification is the normalized payload POSTed to tenant endpoints
+type Notification struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      NotificationData `json:"data"`
+}
+
+// NotificationData carries the payment details of a notification
+type NotificationData struct {
+	EventID       int64     `json:"event_id"`
+	Channel       string    `json:"channel"`
+	ExternalID    string    `json:"external_id"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Amount        int64     `json:"amount"`
+	Currency      string    `json:"currency"`
+	InvoiceRef    string    `json:"invoice_ref,omitempty"`
+	Status        string    `json:"status"`
+	Description   string    `json:"description,omitempty"`
+	ReceivedAt    time.Time `json:"received_at"`
+}
+
+// newNotification builds the notification for a payment event; the ID is stable across retries.
+// Events whose provider reported no status are announced as payment.updated.
+func newNotification(evt *event.Event) Notification {
+	notificationType := "payment.updated"
+	if evt.Status != "" {
+		notificationType = "payment." + evt.Status
+	}
+
+	return Notification{
+		ID:        fmt.Sprintf("evt_%d", evt.ID),
+		Type:      notificationType,
+		CreatedAt: time.Now().UTC(),
+		Data: NotificationData{
+			EventID:       evt.ID,
+			Channel:       string(evt.Type),
+			ExternalID:    evt.ExternalID,
+			TransactionID: evt.TransactionID,
+			Amount:        evt.Amount,
+			Currency:      "KES",
+			InvoiceRef:    evt.InvoiceRef,
+			Status:        evt.Status,
+			Description:   evt.ResponseDescription,
+			ReceivedAt:    evt.ReceivedAt,
+		},
+	}
+}
+
+// ValidationError represents a validation error
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error [" + e.Field + "]: " + e.Message
+}
+
+// ServiceError represents a delivery service error
+type ServiceError struct {
+	Op  string
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	return "delivery service " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
@@ -13,6 +13,8 @@ import (
 type WorkerConfig struct {
 	PollInterval time.Duration
 	BatchSize    int
+	RetryEvery   time.Duration // how often deferred events are retried
+	DeferFor     time.Duration // how long deferred events are retried before they fail
 }
 
 // DefaultWorkerConfig returns sensible defaults for the worker
@@ -20,13 +22,25 @@ func DefaultWorkerConfig() WorkerConfig {
 	return WorkerConfig{
 		PollInterval: 2 * time.Second,
 		BatchSize:    50,
+		RetryEvery:   30 * time.Second,
+		DeferFor:     time.Hour,
 	}
 }
 
+// ProcessingDependencies holds the services the event processor works with
+type ProcessingDependencies struct {
+	PaymentService *payment.Service
+	Matcher        PaymentMatcher // optional
+	Notifier       Notifier       // optional
+	Payouts        PayoutUpdater   // optional
+	Reversals      ReversalUpdater // optional
+	Queries        QueryUpdater    // optional
+}
+
 // NewEventProcessingSystem creates a fully configured event processing system
 func NewEventProcessingSystem(
 	db *pgxpool.Pool,
-	paymentService *payment.Service,
+	deps ProcessingDependencies,
 	config WorkerConfig,
 ) (*Worker, error) {
 	// Create repositories - these need to be the concrete implementations
@@ -34,10 +48,26 @@ func NewEventProcessingSystem(
 	unitOfWork := postgres.NewUnitOfWork(db)
 	
 	// Create processor with dependencies
-	processor := NewProcessor(eventRepo, paymentService, unitOfWork)
+	processor := NewProcessor(eventRepo, deps.PaymentService, unitOfWork)
+	processor.SetDeferFor(config.DeferFor)
+	if deps.Matcher != nil {
+		processor.SetMatcher(deps.Matcher)
+	}
+	if deps.Notifier != nil {
+		processor.SetNotifier(deps.Notifier)
+	}
+	if deps.Payouts != nil {
+		processor.SetPayoutUpdater(deps.Payouts)
+	}
+	if deps.Reversals != nil {
+		processor.SetReversalUpdater(deps.Reversals)
+	}
+	if deps.Queries != nil {
+		processor.SetQueryUpdater(deps.Queries)
+	}
 	
 	// Create worker
-	worker := NewWorker(eventRepo, processor, config.PollInterval, config.BatchSize)
+	worker := NewWorker(eventRepo, processor, config.PollInterval, config.BatchSize, config.RetryEvery)
 	
 	return worker, nil
 }
\ No newline at end of file
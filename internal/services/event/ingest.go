@@ -0,0 +1,48 @@
+package event
+
+import (
+	"context"
+	"fmt"
+
+	"paymatch/internal/domain/event"
+	"paymatch/internal/store/repositories"
+
+	"github.com/rs/zerolog/log"
+)
+
+// IngestService durably stores incoming provider events for the worker to process
+type IngestService struct {
+	eventRepo repositories.EventRepository
+}
+
+// NewIngestService creates a new event ingestion service
+func NewIngestService(eventRepo repositories.EventRepository) *IngestService {
+	return &IngestService{
+		eventRepo: eventRepo,
+	}
+}
+
+// IngestResult describes the outcome of storing an event
+type IngestResult struct {
+	EventID   int64 `json:"eventId"`
+	Duplicate bool  `json:"duplicate"`
+}
+
+// Ingest persists an event; redeliveries of the same callback are detected and not requeued
+func (s *IngestService) Ingest(ctx context.Context, evt *event.Event) (*IngestResult, error) {
+	inserted, err := s.eventRepo.SaveIfAbsent(ctx, evt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to persist event: %w", err)
+	}
+
+	if !inserted {
+		log.Info().
+			Int64("event_id", evt.ID).
+			Int64("tenant_id", evt.TenantID).
+			Str("type", string(evt.Type)).
+			Str("external_id", evt.ExternalID).
+			Msg("duplicate webhook delivery ignored")
+	}
+
+	return &IngestResult{EventID: evt.ID, Duplicate: !inserted}, nil
+}
@@ -3,8 +3,10 @@ package event
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"paymatch/internal/domain/event"
 	"paymatch/internal/services/payment"
@@ -13,11 +15,45 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Notifier queues tenant notifications for events within the transaction that records them
+type Notifier interface {
+	Notify(ctx context.Context, tx repositories.Transaction, evt *event.Event) error
+}
+
+// PaymentMatcher links a processed payment to the invoice its reference points at
+type PaymentMatcher interface {
+	MatchPayment(ctx context.Context, tx repositories.Transaction, eventID, tenantID, credentialID int64, externalID, reference string) error
+}
+
+// PayoutUpdater settles outgoing payouts from provider result and timeout events
+type PayoutUpdater interface {
+	// ApplyResult returns false if no payout matches the event
+	ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error)
+}
+
+// ReversalUpdater settles payment reversals from provider result and timeout events
+type ReversalUpdater interface {
+	// ApplyResult returns false if no reversal matches the event
+	ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error)
+}
+
+// QueryUpdater completes balance and transaction status queries from provider result and timeout events
+type QueryUpdater interface {
+	// ApplyResult returns false if no query matches the event
+	ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error)
+}
+
 // Processor handles event processing business logic
 type Processor struct {
 	eventRepo   repositories.EventRepository
 	paymentSvc  *payment.Service
 	unitOfWork  repositories.UnitOfWork
+	matcher     PaymentMatcher
+	notifier    Notifier
+	payouts     PayoutUpdater
+	reversals   ReversalUpdater
+	queries     QueryUpdater
+	deferFor    time.Duration // how long results for unrecorded requests are retried
 }
 
 // NewProcessor creates a new event processor
@@ -30,6 +66,40 @@ func NewProcessor(
 		eventRepo:   eventRepo,
 		paymentSvc:  paymentSvc,
 		unitOfWork:  unitOfWork,
+		deferFor:    time.Hour,
+	}
+}
+
+// SetMatcher registers an optional payment-to-invoice matcher
+func (p *Processor) SetMatcher(matcher PaymentMatcher) {
+	p.matcher = matcher
+}
+
+// SetNotifier registers an optional notifier for committed payment events
+func (p *Processor) SetNotifier(notifier Notifier) {
+	p.notifier = notifier
+}
+
+// SetPayoutUpdater registers an optional handler for B2C results and timeouts
+func (p *Processor) SetPayoutUpdater(payouts PayoutUpdater) {
+	p.payouts = payouts
+}
+
+// SetReversalUpdater registers an optional handler for reversal results and timeouts
+func (p *Processor) SetReversalUpdater(reversals ReversalUpdater) {
+	p.reversals = reversals
+}
+
+// SetQueryUpdater registers an optional handler for balance and transaction status results
+func (p *Processor) SetQueryUpdater(queries QueryUpdater) {
+	p.queries = queries
+}
+
+// SetDeferFor sets how long events referring to requests not yet recorded are retried
+// before they are marked failed
+func (p *Processor) SetDeferFor(d time.Duration) {
+	if d > 0 {
+		p.deferFor = d
 	}
 }
 
@@ -41,7 +111,15 @@ func (p *Processor) ProcessEvent(ctx context.Context, evt *event.Event) error {
 	case event.TypeC2B:
 		return p.processC2BEvent(ctx, evt)
 	case event.TypeB2C:
-		return p.processB2CEvent(ctx, evt)
+		// Failed query results carry no parameters and parse like failed B2C results
+		return p.processResultEvent(ctx, evt, p.payouts, p.queries)
+	case event.TypeReversal:
+		return p.processResultEvent(ctx, evt, p.reversals)
+	case event.TypeBalance, event.TypeTransactionStatus:
+		return p.processResultEvent(ctx, evt, p.queries)
+	case event.TypeTimeout:
+		// Queue timeouts share one URL; the conversation ID tells which request timed out
+		return p.processResultEvent(ctx, evt, p.payouts, p.reversals, p.queries)
 	default:
 		// Mark unknown events as processed to avoid reprocessing
 		return p.markEventProcessed(ctx, evt, event.ProcessingCompleted)
@@ -56,20 +134,19 @@ func (p *Processor) processSTKEvent(ctx context.Context, evt *event.Event) error
 		return p.markEventProcessed(ctx, evt, event.ProcessingFailed)
 	}
 	
-	// Extract payment data from STK callback
-	amount := payload.extractAmount()
-	msisdn := payload.extractMSISDN()
-	reference := payload.extractReference()
-	isSuccess := payload.isSuccessful()
-	
-	// Determine payment status based on callback result
-	status := "failed"
-	if isSuccess {
-		status = "completed"
+	// Prefer the normalized fields captured at ingestion, falling back to the raw Daraja payload
+	amount := evt.Amount
+	if amount == 0 {
+		amount = payload.extractAmount()
 	}
+	msisdn := firstNonEmpty(evt.MSISDN, payload.extractMSISDN())
+	reference := firstNonEmpty(evt.InvoiceRef, payload.extractReference())
+	
+	// The provider's webhook parser mapped the callback result when it was received
+	outcome := payment.Outcome{Status: evt.Status, FailureCode: evt.FailureCode, FailureReason: evt.ResponseDescription}
 	
 	// Process payment atomically with event update
-	return p.processPaymentEvent(ctx, evt, reference, msisdn, amount, status)
+	return p.processPaymentEvent(ctx, evt, reference, msisdn, amount, outcome)
 }
 
 // processC2BEvent handles Customer-to-Business events  
@@ -80,22 +157,67 @@ func (p *Processor) processC2BEvent(ctx context.Context, evt *event.Event) error
 		return p.markEventProcessed(ctx, evt, event.ProcessingFailed)
 	}
 	
-	amount := payload.extractAmount()
-	msisdn := payload.extractMSISDN()
-	reference := payload.extractReference()
+	amount := evt.Amount
+	if amount == 0 {
+		amount = payload.extractAmount()
+	}
+	msisdn := firstNonEmpty(evt.MSISDN, payload.extractMSISDN())
+	reference := firstNonEmpty(evt.InvoiceRef, payload.extractReference())
 	
 	// C2B payments are typically successful when received
-	return p.processPaymentEvent(ctx, evt, reference, msisdn, amount, "completed")
+	return p.processPaymentEvent(ctx, evt, reference, msisdn, amount, payment.Outcome{Status: "completed"})
 }
 
-// processB2CEvent handles Business-to-Customer events
-func (p *Processor) processB2CEvent(ctx context.Context, evt *event.Event) error {
-	// For now, just mark as processed - B2C logic can be added later
-	return p.markEventProcessed(ctx, evt, event.ProcessingCompleted)
+// resultUpdater applies an asynchronous result to the outgoing request it refers to
+type resultUpdater interface {
+	ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error)
+}
+
+// processResultEvent settles the outgoing request (payout or reversal) a result or queue
+// timeout refers to, trying each updater in turn until one recognizes the event
+func (p *Processor) processResultEvent(ctx context.Context, evt *event.Event, updaters ...resultUpdater) error {
+	var registered bool
+	for _, u := range updaters {
+		registered = registered || u != nil
+	}
+	if !registered {
+		return p.markEventProcessed(ctx, evt, event.ProcessingCompleted)
+	}
+	
+	tx, err := p.unitOfWork.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	
+	var found bool
+	for _, u := range updaters {
+		if u == nil {
+			continue
+		}
+		if found, err = u.ApplyResult(ctx, tx, evt); err != nil {
+			return fmt.Errorf("failed to apply %s result: %w", evt.Type, err)
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		// Not initiated through PayMatch, or the result beat the request being recorded
+		log.Warn().Int64("event_id", evt.ID).Str("external_id", evt.ExternalID).Str("event_type", string(evt.Type)).Msg("no outgoing request matches result callback")
+		return p.deferOrFail(ctx, evt)
+	}
+	
+	if err := tx.EventRepository().MarkProcessed(ctx, evt.ID, event.ProcessingCompleted); err != nil {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	
+	// Tenant notifications announce payments only; outgoing results are not notified
+	return tx.Commit(ctx)
 }
 
 // processPaymentEvent atomically updates both payment and event in a transaction
-func (p *Processor) processPaymentEvent(ctx context.Context, evt *event.Event, reference, msisdn string, amount int64, status string) error {
+func (p *Processor) processPaymentEvent(ctx context.Context, evt *event.Event, reference, msisdn string, amount int64, outcome payment.Outcome) error {
 	// Begin transaction for atomic operation
 	tx, err := p.unitOfWork.Begin(ctx)
 	if err != nil {
@@ -103,15 +225,28 @@ func (p *Processor) processPaymentEvent(ctx context.Context, evt *event.Event, r
 	}
 	defer tx.Rollback(ctx)
 	
-	// Process payment through service layer
+	// Process payment through service layer, attributing any status change to the event
+	outcome.EventID = evt.ID
 	err = p.paymentSvc.ProcessPaymentEvent(ctx, 
 		evt.TenantID, evt.ProviderCredentialID, evt.ExternalID,
-		amount, msisdn, reference, status)
+		amount, msisdn, reference, outcome)
+	if errors.Is(err, payment.ErrPaymentNotRecorded) {
+		// The callback beat the initiating request being recorded; retry once it is
+		log.Warn().Int64("event_id", evt.ID).Str("external_id", evt.ExternalID).Msg("no payment recorded for callback without an amount")
+		return p.deferOrFail(ctx, evt)
+	}
 	if err != nil {
 		log.Error().Err(err).Int64("event_id", evt.ID).Msg("failed to process payment")
 		return p.markEventProcessed(ctx, evt, event.ProcessingFailed)
 	}
 	
+	// Reconcile successful payments against open invoices
+	if p.matcher != nil && outcome.Status == "completed" {
+		if err := p.matcher.MatchPayment(ctx, tx, evt.ID, evt.TenantID, evt.ProviderCredentialID, evt.ExternalID, reference); err != nil {
+			return fmt.Errorf("failed to match payment: %w", err)
+		}
+	}
+	
 	// Mark event as processed
 	eventRepo := tx.EventRepository()
 	err = eventRepo.MarkProcessed(ctx, evt.ID, event.ProcessingCompleted)
@@ -119,15 +254,50 @@ func (p *Processor) processPaymentEvent(ctx context.Context, evt *event.Event, r
 		return fmt.Errorf("failed to mark event processed: %w", err)
 	}
 	
+	// Queue the tenant notification with the payment update so neither commits without the other
+	if err := p.notify(ctx, tx, evt); err != nil {
+		return err
+	}
+	
 	// Commit transaction
 	return tx.Commit(ctx)
 }
 
+// notify queues the tenant notification for an event inside its transaction
+func (p *Processor) notify(ctx context.Context, tx repositories.Transaction, evt *event.Event) error {
+	if p.notifier == nil {
+		return nil
+	}
+	if err := p.notifier.Notify(ctx, tx, evt); err != nil {
+		return fmt.Errorf("failed to queue tenant notification: %w", err)
+	}
+	return nil
+}
+
 // markEventProcessed marks an event with a specific processing status
 func (p *Processor) markEventProcessed(ctx context.Context, evt *event.Event, status event.ProcessingStatus) error {
 	return p.eventRepo.MarkProcessed(ctx, evt.ID, status)
 }
 
+// deferOrFail leaves an event the worker should retry later, or marks it failed once it
+// has been retried for longer than deferFor
+func (p *Processor) deferOrFail(ctx context.Context, evt *event.Event) error {
+	if time.Since(evt.ReceivedAt) > p.deferFor {
+		return p.markEventProcessed(ctx, evt, event.ProcessingFailed)
+	}
+	return p.markEventProcessed(ctx, evt, event.ProcessingDeferred)
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // STK payload structure for parsing Safaricom callbacks
 type stkPayload struct {
 	Body struct {
@@ -154,10 +324,6 @@ func (p *Processor) parseSTKPayload(rawJSON []byte) (*stkPayload, error) {
 	return &payload, nil
 }
 
-func (s *stkPayload) isSuccessful() bool {
-	return s.Body.StkCallback.ResultCode == 0
-}
-
 func (s *stkPayload) extractAmount() int64 {
 	for _, item := range s.Body.StkCallback.CallbackMetadata.Item {
 		if item.Name == "Amount" {
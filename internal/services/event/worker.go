@@ -16,6 +16,7 @@ type Worker struct {
 	processor  *Processor
 	pollEvery  time.Duration
 	batchSize  int
+	retryEvery time.Duration
 }
 
 // NewWorker creates a new event processing worker
@@ -24,6 +25,7 @@ func NewWorker(
 	processor *Processor,
 	pollEvery time.Duration,
 	batchSize int,
+	retryEvery time.Duration,
 ) *Worker {
 	if pollEvery == 0 {
 		pollEvery = 2 * time.Second
@@ -31,12 +33,16 @@ func NewWorker(
 	if batchSize == 0 {
 		batchSize = 50
 	}
+	if retryEvery == 0 {
+		retryEvery = 30 * time.Second
+	}
 	
 	return &Worker{
 		eventRepo:  eventRepo,
 		processor:  processor,
 		pollEvery:  pollEvery,
 		batchSize:  batchSize,
+		retryEvery: retryEvery,
 	}
 }
 
@@ -70,6 +76,15 @@ func (w *Worker) processNextBatch(ctx context.Context) error {
 		return err
 	}
 	
+	// Fill the rest of the batch with deferred events due another try
+	if len(events) < w.batchSize {
+		deferred, err := w.eventRepo.FindDeferredBefore(ctx, time.Now().Add(-w.retryEvery), w.batchSize-len(events))
+		if err != nil {
+			return err
+		}
+		events = append(events, deferred...)
+	}
+	
 	if len(events) == 0 {
 		return nil // No events to process
 	}
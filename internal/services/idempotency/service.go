@@ -0,0 +1,199 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"paymatch/internal/domain/idempotency"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Config holds configuration for Idempotency-Key handling
+type Config struct {
+	Retention     time.Duration // how long a key's response is replayed
+	ClaimTimeout  time.Duration // after which a request still processing is taken to be abandoned
+	PurgeInterval time.Duration
+	BatchSize     int // expired keys deleted per purge statement
+}
+
+// DefaultConfig returns sensible defaults for Idempotency-Key handling
+func DefaultConfig() Config {
+	return Config{
+		Retention:     24 * time.Hour,
+		ClaimTimeout:  5 * time.Minute,
+		PurgeInterval: time.Hour,
+		BatchSize:     500,
+	}
+}
+
+// Service makes retried payment requests safe: the first request with a key is handled
+// and its response stored, and retries with the same key get that response back
+type Service struct {
+	repo   repositories.IdempotencyRepository
+	config Config
+}
+
+// NewService creates a new idempotency service
+func NewService(repo repositories.IdempotencyRepository, config Config) *Service {
+	defaults := DefaultConfig()
+	if config.Retention == 0 {
+		config.Retention = defaults.Retention
+	}
+	if config.ClaimTimeout == 0 {
+		config.ClaimTimeout = defaults.ClaimTimeout
+	}
+	if config.PurgeInterval == 0 {
+		config.PurgeInterval = defaults.PurgeInterval
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	return &Service{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Begin claims a key for a request. A record in StatusProcessing means the caller should
+// handle the request and then Complete or Release it; a completed record holds the
+// response to replay. A key reused for another request, or whose first request is still
+// being handled, is an error. A first request still processing after ClaimTimeout is
+// taken to have crashed, and a retry takes its key over.
+func (s *Service) Begin(ctx context.Context, tenantID int64, key, fingerprint string) (*idempotency.Record, error) {
+	rec, err := idempotency.NewRecord(tenantID, key, fingerprint, s.config.Retention)
+	if err != nil {
+		return nil, &ValidationError{Field: "Idempotency-Key", Message: err.Error()}
+	}
+
+	// A second attempt covers a key released between the claim and the lookup
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := s.repo.Claim(ctx, rec, rec.CreatedAt.Add(-s.config.ClaimTimeout))
+		if err != nil {
+			return nil, &ServiceError{Op: "claim_key", Err: err}
+		}
+		if claimed {
+			return rec, nil
+		}
+
+		existing, err := s.repo.FindByKey(ctx, tenantID, key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, &ServiceError{Op: "find_key", Err: err}
+		}
+		if !existing.Matches(fingerprint) {
+			return nil, ErrKeyReused
+		}
+		if existing.Status != idempotency.StatusCompleted {
+			return nil, ErrInProgress
+		}
+		return existing, nil
+	}
+	return nil, ErrInProgress
+}
+
+// Complete stores the response to a claimed request for replay
+func (s *Service) Complete(ctx context.Context, rec *idempotency.Record, status int, contentType string, body []byte) error {
+	rec.Complete(status, contentType, body)
+	err := s.repo.Complete(ctx, rec)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrClaimLost
+	}
+	if err != nil {
+		return &ServiceError{Op: "complete_key", Err: err}
+	}
+	return nil
+}
+
+// Release frees the key of a request that had no effect, so it can be sent again
+func (s *Service) Release(ctx context.Context, rec *idempotency.Record) error {
+	err := s.repo.Release(ctx, rec)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrClaimLost
+	}
+	if err != nil {
+		return &ServiceError{Op: "release_key", Err: err}
+	}
+	return nil
+}
+
+// Run purges expired keys until context is cancelled
+func (s *Service) Run(ctx context.Context) {
+	log.Info().
+		Dur("retention", s.config.Retention).
+		Dur("purge_every", s.config.PurgeInterval).
+		Msg("idempotency key purger started")
+
+	ticker := time.NewTicker(s.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("idempotency key purger stopping")
+			return
+		case <-ticker.C:
+			if err := s.purgeOnce(ctx); err != nil {
+				log.Error().Err(err).Msg("error purging idempotency keys")
+			}
+		}
+	}
+}
+
+// purgeOnce deletes expired keys in batches
+func (s *Service) purgeOnce(ctx context.Context) error {
+	var total int64
+	for {
+		deleted, err := s.repo.DeleteExpired(ctx, time.Now(), s.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		total += deleted
+		if deleted < int64(s.config.BatchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		log.Info().Int64("deleted", total).Msg("purged expired idempotency keys")
+	}
+	return nil
+}
+
+// ValidationError represents an input validation error
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error [" + e.Field + "]: " + e.Message
+}
+
+// ServiceError represents an idempotency service error
+type ServiceError struct {
+	Op  string
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	return "idempotency service " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// ErrKeyReused is returned when a key comes back with a different request
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrInProgress is returned while the first request with a key is still being handled
+	ErrInProgress = errors.New("a request with this idempotency key is still being processed")
+	// ErrClaimLost is returned when a request outlived its claim and a retry took the key over
+	ErrClaimLost = errors.New("idempotency key was taken over by a retry")
+)
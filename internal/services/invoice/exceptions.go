@@ -0,0 +1,258 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"paymatch/internal/domain/exception"
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ActionRequest identifies who is acting on an exception and why
+type ActionRequest struct {
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+}
+
+// ManualMatchRequest applies a whole payment to one invoice
+type ManualMatchRequest struct {
+	ActionRequest
+	InvoiceID int64 `json:"invoice_id"`
+}
+
+// SplitRequest applies a payment across several invoices
+type SplitRequest struct {
+	ActionRequest
+	Allocations []SplitAllocation `json:"allocations"`
+}
+
+// SplitAllocation is the amount of a payment to apply to one invoice
+type SplitAllocation struct {
+	InvoiceID int64 `json:"invoice_id"`
+	Amount    int64 `json:"amount"`
+}
+
+// ListExceptions retrieves payments needing an operator, optionally filtered by kind
+func (s *Service) ListExceptions(ctx context.Context, tenantID int64, kind exception.Kind, limit, offset int) (*ExceptionListResponse, error) {
+	switch kind {
+	case "", exception.KindUnmatched, exception.KindAmbiguous, exception.KindRefundCandidate:
+	default:
+		return nil, &ValidationError{Field: "kind", Message: "must be unmatched, ambiguous or refund_candidate"}
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	exceptions, err := s.exceptionRepo.FindByTenantID(ctx, tenantID, kind, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_exceptions", Err: err}
+	}
+
+	return &ExceptionListResponse{
+		Exceptions: exceptions,
+		Limit:      limit,
+		Offset:     offset,
+	}, nil
+}
+
+// ManualMatch applies an unmatched payment in full to the invoice an operator chose
+func (s *Service) ManualMatch(ctx context.Context, tenantID, paymentID int64, req ManualMatchRequest) (*ExceptionActionResponse, error) {
+	if req.InvoiceID <= 0 {
+		return nil, &ValidationError{Field: "invoice_id", Message: "invoice_id is required"}
+	}
+	return s.reconcile(ctx, tenantID, paymentID, exception.ActionManualMatch, req.ActionRequest,
+		func(p *payment.Payment) []exception.Split {
+			return []exception.Split{{InvoiceID: req.InvoiceID, Amount: p.Amount}}
+		})
+}
+
+// SplitPayment applies an unmatched payment across several invoices
+func (s *Service) SplitPayment(ctx context.Context, tenantID, paymentID int64, req SplitRequest) (*ExceptionActionResponse, error) {
+	splits := make([]exception.Split, len(req.Allocations))
+	for i, a := range req.Allocations {
+		splits[i] = exception.Split{InvoiceID: a.InvoiceID, Amount: payment.Money(a.Amount)}
+	}
+	return s.reconcile(ctx, tenantID, paymentID, exception.ActionSplit, req.ActionRequest,
+		func(*payment.Payment) []exception.Split { return splits })
+}
+
+// MarkRefundCandidate flags an unmatched payment to be returned to the payer
+func (s *Service) MarkRefundCandidate(ctx context.Context, tenantID, paymentID int64, req ActionRequest) (*ExceptionActionResponse, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := lockPayment(ctx, tx, tenantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := exception.NewAuditEntry(tenantID, p.ID, exception.ActionRefundCandidate, req.Actor, req.Reason, nil)
+	if err != nil {
+		return nil, &ValidationError{Field: "audit", Message: err.Error()}
+	}
+	if err := p.MarkRefundCandidate(); err != nil {
+		return nil, &ValidationError{Field: "payment", Message: err.Error()}
+	}
+
+	if err := tx.PaymentRepository().Save(ctx, p); err != nil {
+		return nil, &ServiceError{Op: "update_payment", Err: err}
+	}
+	if err := s.closeException(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().Int64("tenant_id", tenantID).Int64("payment_id", p.ID).Str("actor", entry.Actor).Msg("payment flagged for refund")
+	return &ExceptionActionResponse{Payment: p, Audit: entry}, nil
+}
+
+// PaymentAudit retrieves the operator actions taken on a payment
+func (s *Service) PaymentAudit(ctx context.Context, tenantID, paymentID int64) ([]*exception.AuditEntry, error) {
+	entries, err := s.exceptionRepo.FindAuditByPaymentID(ctx, tenantID, paymentID)
+	if err != nil {
+		return nil, &ServiceError{Op: "get_audit", Err: err}
+	}
+	return entries, nil
+}
+
+// reconcile applies a payment to the invoices chosen by an operator and records the action
+func (s *Service) reconcile(ctx context.Context, tenantID, paymentID int64, action exception.Action, req ActionRequest, splitsFor func(*payment.Payment) []exception.Split) (*ExceptionActionResponse, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := lockPayment(ctx, tx, tenantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != payment.StatusCompleted && p.Status != payment.StatusRefundCandidate {
+		return nil, &ValidationError{Field: "payment", Message: "only completed, unmatched payments can be matched manually"}
+	}
+
+	splits := splitsFor(p)
+	if err := exception.ValidateSplits(splits, p.Amount); err != nil {
+		return nil, &ValidationError{Field: "allocations", Message: err.Error()}
+	}
+	entry, err := exception.NewAuditEntry(tenantID, p.ID, action, req.Actor, req.Reason, splits)
+	if err != nil {
+		return nil, &ValidationError{Field: "audit", Message: err.Error()}
+	}
+
+	var matches []*MatchResult
+	var references []string
+	for _, split := range splits {
+		inv, err := tx.InvoiceRepository().LockByID(ctx, split.InvoiceID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && inv.TenantID != tenantID) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, &ServiceError{Op: "find_invoice", Err: err}
+		}
+		if err := inv.CanApply(split.Amount, p.Currency); err != nil {
+			return nil, &ValidationError{Field: "invoice_id", Message: err.Error()}
+		}
+
+		match, err := allocate(ctx, tx, p, inv, split.Amount)
+		if err != nil {
+			return nil, &ServiceError{Op: "allocate", Err: err}
+		}
+		if match == nil {
+			return nil, &ValidationError{Field: "invoice_id", Message: "payment is already allocated to invoice " + inv.Reference}
+		}
+		matches = append(matches, match)
+		references = append(references, inv.Reference)
+	}
+
+	if err := p.MarkReconciled(splitStatus(matches), strings.Join(references, ",")); err != nil {
+		return nil, &ValidationError{Field: "payment", Message: err.Error()}
+	}
+	if err := tx.PaymentRepository().Save(ctx, p); err != nil {
+		return nil, &ServiceError{Op: "update_payment", Err: err}
+	}
+	if err := s.closeException(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", tenantID).
+		Int64("payment_id", p.ID).
+		Str("action", string(action)).
+		Str("actor", entry.Actor).
+		Int("invoices", len(matches)).
+		Msg("payment reconciled manually")
+
+	return &ExceptionActionResponse{Payment: p, Matches: matches, Audit: entry}, nil
+}
+
+// closeException writes the audit entry and retires any pending match suggestion
+func (s *Service) closeException(ctx context.Context, tx repositories.Transaction, entry *exception.AuditEntry) error {
+	if err := tx.ExceptionRepository().SaveAudit(ctx, entry); err != nil {
+		return &ServiceError{Op: "save_audit", Err: err}
+	}
+	if err := tx.MatchReviewRepository().SupersedePending(ctx, entry.PaymentID); err != nil {
+		return &ServiceError{Op: "supersede_review", Err: err}
+	}
+	return nil
+}
+
+// lockPayment loads a payment for update and ensures it belongs to the tenant
+func lockPayment(ctx context.Context, tx repositories.Transaction, tenantID, paymentID int64) (*payment.Payment, error) {
+	p, err := tx.ExceptionRepository().LockPayment(ctx, paymentID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && p.TenantID != tenantID) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_payment", Err: err}
+	}
+	return p, nil
+}
+
+// splitStatus summarizes the outcomes of a payment applied to one or more invoices
+func splitStatus(matches []*MatchResult) payment.Status {
+	outcome := invoice.OutcomeExact
+	for _, m := range matches {
+		switch m.Outcome {
+		case invoice.OutcomeOver:
+			return payment.StatusOverpaid
+		case invoice.OutcomePartial:
+			outcome = invoice.OutcomePartial
+		}
+	}
+	return paymentStatusFor(outcome)
+}
+
+// ExceptionListResponse represents paginated exception data
+type ExceptionListResponse struct {
+	Exceptions []*exception.Exception `json:"exceptions"`
+	Limit      int                    `json:"limit"`
+	Offset     int                    `json:"offset"`
+}
+
+// ExceptionActionResponse represents the result of an operator action on a payment
+type ExceptionActionResponse struct {
+	Payment *payment.Payment      `json:"payment"`
+	Matches []*MatchResult        `json:"matches,omitempty"`
+	Audit   *exception.AuditEntry `json:"audit"`
+}
+
+// ErrPaymentNotFound is returned when a payment does not exist for the tenant
+var ErrPaymentNotFound = errors.New("payment not found")
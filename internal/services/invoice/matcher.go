@@ -0,0 +1,226 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/domain/matching"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// payableScanLimit bounds how many open invoices are scored when a reference has no exact match
+const payableScanLimit = 1000
+
+// Matcher links completed payments to open invoices by reference
+type Matcher struct{}
+
+// NewMatcher creates a new payment-to-invoice matcher
+func NewMatcher() *Matcher {
+	return &Matcher{}
+}
+
+// MatchResult describes a payment applied to an invoice
+type MatchResult struct {
+	InvoiceID int64
+	PaymentID int64
+	Outcome   invoice.MatchOutcome
+	Balance   payment.Money
+	CreditID  int64 // set when an overpayment became customer credit
+}
+
+// MatchPayment applies the payment identified by externalID to the invoice its
+// reference (STK AccountReference or C2B BillRefNumber) points at. It runs inside
+// the caller's transaction so the allocation commits together with the event.
+func (m *Matcher) MatchPayment(ctx context.Context, tx repositories.Transaction, eventID, tenantID, credentialID int64, externalID, reference string) error {
+	_, err := m.Match(ctx, tx, eventID, tenantID, credentialID, externalID, reference)
+	return err
+}
+
+// Match applies a payment to an invoice; a nil result means the payment was not
+// applied, either because nothing matched or because the match awaits review
+func (m *Matcher) Match(ctx context.Context, tx repositories.Transaction, eventID, tenantID, credentialID int64, externalID, reference string) (*MatchResult, error) {
+	p, err := tx.PaymentRepository().FindByExternalID(ctx, tenantID, externalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payment %s: %w", externalID, err)
+	}
+	p.CausedBy(eventID)
+
+	// Only successful, not yet reconciled payments are matched
+	if p.Status != payment.StatusCompleted {
+		return nil, nil
+	}
+
+	if reference == "" {
+		reference = p.InvoiceNo
+	}
+
+	// Fast path: the reference names an open invoice exactly
+	if invoice.NormalizeReference(reference) != "" {
+		inv, err := tx.InvoiceRepository().FindPayableByReference(ctx, tenantID, reference)
+		if err == nil {
+			return applyPayment(ctx, tx, p, inv)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to load invoice %s: %w", reference, err)
+		}
+	}
+
+	return m.matchFuzzy(ctx, tx, p, credentialID, reference)
+}
+
+// matchFuzzy scores the tenant's open invoices under its matching rules and either
+// applies the payment, queues the best candidate for review, or leaves it unmatched
+func (m *Matcher) matchFuzzy(ctx context.Context, tx repositories.Transaction, p *payment.Payment, credentialID int64, reference string) (*MatchResult, error) {
+	rules, err := tx.MatchingRulesRepository().FindEffective(ctx, p.TenantID, credentialID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		rules = matching.DefaultRules(p.TenantID)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load matching rules: %w", err)
+	}
+
+	invoices, err := tx.InvoiceRepository().FindPayable(ctx, p.TenantID, payableScanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open invoices: %w", err)
+	}
+
+	result := rules.BestMatch(matching.Payment{
+		Reference:  reference,
+		Amount:     p.Amount,
+		MSISDNHash: p.MSISDNHash,
+	}, invoices)
+
+	switch rules.Decide(result) {
+	case matching.DecisionAutoMatch:
+		// Re-read under lock; FindPayable does not lock the whole candidate set
+		inv, err := tx.InvoiceRepository().LockByID(ctx, result.Invoice.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock invoice %d: %w", result.Invoice.ID, err)
+		}
+		return applyPayment(ctx, tx, p, inv)
+
+	case matching.DecisionReview:
+		review, err := matching.NewReview(p.TenantID, p.ID, result)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.MatchReviewRepository().Save(ctx, review); err != nil {
+			return nil, fmt.Errorf("failed to queue match review: %w", err)
+		}
+		log.Info().
+			Int64("tenant_id", p.TenantID).
+			Int64("payment_id", p.ID).
+			Int64("invoice_id", result.Invoice.ID).
+			Float64("confidence", result.Confidence).
+			Str("method", string(result.Method)).
+			Bool("ambiguous", result.Ambiguous).
+			Msg("payment match queued for review")
+		return nil, nil
+
+	default:
+		log.Info().Int64("tenant_id", p.TenantID).Str("external_id", p.ExternalID).Str("reference", reference).Msg("no open invoice for payment reference")
+		return nil, nil
+	}
+}
+
+// applyPayment allocates a payment to a locked invoice, writes the ledger entry,
+// turns any excess into customer credit and marks the payment reconciled
+func applyPayment(ctx context.Context, tx repositories.Transaction, p *payment.Payment, inv *invoice.Invoice) (*MatchResult, error) {
+	if err := inv.CanApply(p.Amount, p.Currency); err != nil {
+		log.Warn().Err(err).Int64("invoice_id", inv.ID).Int64("payment_id", p.ID).Msg("payment cannot be applied to invoice")
+		return nil, nil
+	}
+
+	result, err := allocate(ctx, tx, p, inv, p.Amount)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	if err := p.MarkReconciled(paymentStatusFor(result.Outcome), inv.Reference); err != nil {
+		return nil, err
+	}
+	if err := tx.PaymentRepository().Save(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	log.Info().
+		Int64("tenant_id", p.TenantID).
+		Int64("invoice_id", inv.ID).
+		Int64("payment_id", p.ID).
+		Str("outcome", string(result.Outcome)).
+		Int64("balance", int64(inv.Balance())).
+		Msg("payment matched to invoice")
+
+	return result, nil
+}
+
+// allocate applies amount of a payment to a locked invoice, writes the ledger entry
+// and turns any excess into customer credit. It leaves the payment's status to the
+// caller; a nil result means this payment was already allocated to the invoice.
+func allocate(ctx context.Context, tx repositories.Transaction, p *payment.Payment, inv *invoice.Invoice, amount payment.Money) (*MatchResult, error) {
+	invoiceRepo := tx.InvoiceRepository()
+
+	outcome, err := inv.ApplyPayment(amount, p.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := invoiceRepo.SaveAllocation(ctx, &invoice.Allocation{
+		InvoiceID: inv.ID,
+		PaymentID: p.ID,
+		Amount:    amount,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save allocation: %w", err)
+	}
+	if !inserted {
+		return nil, nil // already applied by an earlier run
+	}
+
+	if err := invoiceRepo.Save(ctx, inv); err != nil {
+		return nil, fmt.Errorf("failed to update invoice: %w", err)
+	}
+	if err := invoiceRepo.SaveLedgerEntry(ctx, invoice.NewPaymentEntry(inv, p.ID, amount)); err != nil {
+		return nil, fmt.Errorf("failed to write ledger entry: %w", err)
+	}
+
+	// The excess of an overpayment is held as credit for the customer's next invoice
+	var creditID int64
+	if outcome == invoice.OutcomeOver {
+		credit, err := invoice.NewOverpaymentCredit(inv, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.CreditRepository().Save(ctx, credit); err != nil {
+			return nil, fmt.Errorf("failed to save credit: %w", err)
+		}
+		creditID = credit.ID
+	}
+
+	return &MatchResult{
+		InvoiceID: inv.ID,
+		PaymentID: p.ID,
+		Outcome:   outcome,
+		Balance:   inv.Balance(),
+		CreditID:  creditID,
+	}, nil
+}
+
+// paymentStatusFor maps a match outcome to the payment's reconciliation status
+func paymentStatusFor(outcome invoice.MatchOutcome) payment.Status {
+	switch outcome {
+	case invoice.OutcomePartial:
+		return payment.StatusPartiallyPaid
+	case invoice.OutcomeOver:
+		return payment.StatusOverpaid
+	default:
+		return payment.StatusMatched
+	}
+}
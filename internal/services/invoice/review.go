@@ -0,0 +1,214 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+
+	"paymatch/internal/domain/matching"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RulesRequest updates a tenant's matching rules; omitted fields keep their current value
+type RulesRequest struct {
+	CredentialID        *int64   `json:"credential_id,omitempty"` // override for one credential; omit for the tenant default
+	Normalizers         []string `json:"normalizers,omitempty"`
+	MaxEditDistance     *int     `json:"max_edit_distance,omitempty"`
+	AmountPhoneFallback *bool    `json:"amount_phone_fallback,omitempty"`
+	AutoMatchThreshold  *float64 `json:"auto_match_threshold,omitempty"`
+	ReviewThreshold     *float64 `json:"review_threshold,omitempty"`
+}
+
+// GetMatchingRules returns the rules in effect for a credential, or the tenant default when credentialID is nil
+func (s *Service) GetMatchingRules(ctx context.Context, tenantID int64, credentialID *int64) (*matching.Rules, error) {
+	var scope int64
+	if credentialID != nil {
+		scope = *credentialID
+	}
+
+	rules, err := s.rulesRepo.FindEffective(ctx, tenantID, scope)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return matching.DefaultRules(tenantID), nil
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "get_matching_rules", Err: err}
+	}
+	return rules, nil
+}
+
+// UpdateMatchingRules saves the tenant default or a per-credential override
+func (s *Service) UpdateMatchingRules(ctx context.Context, tenantID int64, req RulesRequest) (*matching.Rules, error) {
+	current, err := s.GetMatchingRules(ctx, tenantID, req.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	// An override starts from whatever currently applies to the credential
+	rules := *current
+	if !sameScope(current.CredentialID, req.CredentialID) {
+		rules.ID = 0
+		rules.CredentialID = req.CredentialID
+	}
+
+	if req.Normalizers != nil {
+		rules.Normalizers = make([]matching.Normalizer, len(req.Normalizers))
+		for i, n := range req.Normalizers {
+			rules.Normalizers[i] = matching.Normalizer(n)
+		}
+	}
+	if req.MaxEditDistance != nil {
+		rules.MaxEditDistance = *req.MaxEditDistance
+	}
+	if req.AmountPhoneFallback != nil {
+		rules.AmountPhoneFallback = *req.AmountPhoneFallback
+	}
+	if req.AutoMatchThreshold != nil {
+		rules.AutoMatchThreshold = *req.AutoMatchThreshold
+	}
+	if req.ReviewThreshold != nil {
+		rules.ReviewThreshold = *req.ReviewThreshold
+	}
+
+	if err := rules.Validate(); err != nil {
+		return nil, &ValidationError{Field: "rules", Message: err.Error()}
+	}
+
+	if err := s.rulesRepo.Save(ctx, rules.Touch()); err != nil {
+		return nil, &ServiceError{Op: "save_matching_rules", Err: err}
+	}
+	return &rules, nil
+}
+
+// ListReviews retrieves the tenant's match review queue
+func (s *Service) ListReviews(ctx context.Context, tenantID int64, status matching.ReviewStatus, limit, offset int) (*ReviewListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	reviews, err := s.reviewRepo.FindByTenantID(ctx, tenantID, status, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_reviews", Err: err}
+	}
+
+	return &ReviewListResponse{
+		Reviews: reviews,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// AcceptReview confirms a suggested match and applies the payment to the invoice
+func (s *Service) AcceptReview(ctx context.Context, tenantID, reviewID int64) (*ReviewResponse, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	review, err := lockReview(ctx, tx, tenantID, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if err := review.Accept(); err != nil {
+		return nil, &ValidationError{Field: "status", Message: err.Error()}
+	}
+
+	p, err := tx.PaymentRepository().FindByID(ctx, review.PaymentID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_payment", Err: err}
+	}
+	if p.IsReconciled() {
+		return nil, &ValidationError{Field: "payment", Message: "payment has already been matched"}
+	}
+
+	inv, err := tx.InvoiceRepository().LockByID(ctx, review.InvoiceID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_invoice", Err: err}
+	}
+	if !inv.AcceptsPayments() {
+		return nil, &ValidationError{Field: "invoice", Message: "invoice no longer accepts payments"}
+	}
+
+	match, err := applyPayment(ctx, tx, p, inv)
+	if err != nil {
+		return nil, &ServiceError{Op: "apply_payment", Err: err}
+	}
+	if match == nil {
+		return nil, &ValidationError{Field: "payment", Message: "payment cannot be applied to this invoice"}
+	}
+
+	if err := tx.MatchReviewRepository().Save(ctx, review); err != nil {
+		return nil, &ServiceError{Op: "save_review", Err: err}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	return &ReviewResponse{Review: review, Match: match}, nil
+}
+
+// RejectReview dismisses a suggested match and leaves the payment unmatched
+func (s *Service) RejectReview(ctx context.Context, tenantID, reviewID int64) (*ReviewResponse, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	review, err := lockReview(ctx, tx, tenantID, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if err := review.Reject(); err != nil {
+		return nil, &ValidationError{Field: "status", Message: err.Error()}
+	}
+
+	if err := tx.MatchReviewRepository().Save(ctx, review); err != nil {
+		return nil, &ServiceError{Op: "save_review", Err: err}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	return &ReviewResponse{Review: review}, nil
+}
+
+// lockReview loads a review for update and ensures it belongs to the tenant
+func lockReview(ctx context.Context, tx repositories.Transaction, tenantID, reviewID int64) (*matching.Review, error) {
+	review, err := tx.MatchReviewRepository().LockByID(ctx, reviewID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && review.TenantID != tenantID) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_review", Err: err}
+	}
+	return review, nil
+}
+
+// sameScope reports whether two rule scopes refer to the same credential (or both to the default)
+func sameScope(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// ReviewListResponse represents paginated review data
+type ReviewListResponse struct {
+	Reviews []*matching.Review `json:"reviews"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+}
+
+// ReviewResponse represents a resolved review and, when accepted, the resulting match
+type ReviewResponse struct {
+	Review *matching.Review `json:"review"`
+	Match  *MatchResult     `json:"match,omitempty"`
+}
+
+// ErrReviewNotFound is returned when a match review does not exist for the tenant
+var ErrReviewNotFound = errors.New("match review not found")
@@ -0,0 +1,411 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Service handles invoice registry, ledger, customer credit and manual reconciliation operations
+type Service struct {
+	invoiceRepo   repositories.InvoiceRepository
+	creditRepo    repositories.CreditRepository
+	rulesRepo     repositories.MatchingRulesRepository
+	reviewRepo    repositories.MatchReviewRepository
+	exceptionRepo repositories.ExceptionRepository
+	unitOfWork    repositories.UnitOfWork
+}
+
+// NewService creates a new invoice service
+func NewService(
+	invoiceRepo repositories.InvoiceRepository,
+	creditRepo repositories.CreditRepository,
+	rulesRepo repositories.MatchingRulesRepository,
+	reviewRepo repositories.MatchReviewRepository,
+	exceptionRepo repositories.ExceptionRepository,
+	unitOfWork repositories.UnitOfWork,
+) *Service {
+	return &Service{
+		invoiceRepo:   invoiceRepo,
+		creditRepo:    creditRepo,
+		rulesRepo:     rulesRepo,
+		reviewRepo:    reviewRepo,
+		exceptionRepo: exceptionRepo,
+		unitOfWork:    unitOfWork,
+	}
+}
+
+// CreateRequest represents an invoice creation request
+type CreateRequest struct {
+	Reference     string `json:"reference"`
+	CustomerRef   string `json:"customer_ref,omitempty"`
+	CustomerPhone string `json:"customer_phone,omitempty"` // corroborates fuzzy matches and the amount+phone fallback
+	Description   string `json:"description,omitempty"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency,omitempty"`      // default KES
+	DueDate       string `json:"due_date,omitempty"`      // YYYY-MM-DD
+	ApplyCredits  bool   `json:"apply_credits,omitempty"` // settle from the customer's available credit
+}
+
+// Create registers a new open invoice for the tenant and writes its opening ledger entry
+func (s *Service) Create(ctx context.Context, tenantID int64, req CreateRequest) (*invoice.Invoice, error) {
+	var dueDate *time.Time
+	if req.DueDate != "" {
+		d, err := time.Parse("2006-01-02", req.DueDate)
+		if err != nil {
+			return nil, &ValidationError{Field: "due_date", Message: "must be formatted as YYYY-MM-DD"}
+		}
+		dueDate = &d
+	}
+
+	inv, err := invoice.NewInvoice(tenantID, req.Reference, req.CustomerRef, req.Description,
+		payment.Money(req.Amount), payment.Currency(req.Currency), dueDate)
+	if err != nil {
+		return nil, &ValidationError{Field: "invoice", Message: err.Error()}
+	}
+	if req.CustomerPhone != "" {
+		msisdn, err := payment.NewMSISDN(normalizePhone(req.CustomerPhone))
+		if err != nil {
+			return nil, &ValidationError{Field: "customer_phone", Message: err.Error()}
+		}
+		inv.SetCustomerPhone(msisdn)
+	}
+	if req.ApplyCredits && inv.CustomerRef == "" {
+		return nil, &ValidationError{Field: "apply_credits", Message: "customer_ref is required to apply credits"}
+	}
+
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	invoiceRepo := tx.InvoiceRepository()
+	if err := invoiceRepo.Save(ctx, inv); err != nil {
+		if errors.Is(err, repositories.ErrDuplicate) {
+			return nil, &ValidationError{Field: "reference", Message: "an invoice with this reference already exists"}
+		}
+		return nil, &ServiceError{Op: "create_invoice", Err: err}
+	}
+
+	if err := invoiceRepo.SaveLedgerEntry(ctx, invoice.NewChargeEntry(inv)); err != nil {
+		return nil, &ServiceError{Op: "create_invoice", Err: err}
+	}
+
+	if req.ApplyCredits {
+		credits, err := tx.CreditRepository().LockAvailableByCustomer(ctx, tenantID, inv.CustomerRef)
+		if err != nil {
+			return nil, &ServiceError{Op: "load_credits", Err: err}
+		}
+		for _, credit := range credits {
+			if !inv.AcceptsPayments() {
+				break
+			}
+			if _, err := applyCredit(ctx, tx, credit, inv); err != nil {
+				return nil, &ServiceError{Op: "apply_credit", Err: err}
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+	return inv, nil
+}
+
+// List retrieves a tenant's invoices, optionally filtered by status and customer
+func (s *Service) List(ctx context.Context, tenantID int64, filter repositories.InvoiceFilter, limit, offset int) (*InvoiceListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	invoices, err := s.invoiceRepo.FindByTenantID(ctx, tenantID, filter, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_invoices", Err: err}
+	}
+
+	return &InvoiceListResponse{
+		Invoices: invoices,
+		Limit:    limit,
+		Offset:   offset,
+	}, nil
+}
+
+// Get retrieves an invoice together with its payments and ledger
+func (s *Service) Get(ctx context.Context, tenantID, id int64) (*InvoiceDetails, error) {
+	inv, err := s.find(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations, err := s.invoiceRepo.FindAllocationsByInvoiceID(ctx, inv.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "get_allocations", Err: err}
+	}
+
+	ledger, err := s.invoiceRepo.FindLedgerByInvoiceID(ctx, inv.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "get_ledger", Err: err}
+	}
+
+	return &InvoiceDetails{
+		Invoice:     inv,
+		Outstanding: inv.Outstanding(),
+		Overpaid:    inv.Overpaid(),
+		Payments:    allocations,
+		Ledger:      ledger,
+	}, nil
+}
+
+// Ledger retrieves the running balance ledger of an invoice
+func (s *Service) Ledger(ctx context.Context, tenantID, id int64) ([]*invoice.LedgerEntry, error) {
+	inv, err := s.find(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger, err := s.invoiceRepo.FindLedgerByInvoiceID(ctx, inv.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "get_ledger", Err: err}
+	}
+	return ledger, nil
+}
+
+// Cancel cancels an invoice that has not been paid
+func (s *Service) Cancel(ctx context.Context, tenantID, id int64) (*invoice.Invoice, error) {
+	inv, err := s.find(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := inv.Cancel(); err != nil {
+		return nil, &ValidationError{Field: "status", Message: err.Error()}
+	}
+
+	if err := s.invoiceRepo.Save(ctx, inv); err != nil {
+		return nil, &ServiceError{Op: "cancel_invoice", Err: err}
+	}
+	return inv, nil
+}
+
+// ListCredits retrieves a tenant's customer credits
+func (s *Service) ListCredits(ctx context.Context, tenantID int64, customerRef string, status invoice.CreditStatus, limit, offset int) (*CreditListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	credits, err := s.creditRepo.FindByTenantID(ctx, tenantID, customerRef, status, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_credits", Err: err}
+	}
+
+	return &CreditListResponse{
+		Credits: credits,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// ApplyCredit settles an invoice from a customer credit
+func (s *Service) ApplyCredit(ctx context.Context, tenantID, creditID, invoiceID int64) (*ApplyCreditResponse, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	credit, err := tx.CreditRepository().LockByID(ctx, creditID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && credit.TenantID != tenantID) {
+		return nil, ErrCreditNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_credit", Err: err}
+	}
+
+	inv, err := tx.InvoiceRepository().LockByID(ctx, invoiceID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && inv.TenantID != tenantID) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_invoice", Err: err}
+	}
+
+	used, err := applyCredit(ctx, tx, credit, inv)
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, err
+		}
+		return nil, &ServiceError{Op: "apply_credit", Err: err}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	return &ApplyCreditResponse{
+		Applied: used,
+		Credit:  credit,
+		Invoice: inv,
+	}, nil
+}
+
+// CustomerBalance summarizes what a customer owes across invoices and the credit they hold
+func (s *Service) CustomerBalance(ctx context.Context, tenantID int64, customerRef string) (*CustomerBalanceResponse, error) {
+	customerRef = invoice.NormalizeReference(customerRef)
+	if customerRef == "" {
+		return nil, &ValidationError{Field: "customer_ref", Message: "customer_ref is required"}
+	}
+
+	invoices, err := s.invoiceRepo.FindByTenantID(ctx, tenantID, repositories.InvoiceFilter{CustomerRef: customerRef}, 200, 0)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_invoices", Err: err}
+	}
+
+	credits, err := s.creditRepo.FindByTenantID(ctx, tenantID, customerRef, invoice.CreditAvailable, 200, 0)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_credits", Err: err}
+	}
+
+	response := &CustomerBalanceResponse{
+		CustomerRef:  customerRef,
+		OpenInvoices: []*invoice.Invoice{},
+		Credits:      credits,
+	}
+	for _, inv := range invoices {
+		if inv.AcceptsPayments() {
+			response.Outstanding += inv.Outstanding()
+			response.OpenInvoices = append(response.OpenInvoices, inv)
+		}
+	}
+	for _, credit := range credits {
+		response.AvailableCredit += credit.Remaining
+	}
+	return response, nil
+}
+
+// applyCredit moves money from a credit to an invoice and records it on the ledger
+func applyCredit(ctx context.Context, tx repositories.Transaction, credit *invoice.Credit, inv *invoice.Invoice) (payment.Money, error) {
+	used, err := credit.ApplyTo(inv)
+	if err != nil {
+		return 0, &ValidationError{Field: "credit", Message: err.Error()}
+	}
+	if used == 0 {
+		return 0, nil
+	}
+
+	if err := tx.CreditRepository().Save(ctx, credit); err != nil {
+		return 0, fmt.Errorf("failed to update credit: %w", err)
+	}
+	if err := tx.InvoiceRepository().Save(ctx, inv); err != nil {
+		return 0, fmt.Errorf("failed to update invoice: %w", err)
+	}
+	if err := tx.InvoiceRepository().SaveLedgerEntry(ctx, invoice.NewCreditEntry(inv, credit.ID, used)); err != nil {
+		return 0, fmt.Errorf("failed to write ledger entry: %w", err)
+	}
+	return used, nil
+}
+
+// normalizePhone converts a Kenyan number to the 2547XXXXXXXX form Daraja reports payers in
+func normalizePhone(phone string) string {
+	phone = strings.NewReplacer(" ", "", "-", "", "+", "").Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "0") {
+		phone = "254" + phone[1:]
+	}
+	return phone
+}
+
+// find loads an invoice and ensures it belongs to the tenant
+func (s *Service) find(ctx context.Context, tenantID, id int64) (*invoice.Invoice, error) {
+	inv, err := s.invoiceRepo.FindByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && inv.TenantID != tenantID) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_invoice", Err: err}
+	}
+	return inv, nil
+}
+
+// InvoiceListResponse represents paginated invoice data
+type InvoiceListResponse struct {
+	Invoices []*invoice.Invoice `json:"invoices"`
+	Limit    int                `json:"limit"`
+	Offset   int                `json:"offset"`
+}
+
+// InvoiceDetails represents an invoice with its applied payments and ledger
+type InvoiceDetails struct {
+	Invoice     *invoice.Invoice       `json:"invoice"`
+	Outstanding payment.Money          `json:"outstanding"`
+	Overpaid    payment.Money          `json:"overpaid"`
+	Payments    []*invoice.Allocation  `json:"payments"`
+	Ledger      []*invoice.LedgerEntry `json:"ledger"`
+}
+
+// CreditListResponse represents paginated credit data
+type CreditListResponse struct {
+	Credits []*invoice.Credit `json:"credits"`
+	Limit   int               `json:"limit"`
+	Offset  int               `json:"offset"`
+}
+
+// ApplyCreditResponse represents the result of applying a credit
+type ApplyCreditResponse struct {
+	Applied payment.Money    `json:"applied"`
+	Credit  *invoice.Credit  `json:"credit"`
+	Invoice *invoice.Invoice `json:"invoice"`
+}
+
+// CustomerBalanceResponse summarizes a customer's position
+type CustomerBalanceResponse struct {
+	CustomerRef     string             `json:"customer_ref"`
+	Outstanding     payment.Money      `json:"outstanding"`
+	AvailableCredit payment.Money      `json:"available_credit"`
+	OpenInvoices    []*invoice.Invoice `json:"open_invoices"`
+	Credits         []*invoice.Credit  `json:"credits"`
+}
+
+// ErrNotFound is returned when an invoice does not exist for the tenant
+var ErrNotFound = errors.New("invoice not found")
+
+// ErrCreditNotFound is returned when a credit does not exist for the tenant
+var ErrCreditNotFound = errors.New("credit not found")
+
+// ValidationError represents a validation error
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error [" + e.Field + "]: " + e.Message
+}
+
+// ServiceError represents an invoice service error
+type ServiceError struct {
+	Op  string
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	return "invoice service " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
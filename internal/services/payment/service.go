@@ -2,10 +2,13 @@ package payment
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"paymatch/internal/domain/payment"
 	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // Service handles payment business logic
@@ -22,8 +25,16 @@ func NewService(paymentRepo repositories.PaymentRepository, eventRepo repositori
 	}
 }
 
+// Outcome is what the provider reported about a payment
+type Outcome struct {
+	Status        string // provider status
+	FailureCode   string // standard provider error code when the payment did not complete
+	FailureReason string
+	EventID       int64 // event that reported the outcome; zero when a sweep found it
+}
+
 // ProcessPaymentEvent processes a payment event and updates payment state
-func (s *Service) ProcessPaymentEvent(ctx context.Context, tenantID, credentialID int64, externalID string, amount int64, msisdnStr, invoice, status string) error {
+func (s *Service) ProcessPaymentEvent(ctx context.Context, tenantID, credentialID int64, externalID string, amount int64, msisdnStr, invoice string, outcome Outcome) error {
 	// Create MSISDN domain object with validation
 	var msisdn *payment.MSISDN
 	var err error
@@ -37,6 +48,16 @@ func (s *Service) ProcessPaymentEvent(ctx context.Context, tenantID, credentialI
 	// Find existing payment
 	existingPayment, err := s.paymentRepo.FindByExternalID(ctx, tenantID, externalID)
 	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return ServiceError{Op: "find_payment", Message: "failed to load payment", Err: err}
+		}
+		
+		// Some callbacks (Airtel collections) carry only a status; they can only settle a
+		// payment recorded when it was initiated
+		if amount <= 0 {
+			return ErrPaymentNotRecorded
+		}
+		
 		// Create new payment if not found
 		newPayment, err := payment.NewPayment(
 			tenantID,
@@ -50,45 +71,108 @@ func (s *Service) ProcessPaymentEvent(ctx context.Context, tenantID, credentialI
 		if err != nil {
 			return fmt.Errorf("failed to create payment: %w", err)
 		}
+		newPayment.ProviderCredentialID = credentialID
+		newPayment.CausedBy(outcome.EventID)
 		
 		// Update status based on event
-		if status != "" {
-			statusEnum := s.mapStatusFromProvider(status)
+		if outcome.Status != "" {
+			statusEnum := s.mapStatusFromProvider(outcome.Status)
 			if err := newPayment.Update("", 0, statusEnum, nil); err != nil {
 				return fmt.Errorf("failed to update payment status: %w", err)
 			}
+			newPayment.RecordFailure(outcome.FailureCode, outcome.FailureReason)
 		}
 		
 		return s.paymentRepo.Save(ctx, newPayment)
 	}
 	
 	// Update existing payment with business rules
-	statusEnum := s.mapStatusFromProvider(status)
-	err = existingPayment.Update(invoice, payment.Money(amount), statusEnum, msisdn)
+	statusEnum := s.mapStatusFromProvider(outcome.Status)
+	err = existingPayment.CausedBy(outcome.EventID).Update(invoice, payment.Money(amount), statusEnum, msisdn)
 	if err != nil {
 		return fmt.Errorf("failed to update payment: %w", err)
 	}
+	existingPayment.RecordFailure(outcome.FailureCode, outcome.FailureReason)
 	
 	return s.paymentRepo.Save(ctx, existingPayment)
 }
 
-// CreatePendingPayment creates a new pending payment (for STK push)
-func (s *Service) CreatePendingPayment(ctx context.Context, tenantID, credentialID int64, invoice string, amount int64, externalID string) error {
+// PendingPayment describes an STK push that was accepted by the provider
+type PendingPayment struct {
+	CredentialID int64  // credential the push went through
+	ExternalID   string // provider's checkout request ID, which the callback carries
+	Invoice      string
+	Amount       int64
+	PhoneNumber  string
+	Metadata     map[string]string
+	InitiatedBy  string
+}
+
+// CreatePendingPayment records an STK push as a pending payment for its callback to
+// complete. A callback that arrived first has already created the payment; it is then
+// given the initiation details instead.
+func (s *Service) CreatePendingPayment(ctx context.Context, tenantID int64, req PendingPayment) (*payment.Payment, error) {
+	var msisdn *payment.MSISDN
+	if req.PhoneNumber != "" {
+		var err error
+		msisdn, err = payment.NewMSISDN(req.PhoneNumber)
+		if err != nil {
+			return nil, fmt.Errorf("invalid phone number: %w", err)
+		}
+	}
+	if err := payment.ValidateMetadata(req.Metadata); err != nil {
+		return nil, err
+	}
+
 	// Create payment domain object
 	newPayment, err := payment.NewPayment(
 		tenantID,
-		invoice,
-		payment.Money(amount),
+		req.Invoice,
+		payment.Money(req.Amount),
 		payment.KES,
 		payment.MethodMpesa,
-		externalID,
-		nil, // No MSISDN for STK push initially
+		req.ExternalID,
+		msisdn,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create pending payment: %w", err)
+		return nil, fmt.Errorf("failed to create pending payment: %w", err)
 	}
-	
-	return s.paymentRepo.Save(ctx, newPayment)
+	newPayment.ProviderCredentialID = req.CredentialID
+	newPayment.Metadata = req.Metadata
+	newPayment.InitiatedBy = req.InitiatedBy
+
+	err = s.paymentRepo.Save(ctx, newPayment)
+	if !errors.Is(err, repositories.ErrDuplicate) {
+		if err != nil {
+			return nil, ServiceError{Op: "create_pending_payment", Message: "failed to save payment", Err: err}
+		}
+		return newPayment, nil
+	}
+
+	existing, err := s.paymentRepo.FindByExternalID(ctx, tenantID, req.ExternalID)
+	if err != nil {
+		return nil, ServiceError{Op: "create_pending_payment", Message: "failed to find payment", Err: err}
+	}
+	existing.Initiated(newPayment)
+	if err := s.paymentRepo.Save(ctx, existing); err != nil {
+		return nil, ServiceError{Op: "create_pending_payment", Message: "failed to save payment", Err: err}
+	}
+	return existing, nil
+}
+
+// GetPayment returns one of the tenant's payments
+func (s *Service) GetPayment(ctx context.Context, tenantID, paymentID int64) (*payment.Payment, error) {
+	p, err := s.paymentRepo.FindByID(ctx, paymentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, ServiceError{Op: "get_payment", Message: "failed to find payment", Err: err}
+	}
+	if p.TenantID != tenantID {
+		return nil, ErrPaymentNotFound
+	}
+	return p, nil
 }
 
 // GetPaymentsByTenant retrieves payments for a tenant with pagination
@@ -106,17 +190,28 @@ func (s *Service) GetPaymentsByTenant(ctx context.Context, tenantID int64, limit
 // mapStatusFromProvider maps provider status to domain status
 func (s *Service) mapStatusFromProvider(providerStatus string) payment.Status {
 	switch providerStatus {
+	case "processing":
+		return payment.StatusProcessing
 	case "completed", "0":
 		return payment.StatusCompleted
 	case "failed", "1":
 		return payment.StatusFailed
 	case "cancelled":
 		return payment.StatusCancelled
+	case "timeout", "timed_out":
+		return payment.StatusTimedOut
 	default:
 		return payment.StatusPending
 	}
 }
 
+// ErrPaymentNotFound is returned when a payment does not exist or belongs to another tenant
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// ErrPaymentNotRecorded is returned when a callback without an amount refers to a payment
+// that has not been recorded yet
+var ErrPaymentNotRecorded = errors.New("callback refers to a payment not recorded yet")
+
 // ServiceError represents a payment service error
 type ServiceError struct {
 	Op      string
@@ -0,0 +1,168 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SweeperConfig holds configuration for the pending payment sweeper
+type SweeperConfig struct {
+	PollInterval time.Duration
+	PendingAfter time.Duration // payments pending longer than this are queried
+	GiveUpAfter  time.Duration // payments the provider still reports pending after this long are timed out
+	BatchSize    int
+}
+
+// DefaultSweeperConfig returns sensible defaults for the sweeper
+func DefaultSweeperConfig() SweeperConfig {
+	return SweeperConfig{
+		PollInterval: time.Minute,
+		PendingAfter: 2 * time.Minute,
+		GiveUpAfter:  15 * time.Minute,
+		BatchSize:    50,
+	}
+}
+
+// PendingSweeper resolves STK payments whose callback never arrived by querying the
+// provider, and applies the outcome through the same path as a callback would
+type PendingSweeper struct {
+	svc            *Service
+	credentialRepo repositories.CredentialRepository
+	registry       *provider.Registry
+	config         SweeperConfig
+}
+
+// NewPendingSweeper creates a new pending payment sweeper
+func NewPendingSweeper(svc *Service, credentialRepo repositories.CredentialRepository, registry *provider.Registry, config SweeperConfig) *PendingSweeper {
+	defaults := DefaultSweeperConfig()
+	if config.PollInterval == 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.PendingAfter == 0 {
+		config.PendingAfter = defaults.PendingAfter
+	}
+	if config.GiveUpAfter == 0 {
+		config.GiveUpAfter = defaults.GiveUpAfter
+	}
+	if config.GiveUpAfter < config.PendingAfter {
+		config.GiveUpAfter = config.PendingAfter
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	return &PendingSweeper{
+		svc:            svc,
+		credentialRepo: credentialRepo,
+		registry:       registry,
+		config:         config,
+	}
+}
+
+// Run starts the sweeper and resolves pending payments until context is cancelled
+func (s *PendingSweeper) Run(ctx context.Context) {
+	log.Info().
+		Dur("poll_every", s.config.PollInterval).
+		Dur("pending_after", s.config.PendingAfter).
+		Dur("give_up_after", s.config.GiveUpAfter).
+		Msg("pending payment sweeper started")
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("pending payment sweeper stopping")
+			return
+		case <-ticker.C:
+			if err := s.sweepOnce(ctx); err != nil {
+				log.Error().Err(err).Msg("error sweeping pending payments")
+			}
+		}
+	}
+}
+
+// sweepOnce queries the provider for each stale pending payment and applies final states
+func (s *PendingSweeper) sweepOnce(ctx context.Context) error {
+	now := time.Now()
+	payments, err := s.svc.paymentRepo.FindPendingBefore(ctx, now.Add(-s.config.PendingAfter), s.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	credentials := make(map[int64]*credential.ProviderCredential)
+	for _, p := range payments {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.resolve(ctx, p, now, credentials)
+	}
+	return nil
+}
+
+// resolve settles one pending payment if the provider has a final answer for it, or
+// times it out once it has been pending too long to still complete
+func (s *PendingSweeper) resolve(ctx context.Context, p *payment.Payment, now time.Time, credentials map[int64]*credential.ProviderCredential) {
+	expired := now.Sub(p.CreatedAt) >= s.config.GiveUpAfter
+
+	outcome := s.query(ctx, p, credentials)
+	if outcome.Status == provider.StatusPending || outcome.Status == provider.StatusProcessing {
+		switch {
+		case expired:
+			outcome.Status = provider.StatusTimeout
+			outcome.FailureCode = provider.ErrProviderTimeout
+		case outcome.Status == provider.StatusPending || p.Status == payment.StatusProcessing:
+			// Nothing new to record until the provider has a final answer
+			return
+		}
+	}
+
+	if err := s.svc.ProcessPaymentEvent(ctx, p.TenantID, p.ProviderCredentialID, p.ExternalID, 0, "", "", outcome); err != nil {
+		log.Error().Err(err).Int64("payment_id", p.ID).Str("status", outcome.Status).Msg("failed to resolve pending payment")
+		return
+	}
+
+	log.Info().
+		Int64("tenant_id", p.TenantID).
+		Int64("payment_id", p.ID).
+		Str("external_id", p.ExternalID).
+		Str("status", outcome.Status).
+		Str("result", outcome.FailureReason).
+		Msg("pending payment resolved by STK query")
+}
+
+// query asks the payment's provider for its current state; any failure reads as still pending
+func (s *PendingSweeper) query(ctx context.Context, p *payment.Payment, credentials map[int64]*credential.ProviderCredential) Outcome {
+	if p.ProviderCredentialID == 0 {
+		return Outcome{Status: provider.StatusPending, FailureReason: "payment has no provider credential"}
+	}
+
+	cred, ok := credentials[p.ProviderCredentialID]
+	if !ok {
+		c, err := s.credentialRepo.FindByID(ctx, p.ProviderCredentialID)
+		if err != nil {
+			log.Error().Err(err).Int64("credential_id", p.ProviderCredentialID).Msg("failed to load payment credential")
+			return Outcome{Status: provider.StatusPending, FailureReason: err.Error()}
+		}
+		cred, credentials[p.ProviderCredentialID] = c, c
+	}
+
+	resp, err := s.registry.STKQuery(ctx, cred, p.ExternalID)
+	if err != nil {
+		log.Warn().Err(err).Int64("payment_id", p.ID).Str("external_id", p.ExternalID).Msg("STK query failed")
+		return Outcome{Status: provider.StatusPending, FailureReason: err.Error()}
+	}
+	if resp.Status == provider.StatusPending {
+		// The provider knows the push; the customer has not answered it yet
+		return Outcome{Status: provider.StatusProcessing}
+	}
+	return Outcome{Status: resp.Status, FailureCode: resp.ErrorCode, FailureReason: resp.Message}
+}
@@ -0,0 +1,454 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// expireBatchSize bounds how many lapsed approvals one sweep closes
+const expireBatchSize = 100
+
+// PolicyRequest replaces a tenant's approval policy
+type PolicyRequest struct {
+	Tiers       []TierRequest `json:"tiers"`                  // empty: payouts never need approval
+	ExpiryHours int           `json:"expiry_hours,omitempty"` // default 24
+}
+
+// TierRequest requires a number of approvals at or above an amount
+type TierRequest struct {
+	MinAmount int64 `json:"min_amount"`
+	Approvals int   `json:"approvals"`
+}
+
+// DecisionRequest carries an approver's note; rejections must give a reason
+type DecisionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ApprovalPolicy returns the tenant's approval policy, or the default when none was configured
+func (s *Service) ApprovalPolicy(ctx context.Context, tenantID int64) (*payout.ApprovalPolicy, error) {
+	policy, err := s.approvalRepo.FindPolicy(ctx, tenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return payout.DefaultApprovalPolicy(tenantID), nil
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_approval_policy", Err: err}
+	}
+	return policy, nil
+}
+
+// UpdateApprovalPolicy replaces the tenant's approval policy. Pending approvals keep
+// the number of approvals they were opened with.
+func (s *Service) UpdateApprovalPolicy(ctx context.Context, tenantID int64, req PolicyRequest) (*payout.ApprovalPolicy, error) {
+	policy := &payout.ApprovalPolicy{
+		TenantID:    tenantID,
+		Tiers:       make([]payout.ApprovalTier, len(req.Tiers)),
+		ExpiryHours: req.ExpiryHours,
+	}
+	if policy.ExpiryHours == 0 {
+		policy.ExpiryHours = payout.DefaultApprovalPolicy(tenantID).ExpiryHours
+	}
+	for i, tier := range req.Tiers {
+		policy.Tiers[i] = payout.ApprovalTier{MinAmount: payment.Money(tier.MinAmount), Approvals: tier.Approvals}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, &ValidationError{Field: "policy", Message: err.Error()}
+	}
+	if err := s.approvalRepo.SavePolicy(ctx, policy.Touch()); err != nil {
+		return nil, &ServiceError{Op: "save_approval_policy", Err: err}
+	}
+
+	log.Info().Int64("tenant_id", tenantID).Int("tiers", len(policy.Tiers)).Msg("approval policy updated")
+	return policy, nil
+}
+
+// ListApprovals retrieves a tenant's approvals, optionally filtered by status
+func (s *Service) ListApprovals(ctx context.Context, tenantID int64, status payout.ApprovalStatus, limit, offset int) (*ApprovalListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	approvals, err := s.approvalRepo.FindByTenantID(ctx, tenantID, status, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_approvals", Err: err}
+	}
+
+	return &ApprovalListResponse{
+		Approvals: approvals,
+		Limit:     limit,
+		Offset:    offset,
+	}, nil
+}
+
+// GetApproval retrieves an approval with its audit trail and the payout or batch it releases
+func (s *Service) GetApproval(ctx context.Context, tenantID, id int64) (*ApprovalDetail, error) {
+	a, err := s.approvalRepo.FindByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && a.TenantID != tenantID) {
+		return nil, ErrApprovalNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_approval", Err: err}
+	}
+
+	audit, err := s.approvalRepo.FindAudit(ctx, a.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_approval_audit", Err: err}
+	}
+	detail := &ApprovalDetail{Approval: a, Audit: audit}
+
+	switch a.Subject {
+	case payout.SubjectPayout:
+		if detail.Payout, err = s.Get(ctx, tenantID, a.SubjectID); err != nil {
+			return nil, err
+		}
+	case payout.SubjectBatch:
+		if detail.Batch, err = s.findBatch(ctx, tenantID, a.SubjectID); err != nil {
+			return nil, err
+		}
+	}
+	return detail, nil
+}
+
+// Approve records the actor's approval. Once the last required approval is in, a payout is
+// sent to the provider and a batch is handed to the batch runner.
+func (s *Service) Approve(ctx context.Context, tenantID, id int64, actor string, req DecisionRequest) (*ApprovalDetail, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := lockApproval(ctx, tx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if expired, err := s.expireIn(ctx, tx, a); err != nil {
+		return nil, err
+	} else if expired {
+		// The expiry is recorded even though the decision is refused
+		if err := tx.Commit(ctx); err != nil {
+			return nil, &ServiceError{Op: "commit", Err: err}
+		}
+		return nil, ErrApprovalExpired
+	}
+
+	complete, err := a.Approve(actor)
+	if err != nil {
+		return nil, &ValidationError{Field: "approval", Message: err.Error()}
+	}
+	if err := s.record(ctx, tx, a, payout.ActionApproved, actor, req.Reason); err != nil {
+		return nil, err
+	}
+
+	var released *payout.Payout
+	if complete {
+		if released, err = s.release(ctx, tx, a); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", tenantID).
+		Int64("approval_id", a.ID).
+		Str("actor", actor).
+		Int("approvals", len(a.ApprovedBy)).
+		Int("required", a.Required).
+		Msg("payout approval recorded")
+
+	if released != nil {
+		s.sendApproved(ctx, a, released)
+	}
+	return s.GetApproval(ctx, tenantID, a.ID)
+}
+
+// Reject turns an approval down and cancels the payout or batch it was holding
+func (s *Service) Reject(ctx context.Context, tenantID, id int64, actor string, req DecisionRequest) (*ApprovalDetail, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := lockApproval(ctx, tx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if expired, err := s.expireIn(ctx, tx, a); err != nil {
+		return nil, err
+	} else if expired {
+		// The expiry is recorded even though the decision is refused
+		if err := tx.Commit(ctx); err != nil {
+			return nil, &ServiceError{Op: "commit", Err: err}
+		}
+		return nil, ErrApprovalExpired
+	}
+
+	if err := a.Reject(actor, req.Reason); err != nil {
+		return nil, &ValidationError{Field: "approval", Message: err.Error()}
+	}
+	if err := s.withdraw(ctx, tx, a); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, tx, a, payout.ActionRejected, actor, req.Reason); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().Int64("tenant_id", tenantID).Int64("approval_id", a.ID).Str("actor", actor).Msg("payout approval rejected")
+	return s.GetApproval(ctx, tenantID, a.ID)
+}
+
+// ExpireApprovals closes approvals whose deadline passed and cancels what they were holding
+func (s *Service) ExpireApprovals(ctx context.Context) (int, error) {
+	lapsed, err := s.approvalRepo.FindExpired(ctx, time.Now(), expireBatchSize)
+	if err != nil {
+		return 0, &ServiceError{Op: "find_expired_approvals", Err: err}
+	}
+
+	expired := 0
+	for _, candidate := range lapsed {
+		ok, err := s.expire(ctx, candidate.ID)
+		if err != nil {
+			log.Error().Err(err).Int64("approval_id", candidate.ID).Msg("failed to expire payout approval")
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// expire closes one lapsed approval in its own transaction
+func (s *Service) expire(ctx context.Context, id int64) (bool, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := tx.ApprovalRepository().LockByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	expired, err := s.expireIn(ctx, tx, a)
+	if err != nil || !expired {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// expireIn closes the approval if its deadline has passed; the caller commits
+func (s *Service) expireIn(ctx context.Context, tx repositories.Transaction, a *payout.Approval) (bool, error) {
+	if !a.Expire(time.Now()) {
+		return false, nil
+	}
+	if err := s.withdraw(ctx, tx, a); err != nil {
+		return false, err
+	}
+	if err := s.record(ctx, tx, a, payout.ActionExpired, payout.SystemActor, a.Reason); err != nil {
+		return false, err
+	}
+
+	log.Info().Int64("tenant_id", a.TenantID).Int64("approval_id", a.ID).Msg("payout approval expired")
+	return true, nil
+}
+
+// requestApproval opens an approval for a payout or batch that was just saved in the transaction
+func (s *Service) requestApproval(ctx context.Context, tx repositories.Transaction, policy *payout.ApprovalPolicy, subject payout.Subject, subjectID int64, amount payment.Money, actor string) (*payout.Approval, error) {
+	a, err := payout.NewApproval(policy, subject, subjectID, amount, actor)
+	if err != nil {
+		return nil, &ValidationError{Field: "approval", Message: err.Error()}
+	}
+	if err := s.record(ctx, tx, a, payout.ActionRequested, actor, ""); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// record saves the approval and appends the action to its audit trail
+func (s *Service) record(ctx context.Context, tx repositories.Transaction, a *payout.Approval, action payout.ApprovalAction, actor, reason string) error {
+	repo := tx.ApprovalRepository()
+	if err := repo.Save(ctx, a); err != nil {
+		return &ServiceError{Op: "save_approval", Err: err}
+	}
+	if err := repo.AddAudit(ctx, payout.NewApprovalAuditEntry(a, action, actor, reason)); err != nil {
+		return &ServiceError{Op: "add_approval_audit", Err: err}
+	}
+	return nil
+}
+
+// release frees what a completed approval was holding. A batch starts processing in the
+// transaction; a payout is returned so it can be sent once the approval is committed.
+func (s *Service) release(ctx context.Context, tx repositories.Transaction, a *payout.Approval) (*payout.Payout, error) {
+	switch a.Subject {
+	case payout.SubjectPayout:
+		p, err := tx.PayoutRepository().FindByID(ctx, a.SubjectID)
+		if err != nil {
+			return nil, &ServiceError{Op: "find_payout", Err: err}
+		}
+		if err := p.Release(); err != nil {
+			return nil, &ValidationError{Field: "payout", Message: err.Error()}
+		}
+		if err := tx.PayoutRepository().Save(ctx, p); err != nil {
+			return nil, &ServiceError{Op: "release_payout", Err: err}
+		}
+		return p, nil
+
+	case payout.SubjectBatch:
+		batchRepo := tx.PayoutBatchRepository()
+		batch, err := batchRepo.FindByID(ctx, a.SubjectID)
+		if err != nil {
+			return nil, &ServiceError{Op: "find_batch", Err: err}
+		}
+		if err := batch.Release(); err != nil {
+			return nil, &ValidationError{Field: "batch", Message: err.Error()}
+		}
+		if err := batchRepo.Save(ctx, batch); err != nil {
+			return nil, &ServiceError{Op: "release_batch", Err: err}
+		}
+		if err := tx.ApprovalRepository().AddAudit(ctx, payout.NewApprovalAuditEntry(a, payout.ActionReleased, payout.SystemActor, "batch queued for sending")); err != nil {
+			return nil, &ServiceError{Op: "add_approval_audit", Err: err}
+		}
+	}
+	return nil, nil
+}
+
+// withdraw cancels the payout or batch held by an approval that will never complete
+func (s *Service) withdraw(ctx context.Context, tx repositories.Transaction, a *payout.Approval) error {
+	switch a.Subject {
+	case payout.SubjectPayout:
+		p, err := tx.PayoutRepository().FindByID(ctx, a.SubjectID)
+		if err != nil {
+			return &ServiceError{Op: "find_payout", Err: err}
+		}
+		if p.Cancel("approval " + string(a.Status)) {
+			if err := tx.PayoutRepository().Save(ctx, p); err != nil {
+				return &ServiceError{Op: "cancel_payout", Err: err}
+			}
+		}
+
+	case payout.SubjectBatch:
+		batchRepo := tx.PayoutBatchRepository()
+		batch, err := batchRepo.FindByID(ctx, a.SubjectID)
+		if err != nil {
+			return &ServiceError{Op: "find_batch", Err: err}
+		}
+		if batch.Status != payout.BatchAwaitingApproval {
+			return nil
+		}
+		if err := batch.Cancel(); err != nil {
+			return &ValidationError{Field: "batch", Message: err.Error()}
+		}
+		if err := batchRepo.Save(ctx, batch); err != nil {
+			return &ServiceError{Op: "cancel_batch", Err: err}
+		}
+		if _, err := batchRepo.UpdateItemStatus(ctx, batch.ID, []payout.ItemStatus{payout.ItemQueued}, payout.ItemCancelled); err != nil {
+			return &ServiceError{Op: "cancel_batch_items", Err: err}
+		}
+	}
+	return nil
+}
+
+// sendApproved sends a released payout and records the outcome in the audit trail. The approval
+// is already committed, so a failure here fails the payout rather than the approval.
+func (s *Service) sendApproved(ctx context.Context, a *payout.Approval, p *payout.Payout) {
+	// The approver's request may end before the provider answers; the call must still finish
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
+
+	if err := s.sendHeld(ctx, p); err != nil {
+		recordSendFailure(p, err)
+		log.Error().Err(err).Int64("payout_id", p.ID).Int64("approval_id", a.ID).Msg("approved payout failed to send")
+	}
+	if err := s.payoutRepo.Save(ctx, p); err != nil {
+		log.Error().Err(err).
+			Int64("payout_id", p.ID).
+			Str("conversation_id", p.ExternalID).
+			Msg("approved payout sent but not recorded")
+	}
+
+	reason := "sent to provider"
+	switch p.Status {
+	case payout.StatusFailed:
+		reason = "send failed: " + p.ResultDesc
+	case payout.StatusTimedOut:
+		reason = "send outcome unknown: " + p.ResultDesc
+	}
+	if err := s.approvalRepo.AddAudit(ctx, payout.NewApprovalAuditEntry(a, payout.ActionReleased, payout.SystemActor, reason)); err != nil {
+		log.Error().Err(err).Int64("approval_id", a.ID).Msg("failed to audit payout release")
+	}
+}
+
+// sendHeld sends a payout that was held for approval, using the number stored with it
+func (s *Service) sendHeld(ctx context.Context, p *payout.Payout) error {
+	cred, err := s.credentialRepo.FindByID(ctx, p.ProviderCredentialID)
+	if err != nil {
+		return &ServiceError{Op: "find_credential", Err: err}
+	}
+	if !cred.IsActive {
+		return &ValidationError{Field: "credential_id", Message: "provider credential is no longer active"}
+	}
+	phone, err := crypto.DecryptString(s.aesKey, p.PhoneEnc)
+	if err != nil {
+		return &ServiceError{Op: "decrypt_phone", Err: err}
+	}
+	msisdn, err := payment.NewMSISDN(phone)
+	if err != nil {
+		return &ValidationError{Field: "phone_number", Message: err.Error()}
+	}
+	return s.send(ctx, cred, p, msisdn)
+}
+
+// lockApproval loads an approval for update and ensures it belongs to the tenant
+func lockApproval(ctx context.Context, tx repositories.Transaction, tenantID, id int64) (*payout.Approval, error) {
+	a, err := tx.ApprovalRepository().LockByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && a.TenantID != tenantID) {
+		return nil, ErrApprovalNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "lock_approval", Err: err}
+	}
+	return a, nil
+}
+
+// ApprovalListResponse represents paginated approval data
+type ApprovalListResponse struct {
+	Approvals []*payout.Approval `json:"approvals"`
+	Limit     int                `json:"limit"`
+	Offset    int                `json:"offset"`
+}
+
+// ApprovalDetail is an approval with its audit trail and the payout or batch it holds
+type ApprovalDetail struct {
+	Approval *payout.Approval             `json:"approval"`
+	Audit    []*payout.ApprovalAuditEntry `json:"audit"`
+	Payout   *payout.Payout               `json:"payout,omitempty"`
+	Batch    *payout.Batch                `json:"batch,omitempty"`
+}
+
+// ErrApprovalNotFound is returned when an approval does not exist for the tenant
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// ErrApprovalExpired is returned when a decision arrives after the approval lapsed
+var ErrApprovalExpired = errors.New("approval has expired")
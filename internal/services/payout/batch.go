@@ -0,0 +1,406 @@
+package payout
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// maxReportedLineErrors bounds how many invalid lines a rejected upload lists
+const maxReportedLineErrors = 10
+
+// BatchRequest represents a bulk payout upload; it mirrors provider.BulkTransferReq
+type BatchRequest struct {
+	BatchID      string                      `json:"batch_id,omitempty"`      // tenant's own reference, unique per tenant
+	CredentialID int64                       `json:"credential_id,omitempty"` // default: the tenant's first active credential that supports B2C
+	CommandID    string                      `json:"command_id,omitempty"`    // SalaryPayment, BusinessPayment (default) or PromotionPayment
+	Transfers    []provider.BulkTransferItem `json:"transfers"`
+}
+
+// CreateBatch validates every line of a batch and queues it; the batch runner sends the items.
+// A batch whose total is covered by the tenant's approval policy waits for approval first.
+func (s *Service) CreateBatch(ctx context.Context, tenantID int64, actor string, req BatchRequest) (*BatchReport, error) {
+	if len(req.Transfers) == 0 {
+		return nil, &ValidationError{Field: "transfers", Message: "a batch needs at least one transfer"}
+	}
+	if len(req.Transfers) > payout.MaxBatchItems {
+		return nil, &ValidationError{Field: "transfers", Message: fmt.Sprintf("a batch holds at most %d transfers", payout.MaxBatchItems)}
+	}
+	if req.CommandID == "" {
+		req.CommandID = "BusinessPayment"
+	}
+
+	cred, err := s.resolveCredential(ctx, tenantID, req.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := payout.NewBatch(tenantID, cred.ID, req.BatchID, req.CommandID)
+	if err != nil {
+		return nil, &ValidationError{Field: "batch_id", Message: err.Error()}
+	}
+
+	// Validate every line up front so a batch is either queued whole or not at all
+	items := make([]*payout.BatchItem, 0, len(req.Transfers))
+	var lineErrors []string
+	for i, transfer := range req.Transfers {
+		item, err := s.newBatchItem(batch, transfer)
+		if err != nil {
+			lineErrors = append(lineErrors, fmt.Sprintf("line %d: %v", i+1, err))
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(lineErrors) > 0 {
+		if len(lineErrors) > maxReportedLineErrors {
+			lineErrors = append(lineErrors[:maxReportedLineErrors], fmt.Sprintf("and %d more", len(lineErrors)-maxReportedLineErrors))
+		}
+		return nil, &ValidationError{Field: "transfers", Message: strings.Join(lineErrors, "; ")}
+	}
+
+	policy, err := s.ApprovalPolicy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Required(batch.TotalAmount) > 0 {
+		if err := batch.AwaitApproval(); err != nil {
+			return nil, &ServiceError{Op: "hold_batch", Err: err}
+		}
+	}
+
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	batchRepo := tx.PayoutBatchRepository()
+	if err := batchRepo.Save(ctx, batch); err != nil {
+		if errors.Is(err, repositories.ErrDuplicate) {
+			return nil, &ValidationError{Field: "batch_id", Message: "a batch with this batch_id already exists"}
+		}
+		return nil, &ServiceError{Op: "create_batch", Err: err}
+	}
+	for _, item := range items {
+		item.BatchID = batch.ID
+		if err := batchRepo.SaveItem(ctx, item); err != nil {
+			return nil, &ServiceError{Op: "create_batch_item", Err: err}
+		}
+	}
+	if batch.Status == payout.BatchAwaitingApproval {
+		if _, err := s.requestApproval(ctx, tx, policy, payout.SubjectBatch, batch.ID, batch.TotalAmount, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", tenantID).
+		Int64("batch_id", batch.ID).
+		Int("items", batch.ItemCount).
+		Int64("total_amount", int64(batch.TotalAmount)).
+		Str("status", string(batch.Status)).
+		Msg("payout batch queued")
+
+	return s.report(batch, items), nil
+}
+
+// newBatchItem validates a transfer and adds it to the batch
+func (s *Service) newBatchItem(batch *payout.Batch, transfer provider.BulkTransferItem) (*payout.BatchItem, error) {
+	msisdn, err := payment.NewMSISDN(normalizePhone(transfer.PhoneNumber))
+	if err != nil {
+		return nil, err
+	}
+	phoneEnc, err := crypto.EncryptString(s.aesKey, msisdn.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt phone number: %w", err)
+	}
+	return batch.AddItem(msisdn, phoneEnc, payment.Money(transfer.Amount), transfer.Reference, transfer.Description)
+}
+
+// ParseBatchCSV reads transfers from a CSV upload. The header row names the columns:
+// phone_number and amount are required, reference and description are optional.
+func ParseBatchCSV(r io.Reader) ([]provider.BulkTransferItem, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, &ValidationError{Field: "csv", Message: "missing header row"}
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"phone_number", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, &ValidationError{Field: "csv", Message: "missing column " + required}
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var transfers []provider.BulkTransferItem
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &ValidationError{Field: "csv", Message: err.Error()}
+		}
+		if len(transfers) == payout.MaxBatchItems {
+			return nil, &ValidationError{Field: "csv", Message: fmt.Sprintf("a batch holds at most %d transfers", payout.MaxBatchItems)}
+		}
+
+		amount, err := strconv.ParseInt(field(record, "amount"), 10, 64)
+		if err != nil {
+			return nil, &ValidationError{Field: "csv", Message: fmt.Sprintf("line %d: amount must be a whole number", line)}
+		}
+		transfers = append(transfers, provider.BulkTransferItem{
+			PhoneNumber: field(record, "phone_number"),
+			Amount:      amount,
+			Reference:   field(record, "reference"),
+			Description: field(record, "description"),
+		})
+	}
+	return transfers, nil
+}
+
+// ListBatches retrieves a tenant's payout batches, optionally filtered by status
+func (s *Service) ListBatches(ctx context.Context, tenantID int64, status payout.BatchStatus, limit, offset int) (*BatchListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	batches, err := s.batchRepo.FindByTenantID(ctx, tenantID, status, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_batches", Err: err}
+	}
+
+	return &BatchListResponse{
+		Batches: batches,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// BatchReport retrieves a batch with a per-outcome summary and the state of every item
+func (s *Service) BatchReport(ctx context.Context, tenantID, id int64) (*BatchReport, error) {
+	batch, err := s.findBatch(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.batchRepo.FindItems(ctx, batch.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_batch_items", Err: err}
+	}
+	return s.report(batch, items), nil
+}
+
+// CancelBatch withdraws the items of a batch that have not been sent yet, along with any pending approval
+func (s *Service) CancelBatch(ctx context.Context, tenantID, id int64, actor string) (*payout.Batch, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the approval before the batch, in the same order approving does
+	approval, err := tx.ApprovalRepository().LockPending(ctx, payout.SubjectBatch, id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, &ServiceError{Op: "lock_approval", Err: err}
+	}
+
+	batchRepo := tx.PayoutBatchRepository()
+	batch, err := s.findBatchIn(ctx, batchRepo, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := batch.Cancel(); err != nil {
+		return nil, &ValidationError{Field: "status", Message: err.Error()}
+	}
+	if err := batchRepo.Save(ctx, batch); err != nil {
+		return nil, &ServiceError{Op: "cancel_batch", Err: err}
+	}
+	// Items already claimed by the runner are in flight and finish normally
+	if _, err := batchRepo.UpdateItemStatus(ctx, batch.ID, []payout.ItemStatus{payout.ItemQueued}, payout.ItemCancelled); err != nil {
+		return nil, &ServiceError{Op: "cancel_batch_items", Err: err}
+	}
+	if approval != nil && approval.Cancel("batch cancelled") {
+		if err := s.record(ctx, tx, approval, payout.ActionCancelled, actor, approval.Reason); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+	return batch, nil
+}
+
+// ResumeRequest chooses which unfinished items of a batch are sent again
+type ResumeRequest struct {
+	// RetryUnknown also requeues items interrupted mid-call. Only set it once the
+	// provider has confirmed those payments were not made, or they will be paid twice.
+	RetryUnknown bool `json:"retry_unknown,omitempty"`
+}
+
+// ResumeBatch requeues rejected (and optionally interrupted) items and restarts the batch
+func (s *Service) ResumeBatch(ctx context.Context, tenantID, id int64, req ResumeRequest) (*BatchReport, error) {
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	batchRepo := tx.PayoutBatchRepository()
+	batch, err := s.findBatchIn(ctx, batchRepo, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := []payout.ItemStatus{payout.ItemRejected}
+	if req.RetryUnknown {
+		retry = append(retry, payout.ItemUnknown)
+	}
+	requeued, err := batchRepo.UpdateItemStatus(ctx, batch.ID, retry, payout.ItemQueued)
+	if err != nil {
+		return nil, &ServiceError{Op: "requeue_items", Err: err}
+	}
+	if requeued > 0 {
+		if err := batch.Resume(); err != nil {
+			return nil, &ValidationError{Field: "status", Message: err.Error()}
+		}
+		if err := batchRepo.Save(ctx, batch); err != nil {
+			return nil, &ServiceError{Op: "resume_batch", Err: err}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().Int64("batch_id", batch.ID).Int64("requeued", requeued).Msg("payout batch resumed")
+	return s.BatchReport(ctx, tenantID, batch.ID)
+}
+
+// WriteBatchReportCSV writes a batch report as CSV, one row per item
+func WriteBatchReportCSV(w io.Writer, report *BatchReport) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"line", "phone_number", "amount", "reference", "description", "outcome", "payout_id", "receipt_number", "error"})
+	for _, item := range report.Items {
+		var payoutID string
+		if item.PayoutID != nil {
+			payoutID = strconv.FormatInt(*item.PayoutID, 10)
+		}
+		out.Write([]string{
+			strconv.Itoa(item.Line), item.PhoneNumber, strconv.FormatInt(int64(item.Amount), 10), item.Reference,
+			item.Description, item.Outcome, payoutID, item.ReceiptNumber, item.Error,
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// report builds the tenant-facing view of a batch
+func (s *Service) report(batch *payout.Batch, items []*payout.BatchItem) *BatchReport {
+	report := &BatchReport{
+		Batch:   batch,
+		Summary: payout.Summarize(items),
+		Items:   make([]*BatchItemView, 0, len(items)),
+	}
+	for _, item := range items {
+		report.Items = append(report.Items, &BatchItemView{
+			Line:          item.Line,
+			PhoneNumber:   s.maskedPhone(item.PhoneEnc),
+			Amount:        item.Amount,
+			Reference:     item.Reference,
+			Description:   item.Description,
+			Outcome:       item.Outcome(),
+			PayoutID:      item.PayoutID,
+			ReceiptNumber: item.ReceiptNumber,
+			Error:         item.Error,
+		})
+	}
+	return report
+}
+
+// maskedPhone decrypts a stored phone number and hides its middle digits
+func (s *Service) maskedPhone(phoneEnc string) string {
+	phone, err := crypto.DecryptString(s.aesKey, phoneEnc)
+	if err != nil || len(phone) < 9 {
+		return ""
+	}
+	return phone[:6] + strings.Repeat("*", len(phone)-9) + phone[len(phone)-3:]
+}
+
+// findBatch loads a batch and ensures it belongs to the tenant
+func (s *Service) findBatch(ctx context.Context, tenantID, id int64) (*payout.Batch, error) {
+	return s.findBatchIn(ctx, s.batchRepo, tenantID, id)
+}
+
+// findBatchIn loads a batch through the given repository and ensures it belongs to the tenant
+func (s *Service) findBatchIn(ctx context.Context, repo repositories.PayoutBatchRepository, tenantID, id int64) (*payout.Batch, error) {
+	batch, err := repo.FindByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && batch.TenantID != tenantID) {
+		return nil, ErrBatchNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_batch", Err: err}
+	}
+	return batch, nil
+}
+
+// BatchListResponse represents paginated batch data
+type BatchListResponse struct {
+	Batches []*payout.Batch `json:"batches"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+}
+
+// BatchReport summarizes a batch by outcome and lists its items
+type BatchReport struct {
+	Batch   *payout.Batch           `json:"batch"`
+	Summary map[string]payout.Tally `json:"summary"` // keyed by item outcome
+	Items   []*BatchItemView        `json:"items"`
+}
+
+// BatchItemView is the tenant-facing view of a batch item
+type BatchItemView struct {
+	Line          int           `json:"line"`
+	PhoneNumber   string        `json:"phone_number"` // masked
+	Amount        payment.Money `json:"amount"`
+	Reference     string        `json:"reference,omitempty"`
+	Description   string        `json:"description,omitempty"`
+	Outcome       string        `json:"outcome"` // payout status once submitted, else queued|sending|rejected|unknown|cancelled
+	PayoutID      *int64        `json:"payout_id,omitempty"`
+	ReceiptNumber string        `json:"receipt_number,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// ErrBatchNotFound is returned when a batch does not exist for the tenant
+var ErrBatchNotFound = errors.New("payout batch not found")
@@ -0,0 +1,67 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"paymatch/internal/domain/event"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ResultHandler settles payouts from provider result and queue-timeout callbacks
+type ResultHandler struct{}
+
+// NewResultHandler creates a new payout result handler
+func NewResultHandler() *ResultHandler {
+	return &ResultHandler{}
+}
+
+// ApplyResult updates the payout a B2C result or timeout event refers to. It runs inside
+// the caller's transaction so the payout commits together with the event; it returns
+// false if no payout matches the event.
+func (h *ResultHandler) ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error) {
+	repo := tx.PayoutRepository()
+
+	p, err := repo.LockByExternalID(ctx, evt.TenantID, evt.ExternalID)
+	if errors.Is(err, pgx.ErrNoRows) && evt.InvoiceRef != "" {
+		// B2C results carry the originator conversation ID as the reference
+		p, err = repo.LockByExternalID(ctx, evt.TenantID, evt.InvoiceRef)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load payout %s: %w", evt.ExternalID, err)
+	}
+
+	var changed bool
+	switch evt.Type {
+	case event.TypeTimeout:
+		changed = p.TimeOut(evt.ResponseDescription)
+	default:
+		changed = p.ApplyResult(evt.Status == "completed", evt.TransactionID, evt.MSISDN, evt.ResponseDescription)
+	}
+	if !changed {
+		log.Info().
+			Int64("payout_id", p.ID).
+			Str("status", string(p.Status)).
+			Str("event_type", string(evt.Type)).
+			Msg("payout already settled, ignoring callback")
+		return true, nil
+	}
+
+	if err := repo.Save(ctx, p); err != nil {
+		return false, fmt.Errorf("failed to update payout %d: %w", p.ID, err)
+	}
+
+	log.Info().
+		Int64("payout_id", p.ID).
+		Int64("tenant_id", p.TenantID).
+		Str("status", string(p.Status)).
+		Msg("payout result applied")
+	return true, nil
+}
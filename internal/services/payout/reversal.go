@@ -0,0 +1,243 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"paymatch/internal/domain/event"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// ReversalService returns completed incoming payments to their payers through the provider
+type ReversalService struct {
+	paymentRepo    repositories.PaymentRepository
+	reversalRepo   repositories.ReversalRepository
+	credentialRepo repositories.CredentialRepository
+	registry       *provider.Registry
+}
+
+// NewReversalService creates a new reversal service
+func NewReversalService(
+	paymentRepo repositories.PaymentRepository,
+	reversalRepo repositories.ReversalRepository,
+	credentialRepo repositories.CredentialRepository,
+	registry *provider.Registry,
+) *ReversalService {
+	return &ReversalService{
+		paymentRepo:    paymentRepo,
+		reversalRepo:   reversalRepo,
+		credentialRepo: credentialRepo,
+		registry:       registry,
+	}
+}
+
+// ReverseRequest represents a payment reversal request
+type ReverseRequest struct {
+	CredentialID  int64  `json:"credential_id,omitempty"`  // default: the tenant's first active credential that supports reversals
+	TransactionID string `json:"transaction_id,omitempty"` // default: the payment's receipt number
+	Remarks       string `json:"remarks,omitempty"`
+}
+
+// Reverse asks the provider to return a completed payment to the payer and records the
+// reversal as pending. The reversal result callback later settles it and, on success,
+// marks the payment reversed.
+func (s *ReversalService) Reverse(ctx context.Context, tenantID, paymentID int64, actor string, req ReverseRequest) (*payment.Reversal, error) {
+	p, err := s.findPayment(ctx, tenantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsReversible() {
+		return nil, &ValidationError{Field: "payment", Message: fmt.Sprintf("payment in status %s cannot be reversed", p.Status)}
+	}
+
+	if req.TransactionID == "" && payment.IsReceiptNumber(p.ExternalID) {
+		req.TransactionID = p.ExternalID
+	}
+	if req.TransactionID == "" {
+		return nil, &ValidationError{Field: "transaction_id", Message: "transaction_id is required for payments without a receipt number"}
+	}
+
+	existing, err := s.reversalRepo.FindByPaymentID(ctx, p.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_reversals", Err: err}
+	}
+	for _, rev := range existing {
+		if rev.Status != payment.ReversalFailed {
+			return nil, ErrReversalExists
+		}
+	}
+
+	cred, err := findCredential(ctx, s.credentialRepo, s.registry, tenantID, req.CredentialID, provider.OpReverse, "reversals")
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := payment.NewReversal(p, cred.ID, req.TransactionID, req.Remarks, actor)
+	if err != nil {
+		return nil, &ValidationError{Field: "reversal", Message: err.Error()}
+	}
+
+	// Result and timeout URLs are left to the provider, which points them back at this service
+	resp, err := s.registry.Reverse(ctx, cred, provider.ReverseReq{
+		TransactionID: rev.TransactionID,
+		Amount:        int64(rev.Amount),
+		Remarks:       rev.Remarks,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := rev.Accept(resp.ExternalID, resp.ProviderReference, resp.Message); err != nil {
+		return nil, &ServiceError{Op: "accept_reversal", Err: err}
+	}
+
+	if err := s.reversalRepo.Save(ctx, rev); err != nil {
+		// The provider already queued the reversal; keep enough in the log to reconcile it by hand
+		log.Error().Err(err).
+			Int64("tenant_id", tenantID).
+			Int64("payment_id", p.ID).
+			Str("conversation_id", rev.ExternalID).
+			Str("transaction_id", rev.TransactionID).
+			Msg("reversal queued with provider but not recorded")
+		if errors.Is(err, repositories.ErrDuplicate) {
+			return nil, ErrReversalExists
+		}
+		return nil, &ServiceError{Op: "save_reversal", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", tenantID).
+		Int64("payment_id", p.ID).
+		Int64("reversal_id", rev.ID).
+		Str("conversation_id", rev.ExternalID).
+		Str("requested_by", rev.RequestedBy).
+		Msg("payment reversal initiated")
+
+	return rev, nil
+}
+
+// Get retrieves a reversal belonging to the tenant
+func (s *ReversalService) Get(ctx context.Context, tenantID, id int64) (*payment.Reversal, error) {
+	rev, err := s.reversalRepo.FindByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && rev.TenantID != tenantID) {
+		return nil, ErrReversalNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_reversal", Err: err}
+	}
+	return rev, nil
+}
+
+// ListForPayment retrieves every reversal attempted for a tenant's payment, newest first
+func (s *ReversalService) ListForPayment(ctx context.Context, tenantID, paymentID int64) ([]*payment.Reversal, error) {
+	p, err := s.findPayment(ctx, tenantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	reversals, err := s.reversalRepo.FindByPaymentID(ctx, p.ID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_reversals", Err: err}
+	}
+	if reversals == nil {
+		reversals = []*payment.Reversal{}
+	}
+	return reversals, nil
+}
+
+// findPayment loads a payment belonging to the tenant
+func (s *ReversalService) findPayment(ctx context.Context, tenantID, paymentID int64) (*payment.Payment, error) {
+	p, err := s.paymentRepo.FindByID(ctx, paymentID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && p.TenantID != tenantID) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_payment", Err: err}
+	}
+	return p, nil
+}
+
+// ReversalResultHandler settles reversals from provider result and queue-timeout callbacks
+type ReversalResultHandler struct{}
+
+// NewReversalResultHandler creates a new reversal result handler
+func NewReversalResultHandler() *ReversalResultHandler {
+	return &ReversalResultHandler{}
+}
+
+// ApplyResult updates the reversal a result or timeout event refers to, and marks the
+// payment reversed once the provider confirms it. It runs inside the caller's transaction;
+// it returns false if no reversal matches the event.
+func (h *ReversalResultHandler) ApplyResult(ctx context.Context, tx repositories.Transaction, evt *event.Event) (bool, error) {
+	repo := tx.ReversalRepository()
+
+	rev, err := repo.LockByExternalID(ctx, evt.TenantID, evt.ExternalID)
+	if errors.Is(err, pgx.ErrNoRows) && evt.InvoiceRef != "" {
+		// Results carry the originator conversation ID as the reference
+		rev, err = repo.LockByExternalID(ctx, evt.TenantID, evt.InvoiceRef)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load reversal %s: %w", evt.ExternalID, err)
+	}
+
+	var changed bool
+	switch evt.Type {
+	case event.TypeTimeout:
+		changed = rev.TimeOut(evt.ResponseDescription)
+	default:
+		changed = rev.ApplyResult(evt.Status == "completed", evt.TransactionID, evt.ResponseDescription)
+	}
+	if !changed {
+		log.Info().
+			Int64("reversal_id", rev.ID).
+			Str("status", string(rev.Status)).
+			Str("event_type", string(evt.Type)).
+			Msg("reversal already settled, ignoring callback")
+		return true, nil
+	}
+
+	if err := repo.Save(ctx, rev); err != nil {
+		return false, fmt.Errorf("failed to update reversal %d: %w", rev.ID, err)
+	}
+
+	if rev.Status == payment.ReversalCompleted {
+		p, err := tx.ExceptionRepository().LockPayment(ctx, rev.PaymentID)
+		if err != nil {
+			return false, fmt.Errorf("failed to load payment %d: %w", rev.PaymentID, err)
+		}
+		if err := p.CausedBy(evt.ID).MarkReversed(); err != nil {
+			// The money is back with the payer either way; the payment needs an operator's attention
+			log.Error().Err(err).
+				Int64("reversal_id", rev.ID).
+				Int64("payment_id", p.ID).
+				Msg("reversal completed but payment changed status in the meantime")
+		} else if err := tx.PaymentRepository().Save(ctx, p); err != nil {
+			return false, fmt.Errorf("failed to update payment %d: %w", p.ID, err)
+		}
+	}
+
+	log.Info().
+		Int64("reversal_id", rev.ID).
+		Int64("payment_id", rev.PaymentID).
+		Int64("tenant_id", rev.TenantID).
+		Str("status", string(rev.Status)).
+		Msg("reversal result applied")
+	return true, nil
+}
+
+// ErrReversalNotFound is returned when a reversal does not exist for the tenant
+var ErrReversalNotFound = errors.New("reversal not found")
+
+// ErrPaymentNotFound is returned when the payment to reverse does not exist for the tenant
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// ErrReversalExists is returned when a payment already has a reversal in flight or completed
+var ErrReversalExists = errors.New("payment already has a pending or completed reversal")
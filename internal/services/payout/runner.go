@@ -0,0 +1,245 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/provider"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sendTimeout bounds a single B2C call, which is allowed to finish during shutdown
+const sendTimeout = 30 * time.Second
+
+// BatchRunnerConfig holds configuration for the batch runner
+type BatchRunnerConfig struct {
+	PollInterval  time.Duration
+	ClaimSize     int
+	RatePerSecond int           // B2C calls per second across all batches
+	StaleAfter    time.Duration // items sending for longer than this are flagged unknown
+}
+
+// DefaultBatchRunnerConfig returns sensible defaults for the batch runner
+func DefaultBatchRunnerConfig() BatchRunnerConfig {
+	return BatchRunnerConfig{
+		PollInterval:  2 * time.Second,
+		ClaimSize:     20,
+		RatePerSecond: 5,
+		StaleAfter:    10 * time.Minute,
+	}
+}
+
+// BatchRunner sends queued batch items as individual B2C calls. Batch state lives in
+// the database, so a restarted runner picks up where the previous one stopped.
+type BatchRunner struct {
+	svc    *Service
+	config BatchRunnerConfig
+}
+
+// NewBatchRunner creates a new batch runner
+func NewBatchRunner(svc *Service, config BatchRunnerConfig) *BatchRunner {
+	defaults := DefaultBatchRunnerConfig()
+	if config.PollInterval == 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.ClaimSize == 0 {
+		config.ClaimSize = defaults.ClaimSize
+	}
+	if config.RatePerSecond <= 0 {
+		config.RatePerSecond = defaults.RatePerSecond
+	}
+	if config.StaleAfter == 0 {
+		config.StaleAfter = defaults.StaleAfter
+	}
+
+	return &BatchRunner{svc: svc, config: config}
+}
+
+// Run starts the runner and sends batch items until context is cancelled
+func (r *BatchRunner) Run(ctx context.Context) {
+	log.Info().
+		Dur("poll_every", r.config.PollInterval).
+		Int("rate_per_second", r.config.RatePerSecond).
+		Msg("payout batch runner started")
+
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	limiter := time.NewTicker(time.Second / time.Duration(r.config.RatePerSecond))
+	defer limiter.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("payout batch runner stopping")
+			return
+		case <-ticker.C:
+			if err := r.runOnce(ctx, limiter.C); err != nil {
+				log.Error().Err(err).Msg("error running payout batches")
+			}
+		}
+	}
+}
+
+// runOnce expires lapsed approvals, flags stale items, sends the next claimed items and closes finished batches
+func (r *BatchRunner) runOnce(ctx context.Context, limiter <-chan time.Time) error {
+	repo := r.svc.batchRepo
+
+	if expired, err := r.svc.ExpireApprovals(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to expire payout approvals")
+	} else if expired > 0 {
+		log.Info().Int("approvals", expired).Msg("lapsed payout approvals expired")
+	}
+
+	if stale, err := repo.MarkStale(ctx, time.Now().Add(-r.config.StaleAfter)); err != nil {
+		return err
+	} else if stale > 0 {
+		log.Warn().Int64("items", stale).Msg("payout batch items interrupted mid-call flagged unknown")
+	}
+
+	items, err := repo.ClaimQueued(ctx, r.config.ClaimSize)
+	if err != nil {
+		return err
+	}
+
+	batches := make(map[int64]*payout.Batch)
+	credentials := make(map[int64]*credential.ProviderCredential)
+	for i, item := range items {
+		select {
+		case <-ctx.Done():
+			// Hand unsent claims back so they are not mistaken for interrupted calls
+			r.release(items[i:])
+			return ctx.Err()
+		case <-limiter:
+		}
+		r.sendItem(ctx, item, batches, credentials)
+	}
+
+	if len(items) > 0 {
+		if _, err := repo.CompleteFinished(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendItem makes the B2C call for one item and records the outcome
+func (r *BatchRunner) sendItem(ctx context.Context, item *payout.BatchItem, batches map[int64]*payout.Batch, credentials map[int64]*credential.ProviderCredential) {
+	batch, ok := batches[item.BatchID]
+	if !ok {
+		b, err := r.svc.batchRepo.FindByID(ctx, item.BatchID)
+		if err != nil {
+			log.Error().Err(err).Int64("batch_id", item.BatchID).Msg("failed to load payout batch")
+			r.release([]*payout.BatchItem{item})
+			return
+		}
+		batch, batches[item.BatchID] = b, b
+	}
+
+	cred, ok := credentials[batch.ProviderCredentialID]
+	if !ok {
+		c, err := r.svc.credentialRepo.FindByID(ctx, batch.ProviderCredentialID)
+		if err != nil {
+			log.Error().Err(err).Int64("credential_id", batch.ProviderCredentialID).Msg("failed to load batch credential")
+			r.release([]*payout.BatchItem{item})
+			return
+		}
+		cred, credentials[batch.ProviderCredentialID] = c, c
+	}
+	if batch.Status != payout.BatchProcessing {
+		// Claims only come from processing batches; anything else changed under us
+		r.release([]*payout.BatchItem{item})
+		return
+	}
+	if !cred.IsActive {
+		r.reject(ctx, item, "provider credential is no longer active")
+		return
+	}
+
+	phone, err := crypto.DecryptString(r.svc.aesKey, item.PhoneEnc)
+	if err != nil {
+		r.reject(ctx, item, "phone number could not be decrypted")
+		return
+	}
+	msisdn, err := payment.NewMSISDN(phone)
+	if err != nil {
+		r.reject(ctx, item, err.Error())
+		return
+	}
+	p, err := payout.NewPayout(batch.TenantID, cred.ID, item.Amount, msisdn, batch.CommandID, item.Description, item.Reference)
+	if err != nil {
+		r.reject(ctx, item, err.Error())
+		return
+	}
+	p.BatchID = &batch.ID
+
+	// A call cut off halfway leaves the payment state unknown, so shutdown does not cancel it
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
+	if err := r.svc.send(sendCtx, cred, p, msisdn); err != nil {
+		var providerErr *provider.ProviderError
+		if errors.As(err, &providerErr) && providerErr.Refused {
+			// Refused before leaving this service; try again once the provider recovers
+			r.release([]*payout.BatchItem{item})
+			return
+		}
+		if mayHaveReachedProvider(err) {
+			// The request may have reached the provider; resuming must not pay twice without a check
+			item.Interrupted(err.Error())
+			if err := r.svc.batchRepo.SaveItem(sendCtx, item); err != nil {
+				log.Error().Err(err).Int64("item_id", item.ID).Msg("failed to save interrupted payout batch item")
+			}
+			return
+		}
+		r.reject(sendCtx, item, err.Error())
+		return
+	}
+
+	// The payout and the item commit together; if this fails the item stays sending and is flagged unknown
+	tx, err := r.svc.unitOfWork.Begin(sendCtx)
+	if err != nil {
+		log.Error().Err(err).Int64("item_id", item.ID).Str("conversation_id", p.ExternalID).Msg("payout batch item sent but not recorded")
+		return
+	}
+	defer tx.Rollback(sendCtx)
+
+	if err := tx.PayoutRepository().Save(sendCtx, p); err != nil {
+		log.Error().Err(err).Int64("item_id", item.ID).Str("conversation_id", p.ExternalID).Msg("payout batch item sent but not recorded")
+		return
+	}
+	item.Submitted(p.ID)
+	if err := tx.PayoutBatchRepository().SaveItem(sendCtx, item); err != nil {
+		log.Error().Err(err).Int64("item_id", item.ID).Str("conversation_id", p.ExternalID).Msg("payout batch item sent but not recorded")
+		return
+	}
+	if err := tx.Commit(sendCtx); err != nil {
+		log.Error().Err(err).Int64("item_id", item.ID).Str("conversation_id", p.ExternalID).Msg("payout batch item sent but not recorded")
+	}
+}
+
+// reject records that the provider refused an item
+func (r *BatchRunner) reject(ctx context.Context, item *payout.BatchItem, reason string) {
+	item.Rejected(reason)
+	if err := r.svc.batchRepo.SaveItem(ctx, item); err != nil {
+		log.Error().Err(err).Int64("item_id", item.ID).Msg("failed to save rejected payout batch item")
+	}
+}
+
+// release returns claimed items that were never sent to the queue
+func (r *BatchRunner) release(items []*payout.BatchItem) {
+	// The runner's context may already be cancelled; the release must still land
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, item := range items {
+		item.Release()
+		if err := r.svc.batchRepo.SaveItem(ctx, item); err != nil {
+			log.Error().Err(err).Int64("item_id", item.ID).Msg("failed to release payout batch item")
+		}
+	}
+}
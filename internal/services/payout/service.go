@@ -0,0 +1,340 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Service initiates B2C payouts and batches, holds them for approval where the tenant's
+// policy requires it, and tracks them until the provider reports a result
+type Service struct {
+	payoutRepo     repositories.PayoutRepository
+	batchRepo      repositories.PayoutBatchRepository
+	approvalRepo   repositories.ApprovalRepository
+	credentialRepo repositories.CredentialRepository
+	registry       *provider.Registry
+	unitOfWork     repositories.UnitOfWork
+	aesKey         []byte
+}
+
+// NewService creates a new payout service
+func NewService(
+	payoutRepo repositories.PayoutRepository,
+	batchRepo repositories.PayoutBatchRepository,
+	approvalRepo repositories.ApprovalRepository,
+	credentialRepo repositories.CredentialRepository,
+	registry *provider.Registry,
+	unitOfWork repositories.UnitOfWork,
+	aesKey []byte,
+) *Service {
+	return &Service{
+		payoutRepo:     payoutRepo,
+		batchRepo:      batchRepo,
+		approvalRepo:   approvalRepo,
+		credentialRepo: credentialRepo,
+		registry:       registry,
+		unitOfWork:     unitOfWork,
+		aesKey:         aesKey,
+	}
+}
+
+// InitiateRequest represents a payout request
+type InitiateRequest struct {
+	CredentialID int64  `json:"credential_id,omitempty"` // default: the tenant's first active credential that supports B2C
+	Amount       int64  `json:"amount"`
+	PhoneNumber  string `json:"phone_number"`
+	CommandID    string `json:"command_id,omitempty"` // SalaryPayment, BusinessPayment (default) or PromotionPayment
+	Description  string `json:"description,omitempty"`
+	Occasion     string `json:"occasion,omitempty"`
+}
+
+// Initiate sends a payout through the tenant's provider and records it as pending.
+// The provider's result callback later settles it as completed or failed. When the
+// tenant's approval policy covers the amount, the payout is held for approval instead
+// and actor, the user creating it, cannot be one of its approvers.
+func (s *Service) Initiate(ctx context.Context, tenantID int64, actor string, req InitiateRequest) (*payout.Payout, error) {
+	if req.Amount <= 0 {
+		return nil, &ValidationError{Field: "amount", Message: "amount must be greater than 0"}
+	}
+	if strings.TrimSpace(req.PhoneNumber) == "" {
+		return nil, &ValidationError{Field: "phone_number", Message: "phone_number is required"}
+	}
+	if req.CommandID == "" {
+		req.CommandID = "BusinessPayment"
+	}
+
+	cred, err := s.resolveCredential(ctx, tenantID, req.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	msisdn, err := payment.NewMSISDN(normalizePhone(req.PhoneNumber))
+	if err != nil {
+		return nil, &ValidationError{Field: "phone_number", Message: err.Error()}
+	}
+	p, err := payout.NewPayout(tenantID, cred.ID, payment.Money(req.Amount), msisdn, req.CommandID, req.Description, req.Occasion)
+	if err != nil {
+		return nil, &ValidationError{Field: "payout", Message: err.Error()}
+	}
+
+	policy, err := s.ApprovalPolicy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Required(p.Amount) > 0 {
+		return s.hold(ctx, policy, p, msisdn, actor)
+	}
+
+	// Record the payout before sending it, so money never moves without a record
+	if err := s.payoutRepo.Save(ctx, p); err != nil {
+		return nil, &ServiceError{Op: "save_payout", Err: err}
+	}
+
+	sendErr := s.send(ctx, cred, p, msisdn)
+	if sendErr != nil {
+		recordSendFailure(p, sendErr)
+	}
+	if err := s.payoutRepo.Save(ctx, p); err != nil {
+		// The provider may already have queued the transfer; keep enough in the log to reconcile it by hand
+		log.Error().Err(err).
+			Int64("tenant_id", tenantID).
+			Int64("payout_id", p.ID).
+			Str("conversation_id", p.ExternalID).
+			Int64("amount", req.Amount).
+			Msg("payout sent to provider but its result not recorded")
+		return nil, &ServiceError{Op: "save_payout", Err: err}
+	}
+	if sendErr != nil {
+		return nil, sendErr
+	}
+
+	log.Info().
+		Int64("tenant_id", tenantID).
+		Int64("payout_id", p.ID).
+		Str("conversation_id", p.ExternalID).
+		Int64("amount", req.Amount).
+		Msg("payout initiated")
+
+	return p, nil
+}
+
+// Get retrieves a payout belonging to the tenant
+func (s *Service) Get(ctx context.Context, tenantID, id int64) (*payout.Payout, error) {
+	p, err := s.payoutRepo.FindByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && p.TenantID != tenantID) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_payout", Err: err}
+	}
+	return p, nil
+}
+
+// List retrieves a tenant's payouts, optionally filtered by status
+func (s *Service) List(ctx context.Context, tenantID int64, status payout.Status, limit, offset int) (*ListResponse, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	payouts, err := s.payoutRepo.FindByTenantID(ctx, tenantID, status, limit, offset)
+	if err != nil {
+		return nil, &ServiceError{Op: "list_payouts", Err: err}
+	}
+
+	return &ListResponse{
+		Payouts: payouts,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// hold saves a payout that needs approval together with its approval request
+func (s *Service) hold(ctx context.Context, policy *payout.ApprovalPolicy, p *payout.Payout, msisdn *payment.MSISDN, actor string) (*payout.Payout, error) {
+	phoneEnc, err := crypto.EncryptString(s.aesKey, msisdn.String())
+	if err != nil {
+		return nil, &ServiceError{Op: "encrypt_phone", Err: err}
+	}
+	if err := p.AwaitApproval(phoneEnc); err != nil {
+		return nil, &ServiceError{Op: "hold_payout", Err: err}
+	}
+
+	tx, err := s.unitOfWork.Begin(ctx)
+	if err != nil {
+		return nil, &ServiceError{Op: "begin", Err: err}
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.PayoutRepository().Save(ctx, p); err != nil {
+		return nil, &ServiceError{Op: "save_payout", Err: err}
+	}
+	a, err := s.requestApproval(ctx, tx, policy, payout.SubjectPayout, p.ID, p.Amount, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &ServiceError{Op: "commit", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", p.TenantID).
+		Int64("payout_id", p.ID).
+		Int64("approval_id", a.ID).
+		Int("required", a.Required).
+		Msg("payout held for approval")
+
+	return p, nil
+}
+
+// send submits a payout to the credential's provider and records the identifiers it was queued under
+func (s *Service) send(ctx context.Context, cred *credential.ProviderCredential, p *payout.Payout, msisdn *payment.MSISDN) error {
+	if p.Status == payout.StatusAwaitingApproval {
+		return &ValidationError{Field: "payout", Message: "payout has not been approved"}
+	}
+
+	// Result and timeout URLs are left to the provider, which points them back at this service
+	resp, err := s.registry.B2C(ctx, cred, provider.B2CReq{
+		Amount:      int64(p.Amount),
+		PhoneNumber: msisdn.String(),
+		CommandID:   p.CommandID,
+		Occasion:    p.Occasion,
+		Description: p.Remarks,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := p.Accept(resp.ExternalID, resp.ProviderReference, resp.Message); err != nil {
+		return &ServiceError{Op: "accept_payout", Err: err}
+	}
+	return nil
+}
+
+// recordSendFailure marks a payout whose send failed: timed out, for an operator to check,
+// when the provider may have acted on the request, and failed only when it cannot have
+func recordSendFailure(p *payout.Payout, err error) {
+	if mayHaveReachedProvider(err) {
+		p.TimeOut(err.Error())
+		return
+	}
+	p.Reject(err.Error())
+}
+
+// mayHaveReachedProvider reports whether a failed send leaves the payment state unknown.
+// Daraja can answer 5xx after queueing a request, so only calls refused before leaving
+// this service count as unsent among the provider-down errors.
+func mayHaveReachedProvider(err error) bool {
+	var providerErr *provider.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Refused {
+		return false
+	}
+	switch providerErr.Code {
+	case provider.ErrRequestFailed, provider.ErrProviderTimeout, provider.ErrProviderDown:
+		return true
+	}
+	return false
+}
+
+// resolveCredential picks the credential a payout is sent from
+func (s *Service) resolveCredential(ctx context.Context, tenantID, credentialID int64) (*credential.ProviderCredential, error) {
+	return findCredential(ctx, s.credentialRepo, s.registry, tenantID, credentialID, provider.OpB2C, "B2C")
+}
+
+// findCredential picks the tenant's credential with the given ID, or else the first active
+// one whose provider supports the operation; label names the operation in errors
+func findCredential(ctx context.Context, credentialRepo repositories.CredentialRepository, registry *provider.Registry, tenantID, credentialID int64, op provider.OperationType, label string) (*credential.ProviderCredential, error) {
+	credentials, err := credentialRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_credentials", Err: err}
+	}
+
+	for _, cred := range credentials {
+		if !cred.IsActive {
+			continue
+		}
+		if credentialID != 0 {
+			if cred.ID == credentialID {
+				return cred, nil
+			}
+			continue
+		}
+		if supportsOperation(ctx, registry, cred, op) {
+			return cred, nil
+		}
+	}
+
+	if credentialID != 0 {
+		return nil, &ValidationError{Field: "credential_id", Message: "no active credential with this ID"}
+	}
+	return nil, &ValidationError{Field: "credential_id", Message: "tenant has no active credential that supports " + label}
+}
+
+// supportsOperation reports whether the credential's provider can perform the operation
+func supportsOperation(ctx context.Context, registry *provider.Registry, cred *credential.ProviderCredential, op provider.OperationType) bool {
+	p, err := registry.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return false
+	}
+	for _, supported := range p.SupportedOperations() {
+		if supported == op {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePhone brings local numbers into the 254... form providers report them in
+func normalizePhone(phone string) string {
+	phone = strings.NewReplacer(" ", "", "-", "", "+", "").Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "0") {
+		phone = "254" + phone[1:]
+	}
+	return phone
+}
+
+// ListResponse represents paginated payout data
+type ListResponse struct {
+	Payouts []*payout.Payout `json:"payouts"`
+	Limit   int              `json:"limit"`
+	Offset  int              `json:"offset"`
+}
+
+// ErrNotFound is returned when a payout does not exist for the tenant
+var ErrNotFound = errors.New("payout not found")
+
+// ValidationError represents a validation error
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error [" + e.Field + "]: " + e.Message
+}
+
+// ServiceError represents a payout service error
+type ServiceError struct {
+	Op  string
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	return "payout service " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
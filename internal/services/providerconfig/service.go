@@ -0,0 +1,141 @@
+package providerconfig
+
+import (
+	"context"
+	"time"
+
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Config holds configuration for the provider configuration service
+type Config struct {
+	ReloadInterval time.Duration // how often provider_configs is checked for changes
+}
+
+// DefaultConfig returns sensible defaults for the provider configuration service
+func DefaultConfig() Config {
+	return Config{
+		ReloadInterval: 30 * time.Second,
+	}
+}
+
+// Service applies the endpoints and limits in provider_configs to the registered
+// providers and keeps them in step with the table
+type Service struct {
+	repo     repositories.ProviderConfigRepository
+	registry *provider.Registry
+	config   Config
+	applied  map[key]provider.Settings
+}
+
+// key identifies the settings of one provider in one environment
+type key struct {
+	providerType string
+	environment  string
+}
+
+// NewService creates a new provider configuration service
+func NewService(repo repositories.ProviderConfigRepository, registry *provider.Registry, config Config) *Service {
+	if config.ReloadInterval == 0 {
+		config.ReloadInterval = DefaultConfig().ReloadInterval
+	}
+
+	return &Service{
+		repo:     repo,
+		registry: registry,
+		config:   config,
+		applied:  make(map[key]provider.Settings),
+	}
+}
+
+// Load reads the active configurations and applies those that changed since the last
+// load. Invalid rows are logged and skipped, keeping what was applied before; providers
+// whose row was removed or deactivated go back to their defaults.
+func (s *Service) Load(ctx context.Context) error {
+	configs, err := s.repo.FindActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[key]bool, len(configs))
+	for _, c := range configs {
+		k := key{providerType: c.ProviderType, environment: c.Environment}
+		seen[k] = true
+
+		if err := c.Validate(); err != nil {
+			log.Error().
+				Err(err).
+				Int64("config_id", c.ID).
+				Str("provider", c.ProviderType).
+				Str("environment", c.Environment).
+				Msg("skipping invalid provider config")
+			continue
+		}
+
+		settings := provider.Settings{
+			BaseURL:        c.BaseURL,
+			TimeoutSeconds: c.TimeoutSeconds,
+			MinAmount:      c.MinAmount,
+			MaxAmount:      c.MaxAmount,
+			Currency:       c.Currency,
+		}
+		if prev, ok := s.applied[k]; ok && prev == settings {
+			continue
+		}
+		s.apply(k, settings)
+	}
+
+	for k := range s.applied {
+		if !seen[k] {
+			s.apply(k, provider.Settings{})
+		}
+	}
+	return nil
+}
+
+// Run reloads the configurations until context is cancelled
+func (s *Service) Run(ctx context.Context) {
+	log.Info().Dur("reload_every", s.config.ReloadInterval).Msg("provider config reloader started")
+
+	ticker := time.NewTicker(s.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("provider config reloader stopping")
+			return
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				log.Error().Err(err).Msg("error reloading provider configs")
+			}
+		}
+	}
+}
+
+// apply hands settings to the registry and remembers them; zero settings are forgotten
+func (s *Service) apply(k key, settings provider.Settings) {
+	err := s.registry.ApplySettings(provider.ProviderType(k.providerType), k.environment, settings)
+	if err != nil {
+		log.Error().Err(err).Str("provider", k.providerType).Str("environment", k.environment).Msg("failed to apply provider config")
+		return
+	}
+	if settings == (provider.Settings{}) {
+		delete(s.applied, k)
+		log.Info().Str("provider", k.providerType).Str("environment", k.environment).Msg("provider config removed, using defaults")
+		return
+	}
+	s.applied[k] = settings
+	log.Info().
+		Str("provider", k.providerType).
+		Str("environment", k.environment).
+		Str("base_url", settings.BaseURL).
+		Int("timeout_seconds", settings.TimeoutSeconds).
+		Int64("min_amount", settings.MinAmount).
+		Int64("max_amount", settings.MaxAmount).
+		Str("currency", settings.Currency).
+		Msg("applied provider config")
+}
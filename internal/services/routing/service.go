@@ -0,0 +1,251 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/routing"
+	"paymatch/internal/provider"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Service picks the credential each collection goes through, following the tenant's
+// routing policy, and fails over to the next eligible credential while a provider's
+// circuit is open
+type Service struct {
+	policyRepo     repositories.RoutingPolicyRepository
+	credentialRepo repositories.CredentialRepository
+	registry       *provider.Registry
+	pick           func(n int) int
+}
+
+// NewService creates a new routing service
+func NewService(
+	policyRepo repositories.RoutingPolicyRepository,
+	credentialRepo repositories.CredentialRepository,
+	registry *provider.Registry,
+) *Service {
+	return &Service{
+		policyRepo:     policyRepo,
+		credentialRepo: credentialRepo,
+		registry:       registry,
+		pick:           rand.Intn,
+	}
+}
+
+// STKPushRequest represents an STK push with optional routing hints
+type STKPushRequest struct {
+	provider.STKPushReq
+	CredentialID int64             `json:"credential_id,omitempty"` // send through this credential only, without failover
+	Provider     string            `json:"provider,omitempty"`      // provider to try first, e.g. airtel_money
+	Metadata     map[string]string `json:"metadata,omitempty"`      // the caller's references, kept on the payment
+}
+
+// STKPushResult is the provider's answer and the credential that sent the push
+type STKPushResult struct {
+	*provider.STKPushResp
+	CredentialID int64  `json:"credential_id"`
+	Provider     string `json:"provider"`
+	PaymentID    int64  `json:"payment_id,omitempty"` // pending payment recorded for the push
+
+	// False when the push was sent but not recorded; its callback creates the payment instead
+	PaymentRecorded bool `json:"payment_recorded"`
+}
+
+// PolicyRequest replaces a tenant's routing policy
+type PolicyRequest struct {
+	PreferredProviders []string      `json:"preferred_providers"` // tried in this order
+	Rules              []RuleRequest `json:"rules"`
+}
+
+// RuleRequest weights a credential against the provider's other credentials
+type RuleRequest struct {
+	CredentialID int64    `json:"credential_id"`
+	Networks     []string `json:"networks,omitempty"` // safaricom, airtel or telkom; empty: any
+	Weight       int      `json:"weight"`
+}
+
+// STKPush sends the push through the first available credential the policy routes it
+// to. Credentials whose circuit is open are skipped; any other failure is returned, as
+// the push may have reached the customer.
+func (s *Service) STKPush(ctx context.Context, tenantID int64, req STKPushRequest) (*STKPushResult, error) {
+	routed, err := s.Route(ctx, tenantID, provider.OpSTKPush, req.PhoneNumber, req.CredentialID, credential.ProviderType(req.Provider))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cred := range routed {
+		if !s.registry.Available(ctx, cred) {
+			log.Warn().Int64("tenant_id", tenantID).Int64("credential_id", cred.ID).Msg("credential unavailable, failing over")
+			continue
+		}
+
+		resp, err := s.registry.STKPush(ctx, cred, req.STKPushReq)
+		var providerErr *provider.ProviderError
+		if errors.As(err, &providerErr) && providerErr.Refused {
+			log.Warn().Int64("tenant_id", tenantID).Int64("credential_id", cred.ID).Msg("credential refused the push, failing over")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Info().
+			Int64("tenant_id", tenantID).
+			Int64("credential_id", cred.ID).
+			Str("provider", string(cred.ProviderType)).
+			Str("external_id", resp.ExternalID).
+			Msg("STK push routed")
+		return &STKPushResult{STKPushResp: resp, CredentialID: cred.ID, Provider: string(cred.ProviderType)}, nil
+	}
+
+	return nil, &provider.ProviderError{
+		Code:    provider.ErrProviderDown,
+		Message: "every credential that can take this payment is unavailable, try again later",
+		Refused: true,
+	}
+}
+
+// Route returns the tenant's active credentials that support the operation and may take
+// a payment from the phone number, in the order they should be tried. An explicit
+// credential ID routes to that credential alone.
+func (s *Service) Route(ctx context.Context, tenantID int64, op provider.OperationType, phone string, credentialID int64, preferred credential.ProviderType) ([]*credential.ProviderCredential, error) {
+	credentials, err := s.credentialRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, &ServiceError{Op: "find_credentials", Err: err}
+	}
+
+	var candidates []*credential.ProviderCredential
+	for _, cred := range credentials {
+		if !cred.IsActive || !s.supports(ctx, cred, op) {
+			continue
+		}
+		if credentialID != 0 && cred.ID == credentialID {
+			return []*credential.ProviderCredential{cred}, nil
+		}
+		candidates = append(candidates, cred)
+	}
+	if credentialID != 0 {
+		return nil, &ValidationError{Field: "credential_id", Message: "no active credential with this ID supports " + string(op)}
+	}
+
+	policy, err := s.Policy(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	routed, err := policy.Route(candidates, phone, preferred, s.pick)
+	if err != nil {
+		return nil, &ValidationError{Field: "phone_number", Message: err.Error()}
+	}
+	return routed, nil
+}
+
+// Policy returns the tenant's routing policy, or the default when none was configured
+func (s *Service) Policy(ctx context.Context, tenantID int64) (*routing.Policy, error) {
+	policy, err := s.policyRepo.FindByTenantID(ctx, tenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return routing.DefaultPolicy(tenantID), nil
+	}
+	if err != nil {
+		return nil, &ServiceError{Op: "find_routing_policy", Err: err}
+	}
+	return policy, nil
+}
+
+// UpdatePolicy replaces the tenant's routing policy
+func (s *Service) UpdatePolicy(ctx context.Context, tenantID int64, req PolicyRequest) (*routing.Policy, error) {
+	policy := &routing.Policy{
+		TenantID: tenantID,
+		Rules:    make([]routing.Rule, len(req.Rules)),
+	}
+	for _, providerType := range req.PreferredProviders {
+		policy.PreferredProviders = append(policy.PreferredProviders, credential.ProviderType(providerType))
+	}
+	for i, rule := range req.Rules {
+		policy.Rules[i] = routing.Rule{CredentialID: rule.CredentialID, Weight: rule.Weight}
+		for _, network := range rule.Networks {
+			policy.Rules[i].Networks = append(policy.Rules[i].Networks, routing.Network(network))
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, &ValidationError{Field: "policy", Message: err.Error()}
+	}
+	if err := s.checkCredentials(ctx, tenantID, policy); err != nil {
+		return nil, err
+	}
+	if err := s.policyRepo.Save(ctx, policy.Touch()); err != nil {
+		return nil, &ServiceError{Op: "save_routing_policy", Err: err}
+	}
+
+	log.Info().
+		Int64("tenant_id", tenantID).
+		Int("preferred_providers", len(policy.PreferredProviders)).
+		Int("rules", len(policy.Rules)).
+		Msg("routing policy updated")
+	return policy, nil
+}
+
+// checkCredentials ensures the policy's rules only name the tenant's own credentials
+func (s *Service) checkCredentials(ctx context.Context, tenantID int64, policy *routing.Policy) error {
+	if len(policy.Rules) == 0 {
+		return nil
+	}
+	credentials, err := s.credentialRepo.FindByTenantID(ctx, tenantID)
+	if err != nil {
+		return &ServiceError{Op: "find_credentials", Err: err}
+	}
+	owned := make(map[int64]bool, len(credentials))
+	for _, cred := range credentials {
+		owned[cred.ID] = true
+	}
+	for _, rule := range policy.Rules {
+		if !owned[rule.CredentialID] {
+			return &ValidationError{Field: "rules", Message: "unknown credential ID in rules"}
+		}
+	}
+	return nil
+}
+
+// supports reports whether the credential's provider can perform the operation
+func (s *Service) supports(ctx context.Context, cred *credential.ProviderCredential, op provider.OperationType) bool {
+	p, err := s.registry.GetProviderForCredential(ctx, cred)
+	if err != nil {
+		return false
+	}
+	for _, supported := range p.SupportedOperations() {
+		if supported == op {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError represents an input validation error
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation error [" + e.Field + "]: " + e.Message
+}
+
+// ServiceError represents a routing service error
+type ServiceError struct {
+	Op  string
+	Err error
+}
+
+func (e *ServiceError) Error() string {
+	return "routing service " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
@@ -28,6 +28,11 @@ type OnboardingRequest struct {
 	Passkey         string `json:"passkey"`
 	ConsumerKey     string `json:"consumerKey"`
 	ConsumerSecret  string `json:"consumerSecret"`
+	// Daraja API operator for B2C, balance and status calls; the password is encrypted at rest
+	InitiatorName     string `json:"initiatorName,omitempty"`
+	InitiatorPassword string `json:"initiatorPassword,omitempty"`
+	// Credentials carries additional provider-specific fields (see RequiredCredentialFields), encrypted at rest
+	Credentials map[string]string `json:"credentials,omitempty"`
 }
 
 // OnboardingResponse represents tenant onboarding result
@@ -43,6 +48,13 @@ type OnboardingResponse struct {
 	BillRefRegex    string `json:"billRefRegex"`
 }
 
+// APIKeyResponse returns a newly issued API key; the key itself is only shown once
+type APIKeyResponse struct {
+	TenantID   int64  `json:"tenantId"`
+	APIKey     string `json:"apiKey"`
+	APIKeyName string `json:"apiKeyName"`
+}
+
 // Service handles tenant management with pure architecture
 type Service struct {
 	tenantRepo     repositories.TenantRepository
@@ -173,8 +185,10 @@ func (s *Service) createProviderCredential(ctx context.Context, tenantID int64,
 	}
 
 	// Encrypt and set credential fields
-	if err := providerCred.SetEncryptedField("passkey", req.Passkey, s.cfg.Sec.AESKey); err != nil {
-		return nil, fmt.Errorf("failed to encrypt passkey: %w", err)
+	if req.Passkey != "" {
+		if err := providerCred.SetEncryptedField("passkey", req.Passkey, s.cfg.Sec.AESKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt passkey: %w", err)
+		}
 	}
 	if err := providerCred.SetEncryptedField("consumer_key", req.ConsumerKey, s.cfg.Sec.AESKey); err != nil {
 		return nil, fmt.Errorf("failed to encrypt consumer key: %w", err)
@@ -182,6 +196,21 @@ func (s *Service) createProviderCredential(ctx context.Context, tenantID int64,
 	if err := providerCred.SetEncryptedField("consumer_secret", req.ConsumerSecret, s.cfg.Sec.AESKey); err != nil {
 		return nil, fmt.Errorf("failed to encrypt consumer secret: %w", err)
 	}
+	if req.InitiatorName != "" {
+		if err := providerCred.SetEncryptedField("initiator_name", req.InitiatorName, s.cfg.Sec.AESKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt initiator name: %w", err)
+		}
+	}
+	if req.InitiatorPassword != "" {
+		if err := providerCred.SetEncryptedField("initiator_password", req.InitiatorPassword, s.cfg.Sec.AESKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt initiator password: %w", err)
+		}
+	}
+	for name, value := range req.Credentials {
+		if err := providerCred.SetEncryptedField(name, value, s.cfg.Sec.AESKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+	}
 
 	return providerCred, nil
 }
@@ -214,6 +243,10 @@ func (s *Service) ValidateOnboardingRequest(req *OnboardingRequest) error {
 	if req.Provider == "" {
 		req.Provider = "mpesa_daraja"
 	}
+	if req.Provider != string(credential.ProviderMpesa) && req.Provider != string(credential.ProviderAirtelMoney) {
+		return &ValidationError{Field: "provider", Message: "must be mpesa_daraja or airtel_money"}
+	}
+	isMpesa := req.Provider == string(credential.ProviderMpesa)
 
 	// Validate environment
 	req.Environment = strings.ToLower(strings.TrimSpace(req.Environment))
@@ -221,8 +254,11 @@ func (s *Service) ValidateOnboardingRequest(req *OnboardingRequest) error {
 		return &ValidationError{Field: "environment", Message: "must be sandbox or production"}
 	}
 
-	// Validate C2B mode
+	// Validate C2B mode (only meaningful for M-Pesa shortcodes)
 	req.C2BMode = strings.ToLower(strings.TrimSpace(req.C2BMode))
+	if req.C2BMode == "" && !isMpesa {
+		req.C2BMode = "paybill"
+	}
 	if req.C2BMode != "paybill" && req.C2BMode != "buygoods" {
 		return &ValidationError{Field: "c2bMode", Message: "must be paybill or buygoods"}
 	}
@@ -233,7 +269,7 @@ func (s *Service) ValidateOnboardingRequest(req *OnboardingRequest) error {
 	}
 
 	// Validate credentials
-	if strings.TrimSpace(req.Passkey) == "" {
+	if isMpesa && strings.TrimSpace(req.Passkey) == "" {
 		return &ValidationError{Field: "passkey", Message: "passkey is required"}
 	}
 	if strings.TrimSpace(req.ConsumerKey) == "" {
@@ -259,11 +295,39 @@ func (s *Service) GetTenantByAPIKey(ctx context.Context, apiKey string) (*tenant
 	return s.tenantRepo.FindByAPIKeyHash(ctx, keyHash)
 }
 
+// GetAPIKey retrieves the stored record of an API key, which identifies the user making a request
+func (s *Service) GetAPIKey(ctx context.Context, apiKey string) (*tenant.APIKey, error) {
+	return s.tenantRepo.FindAPIKeyByHash(ctx, s.hashAPIKey(apiKey))
+}
+
+// CreateAPIKey issues an additional key for an existing tenant, e.g. one per user so
+// that payout approvals can tell the maker from the checker
+func (s *Service) CreateAPIKey(ctx context.Context, tenantID int64, name string) (*APIKeyResponse, error) {
+	t, err := s.tenantRepo.FindByID(ctx, tenantID)
+	if err != nil {
+		return nil, &ValidationError{Field: "tenant_id", Message: "tenant not found"}
+	}
+	if !t.IsActive() {
+		return nil, &ValidationError{Field: "tenant_id", Message: "tenant is not active"}
+	}
+
+	apiKey, keyName, err := s.createAPIKey(ctx, tenantID, strings.TrimSpace(name))
+	if err != nil {
+		return nil, &ServiceError{Op: "create_api_key", Err: err}
+	}
+	return &APIKeyResponse{TenantID: tenantID, APIKey: apiKey, APIKeyName: keyName}, nil
+}
+
 // GetTenantCredentials retrieves provider credentials for a tenant
 func (s *Service) GetTenantCredentials(ctx context.Context, tenantID int64) ([]*credential.ProviderCredential, error) {
 	return s.credentialRepo.FindByTenantID(ctx, tenantID)
 }
 
+// GetCredential retrieves a credential by ID (for admin operations)
+func (s *Service) GetCredential(ctx context.Context, id int64) (*credential.ProviderCredential, error) {
+	return s.credentialRepo.FindByID(ctx, id)
+}
+
 // GetCredentialByShortcode retrieves a credential by shortcode (for webhooks)
 func (s *Service) GetCredentialByShortcode(ctx context.Context, shortcode string) (*credential.ProviderCredential, error) {
 	return s.credentialRepo.FindByShortcode(ctx, shortcode)
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"paymatch/internal/domain/account"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// accountQueryRepository implements AccountQueryRepository on a pool or inside a transaction
+type accountQueryRepository struct {
+	db querier
+}
+
+// NewAccountQueryRepository creates a new account query repository
+func NewAccountQueryRepository(db *pgxpool.Pool) *accountQueryRepository {
+	return &accountQueryRepository{db: db}
+}
+
+const accountQueryColumns = `id, tenant_id, provider_credential_id, kind, transaction_id, external_id,
+	originator_conversation_id, status, result_desc, result, accounts, requested_by, created_at, updated_at, completed_at`
+
+// Save saves a query (insert or update)
+func (r *accountQueryRepository) Save(ctx context.Context, q *account.Query) error {
+	result, accounts, err := marshalQueryResult(q)
+	if err != nil {
+		return err
+	}
+
+	if q.ID == 0 {
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO account_queries (tenant_id, provider_credential_id, kind, transaction_id, external_id,
+			                             originator_conversation_id, status, result_desc, result, accounts, requested_by,
+			                             created_at, updated_at, completed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id`,
+			q.TenantID, q.ProviderCredentialID, string(q.Kind), nullString(q.TransactionID), nullString(q.ExternalID),
+			nullString(q.OriginatorConversationID), string(q.Status), nullString(q.ResultDesc), result, accounts,
+			nullString(q.RequestedBy), q.CreatedAt, q.UpdatedAt, q.CompletedAt).Scan(&q.ID)
+		if isUniqueViolation(err) {
+			return repositories.ErrDuplicate
+		}
+		return err
+	}
+
+	_, err = r.db.Exec(ctx, `
+		UPDATE account_queries
+		SET external_id = $1, originator_conversation_id = $2, status = $3, result_desc = $4,
+		    result = $5, accounts = $6, updated_at = $7, completed_at = $8
+		WHERE id = $9`,
+		nullString(q.ExternalID), nullString(q.OriginatorConversationID), string(q.Status), nullString(q.ResultDesc),
+		result, accounts, q.UpdatedAt, q.CompletedAt, q.ID)
+	if isUniqueViolation(err) {
+		return repositories.ErrDuplicate
+	}
+	return err
+}
+
+// FindByID finds a query by ID
+func (r *accountQueryRepository) FindByID(ctx context.Context, id int64) (*account.Query, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+accountQueryColumns+` FROM account_queries WHERE id = $1`, id)
+	return scanAccountQuery(row)
+}
+
+// LockByExternalID finds the query a provider result refers to and locks it for the rest of the transaction
+func (r *accountQueryRepository) LockByExternalID(ctx context.Context, tenantID int64, externalID string) (*account.Query, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+accountQueryColumns+`
+		FROM account_queries
+		WHERE tenant_id = $1 AND (external_id = $2 OR originator_conversation_id = $2)
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`, tenantID, externalID)
+	return scanAccountQuery(row)
+}
+
+// SaveBalance records a credential's balance unless a more recent one is already stored
+func (r *accountQueryRepository) SaveBalance(ctx context.Context, b *account.Balance) error {
+	accounts, err := json.Marshal(b.Accounts)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO credential_balances (provider_credential_id, tenant_id, query_id, accounts, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider_credential_id) DO UPDATE SET
+		    query_id = EXCLUDED.query_id,
+		    accounts = EXCLUDED.accounts,
+		    updated_at = EXCLUDED.updated_at
+		WHERE credential_balances.updated_at <= EXCLUDED.updated_at`,
+		b.ProviderCredentialID, b.TenantID, b.QueryID, accounts, b.UpdatedAt)
+	return err
+}
+
+// FindBalances lists the latest balance of each of the tenant's credentials
+func (r *accountQueryRepository) FindBalances(ctx context.Context, tenantID int64) ([]*account.Balance, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT tenant_id, provider_credential_id, query_id, accounts, updated_at
+		FROM credential_balances
+		WHERE tenant_id = $1
+		ORDER BY provider_credential_id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []*account.Balance
+	for rows.Next() {
+		var b account.Balance
+		var accounts []byte
+		if err := rows.Scan(&b.TenantID, &b.ProviderCredentialID, &b.QueryID, &accounts, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(accounts, &b.Accounts); err != nil {
+			return nil, err
+		}
+		balances = append(balances, &b)
+	}
+	return balances, rows.Err()
+}
+
+// marshalQueryResult encodes the result columns, never storing NULL
+func marshalQueryResult(q *account.Query) ([]byte, []byte, error) {
+	resultMap := q.Result
+	if resultMap == nil {
+		resultMap = map[string]string{}
+	}
+	result, err := json.Marshal(resultMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accountList := q.Accounts
+	if accountList == nil {
+		accountList = []account.Account{}
+	}
+	accounts, err := json.Marshal(accountList)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, accounts, nil
+}
+
+// scanAccountQuery scans a single row into query domain object
+func scanAccountQuery(row pgx.Row) (*account.Query, error) {
+	var q account.Query
+	var transactionID, externalID, originatorID, resultDesc, requestedBy sql.NullString
+	var result, accounts []byte
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&q.ID, &q.TenantID, &q.ProviderCredentialID, &q.Kind, &transactionID, &externalID,
+		&originatorID, &q.Status, &resultDesc, &result, &accounts, &requestedBy, &q.CreatedAt, &q.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	q.TransactionID = transactionID.String
+	q.ExternalID = externalID.String
+	q.OriginatorConversationID = originatorID.String
+	q.ResultDesc = resultDesc.String
+	q.RequestedBy = requestedBy.String
+	if err := json.Unmarshal(result, &q.Result); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(accounts, &q.Accounts); err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		q.CompletedAt = &completedAt.Time
+	}
+	return &q, nil
+}
@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"paymatch/internal/domain/payout"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// approvalRepository implements ApprovalRepository on a pool or inside a transaction
+type approvalRepository struct {
+	db querier
+}
+
+// NewApprovalRepository creates a new approval repository
+func NewApprovalRepository(db *pgxpool.Pool) *approvalRepository {
+	return &approvalRepository{db: db}
+}
+
+const approvalColumns = `id, tenant_id, subject, subject_id, amount, required, requested_by, approved_by, status,
+	reason, expires_at, decided_at, created_at, updated_at`
+
+// SavePolicy creates or replaces the tenant's approval policy
+func (r *approvalRepository) SavePolicy(ctx context.Context, p *payout.ApprovalPolicy) error {
+	tiers, err := json.Marshal(p.Tiers)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO approval_policies (tenant_id, tiers, expiry_hours, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+		    tiers = EXCLUDED.tiers,
+		    expiry_hours = EXCLUDED.expiry_hours,
+		    updated_at = EXCLUDED.updated_at`,
+		p.TenantID, tiers, p.ExpiryHours, p.UpdatedAt)
+	return err
+}
+
+// FindPolicy finds the tenant's approval policy
+func (r *approvalRepository) FindPolicy(ctx context.Context, tenantID int64) (*payout.ApprovalPolicy, error) {
+	var p payout.ApprovalPolicy
+	var tiers []byte
+
+	err := r.db.QueryRow(ctx, `
+		SELECT tenant_id, tiers, expiry_hours, updated_at
+		FROM approval_policies
+		WHERE tenant_id = $1`, tenantID).Scan(&p.TenantID, &tiers, &p.ExpiryHours, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tiers, &p.Tiers); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Save saves an approval (insert or update)
+func (r *approvalRepository) Save(ctx context.Context, a *payout.Approval) error {
+	if a.ID == 0 {
+		return r.db.QueryRow(ctx, `
+			INSERT INTO payout_approvals (tenant_id, subject, subject_id, amount, required, requested_by, approved_by,
+			                              status, reason, expires_at, decided_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`,
+			a.TenantID, string(a.Subject), a.SubjectID, int64(a.Amount), a.Required, a.RequestedBy, approvers(a),
+			string(a.Status), nullString(a.Reason), a.ExpiresAt, a.DecidedAt, a.CreatedAt, a.UpdatedAt).Scan(&a.ID)
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE payout_approvals
+		SET approved_by = $1, status = $2, reason = $3, decided_at = $4, updated_at = $5
+		WHERE id = $6`,
+		approvers(a), string(a.Status), nullString(a.Reason), a.DecidedAt, a.UpdatedAt, a.ID)
+	return err
+}
+
+// FindByID finds an approval by ID
+func (r *approvalRepository) FindByID(ctx context.Context, id int64) (*payout.Approval, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+approvalColumns+` FROM payout_approvals WHERE id = $1`, id)
+	return scanApproval(row)
+}
+
+// LockByID finds an approval and locks it for the rest of the transaction
+func (r *approvalRepository) LockByID(ctx context.Context, id int64) (*payout.Approval, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+approvalColumns+` FROM payout_approvals WHERE id = $1 FOR UPDATE`, id)
+	return scanApproval(row)
+}
+
+// LockPending finds the pending approval for a payout or batch and locks it for the rest of the transaction
+func (r *approvalRepository) LockPending(ctx context.Context, subject payout.Subject, subjectID int64) (*payout.Approval, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+approvalColumns+`
+		FROM payout_approvals
+		WHERE subject = $1 AND subject_id = $2 AND status = 'pending'
+		FOR UPDATE`, string(subject), subjectID)
+	return scanApproval(row)
+}
+
+// FindByTenantID lists a tenant's approvals, newest first, optionally filtered by status
+func (r *approvalRepository) FindByTenantID(ctx context.Context, tenantID int64, status payout.ApprovalStatus, limit, offset int) ([]*payout.Approval, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+approvalColumns+`
+		FROM payout_approvals
+		WHERE tenant_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`, tenantID, string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanApprovals(rows)
+}
+
+// FindExpired lists pending approvals whose deadline is before the cutoff, oldest first
+func (r *approvalRepository) FindExpired(ctx context.Context, before time.Time, limit int) ([]*payout.Approval, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+approvalColumns+`
+		FROM payout_approvals
+		WHERE status = 'pending' AND expires_at <= $1
+		ORDER BY expires_at
+		LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanApprovals(rows)
+}
+
+// AddAudit appends an entry to an approval's audit trail
+func (r *approvalRepository) AddAudit(ctx context.Context, entry *payout.ApprovalAuditEntry) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO payout_approval_audit (approval_id, tenant_id, action, actor, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		entry.ApprovalID, entry.TenantID, string(entry.Action), entry.Actor, nullString(entry.Reason),
+		entry.CreatedAt).Scan(&entry.ID)
+}
+
+// FindAudit lists an approval's audit trail in order
+func (r *approvalRepository) FindAudit(ctx context.Context, approvalID int64) ([]*payout.ApprovalAuditEntry, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, approval_id, tenant_id, action, actor, reason, created_at
+		FROM payout_approval_audit
+		WHERE approval_id = $1
+		ORDER BY id`, approvalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*payout.ApprovalAuditEntry
+	for rows.Next() {
+		var entry payout.ApprovalAuditEntry
+		var reason sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.ApprovalID, &entry.TenantID, &entry.Action, &entry.Actor, &reason,
+			&entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Reason = reason.String
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// approvers never stores NULL, so array_length-style checks in SQL stay simple
+func approvers(a *payout.Approval) []string {
+	if a.ApprovedBy == nil {
+		return []string{}
+	}
+	return a.ApprovedBy
+}
+
+// scanApprovals scans every row into approval domain objects
+func scanApprovals(rows pgx.Rows) ([]*payout.Approval, error) {
+	var approvals []*payout.Approval
+	for rows.Next() {
+		a, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals, rows.Err()
+}
+
+// scanApproval scans a single row into approval domain object
+func scanApproval(row pgx.Row) (*payout.Approval, error) {
+	var a payout.Approval
+	var reason sql.NullString
+	var decidedAt sql.NullTime
+
+	err := row.Scan(&a.ID, &a.TenantID, &a.Subject, &a.SubjectID, &a.Amount, &a.Required, &a.RequestedBy,
+		&a.ApprovedBy, &a.Status, &reason, &a.ExpiresAt, &decidedAt, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Reason = reason.String
+	if decidedAt.Valid {
+		a.DecidedAt = &decidedAt.Time
+	}
+	return &a, nil
+}
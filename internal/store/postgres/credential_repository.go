@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	
 	"paymatch/internal/domain/credential"
 	
@@ -32,7 +33,7 @@ func (r *credentialRepository) Save(ctx context.Context, c *credential.ProviderC
 func (r *credentialRepository) FindByID(ctx context.Context, id int64) (*credential.ProviderCredential, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, tenant_id, provider, provider_type, shortcode, passkey_enc, consumer_key_enc, consumer_secret_enc,
-		       environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
+		       credentials_json, environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
 		FROM provider_credentials 
 		WHERE id = $1`, id)
 	
@@ -43,7 +44,7 @@ func (r *credentialRepository) FindByID(ctx context.Context, id int64) (*credent
 func (r *credentialRepository) FindByShortcode(ctx context.Context, shortcode string) (*credential.ProviderCredential, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, tenant_id, provider, provider_type, shortcode, passkey_enc, consumer_key_enc, consumer_secret_enc,
-		       environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
+		       credentials_json, environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
 		FROM provider_credentials 
 		WHERE shortcode = $1 AND is_active = true`, shortcode)
 	
@@ -54,7 +55,7 @@ func (r *credentialRepository) FindByShortcode(ctx context.Context, shortcode st
 func (r *credentialRepository) FindByWebhookToken(ctx context.Context, token string) (*credential.ProviderCredential, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, tenant_id, provider, provider_type, shortcode, passkey_enc, consumer_key_enc, consumer_secret_enc,
-		       environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
+		       credentials_json, environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
 		FROM provider_credentials 
 		WHERE webhook_token = $1 AND is_active = true`, token)
 	
@@ -65,7 +66,7 @@ func (r *credentialRepository) FindByWebhookToken(ctx context.Context, token str
 func (r *credentialRepository) FindByTenantID(ctx context.Context, tenantID int64) ([]*credential.ProviderCredential, error) {
 	rows, err := r.db.Query(ctx, `
 		SELECT id, tenant_id, provider, provider_type, shortcode, passkey_enc, consumer_key_enc, consumer_secret_enc,
-		       environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
+		       credentials_json, environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active
 		FROM provider_credentials 
 		WHERE tenant_id = $1 AND is_active = true
 		ORDER BY id DESC`, tenantID)
@@ -108,26 +109,38 @@ func (r *credentialRepository) insert(ctx context.Context, c *credential.Provide
 		consumerSecretEnc = c.EncryptedCredentials["consumer_secret"]
 	}
 	
-	err := r.db.QueryRow(ctx, `
+	extraJSON, err := marshalExtraCredentials(c.EncryptedCredentials)
+	if err != nil {
+		return err
+	}
+	
+	err = r.db.QueryRow(ctx, `
 		INSERT INTO provider_credentials (tenant_id, provider, provider_type, shortcode, passkey_enc, consumer_key_enc, consumer_secret_enc, 
-		                                 environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		                                 credentials_json, environment, webhook_token, c2b_mode, c2b_bill_ref_required, c2b_bill_ref_regex, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id`,
 		c.TenantID, c.Provider, string(c.ProviderType), c.Shortcode, passkeyEnc, consumerKeyEnc, consumerSecretEnc,
-		string(c.Environment), c.WebhookToken, string(c.C2BConfiguration.Mode), c.C2BConfiguration.BillRefRequired, c.C2BConfiguration.BillRefRegex, c.IsActive).Scan(&c.ID)
+		extraJSON, string(c.Environment), c.WebhookToken, string(c.C2BConfiguration.Mode), c.C2BConfiguration.BillRefRequired, c.C2BConfiguration.BillRefRegex, c.IsActive).Scan(&c.ID)
 	
 	return err
 }
 
 // update modifies an existing credential record
 func (r *credentialRepository) update(ctx context.Context, c *credential.ProviderCredential) error {
-	_, err := r.db.Exec(ctx, `
+	extraJSON, err := marshalExtraCredentials(c.EncryptedCredentials)
+	if err != nil {
+		return err
+	}
+	
+	_, err = r.db.Exec(ctx, `
 		UPDATE provider_credentials 
 		SET provider = $1, shortcode = $2, environment = $3, 
-		    webhook_token = $4, c2b_mode = $5, c2b_bill_ref_required = $6, c2b_bill_ref_regex = $7, is_active = $8
-		WHERE id = $9`,
+		    webhook_token = $4, c2b_mode = $5, c2b_bill_ref_required = $6, c2b_bill_ref_regex = $7, is_active = $8,
+		    credentials_json = $9, updated_at = now()
+		WHERE id = $10`,
 		c.Provider, c.Shortcode, string(c.Environment),
-		c.WebhookToken, string(c.C2BConfiguration.Mode), c.C2BConfiguration.BillRefRequired, c.C2BConfiguration.BillRefRegex, c.IsActive, c.ID)
+		c.WebhookToken, string(c.C2BConfiguration.Mode), c.C2BConfiguration.BillRefRequired, c.C2BConfiguration.BillRefRegex, c.IsActive,
+		extraJSON, c.ID)
 	
 	return err
 }
@@ -137,12 +150,13 @@ func (r *credentialRepository) scanCredential(row pgx.Row) (*credential.Provider
 	var c credential.ProviderCredential
 	var provider, providerType, environment, c2bMode string
 	var passkeyEnc, consumerKeyEnc, consumerSecretEnc sql.NullString
+	var extraJSON []byte
 	var billRefRequired sql.NullBool
 	var billRefRegex sql.NullString
 	
 	err := row.Scan(
 		&c.ID, &c.TenantID, &provider, &providerType, &c.Shortcode, &passkeyEnc, &consumerKeyEnc, &consumerSecretEnc,
-		&environment, &c.WebhookToken, &c2bMode, &billRefRequired, &billRefRegex, &c.IsActive)
+		&extraJSON, &environment, &c.WebhookToken, &c2bMode, &billRefRequired, &billRefRegex, &c.IsActive)
 	if err != nil {
 		return nil, err
 	}
@@ -158,8 +172,13 @@ func (r *credentialRepository) scanCredential(row pgx.Row) (*credential.Provider
 		c.C2BConfiguration.BillRefRegex = billRefRegex.String
 	}
 	
-	// Populate encrypted credentials map
+	// Populate encrypted credentials map (provider-specific fields first, dedicated columns win)
 	c.EncryptedCredentials = make(map[string]string)
+	if len(extraJSON) > 0 {
+		if err := json.Unmarshal(extraJSON, &c.EncryptedCredentials); err != nil {
+			return nil, err
+		}
+	}
 	if passkeyEnc.Valid {
 		c.EncryptedCredentials["passkey"] = passkeyEnc.String
 	}
@@ -178,12 +197,13 @@ func (r *credentialRepository) scanCredentialFromRows(rows pgx.Rows) (*credentia
 	var c credential.ProviderCredential
 	var provider, providerType, environment, c2bMode string
 	var passkeyEnc, consumerKeyEnc, consumerSecretEnc sql.NullString
+	var extraJSON []byte
 	var billRefRequired sql.NullBool
 	var billRefRegex sql.NullString
 	
 	err := rows.Scan(
 		&c.ID, &c.TenantID, &provider, &providerType, &c.Shortcode, &passkeyEnc, &consumerKeyEnc, &consumerSecretEnc,
-		&environment, &c.WebhookToken, &c2bMode, &billRefRequired, &billRefRegex, &c.IsActive)
+		&extraJSON, &environment, &c.WebhookToken, &c2bMode, &billRefRequired, &billRefRegex, &c.IsActive)
 	if err != nil {
 		return nil, err
 	}
@@ -199,8 +219,13 @@ func (r *credentialRepository) scanCredentialFromRows(rows pgx.Rows) (*credentia
 		c.C2BConfiguration.BillRefRegex = billRefRegex.String
 	}
 	
-	// Populate encrypted credentials map
+	// Populate encrypted credentials map (provider-specific fields first, dedicated columns win)
 	c.EncryptedCredentials = make(map[string]string)
+	if len(extraJSON) > 0 {
+		if err := json.Unmarshal(extraJSON, &c.EncryptedCredentials); err != nil {
+			return nil, err
+		}
+	}
 	if passkeyEnc.Valid {
 		c.EncryptedCredentials["passkey"] = passkeyEnc.String
 	}
@@ -212,4 +237,22 @@ func (r *credentialRepository) scanCredentialFromRows(rows pgx.Rows) (*credentia
 	}
 	
 	return &c, nil
-}
\ No newline at end of file
+}
+
+// dedicatedCredentialColumns are the encrypted fields stored in their own columns
+var dedicatedCredentialColumns = map[string]bool{
+	"passkey":         true,
+	"consumer_key":    true,
+	"consumer_secret": true,
+}
+
+// marshalExtraCredentials encodes provider-specific encrypted fields for credentials_json
+func marshalExtraCredentials(fields map[string]string) ([]byte, error) {
+	extra := make(map[string]string)
+	for name, value := range fields {
+		if !dedicatedCredentialColumns[name] {
+			extra[name] = value
+		}
+	}
+	return json.Marshal(extra)
+}
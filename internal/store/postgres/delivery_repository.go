@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"paymatch/internal/domain/delivery"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// deliveryRepository implements DeliveryRepository on top of the event_queue outbox,
+// on a pool or inside the transaction that records the event's effects
+type deliveryRepository struct {
+	db querier
+}
+
+// NewDeliveryRepository creates a new delivery repository
+func NewDeliveryRepository(db *pgxpool.Pool) *deliveryRepository {
+	return &deliveryRepository{db: db}
+}
+
+// Enqueue adds a delivery for an event; an event is only ever queued once
+func (r *deliveryRepository) Enqueue(ctx context.Context, d *delivery.Delivery) error {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO event_queue (tenant_id, event_id, status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (event_id) DO NOTHING
+		RETURNING id`,
+		d.TenantID, d.EventID, string(d.Status), d.Attempts, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt).Scan(&d.ID)
+	if err == pgx.ErrNoRows {
+		return nil // already queued
+	}
+	return err
+}
+
+// ClaimDue locks due deliveries and marks them as delivering.
+// Rows stuck in delivering (e.g. after a crash) are reclaimed after five minutes.
+func (r *deliveryRepository) ClaimDue(ctx context.Context, limit int) ([]*delivery.Delivery, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE event_queue
+		SET status = 'delivering', updated_at = now()
+		WHERE id IN (
+			SELECT id FROM event_queue
+			WHERE (status IN ('pending', 'failed') AND next_attempt_at <= now())
+			   OR (status = 'delivering' AND updated_at < now() - interval '5 minutes')
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, tenant_id, event_id, status, attempts, next_attempt_at, last_error,
+		          last_status_code, delivered_at, created_at, updated_at`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return r.scanDeliveries(rows)
+}
+
+// Save persists the outcome of a delivery attempt
+func (r *deliveryRepository) Save(ctx context.Context, d *delivery.Delivery) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE event_queue
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4,
+		    last_status_code = $5, delivered_at = $6, updated_at = $7
+		WHERE id = $8`,
+		string(d.Status), d.Attempts, d.NextAttemptAt, nullString(d.LastError),
+		nullInt(d.LastStatusCode), d.DeliveredAt, d.UpdatedAt, d.ID)
+	return err
+}
+
+// FindByID finds a delivery by ID
+func (r *deliveryRepository) FindByID(ctx context.Context, id int64) (*delivery.Delivery, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT id, tenant_id, event_id, status, attempts, next_attempt_at, last_error,
+		       last_status_code, delivered_at, created_at, updated_at
+		FROM event_queue
+		WHERE id = $1`, id)
+
+	return r.scanDelivery(row)
+}
+
+// FindByTenantID lists deliveries, optionally filtered by status; tenantID 0 lists all tenants
+func (r *deliveryRepository) FindByTenantID(ctx context.Context, tenantID int64, status delivery.Status, limit, offset int) ([]*delivery.Delivery, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, tenant_id, event_id, status, attempts, next_attempt_at, last_error,
+		       last_status_code, delivered_at, created_at, updated_at
+		FROM event_queue
+		WHERE ($1 = 0 OR tenant_id = $1)
+		  AND ($2 = '' OR status = $2)
+		ORDER BY updated_at DESC
+		LIMIT $3 OFFSET $4`, tenantID, string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return r.scanDeliveries(rows)
+}
+
+// scanDelivery scans a single row into delivery domain object
+func (r *deliveryRepository) scanDelivery(row pgx.Row) (*delivery.Delivery, error) {
+	var d delivery.Delivery
+	var lastError sql.NullString
+	var lastStatusCode sql.NullInt64
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID, &d.TenantID, &d.EventID, &d.Status, &d.Attempts, &d.NextAttemptAt, &lastError,
+		&lastStatusCode, &deliveredAt, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastError.Valid {
+		d.LastError = lastError.String
+	}
+	if lastStatusCode.Valid {
+		d.LastStatusCode = int(lastStatusCode.Int64)
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return &d, nil
+}
+
+// scanDeliveries scans multiple rows into delivery domain objects
+func (r *deliveryRepository) scanDeliveries(rows pgx.Rows) ([]*delivery.Delivery, error) {
+	var deliveries []*delivery.Delivery
+	for rows.Next() {
+		d, err := r.scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// webhookEndpointRepository implements WebhookEndpointRepository
+type webhookEndpointRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewWebhookEndpointRepository creates a new webhook endpoint repository
+func NewWebhookEndpointRepository(db *pgxpool.Pool) *webhookEndpointRepository {
+	return &webhookEndpointRepository{db: db}
+}
+
+// Save saves an endpoint; each tenant has at most one
+func (r *webhookEndpointRepository) Save(ctx context.Context, e *delivery.Endpoint) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO webhook_endpoints (tenant_id, url, is_active, signing_secret_enc, previous_secret_enc,
+		                               previous_secret_expires_at, secret_rotated_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+		    url = EXCLUDED.url,
+		    is_active = EXCLUDED.is_active,
+		    signing_secret_enc = EXCLUDED.signing_secret_enc,
+		    previous_secret_enc = EXCLUDED.previous_secret_enc,
+		    previous_secret_expires_at = EXCLUDED.previous_secret_expires_at,
+		    secret_rotated_at = EXCLUDED.secret_rotated_at,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING id`,
+		e.TenantID, e.URL, e.IsActive, nullString(e.SigningSecretEnc), nullString(e.PreviousSecretEnc),
+		e.PreviousSecretExpiresAt, e.SecretRotatedAt, e.CreatedAt, e.UpdatedAt).Scan(&e.ID)
+}
+
+// FindByTenantID finds the endpoint configured for a tenant
+func (r *webhookEndpointRepository) FindByTenantID(ctx context.Context, tenantID int64) (*delivery.Endpoint, error) {
+	var e delivery.Endpoint
+	var signingSecret, previousSecret sql.NullString
+	var previousExpiresAt, rotatedAt sql.NullTime
+
+	err := r.db.QueryRow(ctx, `
+		SELECT id, tenant_id, url, is_active, signing_secret_enc, previous_secret_enc,
+		       previous_secret_expires_at, secret_rotated_at, created_at, updated_at
+		FROM webhook_endpoints
+		WHERE tenant_id = $1`, tenantID).Scan(
+		&e.ID, &e.TenantID, &e.URL, &e.IsActive, &signingSecret, &previousSecret,
+		&previousExpiresAt, &rotatedAt, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	e.SigningSecretEnc = signingSecret.String
+	e.PreviousSecretEnc = previousSecret.String
+	if previousExpiresAt.Valid {
+		e.PreviousSecretExpiresAt = &previousExpiresAt.Time
+	}
+	if rotatedAt.Valid {
+		e.SecretRotatedAt = &rotatedAt.Time
+	}
+	return &e, nil
+}
+
+// nullString maps empty strings to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt maps zero to SQL NULL
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+// nullInt64 maps zero IDs to SQL NULL
+func nullInt64(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"time"
 	
 	"paymatch/internal/domain/event"
 	
@@ -28,11 +29,17 @@ func (r *eventRepository) Save(ctx context.Context, e *event.Event) error {
 	return r.update(ctx, e)
 }
 
+// SaveIfAbsent inserts an event unless one with the same (tenant, type, external ID) exists.
+// It reports whether a new row was written; either way e.ID is set to the stored row.
+func (r *eventRepository) SaveIfAbsent(ctx context.Context, e *event.Event) (bool, error) {
+	return saveEventIfAbsent(ctx, r.db, e)
+}
+
 // FindByID finds an event by ID
 func (r *eventRepository) FindByID(ctx context.Context, id int64) (*event.Event, error) {
 	row := r.db.QueryRow(ctx, `
 		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
-		       msisdn, invoice_ref, transaction_id, status, response_description, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
 		       payload_json, received_at, processed_at, processing_status
 		FROM payment_events 
 		WHERE id = $1`, id)
@@ -44,7 +51,7 @@ func (r *eventRepository) FindByID(ctx context.Context, id int64) (*event.Event,
 func (r *eventRepository) FindUnprocessed(ctx context.Context, limit int) ([]*event.Event, error) {
 	rows, err := r.db.Query(ctx, `
 		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
-		       msisdn, invoice_ref, transaction_id, status, response_description, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
 		       payload_json, received_at, processed_at, processing_status
 		FROM payment_events 
 		WHERE processing_status IN ('pending', 'queued')
@@ -58,11 +65,29 @@ func (r *eventRepository) FindUnprocessed(ctx context.Context, limit int) ([]*ev
 	return r.scanEvents(rows)
 }
 
+// FindDeferredBefore finds deferred events last tried before the cutoff, oldest first
+func (r *eventRepository) FindDeferredBefore(ctx context.Context, before time.Time, limit int) ([]*event.Event, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
+		       payload_json, received_at, processed_at, processing_status
+		FROM payment_events 
+		WHERE processing_status = 'deferred' AND processed_at < $1
+		ORDER BY processed_at ASC 
+		LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	return r.scanEvents(rows)
+}
+
 // FindByTenantID finds events by tenant with pagination
 func (r *eventRepository) FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*event.Event, error) {
 	rows, err := r.db.Query(ctx, `
 		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
-		       msisdn, invoice_ref, transaction_id, status, response_description, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
 		       payload_json, received_at, processed_at, processing_status
 		FROM payment_events 
 		WHERE tenant_id = $1 
@@ -99,8 +124,8 @@ func (r *eventRepository) insert(ctx context.Context, e *event.Event) error {
 	err := r.db.QueryRow(ctx, `
 		INSERT INTO payment_events (tenant_id, provider_credential_id, event_type, external_id, 
 		                           amount, msisdn, invoice_ref, transaction_id, status, 
-		                           response_description, payload_json, received_at, processing_status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		                           failure_code, response_description, payload_json, received_at, processing_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		ON CONFLICT (tenant_id, event_type, external_id) DO UPDATE SET
 		    payload_json = EXCLUDED.payload_json,
 		    amount = CASE WHEN EXCLUDED.amount > 0 THEN EXCLUDED.amount ELSE payment_events.amount END,
@@ -108,12 +133,13 @@ func (r *eventRepository) insert(ctx context.Context, e *event.Event) error {
 		    invoice_ref = COALESCE(NULLIF(EXCLUDED.invoice_ref, ''), payment_events.invoice_ref),
 		    transaction_id = COALESCE(NULLIF(EXCLUDED.transaction_id, ''), payment_events.transaction_id),
 		    status = COALESCE(NULLIF(EXCLUDED.status, ''), payment_events.status),
+		    failure_code = CASE WHEN EXCLUDED.status <> '' THEN EXCLUDED.failure_code ELSE payment_events.failure_code END,
 		    response_description = COALESCE(NULLIF(EXCLUDED.response_description, ''), payment_events.response_description),
 		    updated_at = now()
 		RETURNING id`,
 		e.TenantID, e.ProviderCredentialID, string(e.Type), e.ExternalID,
 		e.Amount, e.MSISDN, e.InvoiceRef, e.TransactionID, e.Status,
-		e.ResponseDescription, e.RawJSON, e.ReceivedAt, string(e.ProcessingStatus)).Scan(&e.ID)
+		nullString(e.FailureCode), e.ResponseDescription, e.RawJSON, e.ReceivedAt, string(e.ProcessingStatus)).Scan(&e.ID)
 	
 	return err
 }
@@ -125,12 +151,12 @@ func (r *eventRepository) update(ctx context.Context, e *event.Event) error {
 		SET provider_credential_id = $1, event_type = $2, external_id = $3,
 		    amount = $4, msisdn = $5, invoice_ref = $6, transaction_id = $7,
 		    status = $8, response_description = $9, payload_json = $10,
-		    processed_at = $11, processing_status = $12, updated_at = now()
-		WHERE id = $13`,
+		    processed_at = $11, processing_status = $12, failure_code = $13, updated_at = now()
+		WHERE id = $14`,
 		e.ProviderCredentialID, string(e.Type), e.ExternalID,
 		e.Amount, e.MSISDN, e.InvoiceRef, e.TransactionID,
 		e.Status, e.ResponseDescription, e.RawJSON,
-		e.ProcessedAt, string(e.ProcessingStatus), e.ID)
+		e.ProcessedAt, string(e.ProcessingStatus), nullString(e.FailureCode), e.ID)
 	
 	return err
 }
@@ -139,12 +165,12 @@ func (r *eventRepository) update(ctx context.Context, e *event.Event) error {
 func (r *eventRepository) scanEvent(row pgx.Row) (*event.Event, error) {
 	var e event.Event
 	var amount sql.NullInt64
-	var msisdn, invoiceRef, transactionID, status, responseDesc sql.NullString
+	var msisdn, invoiceRef, transactionID, status, failureCode, responseDesc sql.NullString
 	var processedAt sql.NullTime
 	
 	err := row.Scan(
 		&e.ID, &e.TenantID, &e.ProviderCredentialID, &e.Type, &e.ExternalID,
-		&amount, &msisdn, &invoiceRef, &transactionID, &status, &responseDesc,
+		&amount, &msisdn, &invoiceRef, &transactionID, &status, &failureCode, &responseDesc,
 		&e.RawJSON, &e.ReceivedAt, &processedAt, &e.ProcessingStatus)
 	if err != nil {
 		return nil, err
@@ -165,6 +191,9 @@ func (r *eventRepository) scanEvent(row pgx.Row) (*event.Event, error) {
 	if status.Valid {
 		e.Status = status.String
 	}
+	if failureCode.Valid {
+		e.FailureCode = failureCode.String
+	}
 	if responseDesc.Valid {
 		e.ResponseDescription = responseDesc.String
 	}
@@ -193,12 +222,12 @@ func (r *eventRepository) scanEvents(rows pgx.Rows) ([]*event.Event, error) {
 func (r *eventRepository) scanEventFromRows(rows pgx.Rows) (*event.Event, error) {
 	var e event.Event
 	var amount sql.NullInt64
-	var msisdn, invoiceRef, transactionID, status, responseDesc sql.NullString
+	var msisdn, invoiceRef, transactionID, status, failureCode, responseDesc sql.NullString
 	var processedAt sql.NullTime
 	
 	err := rows.Scan(
 		&e.ID, &e.TenantID, &e.ProviderCredentialID, &e.Type, &e.ExternalID,
-		&amount, &msisdn, &invoiceRef, &transactionID, &status, &responseDesc,
+		&amount, &msisdn, &invoiceRef, &transactionID, &status, &failureCode, &responseDesc,
 		&e.RawJSON, &e.ReceivedAt, &processedAt, &e.ProcessingStatus)
 	if err != nil {
 		return nil, err
@@ -219,6 +248,9 @@ func (r *eventRepository) scanEventFromRows(rows pgx.Rows) (*event.Event, error)
 	if status.Valid {
 		e.Status = status.String
 	}
+	if failureCode.Valid {
+		e.FailureCode = failureCode.String
+	}
 	if responseDesc.Valid {
 		e.ResponseDescription = responseDesc.String
 	}
@@ -227,4 +259,36 @@ func (r *eventRepository) scanEventFromRows(rows pgx.Rows) (*event.Event, error)
 	}
 	
 	return &e, nil
-}
\ No newline at end of file
+}
+
+// eventQuerier is the subset of pgxpool.Pool and pgx.Tx used by shared event queries
+type eventQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// saveEventIfAbsent relies on UNIQUE (tenant_id, event_type, external_id) for deduplication
+func saveEventIfAbsent(ctx context.Context, q eventQuerier, e *event.Event) (bool, error) {
+	err := q.QueryRow(ctx, `
+		INSERT INTO payment_events (tenant_id, provider_credential_id, event_type, external_id, 
+		                           amount, msisdn, invoice_ref, transaction_id, status, 
+		                           failure_code, response_description, payload_json, received_at, processing_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (tenant_id, event_type, external_id) DO NOTHING
+		RETURNING id`,
+		e.TenantID, e.ProviderCredentialID, string(e.Type), e.ExternalID,
+		e.Amount, e.MSISDN, e.InvoiceRef, e.TransactionID, e.Status,
+		nullString(e.FailureCode), e.ResponseDescription, e.RawJSON, e.ReceivedAt, string(e.ProcessingStatus)).Scan(&e.ID)
+	if err == nil {
+		return true, nil
+	}
+	if err != pgx.ErrNoRows {
+		return false, err
+	}
+	
+	// Duplicate delivery: point the event at the row we already have
+	err = q.QueryRow(ctx, `
+		SELECT id, processing_status FROM payment_events
+		WHERE tenant_id = $1 AND event_type = $2 AND external_id = $3`,
+		e.TenantID, string(e.Type), e.ExternalID).Scan(&e.ID, &e.ProcessingStatus)
+	return false, err
+}
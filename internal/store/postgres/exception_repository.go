@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"paymatch/internal/domain/exception"
+	"paymatch/internal/domain/payment"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exceptionRepository implements ExceptionRepository on a pool or inside a transaction
+type exceptionRepository struct {
+	db querier
+}
+
+// NewExceptionRepository creates a new payment exception repository
+func NewExceptionRepository(db *pgxpool.Pool) *exceptionRepository {
+	return &exceptionRepository{db: db}
+}
+
+// FindByTenantID lists completed payments that were not reconciled, with any pending match suggestion
+func (r *exceptionRepository) FindByTenantID(ctx context.Context, tenantID int64, kind exception.Kind, limit, offset int) ([]*exception.Exception, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT p.id, p.tenant_id, p.invoice_no, p.amount, p.currency, p.status, p.method, p.external_id,
+		       p.msisdn_hash, p.created_at, p.updated_at, mr.id, mr.invoice_id, mr.confidence
+		FROM payments p
+		LEFT JOIN match_reviews mr ON mr.payment_id = p.id AND mr.status = 'pending'
+		WHERE p.tenant_id = $1
+		  AND p.status IN ('completed', 'refund_candidate')
+		  AND ($2 = ''
+		       OR ($2 = 'refund_candidate' AND p.status = 'refund_candidate')
+		       OR ($2 = 'ambiguous' AND p.status = 'completed' AND mr.id IS NOT NULL)
+		       OR ($2 = 'unmatched' AND p.status = 'completed' AND mr.id IS NULL))
+		ORDER BY p.created_at DESC
+		LIMIT $3 OFFSET $4`, tenantID, string(kind), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exceptions []*exception.Exception
+	for rows.Next() {
+		var p payment.Payment
+		var invoiceNo, msisdnHash sql.NullString
+		var reviewID, suggestedInvoiceID sql.NullInt64
+		var confidence sql.NullFloat64
+
+		err := rows.Scan(
+			&p.ID, &p.TenantID, &invoiceNo, &p.Amount, &p.Currency, &p.Status, &p.Method, &p.ExternalID,
+			&msisdnHash, &p.CreatedAt, &p.UpdatedAt, &reviewID, &suggestedInvoiceID, &confidence)
+		if err != nil {
+			return nil, err
+		}
+		p.InvoiceNo = invoiceNo.String
+		p.MSISDNHash = msisdnHash.String
+
+		exc := &exception.Exception{Payment: &p, Kind: exception.KindUnmatched}
+		switch {
+		case p.Status == payment.StatusRefundCandidate:
+			exc.Kind = exception.KindRefundCandidate
+		case reviewID.Valid:
+			exc.Kind = exception.KindAmbiguous
+		}
+		if reviewID.Valid {
+			exc.ReviewID = &reviewID.Int64
+			exc.SuggestedInvoiceID = &suggestedInvoiceID.Int64
+			exc.Confidence = &confidence.Float64
+		}
+		exceptions = append(exceptions, exc)
+	}
+	return exceptions, rows.Err()
+}
+
+// LockPayment loads a payment and locks it for the rest of the transaction
+func (r *exceptionRepository) LockPayment(ctx context.Context, paymentID int64) (*payment.Payment, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
+		FROM payments
+		WHERE id = $1
+		FOR UPDATE`, paymentID)
+	return scanPayment(row)
+}
+
+// SaveAudit appends an operator action to the payment's audit trail
+func (r *exceptionRepository) SaveAudit(ctx context.Context, entry *exception.AuditEntry) error {
+	splits, err := json.Marshal(entry.Splits)
+	if err != nil {
+		return err
+	}
+
+	return r.db.QueryRow(ctx, `
+		INSERT INTO payment_audit (tenant_id, payment_id, action, actor, reason, splits, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		entry.TenantID, entry.PaymentID, string(entry.Action), entry.Actor, entry.Reason, splits,
+		entry.CreatedAt).Scan(&entry.ID)
+}
+
+// FindAuditByPaymentID lists the actions taken on a tenant's payment, oldest first
+func (r *exceptionRepository) FindAuditByPaymentID(ctx context.Context, tenantID, paymentID int64) ([]*exception.AuditEntry, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, tenant_id, payment_id, action, actor, reason, splits, created_at
+		FROM payment_audit
+		WHERE tenant_id = $1 AND payment_id = $2
+		ORDER BY id ASC`, tenantID, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*exception.AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// scanAuditEntry scans a single row into an audit entry
+func scanAuditEntry(row pgx.Row) (*exception.AuditEntry, error) {
+	var entry exception.AuditEntry
+	var splits []byte
+
+	err := row.Scan(&entry.ID, &entry.TenantID, &entry.PaymentID, &entry.Action, &entry.Actor, &entry.Reason,
+		&splits, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(splits) > 0 {
+		if err := json.Unmarshal(splits, &entry.Splits); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"paymatch/internal/domain/idempotency"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// idempotencyRepository implements IdempotencyRepository
+type idempotencyRepository struct {
+	db querier
+}
+
+// NewIdempotencyRepository creates a new idempotency key repository
+func NewIdempotencyRepository(db *pgxpool.Pool) *idempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Claim inserts the record, taking over an expired one with the same key or an abandoned
+// claim on the same request
+func (r *idempotencyRepository) Claim(ctx context.Context, rec *idempotency.Record, staleBefore time.Time) (bool, error) {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (tenant_id, key, fingerprint, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, key) DO UPDATE SET
+		    fingerprint = EXCLUDED.fingerprint,
+		    status = EXCLUDED.status,
+		    response_status = NULL,
+		    response_content_type = NULL,
+		    response_body = NULL,
+		    created_at = EXCLUDED.created_at,
+		    completed_at = NULL,
+		    expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+		   OR (idempotency_keys.status = 'processing' AND idempotency_keys.created_at < $7
+		       AND idempotency_keys.fingerprint = EXCLUDED.fingerprint)
+		RETURNING id`,
+		rec.TenantID, rec.Key, rec.Fingerprint, string(rec.Status), rec.CreatedAt, rec.ExpiresAt, staleBefore).Scan(&rec.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FindByKey finds the tenant's record for a key
+func (r *idempotencyRepository) FindByKey(ctx context.Context, tenantID int64, key string) (*idempotency.Record, error) {
+	var rec idempotency.Record
+	var status string
+	var responseStatus sql.NullInt64
+	var contentType sql.NullString
+
+	err := r.db.QueryRow(ctx, `
+		SELECT id, tenant_id, key, fingerprint, status, response_status, response_content_type, response_body,
+		       created_at, completed_at, expires_at
+		FROM idempotency_keys
+		WHERE tenant_id = $1 AND key = $2`, tenantID, key).Scan(
+		&rec.ID, &rec.TenantID, &rec.Key, &rec.Fingerprint, &status, &responseStatus, &contentType, &rec.ResponseBody,
+		&rec.CreatedAt, &rec.CompletedAt, &rec.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	rec.Status = idempotency.Status(status)
+	rec.ResponseStatus = int(responseStatus.Int64)
+	rec.ResponseContentType = contentType.String
+	return &rec, nil
+}
+
+// Complete stores the response of a claimed record. A takeover keeps the row's id, so the
+// claim is matched on its creation time too; pgx.ErrNoRows means it is no longer held.
+func (r *idempotencyRepository) Complete(ctx context.Context, rec *idempotency.Record) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status = $1, response_status = $2, response_content_type = $3, response_body = $4, completed_at = $5
+		WHERE id = $6 AND status = 'processing' AND created_at = $7`,
+		string(rec.Status), rec.ResponseStatus, nullString(rec.ResponseContentType), rec.ResponseBody, rec.CompletedAt,
+		rec.ID, rec.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// Release deletes a claim so the key can be used again; pgx.ErrNoRows means it is no longer held
+func (r *idempotencyRepository) Release(ctx context.Context, rec *idempotency.Record) error {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE id = $1 AND status = 'processing' AND created_at = $2`, rec.ID, rec.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteExpired deletes up to limit records that expired before the given time
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE id IN (
+			SELECT id FROM idempotency_keys
+			WHERE expires_at < $1
+			ORDER BY expires_at
+			LIMIT $2)`, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
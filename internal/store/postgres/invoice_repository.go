@@ -0,0 +1,351 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier is the subset of pgxpool.Pool and pgx.Tx shared by pooled and transactional repositories
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// invoiceRepository implements InvoiceRepository on a pool or inside a transaction
+type invoiceRepository struct {
+	db querier
+}
+
+// NewInvoiceRepository creates a new invoice repository
+func NewInvoiceRepository(db *pgxpool.Pool) *invoiceRepository {
+	return &invoiceRepository{db: db}
+}
+
+const invoiceColumns = `id, tenant_id, reference, customer_ref, customer_msisdn_hash, description, amount_due,
+	amount_paid, currency, due_date, status, created_at, updated_at, cancelled_at`
+
+// Save saves an invoice (insert or update)
+func (r *invoiceRepository) Save(ctx context.Context, inv *invoice.Invoice) error {
+	if inv.ID == 0 {
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO invoices (tenant_id, reference, customer_ref, customer_msisdn_hash, description, amount_due,
+			                      amount_paid, currency, due_date, status, created_at, updated_at, cancelled_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`,
+			inv.TenantID, inv.Reference, nullString(inv.CustomerRef), nullString(inv.CustomerMSISDNHash), nullString(inv.Description),
+			int64(inv.AmountDue), int64(inv.AmountPaid), string(inv.Currency), inv.DueDate,
+			string(inv.Status), inv.CreatedAt, inv.UpdatedAt, inv.CancelledAt).Scan(&inv.ID)
+		if isUniqueViolation(err) {
+			return repositories.ErrDuplicate
+		}
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE invoices
+		SET customer_ref = $1, customer_msisdn_hash = $2, description = $3, amount_due = $4, amount_paid = $5,
+		    currency = $6, due_date = $7, status = $8, updated_at = $9, cancelled_at = $10
+		WHERE id = $11`,
+		nullString(inv.CustomerRef), nullString(inv.CustomerMSISDNHash), nullString(inv.Description), int64(inv.AmountDue), int64(inv.AmountPaid),
+		string(inv.Currency), inv.DueDate, string(inv.Status), inv.UpdatedAt, inv.CancelledAt, inv.ID)
+	return err
+}
+
+// FindByID finds an invoice by ID
+func (r *invoiceRepository) FindByID(ctx context.Context, id int64) (*invoice.Invoice, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE id = $1`, id)
+	return scanInvoice(row)
+}
+
+// LockByID finds an invoice by ID and locks it for the rest of the transaction
+func (r *invoiceRepository) LockByID(ctx context.Context, id int64) (*invoice.Invoice, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE id = $1 FOR UPDATE`, id)
+	return scanInvoice(row)
+}
+
+// FindByTenantID lists a tenant's invoices, optionally filtered by status and customer
+func (r *invoiceRepository) FindByTenantID(ctx context.Context, tenantID int64, filter repositories.InvoiceFilter, limit, offset int) ([]*invoice.Invoice, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+invoiceColumns+`
+		FROM invoices
+		WHERE tenant_id = $1
+		  AND ($2 = '' OR status = $2)
+		  AND ($3 = '' OR customer_ref = $3)
+		ORDER BY created_at DESC
+		LIMIT $4 OFFSET $5`,
+		tenantID, string(filter.Status), invoice.NormalizeReference(filter.CustomerRef), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []*invoice.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
+
+// FindPayableByReference locks the invoice that payments with this reference should go to
+func (r *invoiceRepository) FindPayableByReference(ctx context.Context, tenantID int64, reference string) (*invoice.Invoice, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+invoiceColumns+`
+		FROM invoices
+		WHERE tenant_id = $1 AND reference = $2 AND status IN ('open', 'partially_paid')
+		ORDER BY created_at ASC
+		LIMIT 1
+		FOR UPDATE`, tenantID, invoice.NormalizeReference(reference))
+	return scanInvoice(row)
+}
+
+// FindPayable lists a tenant's open and partially paid invoices, newest first, for fuzzy matching
+func (r *invoiceRepository) FindPayable(ctx context.Context, tenantID int64, limit int) ([]*invoice.Invoice, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+invoiceColumns+`
+		FROM invoices
+		WHERE tenant_id = $1 AND status IN ('open', 'partially_paid')
+		ORDER BY created_at DESC
+		LIMIT $2`, tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []*invoice.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
+
+// SaveAllocation records a payment against an invoice; a payment is allocated to an invoice at most once
+func (r *invoiceRepository) SaveAllocation(ctx context.Context, alloc *invoice.Allocation) (bool, error) {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO invoice_payments (invoice_id, payment_id, amount, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (payment_id, invoice_id) DO NOTHING
+		RETURNING id`,
+		alloc.InvoiceID, alloc.PaymentID, int64(alloc.Amount), alloc.CreatedAt).Scan(&alloc.ID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FindAllocationsByInvoiceID lists the payments applied to an invoice
+func (r *invoiceRepository) FindAllocationsByInvoiceID(ctx context.Context, invoiceID int64) ([]*invoice.Allocation, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, invoice_id, payment_id, amount, created_at
+		FROM invoice_payments
+		WHERE invoice_id = $1
+		ORDER BY created_at ASC`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []*invoice.Allocation
+	for rows.Next() {
+		var a invoice.Allocation
+		if err := rows.Scan(&a.ID, &a.InvoiceID, &a.PaymentID, &a.Amount, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, &a)
+	}
+	return allocations, rows.Err()
+}
+
+// SaveLedgerEntry appends an entry to an invoice's ledger
+func (r *invoiceRepository) SaveLedgerEntry(ctx context.Context, entry *invoice.LedgerEntry) error {
+	return r.db.QueryRow(ctx, `
+		INSERT INTO invoice_ledger_entries (tenant_id, invoice_id, entry_type, amount, balance_after,
+		                                    payment_id, credit_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		entry.TenantID, entry.InvoiceID, string(entry.Type), int64(entry.Amount), int64(entry.BalanceAfter),
+		entry.PaymentID, entry.CreditID, entry.CreatedAt).Scan(&entry.ID)
+}
+
+// FindLedgerByInvoiceID lists an invoice's ledger in the order it was written
+func (r *invoiceRepository) FindLedgerByInvoiceID(ctx context.Context, invoiceID int64) ([]*invoice.LedgerEntry, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, tenant_id, invoice_id, entry_type, amount, balance_after, payment_id, credit_id, created_at
+		FROM invoice_ledger_entries
+		WHERE invoice_id = $1
+		ORDER BY id ASC`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*invoice.LedgerEntry
+	for rows.Next() {
+		var e invoice.LedgerEntry
+		var paymentID, creditID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.TenantID, &e.InvoiceID, &e.Type, &e.Amount, &e.BalanceAfter,
+			&paymentID, &creditID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if paymentID.Valid {
+			e.PaymentID = &paymentID.Int64
+		}
+		if creditID.Valid {
+			e.CreditID = &creditID.Int64
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// scanInvoice scans a single row into invoice domain object
+func scanInvoice(row pgx.Row) (*invoice.Invoice, error) {
+	var inv invoice.Invoice
+	var customerRef, msisdnHash, description sql.NullString
+	var dueDate, cancelledAt sql.NullTime
+
+	err := row.Scan(
+		&inv.ID, &inv.TenantID, &inv.Reference, &customerRef, &msisdnHash, &description, &inv.AmountDue,
+		&inv.AmountPaid, &inv.Currency, &dueDate, &inv.Status, &inv.CreatedAt, &inv.UpdatedAt, &cancelledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.CustomerRef = customerRef.String
+	inv.CustomerMSISDNHash = msisdnHash.String
+	inv.Description = description.String
+	if dueDate.Valid {
+		inv.DueDate = &dueDate.Time
+	}
+	if cancelledAt.Valid {
+		inv.CancelledAt = &cancelledAt.Time
+	}
+	return &inv, nil
+}
+
+// creditRepository implements CreditRepository on a pool or inside a transaction
+type creditRepository struct {
+	db querier
+}
+
+// NewCreditRepository creates a new customer credit repository
+func NewCreditRepository(db *pgxpool.Pool) *creditRepository {
+	return &creditRepository{db: db}
+}
+
+const creditColumns = `id, tenant_id, customer_ref, source_invoice_id, source_payment_id, amount, remaining,
+	currency, status, created_at, updated_at`
+
+// Save saves a credit (insert or update)
+func (r *creditRepository) Save(ctx context.Context, c *invoice.Credit) error {
+	if c.ID == 0 {
+		return r.db.QueryRow(ctx, `
+			INSERT INTO customer_credits (tenant_id, customer_ref, source_invoice_id, source_payment_id,
+			                              amount, remaining, currency, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id`,
+			c.TenantID, nullString(c.CustomerRef), c.SourceInvoiceID, c.SourcePaymentID, int64(c.Amount),
+			int64(c.Remaining), string(c.Currency), string(c.Status), c.CreatedAt, c.UpdatedAt).Scan(&c.ID)
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE customer_credits
+		SET remaining = $1, status = $2, updated_at = $3
+		WHERE id = $4`,
+		int64(c.Remaining), string(c.Status), c.UpdatedAt, c.ID)
+	return err
+}
+
+// LockByID finds a credit by ID and locks it for the rest of the transaction
+func (r *creditRepository) LockByID(ctx context.Context, id int64) (*invoice.Credit, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+creditColumns+` FROM customer_credits WHERE id = $1 FOR UPDATE`, id)
+	return scanCredit(row)
+}
+
+// LockAvailableByCustomer locks a customer's unused credits, oldest first
+func (r *creditRepository) LockAvailableByCustomer(ctx context.Context, tenantID int64, customerRef string) ([]*invoice.Credit, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+creditColumns+`
+		FROM customer_credits
+		WHERE tenant_id = $1 AND customer_ref = $2 AND status = 'available'
+		ORDER BY created_at ASC
+		FOR UPDATE`, tenantID, invoice.NormalizeReference(customerRef))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCredits(rows)
+}
+
+// FindByTenantID lists a tenant's credits, optionally filtered by customer and status
+func (r *creditRepository) FindByTenantID(ctx context.Context, tenantID int64, customerRef string, status invoice.CreditStatus, limit, offset int) ([]*invoice.Credit, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+creditColumns+`
+		FROM customer_credits
+		WHERE tenant_id = $1
+		  AND ($2 = '' OR customer_ref = $2)
+		  AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC
+		LIMIT $4 OFFSET $5`,
+		tenantID, invoice.NormalizeReference(customerRef), string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCredits(rows)
+}
+
+// scanCredit scans a single row into credit domain object
+func scanCredit(row pgx.Row) (*invoice.Credit, error) {
+	var c invoice.Credit
+	var customerRef sql.NullString
+
+	err := row.Scan(&c.ID, &c.TenantID, &customerRef, &c.SourceInvoiceID, &c.SourcePaymentID, &c.Amount,
+		&c.Remaining, &c.Currency, &c.Status, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.CustomerRef = customerRef.String
+	return &c, nil
+}
+
+// scanCredits scans multiple rows into credit domain objects
+func scanCredits(rows pgx.Rows) ([]*invoice.Credit, error) {
+	var credits []*invoice.Credit
+	for rows.Next() {
+		c, err := scanCredit(rows)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, c)
+	}
+	return credits, rows.Err()
+}
@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"paymatch/internal/domain/matching"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// matchingRulesRepository implements MatchingRulesRepository on a pool or inside a transaction
+type matchingRulesRepository struct {
+	db querier
+}
+
+// NewMatchingRulesRepository creates a new matching rules repository
+func NewMatchingRulesRepository(db *pgxpool.Pool) *matchingRulesRepository {
+	return &matchingRulesRepository{db: db}
+}
+
+const matchingRulesColumns = `id, tenant_id, provider_credential_id, normalizers, max_edit_distance,
+	amount_phone_fallback, auto_match_threshold, review_threshold, created_at, updated_at`
+
+// Save upserts a rule set; there is one per tenant plus one per overridden credential
+func (r *matchingRulesRepository) Save(ctx context.Context, rules *matching.Rules) error {
+	normalizers := make([]string, len(rules.Normalizers))
+	for i, n := range rules.Normalizers {
+		normalizers[i] = string(n)
+	}
+
+	return r.db.QueryRow(ctx, `
+		INSERT INTO matching_rules (tenant_id, provider_credential_id, normalizers, max_edit_distance,
+		                            amount_phone_fallback, auto_match_threshold, review_threshold, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (tenant_id, (COALESCE(provider_credential_id, 0))) DO UPDATE SET
+		    normalizers = EXCLUDED.normalizers,
+		    max_edit_distance = EXCLUDED.max_edit_distance,
+		    amount_phone_fallback = EXCLUDED.amount_phone_fallback,
+		    auto_match_threshold = EXCLUDED.auto_match_threshold,
+		    review_threshold = EXCLUDED.review_threshold,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at`,
+		rules.TenantID, rules.CredentialID, normalizers, rules.MaxEditDistance, rules.AmountPhoneFallback,
+		rules.AutoMatchThreshold, rules.ReviewThreshold, rules.CreatedAt, rules.UpdatedAt).Scan(&rules.ID, &rules.CreatedAt)
+}
+
+// FindEffective returns the credential's rules, falling back to the tenant default
+func (r *matchingRulesRepository) FindEffective(ctx context.Context, tenantID, credentialID int64) (*matching.Rules, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+matchingRulesColumns+`
+		FROM matching_rules
+		WHERE tenant_id = $1 AND (provider_credential_id = $2 OR provider_credential_id IS NULL)
+		ORDER BY provider_credential_id NULLS LAST
+		LIMIT 1`, tenantID, credentialID)
+	return scanMatchingRules(row)
+}
+
+// FindByTenantID lists the tenant default and any per-credential overrides
+func (r *matchingRulesRepository) FindByTenantID(ctx context.Context, tenantID int64) ([]*matching.Rules, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+matchingRulesColumns+`
+		FROM matching_rules
+		WHERE tenant_id = $1
+		ORDER BY provider_credential_id NULLS FIRST`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*matching.Rules
+	for rows.Next() {
+		rules, err := scanMatchingRules(rows)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, rules)
+	}
+	return all, rows.Err()
+}
+
+// scanMatchingRules scans a single row into a rule set
+func scanMatchingRules(row pgx.Row) (*matching.Rules, error) {
+	var rules matching.Rules
+	var credentialID sql.NullInt64
+	var normalizers []string
+
+	err := row.Scan(&rules.ID, &rules.TenantID, &credentialID, &normalizers, &rules.MaxEditDistance,
+		&rules.AmountPhoneFallback, &rules.AutoMatchThreshold, &rules.ReviewThreshold, &rules.CreatedAt, &rules.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if credentialID.Valid {
+		rules.CredentialID = &credentialID.Int64
+	}
+	for _, n := range normalizers {
+		rules.Normalizers = append(rules.Normalizers, matching.Normalizer(n))
+	}
+	return &rules, nil
+}
+
+// matchReviewRepository implements MatchReviewRepository on a pool or inside a transaction
+type matchReviewRepository struct {
+	db querier
+}
+
+// NewMatchReviewRepository creates a new match review repository
+func NewMatchReviewRepository(db *pgxpool.Pool) *matchReviewRepository {
+	return &matchReviewRepository{db: db}
+}
+
+const matchReviewColumns = `id, tenant_id, payment_id, invoice_id, confidence, method, ambiguous, status,
+	created_at, resolved_at`
+
+// Save saves a review; a payment has at most one pending review
+func (r *matchReviewRepository) Save(ctx context.Context, review *matching.Review) error {
+	if review.ID == 0 {
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO match_reviews (tenant_id, payment_id, invoice_id, confidence, method, ambiguous, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (payment_id) WHERE status = 'pending' DO NOTHING
+			RETURNING id`,
+			review.TenantID, review.PaymentID, review.InvoiceID, review.Confidence, string(review.Method),
+			review.Ambiguous, string(review.Status), review.CreatedAt).Scan(&review.ID)
+		if err == pgx.ErrNoRows {
+			return nil // already queued
+		}
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE match_reviews
+		SET status = $1, resolved_at = $2
+		WHERE id = $3`,
+		string(review.Status), review.ResolvedAt, review.ID)
+	return err
+}
+
+// LockByID finds a review by ID and locks it for the rest of the transaction
+func (r *matchReviewRepository) LockByID(ctx context.Context, id int64) (*matching.Review, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+matchReviewColumns+` FROM match_reviews WHERE id = $1 FOR UPDATE`, id)
+	return scanMatchReview(row)
+}
+
+// SupersedePending closes any pending review for a payment that was reconciled another way
+func (r *matchReviewRepository) SupersedePending(ctx context.Context, paymentID int64) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE match_reviews
+		SET status = 'superseded', resolved_at = now()
+		WHERE payment_id = $1 AND status = 'pending'`, paymentID)
+	return err
+}
+
+// FindByTenantID lists a tenant's reviews, optionally filtered by status
+func (r *matchReviewRepository) FindByTenantID(ctx context.Context, tenantID int64, status matching.ReviewStatus, limit, offset int) ([]*matching.Review, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+matchReviewColumns+`
+		FROM match_reviews
+		WHERE tenant_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`, tenantID, string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []*matching.Review
+	for rows.Next() {
+		review, err := scanMatchReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// scanMatchReview scans a single row into a review
+func scanMatchReview(row pgx.Row) (*matching.Review, error) {
+	var review matching.Review
+	var resolvedAt sql.NullTime
+
+	err := row.Scan(&review.ID, &review.TenantID, &review.PaymentID, &review.InvoiceID, &review.Confidence,
+		&review.Method, &review.Ambiguous, &review.Status, &review.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolvedAt.Valid {
+		review.ResolvedAt = &resolvedAt.Time
+	}
+	return &review, nil
+}
@@ -0,0 +1,8 @@
+-- 007_event_ingestion.sql
+-- Webhooks are now persisted before processing; the event repositories already
+-- maintain updated_at on payment_events, so make sure the column exists.
+
+ALTER TABLE payment_events
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+COMMENT ON COLUMN payment_events.updated_at IS 'Last time the event row or its processing status changed';
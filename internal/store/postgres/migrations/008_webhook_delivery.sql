@@ -0,0 +1,23 @@
+-- 008_webhook_delivery.sql
+-- Outbound merchant webhooks: per-tenant endpoints and delivery bookkeeping on event_queue
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  url TEXT NOT NULL,
+  is_active BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (tenant_id)
+);
+
+ALTER TABLE event_queue
+ADD COLUMN IF NOT EXISTS last_status_code INT,
+ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMPTZ;
+
+-- status is now pending|delivering|done|failed|dead; 'dead' rows are retained for redelivery
+CREATE INDEX IF NOT EXISTS idx_event_queue_tenant_status
+  ON event_queue(tenant_id, status, updated_at);
+
+COMMENT ON TABLE webhook_endpoints IS 'Tenant URLs that receive normalized payment notifications';
+COMMENT ON COLUMN event_queue.status IS 'pending|delivering|done|failed (retry scheduled)|dead (retries exhausted)';
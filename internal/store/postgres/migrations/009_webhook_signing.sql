@@ -0,0 +1,10 @@
+-- 009_webhook_signing.sql
+-- Per-tenant HMAC signing secrets for outbound webhooks (AES-GCM encrypted, like provider credentials)
+
+ALTER TABLE webhook_endpoints
+ADD COLUMN IF NOT EXISTS signing_secret_enc TEXT,
+ADD COLUMN IF NOT EXISTS previous_secret_enc TEXT,
+ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMPTZ,
+ADD COLUMN IF NOT EXISTS secret_rotated_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN webhook_endpoints.previous_secret_enc IS 'Secret replaced by the last rotation; still signed with until previous_secret_expires_at';
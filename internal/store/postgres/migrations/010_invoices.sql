@@ -0,0 +1,34 @@
+-- 010_invoices.sql
+-- Invoice registry and payment-to-invoice allocations
+
+CREATE TABLE IF NOT EXISTS invoices (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  reference TEXT NOT NULL,                          -- normalized (trimmed, upper-case)
+  description TEXT,
+  amount_due BIGINT NOT NULL CHECK (amount_due > 0),
+  amount_paid BIGINT NOT NULL DEFAULT 0,
+  currency TEXT NOT NULL DEFAULT 'KES',
+  due_date DATE,
+  status TEXT NOT NULL DEFAULT 'open',              -- open|partially_paid|paid|overpaid|cancelled
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  cancelled_at TIMESTAMPTZ
+);
+
+-- A reference identifies at most one live invoice per tenant; cancelled ones may be reissued
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_tenant_reference_live
+  ON invoices(tenant_id, reference) WHERE status <> 'cancelled';
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_status ON invoices(tenant_id, status, created_at);
+
+CREATE TABLE IF NOT EXISTS invoice_payments (
+  id BIGSERIAL PRIMARY KEY,
+  invoice_id BIGINT NOT NULL REFERENCES invoices(id),
+  payment_id BIGINT NOT NULL REFERENCES payments(id),
+  amount BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (payment_id)
+);
+CREATE INDEX IF NOT EXISTS idx_invoice_payments_invoice ON invoice_payments(invoice_id);
+
+COMMENT ON TABLE invoice_payments IS 'Payments applied to invoices by the matcher';
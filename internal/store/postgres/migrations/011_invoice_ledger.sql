@@ -0,0 +1,36 @@
+-- 011_invoice_ledger.sql
+-- Running balance ledger per invoice and customer credits from overpayments
+
+ALTER TABLE invoices
+ADD COLUMN IF NOT EXISTS customer_ref TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_customer ON invoices(tenant_id, customer_ref)
+  WHERE customer_ref IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS customer_credits (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  customer_ref TEXT,
+  source_invoice_id BIGINT NOT NULL REFERENCES invoices(id),
+  source_payment_id BIGINT NOT NULL REFERENCES payments(id),
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  remaining BIGINT NOT NULL CHECK (remaining >= 0),
+  currency TEXT NOT NULL DEFAULT 'KES',
+  status TEXT NOT NULL DEFAULT 'available',         -- available|consumed
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_customer_credits_customer ON customer_credits(tenant_id, customer_ref, status);
+
+CREATE TABLE IF NOT EXISTS invoice_ledger_entries (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  invoice_id BIGINT NOT NULL REFERENCES invoices(id),
+  entry_type TEXT NOT NULL,                         -- charge|payment|credit
+  amount BIGINT NOT NULL,                           -- positive increases what is owed
+  balance_after BIGINT NOT NULL,                    -- negative when overpaid
+  payment_id BIGINT REFERENCES payments(id),
+  credit_id BIGINT REFERENCES customer_credits(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_invoice_ledger_invoice ON invoice_ledger_entries(invoice_id, id);
@@ -0,0 +1,39 @@
+-- 012_matching_rules.sql
+-- Fuzzy bill-reference matching rules and the low-confidence review queue
+
+ALTER TABLE invoices
+ADD COLUMN IF NOT EXISTS customer_msisdn_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_payable ON invoices(tenant_id, created_at)
+  WHERE status IN ('open', 'partially_paid');
+
+CREATE TABLE IF NOT EXISTS matching_rules (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  provider_credential_id BIGINT REFERENCES provider_credentials(id), -- NULL = tenant default
+  normalizers TEXT[] NOT NULL DEFAULT '{}',
+  max_edit_distance INT NOT NULL DEFAULT 1 CHECK (max_edit_distance BETWEEN 0 AND 3),
+  amount_phone_fallback BOOLEAN NOT NULL DEFAULT false,
+  auto_match_threshold DOUBLE PRECISION NOT NULL DEFAULT 0.9,
+  review_threshold DOUBLE PRECISION NOT NULL DEFAULT 0.5,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_matching_rules_scope
+  ON matching_rules(tenant_id, (COALESCE(provider_credential_id, 0)));
+
+CREATE TABLE IF NOT EXISTS match_reviews (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  payment_id BIGINT NOT NULL REFERENCES payments(id),
+  invoice_id BIGINT NOT NULL REFERENCES invoices(id),   -- suggested invoice
+  confidence DOUBLE PRECISION NOT NULL,
+  method TEXT NOT NULL,                                 -- normalized|fuzzy|amount_phone
+  ambiguous BOOLEAN NOT NULL DEFAULT false,
+  status TEXT NOT NULL DEFAULT 'pending',               -- pending|accepted|rejected
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  resolved_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_match_reviews_pending_payment
+  ON match_reviews(payment_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_match_reviews_tenant_status ON match_reviews(tenant_id, status, created_at);
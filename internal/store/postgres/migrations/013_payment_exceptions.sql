@@ -0,0 +1,25 @@
+-- 013_payment_exceptions.sql
+-- Manual reconciliation of unmatched payments with an operator audit trail
+
+-- A payment may now be split across several invoices, but still only once per invoice
+ALTER TABLE invoice_payments DROP CONSTRAINT IF EXISTS invoice_payments_payment_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_payments_payment_invoice
+  ON invoice_payments(payment_id, invoice_id);
+
+CREATE INDEX IF NOT EXISTS idx_payments_tenant_exceptions ON payments(tenant_id, created_at)
+  WHERE status IN ('completed', 'refund_candidate');
+
+CREATE TABLE IF NOT EXISTS payment_audit (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  payment_id BIGINT NOT NULL REFERENCES payments(id),
+  action TEXT NOT NULL,                 -- manual_match|split|refund_candidate
+  actor TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  splits JSONB NOT NULL DEFAULT '[]',   -- [{"InvoiceID":1,"Amount":500}]
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_payment_audit_payment ON payment_audit(payment_id, id);
+CREATE INDEX IF NOT EXISTS idx_payment_audit_tenant ON payment_audit(tenant_id, created_at);
+
+COMMENT ON TABLE payment_audit IS 'Operator actions on payments the matcher could not reconcile';
@@ -0,0 +1,30 @@
+-- 014_payouts.sql
+-- Outgoing B2C payouts and their provider results
+
+CREATE TABLE IF NOT EXISTS payouts (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  provider_credential_id BIGINT NOT NULL REFERENCES provider_credentials(id),
+  external_id TEXT,                     -- provider conversation ID, set once the request is queued
+  originator_conversation_id TEXT,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  currency TEXT NOT NULL DEFAULT 'KES',
+  msisdn_hash TEXT NOT NULL,
+  command_id TEXT NOT NULL,
+  remarks TEXT,
+  occasion TEXT,
+  status TEXT NOT NULL DEFAULT 'pending', -- pending|completed|failed|timed_out
+  result_desc TEXT,
+  receipt_number TEXT,
+  receiver_name TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payouts_external
+  ON payouts(tenant_id, external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payouts_originator
+  ON payouts(tenant_id, originator_conversation_id) WHERE originator_conversation_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payouts_tenant ON payouts(tenant_id, created_at);
+
+COMMENT ON TABLE payouts IS 'B2C transfers initiated by tenants; result callbacks settle them';
@@ -0,0 +1,45 @@
+-- 015_payout_batches.sql
+-- Bulk disbursement: batches of payouts sent as individual, rate-limited B2C calls
+
+CREATE TABLE IF NOT EXISTS payout_batches (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  provider_credential_id BIGINT NOT NULL REFERENCES provider_credentials(id),
+  reference TEXT,                         -- tenant's own batch identifier
+  command_id TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'processing', -- processing|completed|cancelled
+  item_count INT NOT NULL,
+  total_amount BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payout_batches_reference
+  ON payout_batches(tenant_id, reference) WHERE reference IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payout_batches_tenant ON payout_batches(tenant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS payout_batch_items (
+  id BIGSERIAL PRIMARY KEY,
+  batch_id BIGINT NOT NULL REFERENCES payout_batches(id),
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  line INT NOT NULL,
+  phone_enc TEXT NOT NULL,                -- AES-GCM encrypted, needed to resume after a restart
+  msisdn_hash TEXT NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  reference TEXT,
+  description TEXT,
+  status TEXT NOT NULL DEFAULT 'queued',  -- queued|sending|submitted|rejected|unknown|cancelled
+  payout_id BIGINT REFERENCES payouts(id),
+  error TEXT,
+  attempts INT NOT NULL DEFAULT 0,
+  sending_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (batch_id, line)
+);
+CREATE INDEX IF NOT EXISTS idx_payout_batch_items_queued ON payout_batch_items(batch_id, line)
+  WHERE status IN ('queued', 'sending');
+
+ALTER TABLE payouts
+ADD COLUMN IF NOT EXISTS batch_id BIGINT REFERENCES payout_batches(id);
+
+COMMENT ON TABLE payout_batch_items IS 'One row per payout in a batch; submitted items link to the payout carrying the result';
@@ -0,0 +1,47 @@
+-- 016_payout_approvals.sql
+-- Maker-checker approvals: payouts and batches above a tenant's thresholds wait for other users to approve
+
+CREATE TABLE IF NOT EXISTS approval_policies (
+  tenant_id BIGINT PRIMARY KEY REFERENCES tenants(id),
+  tiers JSONB NOT NULL DEFAULT '[]',      -- [{"MinAmount":1,"Approvals":1},{"MinAmount":100000,"Approvals":2}]
+  expiry_hours INT NOT NULL DEFAULT 24,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS payout_approvals (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  subject TEXT NOT NULL,                  -- payout|batch
+  subject_id BIGINT NOT NULL,
+  amount BIGINT NOT NULL,
+  required INT NOT NULL,
+  requested_by TEXT NOT NULL,
+  approved_by TEXT[] NOT NULL DEFAULT '{}',
+  status TEXT NOT NULL DEFAULT 'pending', -- pending|approved|rejected|expired|cancelled
+  reason TEXT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  decided_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payout_approvals_subject
+  ON payout_approvals(subject, subject_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_payout_approvals_tenant ON payout_approvals(tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_payout_approvals_expiry ON payout_approvals(expires_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS payout_approval_audit (
+  id BIGSERIAL PRIMARY KEY,
+  approval_id BIGINT NOT NULL REFERENCES payout_approvals(id),
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  action TEXT NOT NULL,                   -- requested|approved|rejected|expired|cancelled|released
+  actor TEXT NOT NULL,
+  reason TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_payout_approval_audit_approval ON payout_approval_audit(approval_id, id);
+
+-- Payouts held for approval keep the encrypted number until they are sent
+ALTER TABLE payouts
+ADD COLUMN IF NOT EXISTS phone_enc TEXT;
+
+COMMENT ON TABLE payout_approval_audit IS 'Every request, decision and release of a payout approval';
@@ -0,0 +1,31 @@
+-- 017_payment_reversals.sql
+-- Provider reversals that return a completed payment to the payer
+
+CREATE TABLE IF NOT EXISTS payment_reversals (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  payment_id BIGINT NOT NULL REFERENCES payments(id),
+  provider_credential_id BIGINT NOT NULL REFERENCES provider_credentials(id),
+  transaction_id TEXT NOT NULL,           -- provider receipt of the payment being reversed
+  external_id TEXT,                       -- provider conversation ID
+  originator_conversation_id TEXT,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  remarks TEXT,
+  requested_by TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending', -- pending|completed|failed|timed_out
+  result_desc TEXT,
+  receipt_number TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+-- One reversal in flight per payment; a failed one may be retried
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_reversals_active
+  ON payment_reversals(payment_id) WHERE status IN ('pending', 'timed_out', 'completed');
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_reversals_external
+  ON payment_reversals(tenant_id, external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payment_reversals_originator
+  ON payment_reversals(tenant_id, originator_conversation_id) WHERE originator_conversation_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payment_reversals_tenant ON payment_reversals(tenant_id, created_at);
+
+COMMENT ON TABLE payment_reversals IS 'Reversals of completed payments; result callbacks settle them and mark the payment reversed';
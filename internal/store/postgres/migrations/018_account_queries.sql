@@ -0,0 +1,34 @@
+-- 018_account_queries.sql
+-- Balance and transaction status queries answered asynchronously, and the latest balance per credential
+
+CREATE TABLE IF NOT EXISTS account_queries (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  provider_credential_id BIGINT NOT NULL REFERENCES provider_credentials(id),
+  kind TEXT NOT NULL,                     -- balance|transaction_status
+  transaction_id TEXT,                    -- the transaction a status query looks up
+  external_id TEXT,                       -- provider conversation ID
+  originator_conversation_id TEXT,
+  status TEXT NOT NULL DEFAULT 'pending', -- pending|completed|failed|timed_out
+  result_desc TEXT,
+  result JSONB NOT NULL DEFAULT '{}',     -- result parameters as reported by the provider
+  accounts JSONB NOT NULL DEFAULT '[]',   -- parsed balances of a balance query
+  requested_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_queries_external
+  ON account_queries(tenant_id, external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_account_queries_originator
+  ON account_queries(tenant_id, originator_conversation_id) WHERE originator_conversation_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_account_queries_tenant ON account_queries(tenant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS credential_balances (
+  provider_credential_id BIGINT PRIMARY KEY REFERENCES provider_credentials(id),
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  query_id BIGINT NOT NULL REFERENCES account_queries(id),
+  accounts JSONB NOT NULL DEFAULT '[]',
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_credential_balances_tenant ON credential_balances(tenant_id);
@@ -0,0 +1,10 @@
+-- 019_provider_tokens.sql
+-- Provider OAuth tokens shared between API replicas, encrypted with the service AES key
+
+CREATE TABLE IF NOT EXISTS provider_tokens (
+  token_key TEXT PRIMARY KEY,
+  token_enc TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  refresh_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+-- 020_payment_failures.sql
+-- Why a payment did not complete, as a standard provider error code and the provider's description
+
+ALTER TABLE payments
+ADD COLUMN IF NOT EXISTS failure_code TEXT,
+ADD COLUMN IF NOT EXISTS failure_reason TEXT;
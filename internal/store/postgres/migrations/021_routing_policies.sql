@@ -0,0 +1,9 @@
+-- 021_routing_policies.sql
+-- Per-tenant rules for choosing the credential that collects a payment
+
+CREATE TABLE IF NOT EXISTS routing_policies (
+  tenant_id BIGINT PRIMARY KEY REFERENCES tenants(id),
+  preferred_providers TEXT[] NOT NULL DEFAULT '{}', -- tried in this order
+  rules JSONB NOT NULL DEFAULT '[]',                -- [{"CredentialID":1,"Networks":["safaricom"],"Weight":70}]
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,18 @@
+-- 022_idempotency_keys.sql
+-- Idempotency-Key headers on payment-initiating requests, kept with the response for replay
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  key TEXT NOT NULL,
+  fingerprint TEXT NOT NULL,                -- sha256 of method, path and body
+  status TEXT NOT NULL DEFAULT 'processing', -- processing|completed
+  response_status INT,
+  response_content_type TEXT,
+  response_body BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ NOT NULL,
+  UNIQUE (tenant_id, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expiry ON idempotency_keys(expires_at);
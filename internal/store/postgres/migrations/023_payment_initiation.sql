@@ -0,0 +1,6 @@
+-- 023_payment_initiation.sql
+-- STK pushes are recorded as pending payments when they are sent, with the caller's metadata
+
+ALTER TABLE payments
+ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS initiated_by TEXT;
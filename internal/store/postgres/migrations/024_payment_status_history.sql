@@ -0,0 +1,19 @@
+-- 024_payment_status_history.sql
+-- Every payment status change, with the provider event that caused it
+
+CREATE TABLE IF NOT EXISTS payment_status_history (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id),
+  payment_id BIGINT NOT NULL REFERENCES payments(id),
+  from_status TEXT,                              -- NULL for the status the payment was created with
+  to_status TEXT NOT NULL,
+  event_id BIGINT REFERENCES payment_events(id), -- NULL for operator actions and sweeps
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_payment_status_history_payment ON payment_status_history(payment_id, id);
+
+-- The sweeper now also follows payments the provider reports as in progress
+CREATE INDEX IF NOT EXISTS idx_payments_unsettled ON payments(created_at)
+  WHERE status IN ('pending', 'processing');
+
+COMMENT ON TABLE payment_status_history IS 'Append-only log of payment status transitions';
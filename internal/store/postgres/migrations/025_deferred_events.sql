@@ -0,0 +1,6 @@
+-- 025_deferred_events.sql
+-- Lets the worker find events deferred until the request they refer to is recorded
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_deferred
+  ON payment_events(processed_at)
+  WHERE processing_status = 'deferred';
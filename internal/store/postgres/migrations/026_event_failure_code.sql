@@ -0,0 +1,7 @@
+-- 026_event_failure_code.sql
+-- Stores the standard provider error code the webhook parser derived for a failed callback
+
+ALTER TABLE payment_events
+ADD COLUMN IF NOT EXISTS failure_code TEXT;
+
+COMMENT ON COLUMN payment_events.failure_code IS 'Standard provider error code when the callback reports a failure';
@@ -3,6 +3,8 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 	
 	"paymatch/internal/domain/payment"
 	
@@ -20,18 +22,24 @@ func NewPaymentRepository(db *pgxpool.Pool) *paymentRepository {
 	return &paymentRepository{db: db}
 }
 
-// Save saves a payment (insert or update)
+// Save saves a payment (insert or update) together with its status history
 func (r *paymentRepository) Save(ctx context.Context, p *payment.Payment) error {
-	if p.ID == 0 {
-		return r.insert(ctx, p)
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := (&transactionalPaymentRepository{tx: tx}).Save(ctx, p); err != nil {
+		return err
 	}
-	return r.update(ctx, p)
+	return tx.Commit(ctx)
 }
 
 // FindByID finds a payment by ID
 func (r *paymentRepository) FindByID(ctx context.Context, id int64) (*payment.Payment, error) {
 	row := r.db.QueryRow(ctx, `
-		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
 		FROM payments 
 		WHERE id = $1`, id)
 	
@@ -41,7 +49,7 @@ func (r *paymentRepository) FindByID(ctx context.Context, id int64) (*payment.Pa
 // FindByExternalID finds a payment by external ID and tenant
 func (r *paymentRepository) FindByExternalID(ctx context.Context, tenantID int64, externalID string) (*payment.Payment, error) {
 	row := r.db.QueryRow(ctx, `
-		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
 		FROM payments 
 		WHERE tenant_id = $1 AND external_id = $2`, tenantID, externalID)
 	
@@ -51,7 +59,7 @@ func (r *paymentRepository) FindByExternalID(ctx context.Context, tenantID int64
 // FindByTenantID finds payments by tenant with pagination
 func (r *paymentRepository) FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*payment.Payment, error) {
 	rows, err := r.db.Query(ctx, `
-		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
 		FROM payments 
 		WHERE tenant_id = $1 
 		ORDER BY created_at DESC 
@@ -73,38 +81,29 @@ func (r *paymentRepository) FindByTenantID(ctx context.Context, tenantID int64,
 	return payments, rows.Err()
 }
 
-// UpdateStatus updates only the payment status
-func (r *paymentRepository) UpdateStatus(ctx context.Context, id int64, status payment.Status) error {
-	_, err := r.db.Exec(ctx, `
-		UPDATE payments 
-		SET status = $1, updated_at = now() 
-		WHERE id = $2`, string(status), id)
-	return err
-}
-
-// insert creates a new payment record
-func (r *paymentRepository) insert(ctx context.Context, p *payment.Payment) error {
-	err := r.db.QueryRow(ctx, `
-		INSERT INTO payments (tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id`,
-		p.TenantID, p.InvoiceNo, int64(p.Amount), string(p.Currency), string(p.Status), 
-		string(p.Method), p.ExternalID, p.MSISDNHash, p.CreatedAt, p.UpdatedAt).Scan(&p.ID)
+// FindPendingBefore lists pending and processing payments created before the cutoff, oldest first
+func (r *paymentRepository) FindPendingBefore(ctx context.Context, before time.Time, limit int) ([]*payment.Payment, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
+		FROM payments 
+		WHERE status IN ('pending', 'processing') AND created_at < $1
+		ORDER BY created_at 
+		LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	
-	return err
-}
-
-// update modifies an existing payment record
-func (r *paymentRepository) update(ctx context.Context, p *payment.Payment) error {
-	_, err := r.db.Exec(ctx, `
-		UPDATE payments 
-		SET invoice_no = $1, amount = $2, currency = $3, status = $4, method = $5, 
-		    external_id = $6, msisdn_hash = $7, updated_at = $8
-		WHERE id = $9`,
-		p.InvoiceNo, int64(p.Amount), string(p.Currency), string(p.Status), 
-		string(p.Method), p.ExternalID, p.MSISDNHash, p.UpdatedAt, p.ID)
+	var payments []*payment.Payment
+	for rows.Next() {
+		p, err := r.scanPaymentFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
 	
-	return err
+	return payments, rows.Err()
 }
 
 // scanPayment scans a single row into payment domain object
@@ -112,10 +111,14 @@ func (r *paymentRepository) scanPayment(row pgx.Row) (*payment.Payment, error) {
 	var p payment.Payment
 	var invoiceNo sql.NullString
 	var msisdnHash sql.NullString
+	var credentialID sql.NullInt64
+	var failureCode, failureReason, initiatedBy sql.NullString
+	var metadata []byte
 	
 	err := row.Scan(
 		&p.ID, &p.TenantID, &invoiceNo, &p.Amount, &p.Currency,
-		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &p.CreatedAt, &p.UpdatedAt)
+		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &credentialID, &failureCode, &failureReason,
+		&metadata, &initiatedBy, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +129,13 @@ func (r *paymentRepository) scanPayment(row pgx.Row) (*payment.Payment, error) {
 	if msisdnHash.Valid {
 		p.MSISDNHash = msisdnHash.String
 	}
+	p.ProviderCredentialID = credentialID.Int64
+	p.FailureCode = failureCode.String
+	p.FailureReason = failureReason.String
+	p.InitiatedBy = initiatedBy.String
+	if err := json.Unmarshal(metadata, &p.Metadata); err != nil {
+		return nil, err
+	}
 	
 	return &p, nil
 }
@@ -135,10 +145,14 @@ func (r *paymentRepository) scanPaymentFromRows(rows pgx.Rows) (*payment.Payment
 	var p payment.Payment
 	var invoiceNo sql.NullString
 	var msisdnHash sql.NullString
+	var credentialID sql.NullInt64
+	var failureCode, failureReason, initiatedBy sql.NullString
+	var metadata []byte
 	
 	err := rows.Scan(
 		&p.ID, &p.TenantID, &invoiceNo, &p.Amount, &p.Currency,
-		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &p.CreatedAt, &p.UpdatedAt)
+		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &credentialID, &failureCode, &failureReason,
+		&metadata, &initiatedBy, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +163,13 @@ func (r *paymentRepository) scanPaymentFromRows(rows pgx.Rows) (*payment.Payment
 	if msisdnHash.Valid {
 		p.MSISDNHash = msisdnHash.String
 	}
+	p.ProviderCredentialID = credentialID.Int64
+	p.FailureCode = failureCode.String
+	p.FailureReason = failureReason.String
+	p.InitiatedBy = initiatedBy.String
+	if err := json.Unmarshal(metadata, &p.Metadata); err != nil {
+		return nil, err
+	}
 	
 	return &p, nil
 }
\ No newline at end of file
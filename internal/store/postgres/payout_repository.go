@@ -0,0 +1,363 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// payoutRepository implements PayoutRepository on a pool or inside a transaction
+type payoutRepository struct {
+	db querier
+}
+
+// NewPayoutRepository creates a new payout repository
+func NewPayoutRepository(db *pgxpool.Pool) *payoutRepository {
+	return &payoutRepository{db: db}
+}
+
+const payoutColumns = `id, tenant_id, provider_credential_id, batch_id, external_id, originator_conversation_id, amount, currency,
+	msisdn_hash, phone_enc, command_id, remarks, occasion, status, result_desc, receipt_number, receiver_name,
+	created_at, updated_at, completed_at`
+
+// Save saves a payout (insert or update)
+func (r *payoutRepository) Save(ctx context.Context, p *payout.Payout) error {
+	if p.ID == 0 {
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO payouts (tenant_id, provider_credential_id, batch_id, external_id, originator_conversation_id,
+			                     amount, currency, msisdn_hash, phone_enc, command_id, remarks, occasion, status, result_desc,
+			                     receipt_number, receiver_name, created_at, updated_at, completed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+			RETURNING id`,
+			p.TenantID, p.ProviderCredentialID, p.BatchID, nullString(p.ExternalID), nullString(p.OriginatorConversationID),
+			int64(p.Amount), string(p.Currency), p.MSISDNHash, nullString(p.PhoneEnc), p.CommandID, nullString(p.Remarks), nullString(p.Occasion),
+			string(p.Status), nullString(p.ResultDesc), nullString(p.ReceiptNumber), nullString(p.ReceiverName),
+			p.CreatedAt, p.UpdatedAt, p.CompletedAt).Scan(&p.ID)
+		if isUniqueViolation(err) {
+			return repositories.ErrDuplicate
+		}
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE payouts
+		SET external_id = $1, originator_conversation_id = $2, status = $3, result_desc = $4,
+		    receipt_number = $5, receiver_name = $6, updated_at = $7, completed_at = $8, phone_enc = $9
+		WHERE id = $10`,
+		nullString(p.ExternalID), nullString(p.OriginatorConversationID), string(p.Status), nullString(p.ResultDesc),
+		nullString(p.ReceiptNumber), nullString(p.ReceiverName), p.UpdatedAt, p.CompletedAt, nullString(p.PhoneEnc), p.ID)
+	if isUniqueViolation(err) {
+		return repositories.ErrDuplicate
+	}
+	return err
+}
+
+// FindByID finds a payout by ID
+func (r *payoutRepository) FindByID(ctx context.Context, id int64) (*payout.Payout, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+payoutColumns+` FROM payouts WHERE id = $1`, id)
+	return scanPayout(row)
+}
+
+// LockByExternalID finds the payout a provider result refers to and locks it for the rest of the transaction
+func (r *payoutRepository) LockByExternalID(ctx context.Context, tenantID int64, externalID string) (*payout.Payout, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+payoutColumns+`
+		FROM payouts
+		WHERE tenant_id = $1 AND (external_id = $2 OR originator_conversation_id = $2)
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`, tenantID, externalID)
+	return scanPayout(row)
+}
+
+// FindByTenantID lists a tenant's payouts, newest first, optionally filtered by status
+func (r *payoutRepository) FindByTenantID(ctx context.Context, tenantID int64, status payout.Status, limit, offset int) ([]*payout.Payout, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+payoutColumns+`
+		FROM payouts
+		WHERE tenant_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`, tenantID, string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payouts []*payout.Payout
+	for rows.Next() {
+		p, err := scanPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, p)
+	}
+	return payouts, rows.Err()
+}
+
+// scanPayout scans a single row into payout domain object
+func scanPayout(row pgx.Row) (*payout.Payout, error) {
+	var p payout.Payout
+	var externalID, originatorID, phoneEnc, remarks, occasion, resultDesc, receipt, receiverName sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&p.ID, &p.TenantID, &p.ProviderCredentialID, &p.BatchID, &externalID, &originatorID, &p.Amount, &p.Currency,
+		&p.MSISDNHash, &phoneEnc, &p.CommandID, &remarks, &occasion, &p.Status, &resultDesc, &receipt, &receiverName,
+		&p.CreatedAt, &p.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.ExternalID = externalID.String
+	p.OriginatorConversationID = originatorID.String
+	p.PhoneEnc = phoneEnc.String
+	p.Remarks = remarks.String
+	p.Occasion = occasion.String
+	p.ResultDesc = resultDesc.String
+	p.ReceiptNumber = receipt.String
+	p.ReceiverName = receiverName.String
+	if completedAt.Valid {
+		p.CompletedAt = &completedAt.Time
+	}
+	return &p, nil
+}
+
+// payoutBatchRepository implements PayoutBatchRepository on a pool or inside a transaction
+type payoutBatchRepository struct {
+	db querier
+}
+
+// NewPayoutBatchRepository creates a new payout batch repository
+func NewPayoutBatchRepository(db *pgxpool.Pool) *payoutBatchRepository {
+	return &payoutBatchRepository{db: db}
+}
+
+const payoutBatchColumns = `id, tenant_id, provider_credential_id, reference, command_id, status, item_count,
+	total_amount, created_at, updated_at, completed_at`
+
+const batchItemColumns = `i.id, i.batch_id, i.tenant_id, i.line, i.phone_enc, i.msisdn_hash, i.amount, i.reference,
+	i.description, i.status, i.payout_id, i.error, i.attempts, i.sending_at, i.updated_at`
+
+// Save saves a batch (insert or update)
+func (r *payoutBatchRepository) Save(ctx context.Context, b *payout.Batch) error {
+	if b.ID == 0 {
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO payout_batches (tenant_id, provider_credential_id, reference, command_id, status, item_count,
+			                            total_amount, created_at, updated_at, completed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id`,
+			b.TenantID, b.ProviderCredentialID, nullString(b.Reference), b.CommandID, string(b.Status), b.ItemCount,
+			int64(b.TotalAmount), b.CreatedAt, b.UpdatedAt, b.CompletedAt).Scan(&b.ID)
+		if isUniqueViolation(err) {
+			return repositories.ErrDuplicate
+		}
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE payout_batches
+		SET status = $1, updated_at = $2, completed_at = $3
+		WHERE id = $4`,
+		string(b.Status), b.UpdatedAt, b.CompletedAt, b.ID)
+	return err
+}
+
+// SaveItem saves a batch item (insert or update)
+func (r *payoutBatchRepository) SaveItem(ctx context.Context, item *payout.BatchItem) error {
+	if item.ID == 0 {
+		return r.db.QueryRow(ctx, `
+			INSERT INTO payout_batch_items (batch_id, tenant_id, line, phone_enc, msisdn_hash, amount, reference,
+			                                description, status, payout_id, error, attempts, sending_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id`,
+			item.BatchID, item.TenantID, item.Line, item.PhoneEnc, item.MSISDNHash, int64(item.Amount),
+			nullString(item.Reference), nullString(item.Description), string(item.Status), item.PayoutID,
+			nullString(item.Error), item.Attempts, item.SendingAt, item.UpdatedAt).Scan(&item.ID)
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE payout_batch_items
+		SET status = $1, payout_id = $2, error = $3, attempts = $4, sending_at = $5, updated_at = $6
+		WHERE id = $7`,
+		string(item.Status), item.PayoutID, nullString(item.Error), item.Attempts, item.SendingAt, item.UpdatedAt, item.ID)
+	return err
+}
+
+// FindByID finds a batch by ID
+func (r *payoutBatchRepository) FindByID(ctx context.Context, id int64) (*payout.Batch, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+payoutBatchColumns+` FROM payout_batches WHERE id = $1`, id)
+	return scanPayoutBatch(row)
+}
+
+// FindByTenantID lists a tenant's batches, newest first, optionally filtered by status
+func (r *payoutBatchRepository) FindByTenantID(ctx context.Context, tenantID int64, status payout.BatchStatus, limit, offset int) ([]*payout.Batch, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+payoutBatchColumns+`
+		FROM payout_batches
+		WHERE tenant_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`, tenantID, string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []*payout.Batch
+	for rows.Next() {
+		b, err := scanPayoutBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+// FindItems lists a batch's items in upload order with the status and receipt of their payouts
+func (r *payoutBatchRepository) FindItems(ctx context.Context, batchID int64) ([]*payout.BatchItem, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+batchItemColumns+`, p.status, p.receipt_number
+		FROM payout_batch_items i
+		LEFT JOIN payouts p ON p.id = i.payout_id
+		WHERE i.batch_id = $1
+		ORDER BY i.line`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBatchItems(rows)
+}
+
+// ClaimQueued marks the next queued items of processing batches as sending, skipping rows
+// another worker holds, so that each item is sent by exactly one worker
+func (r *payoutBatchRepository) ClaimQueued(ctx context.Context, limit int) ([]*payout.BatchItem, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE payout_batch_items i
+		SET status = 'sending', sending_at = now(), attempts = attempts + 1, updated_at = now()
+		WHERE i.id IN (
+			SELECT q.id
+			FROM payout_batch_items q
+			JOIN payout_batches b ON b.id = q.batch_id
+			WHERE q.status = 'queued' AND b.status = 'processing'
+			ORDER BY q.batch_id, q.line
+			LIMIT $1
+			FOR UPDATE OF q SKIP LOCKED)
+		RETURNING `+batchItemColumns+`, NULL::text, NULL::text`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items, err := scanBatchItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(a, b int) bool {
+		if items[a].BatchID != items[b].BatchID {
+			return items[a].BatchID < items[b].BatchID
+		}
+		return items[a].Line < items[b].Line
+	})
+	return items, nil
+}
+
+// MarkStale flags items whose B2C call never reported back, e.g. because the process died mid-call
+func (r *payoutBatchRepository) MarkStale(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE payout_batch_items
+		SET status = 'unknown', error = 'interrupted while sending; check with the provider before retrying', updated_at = now()
+		WHERE status = 'sending' AND sending_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CompleteFinished closes processing batches with no queued or sending items left
+func (r *payoutBatchRepository) CompleteFinished(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE payout_batches b
+		SET status = 'completed', completed_at = now(), updated_at = now()
+		WHERE b.status = 'processing'
+		  AND NOT EXISTS (
+			SELECT 1 FROM payout_batch_items i
+			WHERE i.batch_id = b.id AND i.status IN ('queued', 'sending'))`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// UpdateItemStatus moves a batch's items in any of the given statuses to a new status
+func (r *payoutBatchRepository) UpdateItemStatus(ctx context.Context, batchID int64, from []payout.ItemStatus, to payout.ItemStatus) (int64, error) {
+	statuses := make([]string, len(from))
+	for i, s := range from {
+		statuses[i] = string(s)
+	}
+
+	tag, err := r.db.Exec(ctx, `
+		UPDATE payout_batch_items
+		SET status = $1, error = NULL, sending_at = NULL, updated_at = now()
+		WHERE batch_id = $2 AND status = ANY($3)`, string(to), batchID, statuses)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// scanPayoutBatch scans a single row into batch domain object
+func scanPayoutBatch(row pgx.Row) (*payout.Batch, error) {
+	var b payout.Batch
+	var reference sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&b.ID, &b.TenantID, &b.ProviderCredentialID, &reference, &b.CommandID, &b.Status, &b.ItemCount,
+		&b.TotalAmount, &b.CreatedAt, &b.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Reference = reference.String
+	if completedAt.Valid {
+		b.CompletedAt = &completedAt.Time
+	}
+	return &b, nil
+}
+
+// scanBatchItems scans batch items followed by their payout's status and receipt
+func scanBatchItems(rows pgx.Rows) ([]*payout.BatchItem, error) {
+	var items []*payout.BatchItem
+	for rows.Next() {
+		var item payout.BatchItem
+		var reference, description, itemErr, payoutStatus, receipt sql.NullString
+		var sendingAt sql.NullTime
+
+		err := rows.Scan(
+			&item.ID, &item.BatchID, &item.TenantID, &item.Line, &item.PhoneEnc, &item.MSISDNHash, &item.Amount,
+			&reference, &description, &item.Status, &item.PayoutID, &itemErr, &item.Attempts, &sendingAt,
+			&item.UpdatedAt, &payoutStatus, &receipt)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Reference = reference.String
+		item.Description = description.String
+		item.Error = itemErr.String
+		item.PayoutStatus = payout.Status(payoutStatus.String)
+		item.ReceiptNumber = receipt.String
+		if sendingAt.Valid {
+			item.SendingAt = &sendingAt.Time
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"paymatch/internal/domain/providerconfig"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// providerConfigRepository implements ProviderConfigRepository
+type providerConfigRepository struct {
+	db querier
+}
+
+// NewProviderConfigRepository creates a new provider configuration repository
+func NewProviderConfigRepository(db *pgxpool.Pool) *providerConfigRepository {
+	return &providerConfigRepository{db: db}
+}
+
+// providerConfigJSON is the config_json document of a provider_configs row
+type providerConfigJSON struct {
+	BaseURL        string `json:"base_url"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	MinAmount      int64  `json:"min_amount"`
+	MaxAmount      int64  `json:"max_amount"`
+	Currency       string `json:"currency"`
+}
+
+// FindActive lists the active provider configurations
+func (r *providerConfigRepository) FindActive(ctx context.Context) ([]*providerconfig.Config, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, provider_type, environment, config_json, is_active, updated_at
+		FROM provider_configs
+		WHERE is_active
+		ORDER BY provider_type, environment`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []*providerconfig.Config
+	for rows.Next() {
+		var c providerconfig.Config
+		var raw []byte
+		if err := rows.Scan(&c.ID, &c.ProviderType, &c.Environment, &raw, &c.IsActive, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		var doc providerConfigJSON
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("provider config %d: %w", c.ID, err)
+		}
+		c.BaseURL = doc.BaseURL
+		c.TimeoutSeconds = doc.TimeoutSeconds
+		c.MinAmount = doc.MinAmount
+		c.MaxAmount = doc.MaxAmount
+		c.Currency = doc.Currency
+		configs = append(configs, &c)
+	}
+	return configs, rows.Err()
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"paymatch/internal/domain/payment"
+	"paymatch/internal/store/repositories"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reversalRepository implements ReversalRepository on a pool or inside a transaction
+type reversalRepository struct {
+	db querier
+}
+
+// NewReversalRepository creates a new payment reversal repository
+func NewReversalRepository(db *pgxpool.Pool) *reversalRepository {
+	return &reversalRepository{db: db}
+}
+
+const reversalColumns = `id, tenant_id, payment_id, provider_credential_id, transaction_id, external_id,
+	originator_conversation_id, amount, remarks, requested_by, status, result_desc, receipt_number,
+	created_at, updated_at, completed_at`
+
+// Save saves a reversal (insert or update)
+func (r *reversalRepository) Save(ctx context.Context, rev *payment.Reversal) error {
+	if rev.ID == 0 {
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO payment_reversals (tenant_id, payment_id, provider_credential_id, transaction_id, external_id,
+			                               originator_conversation_id, amount, remarks, requested_by, status, result_desc,
+			                               receipt_number, created_at, updated_at, completed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			RETURNING id`,
+			rev.TenantID, rev.PaymentID, rev.ProviderCredentialID, rev.TransactionID, nullString(rev.ExternalID),
+			nullString(rev.OriginatorConversationID), int64(rev.Amount), nullString(rev.Remarks), rev.RequestedBy,
+			string(rev.Status), nullString(rev.ResultDesc), nullString(rev.ReceiptNumber),
+			rev.CreatedAt, rev.UpdatedAt, rev.CompletedAt).Scan(&rev.ID)
+		if isUniqueViolation(err) {
+			return repositories.ErrDuplicate
+		}
+		return err
+	}
+
+	_, err := r.db.Exec(ctx, `
+		UPDATE payment_reversals
+		SET external_id = $1, originator_conversation_id = $2, status = $3, result_desc = $4,
+		    receipt_number = $5, updated_at = $6, completed_at = $7
+		WHERE id = $8`,
+		nullString(rev.ExternalID), nullString(rev.OriginatorConversationID), string(rev.Status), nullString(rev.ResultDesc),
+		nullString(rev.ReceiptNumber), rev.UpdatedAt, rev.CompletedAt, rev.ID)
+	if isUniqueViolation(err) {
+		return repositories.ErrDuplicate
+	}
+	return err
+}
+
+// FindByID finds a reversal by ID
+func (r *reversalRepository) FindByID(ctx context.Context, id int64) (*payment.Reversal, error) {
+	row := r.db.QueryRow(ctx, `SELECT `+reversalColumns+` FROM payment_reversals WHERE id = $1`, id)
+	return scanReversal(row)
+}
+
+// LockByExternalID finds the reversal a provider result refers to and locks it for the rest of the transaction
+func (r *reversalRepository) LockByExternalID(ctx context.Context, tenantID int64, externalID string) (*payment.Reversal, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+reversalColumns+`
+		FROM payment_reversals
+		WHERE tenant_id = $1 AND (external_id = $2 OR originator_conversation_id = $2)
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`, tenantID, externalID)
+	return scanReversal(row)
+}
+
+// FindByPaymentID lists a payment's reversals, newest first
+func (r *reversalRepository) FindByPaymentID(ctx context.Context, paymentID int64) ([]*payment.Reversal, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+reversalColumns+`
+		FROM payment_reversals
+		WHERE payment_id = $1
+		ORDER BY created_at DESC`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reversals []*payment.Reversal
+	for rows.Next() {
+		rev, err := scanReversal(rows)
+		if err != nil {
+			return nil, err
+		}
+		reversals = append(reversals, rev)
+	}
+	return reversals, rows.Err()
+}
+
+// scanReversal scans a single row into reversal domain object
+func scanReversal(row pgx.Row) (*payment.Reversal, error) {
+	var rev payment.Reversal
+	var externalID, originatorID, remarks, resultDesc, receipt sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&rev.ID, &rev.TenantID, &rev.PaymentID, &rev.ProviderCredentialID, &rev.TransactionID, &externalID,
+		&originatorID, &rev.Amount, &remarks, &rev.RequestedBy, &rev.Status, &resultDesc, &receipt,
+		&rev.CreatedAt, &rev.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.ExternalID = externalID.String
+	rev.OriginatorConversationID = originatorID.String
+	rev.Remarks = remarks.String
+	rev.ResultDesc = resultDesc.String
+	rev.ReceiptNumber = receipt.String
+	if completedAt.Valid {
+		rev.CompletedAt = &completedAt.Time
+	}
+	return &rev, nil
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/routing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// routingPolicyRepository implements RoutingPolicyRepository
+type routingPolicyRepository struct {
+	db querier
+}
+
+// NewRoutingPolicyRepository creates a new routing policy repository
+func NewRoutingPolicyRepository(db *pgxpool.Pool) *routingPolicyRepository {
+	return &routingPolicyRepository{db: db}
+}
+
+// Save creates or replaces the tenant's routing policy
+func (r *routingPolicyRepository) Save(ctx context.Context, p *routing.Policy) error {
+	rules := p.Rules
+	if rules == nil {
+		rules = []routing.Rule{}
+	}
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	preferred := make([]string, len(p.PreferredProviders))
+	for i, providerType := range p.PreferredProviders {
+		preferred[i] = string(providerType)
+	}
+
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO routing_policies (tenant_id, preferred_providers, rules, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+		    preferred_providers = EXCLUDED.preferred_providers,
+		    rules = EXCLUDED.rules,
+		    updated_at = EXCLUDED.updated_at`,
+		p.TenantID, preferred, encoded, p.UpdatedAt)
+	return err
+}
+
+// FindByTenantID finds the tenant's routing policy
+func (r *routingPolicyRepository) FindByTenantID(ctx context.Context, tenantID int64) (*routing.Policy, error) {
+	var p routing.Policy
+	var preferred []string
+	var rules []byte
+
+	err := r.db.QueryRow(ctx, `
+		SELECT tenant_id, preferred_providers, rules, updated_at
+		FROM routing_policies
+		WHERE tenant_id = $1`, tenantID).Scan(&p.TenantID, &preferred, &rules, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, providerType := range preferred {
+		p.PreferredProviders = append(p.PreferredProviders, credential.ProviderType(providerType))
+	}
+	if err := json.Unmarshal(rules, &p.Rules); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
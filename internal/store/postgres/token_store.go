@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"paymatch/internal/crypto"
+	"paymatch/internal/provider/base"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tokenStore shares provider access tokens between API replicas through the database
+type tokenStore struct {
+	db     querier
+	aesKey []byte
+}
+
+// NewTokenStore creates a new token store; tokens are encrypted with the given key
+func NewTokenStore(db *pgxpool.Pool, aesKey []byte) *tokenStore {
+	return &tokenStore{db: db, aesKey: aesKey}
+}
+
+// GetToken returns the stored token for the key, or nil if there is none
+func (s *tokenStore) GetToken(ctx context.Context, key string) (*base.Token, error) {
+	var enc string
+	var token base.Token
+	err := s.db.QueryRow(ctx, `
+		SELECT token_enc, expires_at, refresh_at
+		FROM provider_tokens
+		WHERE token_key = $1`, key).Scan(&enc, &token.ExpiresAt, &token.RefreshAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token.Value, err = crypto.DecryptString(s.aesKey, enc)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// SetToken stores the token for the key unless a longer-lived one is already stored
+func (s *tokenStore) SetToken(ctx context.Context, key string, token *base.Token) error {
+	enc, err := crypto.EncryptString(s.aesKey, token.Value)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO provider_tokens (token_key, token_enc, expires_at, refresh_at, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (token_key) DO UPDATE SET
+		    token_enc = EXCLUDED.token_enc,
+		    expires_at = EXCLUDED.expires_at,
+		    refresh_at = EXCLUDED.refresh_at,
+		    updated_at = now()
+		WHERE provider_tokens.expires_at <= EXCLUDED.expires_at`,
+		key, enc, token.ExpiresAt, token.RefreshAt)
+	return err
+}
@@ -3,6 +3,8 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 	
 	"paymatch/internal/domain/event"
 	"paymatch/internal/domain/payment"
@@ -63,6 +65,61 @@ func (t *transaction) EventRepository() repositories.EventRepository {
 	return &transactionalEventRepository{tx: t.tx}
 }
 
+// InvoiceRepository returns a transactional invoice repository
+func (t *transaction) InvoiceRepository() repositories.InvoiceRepository {
+	return &invoiceRepository{db: t.tx}
+}
+
+// CreditRepository returns a transactional credit repository
+func (t *transaction) CreditRepository() repositories.CreditRepository {
+	return &creditRepository{db: t.tx}
+}
+
+// MatchingRulesRepository returns a transactional matching rules repository
+func (t *transaction) MatchingRulesRepository() repositories.MatchingRulesRepository {
+	return &matchingRulesRepository{db: t.tx}
+}
+
+// MatchReviewRepository returns a transactional match review repository
+func (t *transaction) MatchReviewRepository() repositories.MatchReviewRepository {
+	return &matchReviewRepository{db: t.tx}
+}
+
+// ExceptionRepository returns a transactional payment exception repository
+func (t *transaction) ExceptionRepository() repositories.ExceptionRepository {
+	return &exceptionRepository{db: t.tx}
+}
+
+// PayoutRepository returns a transactional payout repository
+func (t *transaction) PayoutRepository() repositories.PayoutRepository {
+	return &payoutRepository{db: t.tx}
+}
+
+// PayoutBatchRepository returns a transactional payout batch repository
+func (t *transaction) PayoutBatchRepository() repositories.PayoutBatchRepository {
+	return &payoutBatchRepository{db: t.tx}
+}
+
+// ApprovalRepository returns a transactional approval repository
+func (t *transaction) ApprovalRepository() repositories.ApprovalRepository {
+	return &approvalRepository{db: t.tx}
+}
+
+// ReversalRepository returns a transactional payment reversal repository
+func (t *transaction) ReversalRepository() repositories.ReversalRepository {
+	return &reversalRepository{db: t.tx}
+}
+
+// AccountQueryRepository returns a transactional account query repository
+func (t *transaction) AccountQueryRepository() repositories.AccountQueryRepository {
+	return &accountQueryRepository{db: t.tx}
+}
+
+// DeliveryRepository returns a transactional delivery repository
+func (t *transaction) DeliveryRepository() repositories.DeliveryRepository {
+	return &deliveryRepository{db: t.tx}
+}
+
 // Transactional repository implementations that use pgx.Tx instead of pgxpool.Pool
 
 // transactionalPaymentRepository wraps payment operations in a transaction
@@ -71,15 +128,37 @@ type transactionalPaymentRepository struct {
 }
 
 func (r *transactionalPaymentRepository) Save(ctx context.Context, p *payment.Payment) error {
+	var err error
 	if p.ID == 0 {
-		return r.insert(ctx, p)
+		err = r.insert(ctx, p)
+	} else {
+		err = r.update(ctx, p)
+	}
+	if err != nil {
+		return err
+	}
+	return r.appendStatusChanges(ctx, p)
+}
+
+// appendStatusChanges writes the payment's unsaved status changes to its history
+func (r *transactionalPaymentRepository) appendStatusChanges(ctx context.Context, p *payment.Payment) error {
+	for _, change := range p.StatusChanges() {
+		_, err := r.tx.Exec(ctx, `
+			INSERT INTO payment_status_history (tenant_id, payment_id, from_status, to_status, event_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			change.TenantID, change.PaymentID, nullString(string(change.From)), string(change.To),
+			nullInt64(change.EventID), change.CreatedAt)
+		if err != nil {
+			return err
+		}
 	}
-	return r.update(ctx, p)
+	p.ClearStatusChanges()
+	return nil
 }
 
 func (r *transactionalPaymentRepository) FindByID(ctx context.Context, id int64) (*payment.Payment, error) {
 	row := r.tx.QueryRow(ctx, `
-		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
 		FROM payments 
 		WHERE id = $1`, id)
 	
@@ -88,7 +167,7 @@ func (r *transactionalPaymentRepository) FindByID(ctx context.Context, id int64)
 
 func (r *transactionalPaymentRepository) FindByExternalID(ctx context.Context, tenantID int64, externalID string) (*payment.Payment, error) {
 	row := r.tx.QueryRow(ctx, `
-		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
 		FROM payments 
 		WHERE tenant_id = $1 AND external_id = $2`, tenantID, externalID)
 	
@@ -97,7 +176,7 @@ func (r *transactionalPaymentRepository) FindByExternalID(ctx context.Context, t
 
 func (r *transactionalPaymentRepository) FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*payment.Payment, error) {
 	rows, err := r.tx.Query(ctx, `
-		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
 		FROM payments 
 		WHERE tenant_id = $1 
 		ORDER BY created_at DESC 
@@ -119,22 +198,43 @@ func (r *transactionalPaymentRepository) FindByTenantID(ctx context.Context, ten
 	return payments, rows.Err()
 }
 
-func (r *transactionalPaymentRepository) UpdateStatus(ctx context.Context, id int64, status payment.Status) error {
-	_, err := r.tx.Exec(ctx, `
-		UPDATE payments 
-		SET status = $1, updated_at = now() 
-		WHERE id = $2`, string(status), id)
-	return err
+func (r *transactionalPaymentRepository) FindPendingBefore(ctx context.Context, before time.Time, limit int) ([]*payment.Payment, error) {
+	rows, err := r.tx.Query(ctx, `
+		SELECT id, tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id, failure_code, failure_reason, metadata, initiated_by, created_at, updated_at
+		FROM payments 
+		WHERE status IN ('pending', 'processing') AND created_at < $1
+		ORDER BY created_at 
+		LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var payments []*payment.Payment
+	for rows.Next() {
+		p, err := scanPaymentFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	
+	return payments, rows.Err()
 }
 
 func (r *transactionalPaymentRepository) insert(ctx context.Context, p *payment.Payment) error {
 	err := r.tx.QueryRow(ctx, `
-		INSERT INTO payments (tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO payments (tenant_id, invoice_no, amount, currency, status, method, external_id, msisdn_hash, provider_credential_id,
+		                      failure_code, failure_reason, metadata, initiated_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		RETURNING id`,
 		p.TenantID, p.InvoiceNo, int64(p.Amount), string(p.Currency), string(p.Status), 
-		string(p.Method), p.ExternalID, p.MSISDNHash, p.CreatedAt, p.UpdatedAt).Scan(&p.ID)
-	
+		string(p.Method), p.ExternalID, p.MSISDNHash, nullInt64(p.ProviderCredentialID),
+		nullString(p.FailureCode), nullString(p.FailureReason), paymentMetadata(p), nullString(p.InitiatedBy),
+		p.CreatedAt, p.UpdatedAt).Scan(&p.ID)
+	if isUniqueViolation(err) {
+		return repositories.ErrDuplicate
+	}
 	return err
 }
 
@@ -142,10 +242,12 @@ func (r *transactionalPaymentRepository) update(ctx context.Context, p *payment.
 	_, err := r.tx.Exec(ctx, `
 		UPDATE payments 
 		SET invoice_no = $1, amount = $2, currency = $3, status = $4, method = $5, 
-		    external_id = $6, msisdn_hash = $7, updated_at = $8
-		WHERE id = $9`,
+		    external_id = $6, msisdn_hash = $7, failure_code = $8, failure_reason = $9, updated_at = $10,
+		    provider_credential_id = $11, metadata = $12, initiated_by = $13
+		WHERE id = $14`,
 		p.InvoiceNo, int64(p.Amount), string(p.Currency), string(p.Status), 
-		string(p.Method), p.ExternalID, p.MSISDNHash, p.UpdatedAt, p.ID)
+		string(p.Method), p.ExternalID, p.MSISDNHash, nullString(p.FailureCode), nullString(p.FailureReason), p.UpdatedAt,
+		nullInt64(p.ProviderCredentialID), paymentMetadata(p), nullString(p.InitiatedBy), p.ID)
 	
 	return err
 }
@@ -162,10 +264,14 @@ func (r *transactionalEventRepository) Save(ctx context.Context, e *event.Event)
 	return r.update(ctx, e)
 }
 
+func (r *transactionalEventRepository) SaveIfAbsent(ctx context.Context, e *event.Event) (bool, error) {
+	return saveEventIfAbsent(ctx, r.tx, e)
+}
+
 func (r *transactionalEventRepository) FindByID(ctx context.Context, id int64) (*event.Event, error) {
 	row := r.tx.QueryRow(ctx, `
 		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
-		       msisdn, invoice_ref, transaction_id, status, response_description, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
 		       payload_json, received_at, processed_at, processing_status
 		FROM payment_events 
 		WHERE id = $1`, id)
@@ -176,7 +282,7 @@ func (r *transactionalEventRepository) FindByID(ctx context.Context, id int64) (
 func (r *transactionalEventRepository) FindUnprocessed(ctx context.Context, limit int) ([]*event.Event, error) {
 	rows, err := r.tx.Query(ctx, `
 		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
-		       msisdn, invoice_ref, transaction_id, status, response_description, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
 		       payload_json, received_at, processed_at, processing_status
 		FROM payment_events 
 		WHERE processing_status IN ('pending', 'queued')
@@ -190,10 +296,27 @@ func (r *transactionalEventRepository) FindUnprocessed(ctx context.Context, limi
 	return scanEvents(rows)
 }
 
+func (r *transactionalEventRepository) FindDeferredBefore(ctx context.Context, before time.Time, limit int) ([]*event.Event, error) {
+	rows, err := r.tx.Query(ctx, `
+		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
+		       payload_json, received_at, processed_at, processing_status
+		FROM payment_events 
+		WHERE processing_status = 'deferred' AND processed_at < $1
+		ORDER BY processed_at ASC 
+		LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	return scanEvents(rows)
+}
+
 func (r *transactionalEventRepository) FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*event.Event, error) {
 	rows, err := r.tx.Query(ctx, `
 		SELECT id, tenant_id, provider_credential_id, event_type, external_id, amount, 
-		       msisdn, invoice_ref, transaction_id, status, response_description, 
+		       msisdn, invoice_ref, transaction_id, status, failure_code, response_description, 
 		       payload_json, received_at, processed_at, processing_status
 		FROM payment_events 
 		WHERE tenant_id = $1 
@@ -227,8 +350,8 @@ func (r *transactionalEventRepository) insert(ctx context.Context, e *event.Even
 	err := r.tx.QueryRow(ctx, `
 		INSERT INTO payment_events (tenant_id, provider_credential_id, event_type, external_id, 
 		                           amount, msisdn, invoice_ref, transaction_id, status, 
-		                           response_description, payload_json, received_at, processing_status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		                           failure_code, response_description, payload_json, received_at, processing_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		ON CONFLICT (tenant_id, event_type, external_id) DO UPDATE SET
 		    payload_json = EXCLUDED.payload_json,
 		    amount = CASE WHEN EXCLUDED.amount > 0 THEN EXCLUDED.amount ELSE payment_events.amount END,
@@ -236,12 +359,13 @@ func (r *transactionalEventRepository) insert(ctx context.Context, e *event.Even
 		    invoice_ref = COALESCE(NULLIF(EXCLUDED.invoice_ref, ''), payment_events.invoice_ref),
 		    transaction_id = COALESCE(NULLIF(EXCLUDED.transaction_id, ''), payment_events.transaction_id),
 		    status = COALESCE(NULLIF(EXCLUDED.status, ''), payment_events.status),
+		    failure_code = CASE WHEN EXCLUDED.status <> '' THEN EXCLUDED.failure_code ELSE payment_events.failure_code END,
 		    response_description = COALESCE(NULLIF(EXCLUDED.response_description, ''), payment_events.response_description),
 		    updated_at = now()
 		RETURNING id`,
 		e.TenantID, e.ProviderCredentialID, string(e.Type), e.ExternalID,
 		e.Amount, e.MSISDN, e.InvoiceRef, e.TransactionID, e.Status,
-		e.ResponseDescription, e.RawJSON, e.ReceivedAt, string(e.ProcessingStatus)).Scan(&e.ID)
+		nullString(e.FailureCode), e.ResponseDescription, e.RawJSON, e.ReceivedAt, string(e.ProcessingStatus)).Scan(&e.ID)
 	
 	return err
 }
@@ -252,12 +376,12 @@ func (r *transactionalEventRepository) update(ctx context.Context, e *event.Even
 		SET provider_credential_id = $1, event_type = $2, external_id = $3,
 		    amount = $4, msisdn = $5, invoice_ref = $6, transaction_id = $7,
 		    status = $8, response_description = $9, payload_json = $10,
-		    processed_at = $11, processing_status = $12, updated_at = now()
-		WHERE id = $13`,
+		    processed_at = $11, processing_status = $12, failure_code = $13, updated_at = now()
+		WHERE id = $14`,
 		e.ProviderCredentialID, string(e.Type), e.ExternalID,
 		e.Amount, e.MSISDN, e.InvoiceRef, e.TransactionID,
 		e.Status, e.ResponseDescription, e.RawJSON,
-		e.ProcessedAt, string(e.ProcessingStatus), e.ID)
+		e.ProcessedAt, string(e.ProcessingStatus), nullString(e.FailureCode), e.ID)
 	
 	return err
 }
@@ -269,10 +393,14 @@ func scanPayment(row pgx.Row) (*payment.Payment, error) {
 	var p payment.Payment
 	var invoiceNo sql.NullString
 	var msisdnHash sql.NullString
+	var credentialID sql.NullInt64
+	var failureCode, failureReason, initiatedBy sql.NullString
+	var metadata []byte
 	
 	err := row.Scan(
 		&p.ID, &p.TenantID, &invoiceNo, &p.Amount, &p.Currency,
-		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &p.CreatedAt, &p.UpdatedAt)
+		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &credentialID, &failureCode, &failureReason,
+		&metadata, &initiatedBy, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -283,19 +411,40 @@ func scanPayment(row pgx.Row) (*payment.Payment, error) {
 	if msisdnHash.Valid {
 		p.MSISDNHash = msisdnHash.String
 	}
+	p.ProviderCredentialID = credentialID.Int64
+	p.FailureCode = failureCode.String
+	p.FailureReason = failureReason.String
+	p.InitiatedBy = initiatedBy.String
+	if err := json.Unmarshal(metadata, &p.Metadata); err != nil {
+		return nil, err
+	}
 	
 	return &p, nil
 }
 
+// paymentMetadata encodes the caller's metadata, never storing NULL
+func paymentMetadata(p *payment.Payment) []byte {
+	metadata := p.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	encoded, _ := json.Marshal(metadata)
+	return encoded
+}
+
 // scanPaymentFromRows scans rows into payment domain object
 func scanPaymentFromRows(rows pgx.Rows) (*payment.Payment, error) {
 	var p payment.Payment
 	var invoiceNo sql.NullString
 	var msisdnHash sql.NullString
+	var credentialID sql.NullInt64
+	var failureCode, failureReason, initiatedBy sql.NullString
+	var metadata []byte
 	
 	err := rows.Scan(
 		&p.ID, &p.TenantID, &invoiceNo, &p.Amount, &p.Currency,
-		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &p.CreatedAt, &p.UpdatedAt)
+		&p.Status, &p.Method, &p.ExternalID, &msisdnHash, &credentialID, &failureCode, &failureReason,
+		&metadata, &initiatedBy, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -306,6 +455,13 @@ func scanPaymentFromRows(rows pgx.Rows) (*payment.Payment, error) {
 	if msisdnHash.Valid {
 		p.MSISDNHash = msisdnHash.String
 	}
+	p.ProviderCredentialID = credentialID.Int64
+	p.FailureCode = failureCode.String
+	p.FailureReason = failureReason.String
+	p.InitiatedBy = initiatedBy.String
+	if err := json.Unmarshal(metadata, &p.Metadata); err != nil {
+		return nil, err
+	}
 	
 	return &p, nil
 }
@@ -314,12 +470,12 @@ func scanPaymentFromRows(rows pgx.Rows) (*payment.Payment, error) {
 func scanEvent(row pgx.Row) (*event.Event, error) {
 	var e event.Event
 	var amount sql.NullInt64
-	var msisdn, invoiceRef, transactionID, status, responseDesc sql.NullString
+	var msisdn, invoiceRef, transactionID, status, failureCode, responseDesc sql.NullString
 	var processedAt sql.NullTime
 	
 	err := row.Scan(
 		&e.ID, &e.TenantID, &e.ProviderCredentialID, &e.Type, &e.ExternalID,
-		&amount, &msisdn, &invoiceRef, &transactionID, &status, &responseDesc,
+		&amount, &msisdn, &invoiceRef, &transactionID, &status, &failureCode, &responseDesc,
 		&e.RawJSON, &e.ReceivedAt, &processedAt, &e.ProcessingStatus)
 	if err != nil {
 		return nil, err
@@ -340,6 +496,9 @@ func scanEvent(row pgx.Row) (*event.Event, error) {
 	if status.Valid {
 		e.Status = status.String
 	}
+	if failureCode.Valid {
+		e.FailureCode = failureCode.String
+	}
 	if responseDesc.Valid {
 		e.ResponseDescription = responseDesc.String
 	}
@@ -368,12 +527,12 @@ func scanEvents(rows pgx.Rows) ([]*event.Event, error) {
 func scanEventFromRows(rows pgx.Rows) (*event.Event, error) {
 	var e event.Event
 	var amount sql.NullInt64
-	var msisdn, invoiceRef, transactionID, status, responseDesc sql.NullString
+	var msisdn, invoiceRef, transactionID, status, failureCode, responseDesc sql.NullString
 	var processedAt sql.NullTime
 	
 	err := rows.Scan(
 		&e.ID, &e.TenantID, &e.ProviderCredentialID, &e.Type, &e.ExternalID,
-		&amount, &msisdn, &invoiceRef, &transactionID, &status, &responseDesc,
+		&amount, &msisdn, &invoiceRef, &transactionID, &status, &failureCode, &responseDesc,
 		&e.RawJSON, &e.ReceivedAt, &processedAt, &e.ProcessingStatus)
 	if err != nil {
 		return nil, err
@@ -394,6 +553,9 @@ func scanEventFromRows(rows pgx.Rows) (*event.Event, error) {
 	if status.Valid {
 		e.Status = status.String
 	}
+	if failureCode.Valid {
+		e.FailureCode = failureCode.String
+	}
 	if responseDesc.Valid {
 		e.ResponseDescription = responseDesc.String
 	}
@@ -0,0 +1,105 @@
+// Package redis shares provider access tokens between API replicas through Redis.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"paymatch/internal/config"
+	"paymatch/internal/crypto"
+	"paymatch/internal/provider/base"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces token keys in a Redis shared with other applications
+const keyPrefix = "paymatch:token:"
+
+// commandTimeout bounds a command when the caller's context has no deadline
+const commandTimeout = 2 * time.Second
+
+// TokenStore keeps encrypted provider tokens in Redis until they expire
+type TokenStore struct {
+	client *goredis.Client
+	aesKey []byte
+}
+
+// NewTokenStore creates a new token store; the client connects on first use
+func NewTokenStore(cfg config.RedisCfg, aesKey []byte) *TokenStore {
+	opts := &goredis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  commandTimeout,
+		ReadTimeout:  commandTimeout,
+		WriteTimeout: commandTimeout,
+	}
+	if cfg.TLS {
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			host = cfg.Addr
+		}
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host}
+	}
+	return &TokenStore{client: goredis.NewClient(opts), aesKey: aesKey}
+}
+
+// storedToken is the JSON form of a token in Redis
+type storedToken struct {
+	TokenEnc  string    `json:"token_enc"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RefreshAt time.Time `json:"refresh_at"`
+}
+
+// GetToken returns the stored token for the key, or nil if there is none
+func (s *TokenStore) GetToken(ctx context.Context, key string) (*base.Token, error) {
+	reply, err := s.client.Get(ctx, keyPrefix+key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get failed: %w", err)
+	}
+
+	var stored storedToken
+	if err := json.Unmarshal(reply, &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored token: %w", err)
+	}
+	value, err := crypto.DecryptString(s.aesKey, stored.TokenEnc)
+	if err != nil {
+		return nil, err
+	}
+	return &base.Token{Value: value, ExpiresAt: stored.ExpiresAt, RefreshAt: stored.RefreshAt}, nil
+}
+
+// SetToken stores the token for the key; Redis drops it when it expires
+func (s *TokenStore) SetToken(ctx context.Context, key string, token *base.Token) error {
+	ttl := time.Until(token.ExpiresAt)
+	if ttl < time.Millisecond {
+		return nil
+	}
+
+	enc, err := crypto.EncryptString(s.aesKey, token.Value)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(storedToken{TokenEnc: enc, ExpiresAt: token.ExpiresAt, RefreshAt: token.RefreshAt})
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.Set(ctx, keyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis set failed: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connections to Redis
+func (s *TokenStore) Close() error {
+	return s.client.Close()
+}
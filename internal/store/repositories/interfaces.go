@@ -2,27 +2,45 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"time"
 	
+	"paymatch/internal/domain/account"
 	"paymatch/internal/domain/payment"
 	"paymatch/internal/domain/event"
 	"paymatch/internal/domain/credential"
+	"paymatch/internal/domain/delivery"
+	"paymatch/internal/domain/exception"
+	"paymatch/internal/domain/idempotency"
+	"paymatch/internal/domain/invoice"
+	"paymatch/internal/domain/matching"
+	"paymatch/internal/domain/payout"
+	"paymatch/internal/domain/providerconfig"
+	"paymatch/internal/domain/routing"
 	"paymatch/internal/domain/tenant"
 )
 
+// ErrDuplicate is returned when a save violates a uniqueness rule
+var ErrDuplicate = errors.New("duplicate record")
+
 // PaymentRepository defines the contract for payment data access
 type PaymentRepository interface {
 	Save(ctx context.Context, payment *payment.Payment) error
 	FindByID(ctx context.Context, id int64) (*payment.Payment, error)
 	FindByExternalID(ctx context.Context, tenantID int64, externalID string) (*payment.Payment, error)
 	FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*payment.Payment, error)
-	UpdateStatus(ctx context.Context, id int64, status payment.Status) error
+	// FindPendingBefore lists pending and processing payments created before the cutoff, oldest first
+	FindPendingBefore(ctx context.Context, before time.Time, limit int) ([]*payment.Payment, error)
 }
 
 // EventRepository defines the contract for event data access
 type EventRepository interface {
 	Save(ctx context.Context, event *event.Event) error
+	SaveIfAbsent(ctx context.Context, event *event.Event) (bool, error)
 	FindByID(ctx context.Context, id int64) (*event.Event, error)
 	FindUnprocessed(ctx context.Context, limit int) ([]*event.Event, error)
+	// FindDeferredBefore lists deferred events last tried before the cutoff, oldest first
+	FindDeferredBefore(ctx context.Context, before time.Time, limit int) ([]*event.Event, error)
 	FindByTenantID(ctx context.Context, tenantID int64, limit, offset int) ([]*event.Event, error)
 	MarkProcessed(ctx context.Context, id int64, status event.ProcessingStatus) error
 	MarkForReprocessing(ctx context.Context, tenantID, eventID int64) error
@@ -47,6 +65,173 @@ type TenantRepository interface {
 	FindAPIKeyByHash(ctx context.Context, keyHash string) (*tenant.APIKey, error)
 }
 
+// DeliveryRepository defines the contract for the outbound webhook queue (event_queue)
+type DeliveryRepository interface {
+	Enqueue(ctx context.Context, d *delivery.Delivery) error
+	ClaimDue(ctx context.Context, limit int) ([]*delivery.Delivery, error)
+	Save(ctx context.Context, d *delivery.Delivery) error
+	FindByID(ctx context.Context, id int64) (*delivery.Delivery, error)
+	FindByTenantID(ctx context.Context, tenantID int64, status delivery.Status, limit, offset int) ([]*delivery.Delivery, error)
+}
+
+// WebhookEndpointRepository defines the contract for tenant webhook endpoint data access
+type WebhookEndpointRepository interface {
+	Save(ctx context.Context, endpoint *delivery.Endpoint) error
+	FindByTenantID(ctx context.Context, tenantID int64) (*delivery.Endpoint, error)
+}
+
+// InvoiceFilter narrows invoice listings; empty fields match everything
+type InvoiceFilter struct {
+	Status      invoice.Status
+	CustomerRef string
+}
+
+// InvoiceRepository defines the contract for invoice data access
+type InvoiceRepository interface {
+	Save(ctx context.Context, inv *invoice.Invoice) error
+	FindByID(ctx context.Context, id int64) (*invoice.Invoice, error)
+	// LockByID loads an invoice for update within a transaction
+	LockByID(ctx context.Context, id int64) (*invoice.Invoice, error)
+	FindByTenantID(ctx context.Context, tenantID int64, filter InvoiceFilter, limit, offset int) ([]*invoice.Invoice, error)
+	// FindPayableByReference locks the open or partially paid invoice with the reference
+	FindPayableByReference(ctx context.Context, tenantID int64, reference string) (*invoice.Invoice, error)
+	// FindPayable lists open and partially paid invoices, newest first
+	FindPayable(ctx context.Context, tenantID int64, limit int) ([]*invoice.Invoice, error)
+	// SaveAllocation records a payment against an invoice; false if the payment was already allocated
+	SaveAllocation(ctx context.Context, alloc *invoice.Allocation) (bool, error)
+	FindAllocationsByInvoiceID(ctx context.Context, invoiceID int64) ([]*invoice.Allocation, error)
+	SaveLedgerEntry(ctx context.Context, entry *invoice.LedgerEntry) error
+	FindLedgerByInvoiceID(ctx context.Context, invoiceID int64) ([]*invoice.LedgerEntry, error)
+}
+
+// CreditRepository defines the contract for customer credit data access
+type CreditRepository interface {
+	Save(ctx context.Context, credit *invoice.Credit) error
+	// LockByID loads a credit for update within a transaction
+	LockByID(ctx context.Context, id int64) (*invoice.Credit, error)
+	// LockAvailableByCustomer loads a customer's unused credits, oldest first, for update
+	LockAvailableByCustomer(ctx context.Context, tenantID int64, customerRef string) ([]*invoice.Credit, error)
+	FindByTenantID(ctx context.Context, tenantID int64, customerRef string, status invoice.CreditStatus, limit, offset int) ([]*invoice.Credit, error)
+}
+
+// MatchingRulesRepository defines the contract for reference matching rules
+type MatchingRulesRepository interface {
+	Save(ctx context.Context, rules *matching.Rules) error
+	// FindEffective returns the credential's rules, falling back to the tenant default
+	FindEffective(ctx context.Context, tenantID, credentialID int64) (*matching.Rules, error)
+	FindByTenantID(ctx context.Context, tenantID int64) ([]*matching.Rules, error)
+}
+
+// MatchReviewRepository defines the contract for the low-confidence match review queue
+type MatchReviewRepository interface {
+	Save(ctx context.Context, review *matching.Review) error
+	// LockByID loads a review for update within a transaction
+	LockByID(ctx context.Context, id int64) (*matching.Review, error)
+	FindByTenantID(ctx context.Context, tenantID int64, status matching.ReviewStatus, limit, offset int) ([]*matching.Review, error)
+	// SupersedePending closes a payment's pending review once it is reconciled another way
+	SupersedePending(ctx context.Context, paymentID int64) error
+}
+
+// ExceptionRepository defines the contract for unreconciled payments and their operator audit trail
+type ExceptionRepository interface {
+	FindByTenantID(ctx context.Context, tenantID int64, kind exception.Kind, limit, offset int) ([]*exception.Exception, error)
+	// LockPayment loads a payment for update within a transaction
+	LockPayment(ctx context.Context, paymentID int64) (*payment.Payment, error)
+	SaveAudit(ctx context.Context, entry *exception.AuditEntry) error
+	FindAuditByPaymentID(ctx context.Context, tenantID, paymentID int64) ([]*exception.AuditEntry, error)
+}
+
+// PayoutRepository defines the contract for outgoing payout data access
+type PayoutRepository interface {
+	Save(ctx context.Context, p *payout.Payout) error
+	FindByID(ctx context.Context, id int64) (*payout.Payout, error)
+	// LockByExternalID loads the payout with the conversation or originator conversation ID for update
+	LockByExternalID(ctx context.Context, tenantID int64, externalID string) (*payout.Payout, error)
+	FindByTenantID(ctx context.Context, tenantID int64, status payout.Status, limit, offset int) ([]*payout.Payout, error)
+}
+
+// PayoutBatchRepository defines the contract for bulk payout batches and their items
+type PayoutBatchRepository interface {
+	Save(ctx context.Context, b *payout.Batch) error
+	// SaveItem inserts or updates a batch item
+	SaveItem(ctx context.Context, item *payout.BatchItem) error
+	FindByID(ctx context.Context, id int64) (*payout.Batch, error)
+	FindByTenantID(ctx context.Context, tenantID int64, status payout.BatchStatus, limit, offset int) ([]*payout.Batch, error)
+	// FindItems lists a batch's items in upload order together with their payout results
+	FindItems(ctx context.Context, batchID int64) ([]*payout.BatchItem, error)
+	// ClaimQueued marks up to limit queued items of processing batches as sending and returns them
+	ClaimQueued(ctx context.Context, limit int) ([]*payout.BatchItem, error)
+	// MarkStale flags items that have been sending since before the cutoff as unknown
+	MarkStale(ctx context.Context, before time.Time) (int64, error)
+	// CompleteFinished closes processing batches that have nothing left to send
+	CompleteFinished(ctx context.Context) (int64, error)
+	// UpdateItemStatus moves a batch's items in any of the given statuses to a new status
+	UpdateItemStatus(ctx context.Context, batchID int64, from []payout.ItemStatus, to payout.ItemStatus) (int64, error)
+}
+
+// ApprovalRepository defines the contract for payout approvals, their audit trail and tenant policies
+type ApprovalRepository interface {
+	SavePolicy(ctx context.Context, p *payout.ApprovalPolicy) error
+	FindPolicy(ctx context.Context, tenantID int64) (*payout.ApprovalPolicy, error)
+	Save(ctx context.Context, a *payout.Approval) error
+	FindByID(ctx context.Context, id int64) (*payout.Approval, error)
+	// LockByID loads an approval for update
+	LockByID(ctx context.Context, id int64) (*payout.Approval, error)
+	// LockPending loads the pending approval of a payout or batch for update
+	LockPending(ctx context.Context, subject payout.Subject, subjectID int64) (*payout.Approval, error)
+	FindByTenantID(ctx context.Context, tenantID int64, status payout.ApprovalStatus, limit, offset int) ([]*payout.Approval, error)
+	// FindExpired lists pending approvals whose deadline is before the cutoff
+	FindExpired(ctx context.Context, before time.Time, limit int) ([]*payout.Approval, error)
+	AddAudit(ctx context.Context, entry *payout.ApprovalAuditEntry) error
+	FindAudit(ctx context.Context, approvalID int64) ([]*payout.ApprovalAuditEntry, error)
+}
+
+// ReversalRepository defines the contract for payment reversals
+type ReversalRepository interface {
+	Save(ctx context.Context, r *payment.Reversal) error
+	FindByID(ctx context.Context, id int64) (*payment.Reversal, error)
+	// LockByExternalID loads the reversal a provider result refers to for update
+	LockByExternalID(ctx context.Context, tenantID int64, externalID string) (*payment.Reversal, error)
+	FindByPaymentID(ctx context.Context, paymentID int64) ([]*payment.Reversal, error)
+}
+
+// AccountQueryRepository defines the contract for balance and transaction status queries
+// and the latest balance per credential
+type AccountQueryRepository interface {
+	Save(ctx context.Context, q *account.Query) error
+	FindByID(ctx context.Context, id int64) (*account.Query, error)
+	// LockByExternalID loads the query a provider result refers to for update
+	LockByExternalID(ctx context.Context, tenantID int64, externalID string) (*account.Query, error)
+	// SaveBalance keeps a credential's balance unless a more recent one is already stored
+	SaveBalance(ctx context.Context, b *account.Balance) error
+	FindBalances(ctx context.Context, tenantID int64) ([]*account.Balance, error)
+}
+
+// ProviderConfigRepository defines the contract for provider configuration data access
+type ProviderConfigRepository interface {
+	// FindActive lists the active provider configurations
+	FindActive(ctx context.Context) ([]*providerconfig.Config, error)
+}
+
+// RoutingPolicyRepository defines the contract for tenants' credential routing policies
+type RoutingPolicyRepository interface {
+	Save(ctx context.Context, p *routing.Policy) error
+	FindByTenantID(ctx context.Context, tenantID int64) (*routing.Policy, error)
+}
+
+// IdempotencyRepository defines the contract for Idempotency-Key records
+type IdempotencyRepository interface {
+	// Claim inserts the record, taking over an expired one with the same key, or one for the
+	// same request still processing since before staleBefore; it reports false when a live
+	// record already holds the key
+	Claim(ctx context.Context, r *idempotency.Record, staleBefore time.Time) (bool, error)
+	FindByKey(ctx context.Context, tenantID int64, key string) (*idempotency.Record, error)
+	Complete(ctx context.Context, r *idempotency.Record) error
+	// Release gives up a claim whose request may safely be sent again
+	Release(ctx context.Context, r *idempotency.Record) error
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
 // UnitOfWork defines transactional operations
 type UnitOfWork interface {
 	Begin(ctx context.Context) (Transaction, error)
@@ -58,4 +243,15 @@ type Transaction interface {
 	Rollback(ctx context.Context) error
 	PaymentRepository() PaymentRepository
 	EventRepository() EventRepository
+	InvoiceRepository() InvoiceRepository
+	CreditRepository() CreditRepository
+	MatchingRulesRepository() MatchingRulesRepository
+	MatchReviewRepository() MatchReviewRepository
+	ExceptionRepository() ExceptionRepository
+	PayoutRepository() PayoutRepository
+	PayoutBatchRepository() PayoutBatchRepository
+	ApprovalRepository() ApprovalRepository
+	ReversalRepository() ReversalRepository
+	AccountQueryRepository() AccountQueryRepository
+	DeliveryRepository() DeliveryRepository
 }
\ No newline at end of file
@@ -0,0 +1,875 @@
+// Package darajasim simulates the Safaricom Daraja API so PayMatch can be developed and
+// tested without Safaricom credentials or network access.
+//
+// It serves the OAuth, STK push, STK query, C2B register and simulate, B2C, account
+// balance and transaction status endpoints, and calls back the URLs named in each
+// request the way Daraja does. What happens to a request is scripted per phone number:
+//
+//	sim := darajasim.New(darajasim.Config{CallbackLatency: 500 * time.Millisecond})
+//	defer sim.Close()
+//	sim.Script("254708374149", darajasim.OutcomeCancel)
+//	srv := httptest.NewServer(sim)
+//
+// Point PayMatch at it with MPESA_SANDBOX_BASE_URL, or run it standalone with
+// go run ./cmd/daraja-sim.
+package darajasim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome is how the simulator settles a request
+type Outcome string
+
+const (
+	OutcomeSuccess           Outcome = "success"
+	OutcomeCancel            Outcome = "cancel"             // the customer dismisses the STK prompt
+	OutcomeTimeout           Outcome = "timeout"            // the customer's phone cannot be reached; B2C requests time out in the queue
+	OutcomeInsufficientFunds Outcome = "insufficient_funds" // the paying account cannot cover the amount
+)
+
+// ParseOutcome parses an outcome name
+func ParseOutcome(name string) (Outcome, error) {
+	switch o := Outcome(strings.ToLower(strings.TrimSpace(name))); o {
+	case OutcomeSuccess, OutcomeCancel, OutcomeTimeout, OutcomeInsufficientFunds:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unknown outcome %q: use success, cancel, timeout or insufficient_funds", name)
+	}
+}
+
+// Config holds configuration for the simulator
+type Config struct {
+	// CallbackURL, when set, replaces the scheme and host of every callback URL, for when
+	// the URLs PayMatch sends are not reachable from the simulator
+	CallbackURL  string
+	WebhookToken string // sent as X-Webhook-Token on every callback
+
+	// ConsumerKey and ConsumerSecret, when set, are the only ones granted access tokens
+	ConsumerKey    string
+	ConsumerSecret string
+	TokenTTL       time.Duration // access token lifetime
+
+	ResponseLatency time.Duration // delay before an API call is answered
+	CallbackLatency time.Duration // delay between accepting a request and calling back its result
+
+	Outcome        Outcome // outcome for phone numbers without a script
+	OpeningBalance int64   // KES each shortcode's utility account starts with
+
+	Client *http.Client                     // sends callbacks
+	Logf   func(format string, args ...any) // receives one line per call and callback; nil discards them
+}
+
+// DefaultConfig returns sensible defaults for the simulator
+func DefaultConfig() Config {
+	return Config{
+		TokenTTL:        time.Hour,
+		CallbackLatency: 2 * time.Second,
+		Outcome:         OutcomeSuccess,
+		OpeningBalance:  1000000,
+	}
+}
+
+// Server is a simulated Daraja API. It is an http.Handler.
+type Server struct {
+	config Config
+	mux    *http.ServeMux
+
+	mu           sync.Mutex
+	seq          int
+	tokens       map[string]time.Time // access token expiry
+	scripts      map[string]Outcome   // by phone number
+	stk          map[string]*stkRequest
+	c2b          map[string]c2bURLs // by shortcode
+	balances     map[string]int64   // utility account balance by shortcode
+	transactions map[string]*transaction
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending sync.WaitGroup
+}
+
+// stkRequest is an STK prompt and, once settled, its result
+type stkRequest struct {
+	merchantRequestID string
+	checkoutRequestID string
+	shortcode         string
+	phone             string
+	amount            int64
+	reference         string
+	callbackURL       string
+	settled           bool
+	resultCode        int
+	resultDesc        string
+	receipt           string
+}
+
+// c2bURLs are the URLs registered for a shortcode's C2B payments
+type c2bURLs struct {
+	confirmation string
+	validation   string
+}
+
+// transaction is a completed movement of money, looked up by transaction status queries
+type transaction struct {
+	receipt   string
+	shortcode string
+	phone     string
+	amount    int64
+	incoming  bool // paid by the customer to the shortcode
+	at        time.Time
+}
+
+// New creates a simulator; zero config values take their defaults
+func New(config Config) *Server {
+	defaults := DefaultConfig()
+	if config.TokenTTL == 0 {
+		config.TokenTTL = defaults.TokenTTL
+	}
+	if config.CallbackLatency == 0 {
+		config.CallbackLatency = defaults.CallbackLatency
+	}
+	if config.Outcome == "" {
+		config.Outcome = defaults.Outcome
+	}
+	if config.OpeningBalance == 0 {
+		config.OpeningBalance = defaults.OpeningBalance
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	config.CallbackURL = strings.TrimSuffix(config.CallbackURL, "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:       config,
+		mux:          http.NewServeMux(),
+		tokens:       make(map[string]time.Time),
+		scripts:      make(map[string]Outcome),
+		stk:          make(map[string]*stkRequest),
+		c2b:          make(map[string]c2bURLs),
+		balances:     make(map[string]int64),
+		transactions: make(map[string]*transaction),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+
+	s.mux.HandleFunc("GET /oauth/v1/generate", s.generateToken)
+	s.mux.HandleFunc("POST /mpesa/stkpush/v1/processrequest", s.authorized(s.stkPush))
+	s.mux.HandleFunc("POST /mpesa/stkpushquery/v1/query", s.authorized(s.stkQuery))
+	s.mux.HandleFunc("POST /mpesa/c2b/v1/registerurl", s.authorized(s.registerURL))
+	s.mux.HandleFunc("POST /mpesa/c2b/v1/simulate", s.authorized(s.simulateC2B))
+	s.mux.HandleFunc("POST /mpesa/b2c/v1/paymentrequest", s.authorized(s.b2c))
+	s.mux.HandleFunc("POST /mpesa/accountbalance/v1/query", s.authorized(s.accountBalance))
+	s.mux.HandleFunc("POST /mpesa/transactionstatus/v1/query", s.authorized(s.transactionStatus))
+	return s
+}
+
+// ServeHTTP answers a Daraja API call
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.config.ResponseLatency > 0 {
+		select {
+		case <-time.After(s.config.ResponseLatency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	s.logf("%s %s", r.Method, r.URL.Path)
+	s.mux.ServeHTTP(w, r)
+}
+
+// Script sets the outcome of requests involving a phone number, given as 2547XXXXXXXX
+func (s *Server) Script(phone string, outcome Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[phone] = outcome
+}
+
+// Balance returns a shortcode's utility account balance in KES
+func (s *Server) Balance(shortcode string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.balance(shortcode)
+}
+
+// Close drops callbacks that are still waiting and waits for those being sent
+func (s *Server) Close() {
+	s.cancel()
+	s.pending.Wait()
+}
+
+// generateToken issues an access token for valid consumer credentials
+func (s *Server) generateToken(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("grant_type") != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "400.008.02", "Invalid grant type passed")
+		return
+	}
+	key, secret, ok := r.BasicAuth()
+	if !ok || (s.config.ConsumerKey != "" && (key != s.config.ConsumerKey || secret != s.config.ConsumerSecret)) {
+		writeError(w, http.StatusBadRequest, "400.008.01", "Invalid Authentication passed")
+		return
+	}
+
+	token := randomHex(14)
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(s.config.TokenTTL)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": token,
+		"expires_in":   strconv.Itoa(int(s.config.TokenTTL.Seconds()) - 1),
+	})
+}
+
+// authorized rejects calls without a live access token
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		expires, ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok || time.Now().After(expires) {
+			writeError(w, http.StatusUnauthorized, "404.001.03", "Invalid Access Token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// stkPush accepts an STK prompt and settles it after the callback latency
+func (s *Server) stkPush(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BusinessShortCode string `json:"BusinessShortCode"`
+		Password          string `json:"Password"`
+		Timestamp         string `json:"Timestamp"`
+		Amount            amount `json:"Amount"`
+		PhoneNumber       string `json:"PhoneNumber"`
+		CallBackURL       string `json:"CallBackURL"`
+		AccountReference  string `json:"AccountReference"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if missing := firstMissing(map[string]string{
+		"BusinessShortCode": req.BusinessShortCode, "Password": req.Password, "Timestamp": req.Timestamp,
+		"PhoneNumber": req.PhoneNumber, "CallBackURL": req.CallBackURL,
+	}); missing != "" || req.Amount <= 0 {
+		if missing == "" {
+			missing = "Amount"
+		}
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid "+missing)
+		return
+	}
+
+	s.mu.Lock()
+	s.seq++
+	stk := &stkRequest{
+		merchantRequestID: fmt.Sprintf("%d-%d-1", 29115+s.seq, time.Now().UnixNano()%100000000),
+		checkoutRequestID: fmt.Sprintf("ws_CO_%s%04d", time.Now().Format("02012006150405"), s.seq),
+		shortcode:         req.BusinessShortCode,
+		phone:             req.PhoneNumber,
+		amount:            int64(req.Amount),
+		reference:         req.AccountReference,
+		callbackURL:       req.CallBackURL,
+	}
+	s.stk[stk.checkoutRequestID] = stk
+	s.mu.Unlock()
+
+	s.later(func() { s.settleSTK(stk) })
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"MerchantRequestID":   stk.merchantRequestID,
+		"CheckoutRequestID":   stk.checkoutRequestID,
+		"ResponseCode":        "0",
+		"ResponseDescription": "Success. Request accepted for processing",
+		"CustomerMessage":     "Success. Request accepted for processing",
+	})
+}
+
+// settleSTK decides an STK prompt's outcome and calls back its result
+func (s *Server) settleSTK(stk *stkRequest) {
+	s.mu.Lock()
+	switch s.outcome(stk.phone) {
+	case OutcomeCancel:
+		stk.resultCode, stk.resultDesc = 1032, "Request cancelled by user"
+	case OutcomeTimeout:
+		stk.resultCode, stk.resultDesc = 1037, "DS timeout user cannot be reached"
+	case OutcomeInsufficientFunds:
+		stk.resultCode, stk.resultDesc = 1, "The balance is insufficient for the transaction"
+	default:
+		stk.resultCode, stk.resultDesc = 0, "The service request is processed successfully."
+		txn := s.record(randomReceipt(), stk.shortcode, stk.phone, stk.amount, true)
+		stk.receipt = txn.receipt
+	}
+	stk.settled = true
+	s.mu.Unlock()
+
+	callback := map[string]interface{}{
+		"MerchantRequestID": stk.merchantRequestID,
+		"CheckoutRequestID": stk.checkoutRequestID,
+		"ResultCode":        stk.resultCode,
+		"ResultDesc":        stk.resultDesc,
+	}
+	if stk.resultCode == 0 {
+		phone, _ := strconv.ParseInt(stk.phone, 10, 64)
+		date, _ := strconv.ParseInt(time.Now().Format("20060102150405"), 10, 64)
+		callback["CallbackMetadata"] = map[string]interface{}{
+			"Item": []map[string]interface{}{
+				{"Name": "Amount", "Value": stk.amount},
+				{"Name": "MpesaReceiptNumber", "Value": stk.receipt},
+				{"Name": "TransactionDate", "Value": date},
+				{"Name": "PhoneNumber", "Value": phone},
+			},
+		}
+	}
+	s.send(stk.callbackURL, map[string]interface{}{"Body": map[string]interface{}{"stkCallback": callback}})
+}
+
+// stkQuery reports an STK prompt's result, or that the customer has not answered yet
+func (s *Server) stkQuery(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BusinessShortCode string `json:"BusinessShortCode"`
+		CheckoutRequestID string `json:"CheckoutRequestID"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	stk, ok := s.stk[req.CheckoutRequestID]
+	var settled bool
+	var resultCode int
+	var resultDesc, merchantRequestID string
+	if ok {
+		settled, resultCode, resultDesc, merchantRequestID = stk.settled, stk.resultCode, stk.resultDesc, stk.merchantRequestID
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid CheckoutRequestID")
+	case !settled:
+		writeError(w, http.StatusInternalServerError, "500.001.1001", "The transaction is being processed")
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{
+			"ResponseCode":        "0",
+			"ResponseDescription": "The service request has been accepted successsfully",
+			"MerchantRequestID":   merchantRequestID,
+			"CheckoutRequestID":   req.CheckoutRequestID,
+			"ResultCode":          strconv.Itoa(resultCode),
+			"ResultDesc":          resultDesc,
+		})
+	}
+}
+
+// registerURL records where a shortcode's C2B payments are validated and confirmed
+func (s *Server) registerURL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ShortCode       string `json:"ShortCode"`
+		ResponseType    string `json:"ResponseType"`
+		ConfirmationURL string `json:"ConfirmationURL"`
+		ValidationURL   string `json:"ValidationURL"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if missing := firstMissing(map[string]string{"ShortCode": req.ShortCode, "ConfirmationURL": req.ConfirmationURL}); missing != "" {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid "+missing)
+		return
+	}
+
+	s.mu.Lock()
+	s.c2b[req.ShortCode] = c2bURLs{confirmation: req.ConfirmationURL, validation: req.ValidationURL}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"OriginatorCoversationID": randomHex(8),
+		"ResponseCode":            "0",
+		"ResponseDescription":     "Success",
+	})
+}
+
+// simulateC2B makes a customer pay a shortcode directly, as if from their phone
+func (s *Server) simulateC2B(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ShortCode     string `json:"ShortCode"`
+		CommandID     string `json:"CommandID"`
+		Amount        amount `json:"Amount"`
+		Msisdn        string `json:"Msisdn"`
+		BillRefNumber string `json:"BillRefNumber"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if missing := firstMissing(map[string]string{"ShortCode": req.ShortCode, "Msisdn": req.Msisdn}); missing != "" || req.Amount <= 0 {
+		if missing == "" {
+			missing = "Amount"
+		}
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid "+missing)
+		return
+	}
+
+	s.mu.Lock()
+	urls, ok := s.c2b[req.ShortCode]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid ShortCode: no URLs registered")
+		return
+	}
+
+	s.later(func() {
+		s.settleC2B(urls, req.ShortCode, req.CommandID, req.Msisdn, req.BillRefNumber, int64(req.Amount))
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"OriginatorCoversationID": randomHex(8),
+		"ResponseCode":            "0",
+		"ResponseDescription":     "Accept the service request successfully.",
+	})
+}
+
+// settleC2B validates and confirms a C2B payment. Payments the customer cannot complete
+// never reach the shortcode, so nothing is called back for them.
+func (s *Server) settleC2B(urls c2bURLs, shortcode, commandID, phone, billRef string, amount int64) {
+	s.mu.Lock()
+	outcome := s.outcome(phone)
+	s.mu.Unlock()
+	if outcome != OutcomeSuccess {
+		s.logf("C2B payment from %s not made: %s", phone, outcome)
+		return
+	}
+
+	transactionType := "Pay Bill"
+	if commandID == "CustomerBuyGoodsOnline" {
+		transactionType = "Buy Goods"
+	}
+	payment := map[string]interface{}{
+		"TransactionType":   transactionType,
+		"TransID":           randomReceipt(),
+		"TransTime":         time.Now().Format("20060102150405"),
+		"TransAmount":       fmt.Sprintf("%d.00", amount),
+		"BusinessShortCode": shortcode,
+		"BillRefNumber":     billRef,
+		"InvoiceNumber":     "",
+		"OrgAccountBalance": "",
+		"ThirdPartyTransID": "",
+		"MSISDN":            phone,
+		"FirstName":         "John",
+		"MiddleName":        "",
+		"LastName":          "Doe",
+	}
+
+	if urls.validation != "" {
+		var answer struct {
+			ResultCode json.RawMessage `json:"ResultCode"`
+		}
+		if err := s.post(urls.validation, payment, &answer); err != nil {
+			s.logf("C2B validation failed, completing anyway: %v", err)
+		} else if code := strings.Trim(string(answer.ResultCode), `"`); code != "" && code != "0" {
+			s.logf("C2B payment from %s rejected by validation: %s", phone, code)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.record(payment["TransID"].(string), shortcode, phone, amount, true)
+	payment["OrgAccountBalance"] = fmt.Sprintf("%d.00", s.balance(shortcode))
+	s.mu.Unlock()
+
+	s.send(urls.confirmation, payment)
+}
+
+// b2c accepts a payment to a customer and settles it after the callback latency
+func (s *Server) b2c(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OriginatorConversationID string `json:"OriginatorConversationID"`
+		InitiatorName            string `json:"InitiatorName"`
+		SecurityCredential       string `json:"SecurityCredential"`
+		CommandID                string `json:"CommandID"`
+		Amount                   amount `json:"Amount"`
+		PartyA                   string `json:"PartyA"`
+		PartyB                   string `json:"PartyB"`
+		QueueTimeOutURL          string `json:"QueueTimeOutURL"`
+		ResultURL                string `json:"ResultURL"`
+	}
+	s.acceptResult(w, r, &req, func() (string, map[string]string) {
+		return req.OriginatorConversationID, map[string]string{
+			"InitiatorName": req.InitiatorName, "SecurityCredential": req.SecurityCredential,
+			"PartyA": req.PartyA, "PartyB": req.PartyB, "ResultURL": req.ResultURL, "QueueTimeOutURL": req.QueueTimeOutURL,
+		}
+	}, func(ids resultIDs) {
+		s.settleB2C(ids, req.PartyA, req.PartyB, int64(req.Amount), req.ResultURL, req.QueueTimeOutURL)
+	})
+}
+
+// settleB2C pays a customer from the shortcode's utility account, which must cover the
+// amount whatever the script says
+func (s *Server) settleB2C(ids resultIDs, shortcode, phone string, amount int64, resultURL, timeoutURL string) {
+	s.mu.Lock()
+	outcome := s.outcome(phone)
+	if outcome != OutcomeTimeout && s.balance(shortcode) < amount {
+		outcome = OutcomeInsufficientFunds
+	}
+	var txn *transaction
+	if outcome == OutcomeSuccess || outcome == OutcomeCancel { // customers cannot decline a B2C payment
+		txn = s.record(randomReceipt(), shortcode, phone, amount, false)
+	}
+	balance := s.balance(shortcode)
+	s.mu.Unlock()
+
+	switch {
+	case outcome == OutcomeTimeout:
+		s.send(timeoutURL, result(ids, 1, 1019, "Transaction has expired", "", nil))
+	case txn == nil:
+		s.send(resultURL, result(ids, 0, 1, "The balance is insufficient for the transaction.", "", nil))
+	default:
+		s.send(resultURL, result(ids, 0, 0, "The service request is processed successfully.", txn.receipt, []parameter{
+			{"TransactionAmount", amount},
+			{"TransactionReceipt", txn.receipt},
+			{"B2CRecipientIsRegisteredCustomer", "Y"},
+			{"B2CChargesPaidAccountAvailableFunds", 0},
+			{"ReceiverPartyPublicName", phone + " - John Doe"},
+			{"TransactionCompletedDateTime", txn.at.Format("02.01.2006 15:04:05")},
+			{"B2CUtilityAccountAvailableFunds", balance},
+			{"B2CWorkingAccountAvailableFunds", 0},
+		}))
+	}
+}
+
+// accountBalance reports the shortcode's balances after the callback latency
+func (s *Server) accountBalance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OriginatorConversationID string `json:"OriginatorConversationID"`
+		Initiator                string `json:"Initiator"`
+		SecurityCredential       string `json:"SecurityCredential"`
+		PartyA                   string `json:"PartyA"`
+		QueueTimeOutURL          string `json:"QueueTimeOutURL"`
+		ResultURL                string `json:"ResultURL"`
+	}
+	s.acceptResult(w, r, &req, func() (string, map[string]string) {
+		return req.OriginatorConversationID, map[string]string{
+			"Initiator": req.Initiator, "SecurityCredential": req.SecurityCredential,
+			"PartyA": req.PartyA, "ResultURL": req.ResultURL,
+		}
+	}, func(ids resultIDs) {
+		s.mu.Lock()
+		balance := s.balance(req.PartyA)
+		s.mu.Unlock()
+
+		report := fmt.Sprintf("Working Account|KES|0.00|0.00|0.00|0.00&Utility Account|KES|%d.00|%d.00|0.00|0.00&Charges Paid Account|KES|0.00|0.00|0.00|0.00", balance, balance)
+		completed, _ := strconv.ParseInt(time.Now().Format("20060102150405"), 10, 64)
+		s.send(req.ResultURL, result(ids, 0, 0, "The service request is processed successfully.", randomReceipt(), []parameter{
+			{"AccountBalance", report},
+			{"BOCompletedTime", completed},
+		}))
+	})
+}
+
+// transactionStatus looks up a transaction by receipt after the callback latency
+func (s *Server) transactionStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OriginatorConversationID string `json:"OriginatorConversationID"`
+		Initiator                string `json:"Initiator"`
+		SecurityCredential       string `json:"SecurityCredential"`
+		TransactionID            string `json:"TransactionID"`
+		PartyA                   string `json:"PartyA"`
+		QueueTimeOutURL          string `json:"QueueTimeOutURL"`
+		ResultURL                string `json:"ResultURL"`
+	}
+	s.acceptResult(w, r, &req, func() (string, map[string]string) {
+		return req.OriginatorConversationID, map[string]string{
+			"Initiator": req.Initiator, "SecurityCredential": req.SecurityCredential,
+			"TransactionID": req.TransactionID, "PartyA": req.PartyA, "ResultURL": req.ResultURL,
+		}
+	}, func(ids resultIDs) {
+		s.mu.Lock()
+		txn, ok := s.transactions[req.TransactionID]
+		var found transaction
+		if ok {
+			found = *txn
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			s.send(req.ResultURL, result(ids, 0, 2032, "The transaction receipt number does not exist.", "", nil))
+			return
+		}
+		debit, credit := found.shortcode+" - PayMatch", found.phone+" - John Doe"
+		if found.incoming {
+			debit, credit = credit, debit
+		}
+		at := found.at.Format("20060102150405")
+		s.send(req.ResultURL, result(ids, 0, 0, "The service request is processed successfully.", randomReceipt(), []parameter{
+			{"DebitPartyName", debit},
+			{"CreditPartyName", credit},
+			{"OriginatorConversationID", ids.originatorConversationID},
+			{"InitiatedTime", at},
+			{"DebitAccountType", "Utility Account"},
+			{"DebitPartyCharges", ""},
+			{"TransactionReason", ""},
+			{"ReasonType", "Salary Payment via API"},
+			{"TransactionStatus", "Completed"},
+			{"FinalisedTime", at},
+			{"Amount", found.amount},
+			{"ConversationID", ids.conversationID},
+			{"ReceiptNo", found.receipt},
+		}))
+	})
+}
+
+// resultIDs identify an asynchronous request in its result
+type resultIDs struct {
+	conversationID           string
+	originatorConversationID string
+}
+
+// acceptResult decodes and checks a request whose result is called back later, answers
+// it and schedules settle. fields returns the caller's conversation ID and the fields
+// that must not be empty.
+func (s *Server) acceptResult(w http.ResponseWriter, r *http.Request, req interface{}, fields func() (string, map[string]string), settle func(resultIDs)) bool {
+	if !decode(w, r, req) {
+		return false
+	}
+	originatorConversationID, required := fields()
+	if missing := firstMissing(required); missing != "" {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid "+missing)
+		return false
+	}
+
+	if originatorConversationID == "" {
+		originatorConversationID = randomHex(8) + "-" + randomHex(4)
+	}
+	ids := resultIDs{
+		conversationID:           "AG_" + time.Now().Format("20060102") + "_" + randomHex(10),
+		originatorConversationID: originatorConversationID,
+	}
+	s.later(func() { settle(ids) })
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ConversationID":           ids.conversationID,
+		"OriginatorConversationID": ids.originatorConversationID,
+		"ResponseCode":             "0",
+		"ResponseDescription":      "Accept the service request successfully.",
+	})
+	return true
+}
+
+// parameter is one key and value of a result
+type parameter struct {
+	Key   string
+	Value interface{}
+}
+
+// result builds the envelope Daraja posts results of asynchronous requests in
+func result(ids resultIDs, resultType, resultCode int, desc, transactionID string, params []parameter) map[string]interface{} {
+	body := map[string]interface{}{
+		"ResultType":               resultType,
+		"ResultCode":               resultCode,
+		"ResultDesc":               desc,
+		"OriginatorConversationID": ids.originatorConversationID,
+		"ConversationID":           ids.conversationID,
+		"TransactionID":            transactionID,
+	}
+	if len(params) > 0 {
+		items := make([]map[string]interface{}, 0, len(params))
+		for _, p := range params {
+			items = append(items, map[string]interface{}{"Key": p.Key, "Value": p.Value})
+		}
+		body["ResultParameters"] = map[string]interface{}{"ResultParameter": items}
+	}
+	return map[string]interface{}{"Result": body}
+}
+
+// outcome returns the scripted outcome for a phone number; callers hold s.mu
+func (s *Server) outcome(phone string) Outcome {
+	if o, ok := s.scripts[phone]; ok {
+		return o
+	}
+	return s.config.Outcome
+}
+
+// balance returns a shortcode's utility account balance; callers hold s.mu
+func (s *Server) balance(shortcode string) int64 {
+	if b, ok := s.balances[shortcode]; ok {
+		return b
+	}
+	return s.config.OpeningBalance
+}
+
+// record books a completed transaction against a shortcode; callers hold s.mu
+func (s *Server) record(receipt, shortcode, phone string, amount int64, incoming bool) *transaction {
+	if incoming {
+		s.balances[shortcode] = s.balance(shortcode) + amount
+	} else {
+		s.balances[shortcode] = s.balance(shortcode) - amount
+	}
+	txn := &transaction{
+		receipt:   receipt,
+		shortcode: shortcode,
+		phone:     phone,
+		amount:    amount,
+		incoming:  incoming,
+		at:        time.Now(),
+	}
+	s.transactions[txn.receipt] = txn
+	return txn
+}
+
+// later runs fn after the callback latency unless the simulator is closed first
+func (s *Server) later(fn func()) {
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		select {
+		case <-time.After(s.config.CallbackLatency):
+			fn()
+		case <-s.ctx.Done():
+		}
+	}()
+}
+
+// send calls back a result; Daraja does not retry failed callbacks, and neither does the simulator
+func (s *Server) send(target string, body interface{}) {
+	if err := s.post(target, body, nil); err != nil {
+		s.logf("callback to %s failed: %v", target, err)
+	}
+}
+
+// post sends a callback and decodes the answer into out when it is set
+func (s *Server) post(target string, body, out interface{}) error {
+	target, err := s.callbackURL(target)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.WebhookToken != "" {
+		req.Header.Set("X-Webhook-Token", s.config.WebhookToken)
+	}
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	s.logf("callback %s answered %d", target, resp.StatusCode)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback answered status %d", resp.StatusCode)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// callbackURL applies the configured callback base URL to a URL named in a request
+func (s *Server) callbackURL(target string) (string, error) {
+	if target == "" {
+		return "", fmt.Errorf("no callback URL")
+	}
+	if s.config.CallbackURL == "" {
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback URL %q: %w", target, err)
+	}
+	return s.config.CallbackURL + u.RequestURI(), nil
+}
+
+// logf writes a log line if logging is configured
+func (s *Server) logf(format string, args ...any) {
+	if s.config.Logf != nil {
+		s.config.Logf(format, args...)
+	}
+}
+
+// amount accepts Daraja amounts sent as numbers or numeric strings
+type amount int64
+
+func (a *amount) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	*a = amount(f)
+	return nil
+}
+
+// decode reads a JSON request body, answering Daraja's error if it is malformed
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "400.002.05", "Invalid Request Payload")
+		return false
+	}
+	return true
+}
+
+// firstMissing returns the name of an empty required field, in name order so errors are stable
+func firstMissing(fields map[string]string) string {
+	missing := ""
+	for name, value := range fields {
+		if strings.TrimSpace(value) == "" && (missing == "" || name < missing) {
+			missing = name
+		}
+	}
+	return missing
+}
+
+// writeError answers with a Daraja error body
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{
+		"requestId":    randomHex(4) + "-" + randomHex(4),
+		"errorCode":    code,
+		"errorMessage": message,
+	})
+}
+
+// writeJSON answers with a JSON body
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// randomReceipt returns an M-Pesa style receipt number such as QGR7I1F3XM
+func randomReceipt() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, 10)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,163 @@
+// Package webhooksig signs and verifies PayMatch outbound webhook notifications.
+//
+// Every notification carries two headers:
+//
+//	PayMatch-Timestamp: 1700000000
+//	PayMatch-Signature: v1=5257a869...,v1=9ae1c0f2...
+//
+// Each v1 value is the hex HMAC-SHA256 of "<timestamp>.<raw body>" keyed with
+// one of the tenant's signing secrets. While a secret is being rotated,
+// PayMatch signs with both the new and the previous secret, so receivers can
+// switch secrets at their own pace. A receiver only needs one match.
+//
+// Typical use in a receiving service:
+//
+//	verifier := webhooksig.NewVerifier(os.Getenv("PAYMATCH_WEBHOOK_SECRET"))
+//	body, _ := io.ReadAll(r.Body)
+//	if err := verifier.Verify(r.Header, body); err != nil {
+//		http.Error(w, "invalid signature", http.StatusUnauthorized)
+//		return
+//	}
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderTimestamp carries the unix time the notification was signed at
+	HeaderTimestamp = "PayMatch-Timestamp"
+	// HeaderSignature carries one or more comma separated v1=<hex> signatures
+	HeaderSignature = "PayMatch-Signature"
+
+	// DefaultTolerance is how far a timestamp may drift before it is rejected
+	DefaultTolerance = 5 * time.Minute
+
+	signatureScheme = "v1"
+)
+
+var (
+	ErrMissingHeaders      = errors.New("webhooksig: missing timestamp or signature header")
+	ErrInvalidTimestamp    = errors.New("webhooksig: invalid timestamp header")
+	ErrTimestampOutOfRange = errors.New("webhooksig: timestamp outside tolerance")
+	ErrNoSecrets           = errors.New("webhooksig: no secrets configured")
+	ErrSignatureMismatch   = errors.New("webhooksig: no signature matches")
+)
+
+// Sign returns the hex encoded v1 signature of payload at the given timestamp
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader builds the PayMatch-Signature value, one v1 entry per secret
+func SignatureHeader(timestamp int64, payload []byte, secrets ...string) string {
+	parts := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		parts = append(parts, signatureScheme+"="+Sign(secret, timestamp, payload))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verifier checks notification signatures against one or more secrets
+type Verifier struct {
+	secrets   []string
+	Tolerance time.Duration    // zero uses DefaultTolerance; negative disables the check
+	Now       func() time.Time // overridable for tests
+}
+
+// NewVerifier creates a verifier; pass both the old and new secret while rotating
+func NewVerifier(secrets ...string) *Verifier {
+	v := &Verifier{Tolerance: DefaultTolerance, Now: time.Now}
+	for _, s := range secrets {
+		if s != "" {
+			v.secrets = append(v.secrets, s)
+		}
+	}
+	return v
+}
+
+// Verify checks the headers of a notification against its raw body
+func (v *Verifier) Verify(header http.Header, payload []byte) error {
+	return v.VerifyValues(header.Get(HeaderTimestamp), header.Get(HeaderSignature), payload)
+}
+
+// VerifyValues checks raw timestamp and signature header values against the body
+func (v *Verifier) VerifyValues(timestampHeader, signatureHeader string, payload []byte) error {
+	if len(v.secrets) == 0 {
+		return ErrNoSecrets
+	}
+	if timestampHeader == "" || signatureHeader == "" {
+		return ErrMissingHeaders
+	}
+
+	timestamp, err := strconv.ParseInt(strings.TrimSpace(timestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	if err := v.checkTolerance(timestamp); err != nil {
+		return err
+	}
+
+	for _, secret := range v.secrets {
+		expected := []byte(Sign(secret, timestamp, payload))
+		for _, candidate := range parseSignatures(signatureHeader) {
+			if hmac.Equal(expected, []byte(candidate)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrSignatureMismatch
+}
+
+// checkTolerance rejects timestamps too far from the current time to block replays
+func (v *Verifier) checkTolerance(timestamp int64) error {
+	tolerance := v.Tolerance
+	if tolerance < 0 {
+		return nil
+	}
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+
+	drift := now().Sub(time.Unix(timestamp, 0))
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > tolerance {
+		return ErrTimestampOutOfRange
+	}
+	return nil
+}
+
+// parseSignatures extracts the v1 signatures from a header value
+func parseSignatures(header string) []string {
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		scheme, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && scheme == signatureScheme && value != "" {
+			signatures = append(signatures, value)
+		}
+	}
+	return signatures
+}
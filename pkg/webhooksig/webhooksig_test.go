@@ -0,0 +1,52 @@
+package webhooksig
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.completed"}`)
+	now := time.Unix(1700000000, 0)
+	ts := now.Unix()
+
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	header.Set(HeaderSignature, SignatureHeader(ts, payload, "whsec_new", "whsec_old"))
+
+	tests := []struct {
+		name    string
+		secrets []string
+		at      time.Time
+		body    []byte
+		want    error
+	}{
+		{"current secret", []string{"whsec_new"}, now, payload, nil},
+		{"previous secret during rotation", []string{"whsec_old"}, now, payload, nil},
+		{"unknown secret", []string{"whsec_other"}, now, payload, ErrSignatureMismatch},
+		{"tampered body", []string{"whsec_new"}, now, []byte(`{}`), ErrSignatureMismatch},
+		{"stale timestamp", []string{"whsec_new"}, now.Add(10 * time.Minute), payload, ErrTimestampOutOfRange},
+		{"no secrets", nil, now, payload, ErrNoSecrets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(tt.secrets...)
+			v.Now = func() time.Time { return tt.at }
+
+			if err := v.Verify(header, tt.body); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyMissingHeaders(t *testing.T) {
+	v := NewVerifier("whsec_new")
+	if err := v.Verify(http.Header{}, []byte("{}")); !errors.Is(err, ErrMissingHeaders) {
+		t.Fatalf("Verify() = %v, want %v", err, ErrMissingHeaders)
+	}
+}